@@ -14,19 +14,23 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
 
+	"github.com/aiservice/internal/auth"
 	"github.com/aiservice/internal/cache"
 	"github.com/aiservice/internal/config"
 	"github.com/aiservice/internal/handlers"
 	"github.com/aiservice/internal/log"
 	"github.com/aiservice/internal/providers"
+	"github.com/aiservice/internal/providers/anthropic"
 	"github.com/aiservice/internal/providers/gemini"
 	"github.com/aiservice/internal/providers/mock"
-	openaimock "github.com/aiservice/internal/providers/openai"
-	yandexmock "github.com/aiservice/internal/providers/yandex"
+	"github.com/aiservice/internal/providers/openai"
+	"github.com/aiservice/internal/providers/yandex"
 	"github.com/aiservice/internal/s3"
 	"github.com/aiservice/internal/services/analysis"
 	"github.com/aiservice/internal/services/database"
 	jobservice "github.com/aiservice/internal/services/jobService"
+	"github.com/aiservice/internal/services/quota"
+	"github.com/aiservice/internal/tracing"
 
 	_ "github.com/aiservice/docs" // docs is generated by Swag CLI, you have to import it.
 )
@@ -34,6 +38,7 @@ import (
 // @title AIService API
 // @version 1.0
 // @description AI Service for processing board data with summarization and structurization capabilities
+// @description Every error response is a models.ErrorResponse whose error.code is a stable, machine-readable identifier of the failure.
 // @termsOfService http://swagger.io/terms/
 
 // @contact.name API Support
@@ -46,14 +51,47 @@ import (
 // @host localhost:8080
 // @BasePath /
 // @schemes http https
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description API key or JWT as "Bearer <token>"
+
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
 	cfg := config.LoadFromEnv()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg.Database, os.Args[2:], os.Stdout))
+	}
+
 	_ = log.SetupJsonLogger()
 
+	authenticator, err := auth.NewAuthenticator(cfg.Auth)
+	if err != nil {
+		slog.Error("failed to load credentials:", "err", err)
+		os.Exit(1)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		slog.Error("failed to set up tracing:", "err", err)
+		os.Exit(1)
+	}
+	// Flush the spans of the last requests once the server stopped
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush traces:", "err", err)
+		}
+	}()
+
 	llmClient := initLLMProviders(ctx, cfg)
 
 	// Initialize cache
@@ -101,19 +139,29 @@ func main() {
 	// Create the analysis service without the job queue initially
 	analysisService := analysis.NewAnalysisServiceWithoutJobQueue(cfg.Timeouts.SyncProcess, wrappedLLMClient)
 
+	if cfg.Callback.Secret == "" {
+		slog.Warn("CALLBACK_SECRET is not set, webhooks are sent without the X-Signature-256 header")
+	}
+
 	// Create the job queue service with the analysis service as the processor
 	jobQueueService := jobservice.NewJobQueueService(
-		cfg.Job.QueueSize,
-		cfg.Job.WorkerCount,
-		cfg.Job.DbWorkerCount,
+		cfg.Job,
 		wrappedStorage,
 		analysisService, // analysisService implements the Processor interface
+		jobservice.NewCallbackSender(cfg.Callback, wrappedStorage),
 	)
 
 	// Now set the job queue service in the analysis service
 	analysisService.SetJobQueueService(jobQueueService)
 
+	// Quotas are counted in the job database so every replica enforces the same limits
+	quotaService := quota.NewService(cfg.Quota, wrappedStorage)
+	go quotaService.Run(ctx)
+	analysisService.SetQuotaService(quotaService)
+	analysisService.SetRouting(cfg.Routing)
+
 	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler
 	// Configure CORS based on environment
 	var corsConfig middleware.CORSConfig
 	if cfg.Server.Env == "prod" {
@@ -121,20 +169,24 @@ func main() {
 		corsConfig = middleware.CORSConfig{
 			AllowOrigins:     []string{"http://localhost:3001", "http://backend:3001", "https://foggy-backend.example.com"}, // Adjust domain for actual production
 			AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-			AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+			AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, handlers.IdempotencyKeyHeader, handlers.LastEventIDHeader, handlers.APIKeyHeader, handlers.PreferHeader, handlers.RegionHeader},
+			ExposeHeaders:    []string{handlers.PreferenceAppliedHeader, "Retry-After", echo.HeaderLocation},
 			AllowCredentials: true,
 		}
 	} else {
 		// In development, allow all origins
 		corsConfig = middleware.CORSConfig{
-			AllowOrigins: []string{"*"},
-			AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-			AllowHeaders: []string{echo.HeaderContentType, echo.HeaderAuthorization, echo.HeaderOrigin, echo.HeaderAccept},
+			AllowOrigins:  []string{"*"},
+			AllowMethods:  []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+			AllowHeaders:  []string{echo.HeaderContentType, echo.HeaderAuthorization, echo.HeaderOrigin, echo.HeaderAccept, handlers.IdempotencyKeyHeader, handlers.LastEventIDHeader, handlers.APIKeyHeader, handlers.PreferHeader, handlers.RegionHeader},
+			ExposeHeaders: []string{handlers.PreferenceAppliedHeader, "Retry-After", echo.HeaderLocation},
 		}
 	}
 
 	e.Use(
 		middleware.Logger(),
+		handlers.Metrics,
+		handlers.Tracing,
 		middleware.Recover(),
 		middleware.RequestID(),
 		middleware.CORSWithConfig(corsConfig),
@@ -149,12 +201,37 @@ func main() {
 		cfg.Timeouts.SyncProcess,
 		s3Client, // Pass S3 client to the handler
 	)
+	AnalyzeHandler.SetWebSocketConfig(cfg.WebSocket, corsConfig.AllowOrigins)
+	AnalyzeHandler.SetMaxBatchItems(cfg.Job.MaxBatchItems)
+
+	// Every route but the health check, the metrics and the docs identifies its caller
+	authenticated := handlers.Authenticate(authenticator)
 
 	e.GET("/health", handlers.HealthHandler)
-	e.GET("/jobs/:id", AnalyzeHandler.GetJobStatus)
-	e.PUT("/jobs/:id/abort", AnalyzeHandler.Abort)
-	e.POST("/summarize", AnalyzeHandler.Summarize)
-	e.POST("/structurize", AnalyzeHandler.Structurize)
+	e.GET("/metrics", handlers.MetricsHandler)
+	e.GET("/jobs", AnalyzeHandler.ListJobs, authenticated)
+	e.GET("/jobs/:id", AnalyzeHandler.GetJobStatus, authenticated)
+	e.GET("/jobs/:id/events", AnalyzeHandler.StreamJobEvents, authenticated)
+	e.PUT("/jobs/:id/abort", AnalyzeHandler.Abort, authenticated)
+	e.GET("/jobs/:id/callbacks", AnalyzeHandler.GetCallbackDeliveries, authenticated)
+	e.POST("/jobs/:id/callbacks/replay", AnalyzeHandler.ReplayCallback, authenticated)
+	e.POST("/summarize", AnalyzeHandler.Summarize, authenticated)
+	e.POST("/structurize", AnalyzeHandler.Structurize, authenticated)
+	e.POST("/batches", AnalyzeHandler.CreateBatch, authenticated)
+	e.GET("/batches/:id", AnalyzeHandler.GetBatch, authenticated)
+	e.PUT("/batches/:id/abort", AnalyzeHandler.AbortBatch, authenticated)
+	e.GET("/boards/:boardId/session", AnalyzeHandler.BoardSession, authenticated)
+
+	if authenticator.Enabled() {
+		QuotaHandler := handlers.NewQuotaHandler(quotaService)
+		admin := e.Group("/admin", authenticated, handlers.RequireAdmin)
+		admin.GET("/quotas", QuotaHandler.ListQuotas)
+		admin.GET("/quotas/:scope/:subjectId", QuotaHandler.GetQuota)
+		admin.PUT("/quotas/:scope/:subjectId", QuotaHandler.SetQuota)
+		admin.DELETE("/quotas/:scope/:subjectId", QuotaHandler.ResetQuota)
+	} else {
+		slog.Warn("no credentials are configured, the API is open and the admin API is disabled")
+	}
 
 	startServer(ctx, cancel, cfg, jobQueueService, e)
 }
@@ -188,7 +265,70 @@ func startServer(ctx context.Context, cancelAiServices context.CancelFunc, cfg *
 }
 
 func initLLMProviders(ctx context.Context, cfg *config.Config) providers.LLMClient {
+	// Any OpenAI-compatible endpoint replaces the mock once a key or base URL is configured
+	openaiEnabled := cfg.OpenAI.APIKey != "" || cfg.OpenAI.BaseURL != ""
+	openaiConfig := providers.ProviderConfig{
+		Name:     "openai",
+		APIKey:   cfg.OpenAI.APIKey,
+		BaseURL:  cfg.OpenAI.BaseURL,
+		Model:    cfg.OpenAI.Model,
+		Timeout:  cfg.OpenAI.Timeout,
+		Regions:  []string{"RU", "US", "EU"}, // Available globally
+		Priority: 2,
+		Enabled:  true,
+	}
+	if !openaiEnabled {
+		openaiConfig = providers.ProviderConfig{
+			Name:     "openai-mock",
+			APIKey:   "mock-key",
+			BaseURL:  "https://mock.openai.api",
+			Model:    "gpt-4-mock",
+			Timeout:  30 * time.Second,
+			Regions:  []string{"RU", "US", "EU"}, // Available globally
+			Priority: 2,
+			Enabled:  true,
+		}
+	}
+
 	// Create provider manager with multi-provider configuration
+	// YandexGPT needs credentials and the folder billed for the requests
+	yandexEnabled := (cfg.Yandex.APIKey != "" || cfg.Yandex.IAMToken != "") && cfg.Yandex.FolderID != ""
+	if !yandexEnabled && (cfg.Yandex.APIKey != "" || cfg.Yandex.IAMToken != "") {
+		slog.Warn("YandexGPT credentials provided without YANDEX_FOLDER_ID, using the mock")
+	}
+	yandexConfig := providers.ProviderConfig{
+		Name:     "yandex-gpt",
+		BaseURL:  cfg.Yandex.BaseURL,
+		Model:    cfg.Yandex.Model,
+		Timeout:  cfg.Yandex.Timeout,
+		Regions:  []string{"RU", "CIS"}, // Available in Russia/CIS
+		Priority: 3,
+		Enabled:  true,
+	}
+	if !yandexEnabled {
+		yandexConfig = providers.ProviderConfig{
+			Name:     "yandex-gpt-mock",
+			APIKey:   "mock-key",
+			BaseURL:  "https://mock.yandex.api",
+			Model:    "yandex-gpt-mock",
+			Timeout:  30 * time.Second,
+			Regions:  []string{"RU", "CIS"}, // Available in Russia/CIS
+			Priority: 3,
+			Enabled:  true,
+		}
+	}
+
+	anthropicConfig := providers.ProviderConfig{
+		Name:     "anthropic",
+		APIKey:   cfg.Anthropic.APIKey,
+		BaseURL:  cfg.Anthropic.BaseURL,
+		Model:    cfg.Anthropic.Model,
+		Timeout:  cfg.Anthropic.Timeout,
+		Regions:  []string{"!RU"}, // Not available in Russia
+		Priority: 4,
+		Enabled:  cfg.Anthropic.APIKey != "",
+	}
+
 	providerConfig := &providers.MultiProviderConfig{
 		Providers: []providers.ProviderConfig{
 			{
@@ -201,26 +341,9 @@ func initLLMProviders(ctx context.Context, cfg *config.Config) providers.LLMClie
 				Priority: 1,
 				Enabled:  cfg.LLM.APIKey != "" && cfg.LLM.APIKey != "your_api_key_here",
 			},
-			{
-				Name:     "openai-mock",
-				APIKey:   "mock-key",
-				BaseURL:  "https://mock.openai.api",
-				Model:    "gpt-4-mock",
-				Timeout:  30 * time.Second,
-				Regions:  []string{"RU", "US", "EU"}, // Available globally
-				Priority: 2,
-				Enabled:  true,
-			},
-			{
-				Name:     "yandex-gpt-mock",
-				APIKey:   "mock-key",
-				BaseURL:  "https://mock.yandex.api",
-				Model:    "yandex-gpt-mock",
-				Timeout:  30 * time.Second,
-				Regions:  []string{"RU", "CIS"}, // Available in Russia/CIS
-				Priority: 3,
-				Enabled:  true,
-			},
+			openaiConfig,
+			yandexConfig,
+			anthropicConfig,
 		},
 	}
 
@@ -237,12 +360,21 @@ func initLLMProviders(ctx context.Context, cfg *config.Config) providers.LLMClie
 		providerManager.RegisterProvider("gemini", mockGemini)
 	}
 
-	// Register mock providers
-	openaiClient := openaimock.NewOpenAIClient()
-	providerManager.RegisterProvider("openai-mock", openaiClient)
+	if openaiEnabled {
+		providerManager.RegisterProvider(openaiConfig.Name, openai.NewOpenAIClient(openaiConfig))
+	} else {
+		providerManager.RegisterProvider(openaiConfig.Name, openai.NewMockOpenAIClient())
+	}
+
+	if yandexEnabled {
+		providerManager.RegisterProvider(yandexConfig.Name, yandex.NewYandexGPTClient(yandexConfig.Name, cfg.Yandex))
+	} else {
+		providerManager.RegisterProvider(yandexConfig.Name, yandex.NewMockYandexGPTClient())
+	}
 
-	yandexClient := yandexmock.NewYandexGPTClient()
-	providerManager.RegisterProvider("yandex-gpt-mock", yandexClient)
+	if anthropicConfig.Enabled {
+		providerManager.RegisterProvider(anthropicConfig.Name, anthropic.NewAnthropicClient(anthropicConfig))
+	}
 
 	slog.Info("Initialized provider manager with multiple providers")
 	return providerManager
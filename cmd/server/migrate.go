@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/services/database"
+)
+
+const migrateUsage = `usage: aiservice migrate <command>
+
+commands:
+  up          apply every pending migration
+  down [n]    roll back the last n applied migrations (default 1)
+  status      list migrations and whether they are applied
+
+The database is selected with DB_TYPE and the usual DB_* / SQLITE_FILE_PATH variables.
+`
+
+// runMigrate implements the migrate subcommand and returns the process exit code
+func runMigrate(cfg config.DatabaseConfig, args []string, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(out, migrateUsage)
+		return 2
+	}
+
+	m, err := database.NewMigrator(cfg)
+	if err != nil {
+		fmt.Fprintf(out, "migrate: %v\n", err)
+		return 1
+	}
+	defer m.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "migrate up: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintf(out, "migrate down: invalid step count %q\n", args[1])
+				return 2
+			}
+		}
+		rolledBack, err := m.Down(ctx, steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(out, "rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "migrate down: %v\n", err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Fprintln(out, "no applied migrations to roll back")
+		}
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(out, "migrate status: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = time.Unix(status.AppliedAt, 0).UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintf(out, "migrate: unknown command %q\n\n%s", args[0], migrateUsage)
+		return 2
+	}
+
+	return 0
+}
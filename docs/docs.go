@@ -24,6 +24,489 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/quotas": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "List every user and tenant whose limits were set through the admin API; everyone else gets the configured defaults.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List custom quota limits",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.QuotaLimits"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/quotas/{scope}/{subjectId}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get the limits of a user or tenant, custom or defaults, along with its usage this minute and today (UTC).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get a quota",
+                "parameters": [
+                    {
+                        "enum": [
+                            "user",
+                            "tenant"
+                        ],
+                        "type": "string",
+                        "description": "Quota scope",
+                        "name": "scope",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User or tenant ID",
+                        "name": "subjectId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.QuotaStatus"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Set custom limits for a user or tenant, replacing the configured defaults. A zero limit means unlimited.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Set a quota",
+                "parameters": [
+                    {
+                        "enum": [
+                            "user",
+                            "tenant"
+                        ],
+                        "type": "string",
+                        "description": "Quota scope",
+                        "name": "scope",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User or tenant ID",
+                        "name": "subjectId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New limits, scope and subjectId are taken from the path",
+                        "name": "limits",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.QuotaLimits"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.QuotaLimits"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Delete the custom limits of a user or tenant so the configured defaults apply again. Usage counters are kept.",
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Reset a quota",
+                "parameters": [
+                    {
+                        "enum": [
+                            "user",
+                            "tenant"
+                        ],
+                        "type": "string",
+                        "description": "Quota scope",
+                        "name": "scope",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User or tenant ID",
+                        "name": "subjectId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/batches": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Queue one summarize or structurize job per item, linked to a new batch. Items are validated like POST /summarize and POST /structurize and always run asynchronously.\nThe batch is accepted or rejected as a whole; every item counts against the concurrent jobs quota of its user. Follow the batch with GET /batches/{id}.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Batches"
+                ],
+                "summary": "Submit a batch",
+                "parameters": [
+                    {
+                        "description": "Batch Request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.BatchRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Region of the items that have no region field, e.g. RU",
+                        "name": "X-Region",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.BatchResponse"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the batch"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_request, or validation_failed with the offending field in details",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "A quota is exceeded, see the Retry-After header",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/batches/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get the aggregate progress of a batch and the job of every item in submission order, with their results once completed.\nThe batch is pending until an item starts, running until every item finished, then aborted, failed or completed.\nBatches submitted by another principal are reported as not found, except to admins.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Batches"
+                ],
+                "summary": "Get batch status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Batch ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.BatchResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/batches/{id}/abort": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Abort every pending or running job of a batch, as PUT /jobs/{id}/abort does. Finished items keep their results.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Batches"
+                ],
+                "summary": "Abort a batch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Batch ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.BatchResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/boards/{boardId}/session": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Upgrade to a WebSocket that submits and follows the jobs of one board. Client messages are JSON models.BoardClientMessage:\n\"summarize\" and \"structurize\" queue the request in the matching field (its board ID defaults to the path one) and are answered\nwith \"accepted\" and the job ID, then every progress event of the job is sent as an \"event\" message (see GET /jobs/{id}/events).\n\"cancel\" aborts a job submitted on the same connection. Rejected messages are answered with \"error\", an error code and the client's requestId.\nAt most WS_MAX_JOBS_PER_CONNECTION jobs may be unfinished at once. Jobs still unfinished when the connection closes are aborted.",
+                "tags": [
+                    "Boards"
+                ],
+                "summary": "Board session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Board ID",
+                        "name": "boardId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "API key or JWT, for browsers that cannot set the Authorization header on the handshake",
+                        "name": "access_token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/models.BoardServerMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Not a WebSocket handshake",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Origin not allowed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/health": {
             "get": {
                 "description": "Check if the service is running",
@@ -34,25 +517,243 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Health"
+                    "Health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "List jobs newest first (or oldest first with order=asc), filtered by status, request type, user, board, batch and creation time.\nPass the returned nextCursor as cursor to fetch the next page; it is omitted on the last page.\nAuthenticated callers only see the jobs they submitted, unless they are admins.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "List jobs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Comma separated job statuses (pending, running, completed, failed, aborted)",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Request type (summarize or structurize)",
+                        "name": "requestType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "userId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Board ID",
+                        "name": "boardId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Batch ID",
+                        "name": "batchId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Inclusive lower bound of creation time, unix seconds or RFC3339",
+                        "name": "createdFrom",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Exclusive upper bound of creation time, unix seconds or RFC3339",
+                        "name": "createdTo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Pagination cursor from a previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 50 by default and at most 200",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort order by creation time (asc or desc, default desc)",
+                        "name": "order",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.JobListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get the status of a job by ID. Completed jobs carry their result and failed jobs the failure reason.\nSummarize jobs return models.SummarizeJobResponse, structurize jobs return models.StructurizeJobResponse.\nJobs submitted by another principal are reported as not found, except to admins.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "Get job status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "oneOf by requestType: summarize jobs carry a models.SummarizeResponse result, structurize jobs a models.StructurizeResponse result",
+                        "schema": {
+                            "$ref": "#/definitions/models.JobResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}/abort": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Abort a pending or running job by ID. A running job has its provider call cancelled immediately and sends no callback.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "Abort a job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Health check",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/jobs/{id}": {
+        "/jobs/{id}/callbacks": {
             "get": {
-                "description": "Get the status of a job by ID",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "List every webhook delivery attempt recorded for a job",
                 "consumes": [
                     "application/json"
                 ],
@@ -62,7 +763,7 @@ const docTemplate = `{
                 "tags": [
                     "Jobs"
                 ],
-                "summary": "Get job status",
+                "summary": "Get job callback deliveries",
                 "parameters": [
                     {
                         "type": "string",
@@ -76,24 +777,38 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Job"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.CallbackDelivery"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/jobs/{id}/abort": {
-            "put": {
-                "description": "Abort a job by ID",
+        "/jobs/{id}/callbacks/replay": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Re-deliver the completion or failure webhook of a finished job, with the usual retries",
                 "consumes": [
                     "application/json"
                 ],
@@ -103,7 +818,7 @@ const docTemplate = `{
                 "tags": [
                     "Jobs"
                 ],
-                "summary": "Abort a job",
+                "summary": "Replay job callback",
                 "parameters": [
                     {
                         "type": "string",
@@ -117,17 +832,118 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.CallbackDelivery"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The job has not finished or has no callback URL",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Webhook delivery is disabled",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Delivery failed, details is the models.CallbackDelivery",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}/events": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Stream the progress of a job as Server-Sent Events: status transitions (event \"status\"), retry attempts (\"retry\"),\nthe LLM provider being tried (\"provider\") and finally the result or failure reason (\"result\"), after which the stream ends.\nEach event carries its sequence number as the SSE id; reconnect with the Last-Event-ID header to resume after it.\nEvents without an id are snapshots of the stored job, sent when no live events are known for it, e.g. it runs on another replica.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "Stream job events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resume after this event",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.JobEvent"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "description": "Job queue, LLM provider, circuit breaker, cache and HTTP metrics in the Prometheus text format",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Prometheus metrics",
+                "responses": {
+                    "200": {
+                        "description": "Prometheus text exposition",
+                        "schema": {
+                            "type": "string"
                         }
                     }
                 }
@@ -135,7 +951,15 @@ const docTemplate = `{
         },
         "/structurize": {
             "post": {
-                "description": "Process a board and return a structured file hierarchy",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Process a board and return a structured file hierarchy\nThe request is processed while the client waits, up to TIMEOUT_SYNC_PROCESS, then answered with 202 and the job ID; the job keeps the work already done.\n\"Prefer: respond-async\" (or mode=async) returns 202 right away, \"Prefer: wait=N\" waits at most N seconds. The honored preference is echoed in Preference-Applied.",
                 "consumes": [
                     "application/json"
                 ],
@@ -155,6 +979,24 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/models.StructurizeRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "respond-async or wait=N (seconds)",
+                        "name": "Prefer",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Repeated requests with the same key return the first response or job ID instead of starting a new job",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Region of the request when the body has no region field, e.g. RU; only the providers available there are tried",
+                        "name": "X-Region",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -162,30 +1004,66 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/models.StructurizeResponse"
+                        },
+                        "headers": {
+                            "Preference-Applied": {
+                                "type": "string",
+                                "description": "The honored Prefer preference"
+                            }
                         }
                     },
                     "202": {
                         "description": "Job ID",
                         "schema": {
                             "type": "string"
+                        },
+                        "headers": {
+                            "Preference-Applied": {
+                                "type": "string",
+                                "description": "The honored Prefer preference"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "invalid_request, or validation_failed with the offending field in details",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A request with the same Idempotency-Key is still in progress",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "The Idempotency-Key was used with a different request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "A quota is exceeded, see the Retry-After header",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "providers_unavailable or queue_full, retry later",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     }
                 }
@@ -193,7 +1071,15 @@ const docTemplate = `{
         },
         "/summarize": {
             "post": {
-                "description": "Process a board and return a summary of the content",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Process a board and return a summary of the content\nThe request is processed while the client waits, up to TIMEOUT_SYNC_PROCESS, then answered with 202 and the job ID; the job keeps the work already done.\n\"Prefer: respond-async\" (or mode=async) returns 202 right away, \"Prefer: wait=N\" waits at most N seconds. The honored preference is echoed in Preference-Applied.",
                 "consumes": [
                     "application/json"
                 ],
@@ -213,6 +1099,24 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/models.SummarizeRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "respond-async or wait=N (seconds)",
+                        "name": "Prefer",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Repeated requests with the same key return the first response or job ID instead of starting a new job",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Region of the request when the body has no region field, e.g. RU; only the providers available there are tried",
+                        "name": "X-Region",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -220,30 +1124,66 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/models.SummarizeResponse"
+                        },
+                        "headers": {
+                            "Preference-Applied": {
+                                "type": "string",
+                                "description": "The honored Prefer preference"
+                            }
                         }
                     },
                     "202": {
                         "description": "Job ID",
                         "schema": {
                             "type": "string"
+                        },
+                        "headers": {
+                            "Preference-Applied": {
+                                "type": "string",
+                                "description": "The honored Prefer preference"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "invalid_request, or validation_failed with the offending field in details",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A request with the same Idempotency-Key is still in progress",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "The Idempotency-Key was used with a different request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "A quota is exceeded, see the Retry-After header",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "providers_unavailable or queue_full, retry later",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     }
                 }
@@ -251,18 +1191,83 @@ const docTemplate = `{
         }
     },
     "definitions": {
-        "models.AnalyzeRequest": {
+        "models.AnalyzeResponse": {
             "type": "object",
             "properties": {
-                "requestType": {
-                    "description": "summarize, structurize",
+                "structurizeResponse": {
+                    "$ref": "#/definitions/models.StructurizeResponse"
+                },
+                "summarizeResponse": {
+                    "$ref": "#/definitions/models.SummarizeResponse"
+                }
+            }
+        },
+        "models.BatchItem": {
+            "type": "object",
+            "properties": {
+                "structurize": {
+                    "$ref": "#/definitions/models.StructurizeRequest"
+                },
+                "summarize": {
+                    "$ref": "#/definitions/models.SummarizeRequest"
+                }
+            }
+        },
+        "models.BatchProgress": {
+            "type": "object",
+            "properties": {
+                "aborted": {
+                    "type": "integer"
+                },
+                "completed": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "pending": {
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.BatchRequest": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.BatchItem"
+                    }
+                }
+            }
+        },
+        "models.BatchResponse": {
+            "type": "object",
+            "properties": {
+                "batchId": {
                     "type": "string"
                 },
-                "structurizeRequest": {
-                    "$ref": "#/definitions/models.StructurizeRequest"
+                "createdAt": {
+                    "type": "integer"
+                },
+                "items": {
+                    "description": "Items are models.SummarizeJobResponse or models.StructurizeJobResponse,\nas returned by GET /jobs/{id}",
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "progress": {
+                    "$ref": "#/definitions/models.BatchProgress"
                 },
-                "summarizeRequest": {
-                    "$ref": "#/definitions/models.SummarizeRequest"
+                "status": {
+                    "$ref": "#/definitions/models.JobStatus"
                 }
             }
         },
@@ -283,6 +1288,84 @@ const docTemplate = `{
                 }
             }
         },
+        "models.BoardMessageType": {
+            "type": "string",
+            "enum": [
+                "summarize",
+                "structurize",
+                "cancel",
+                "accepted",
+                "event",
+                "cancelled",
+                "error"
+            ],
+            "x-enum-varnames": [
+                "BoardMessageSummarize",
+                "BoardMessageStructurize",
+                "BoardMessageCancel",
+                "BoardMessageAccepted",
+                "BoardMessageEvent",
+                "BoardMessageCancelled",
+                "BoardMessageError"
+            ]
+        },
+        "models.BoardServerMessage": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "machine-readable reason of an error",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.ErrorCode"
+                        }
+                    ]
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event": {
+                    "$ref": "#/definitions/models.JobEvent"
+                },
+                "jobId": {
+                    "type": "string"
+                },
+                "requestId": {
+                    "type": "string"
+                },
+                "type": {
+                    "$ref": "#/definitions/models.BoardMessageType"
+                }
+            }
+        },
+        "models.CallbackDelivery": {
+            "type": "object",
+            "properties": {
+                "attempt": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "jobId": {
+                    "type": "string"
+                },
+                "statusCode": {
+                    "type": "integer"
+                },
+                "success": {
+                    "type": "boolean"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
         "models.Element": {
             "type": "object",
             "properties": {
@@ -341,6 +1424,110 @@ const docTemplate = `{
                 }
             }
         },
+        "models.ErrorBody": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.ErrorCode"
+                        }
+                    ],
+                    "example": "validation_failed"
+                },
+                "details": {
+                    "description": "see the ErrorCode",
+                    "type": "object"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "invalid request data: boardID is empty"
+                },
+                "requestId": {
+                    "description": "X-Request-Id of the request",
+                    "type": "string",
+                    "example": "TpnrsJxITNxPvlAgnxmwaDpmmZbFEHoC"
+                }
+            }
+        },
+        "models.ErrorCode": {
+            "type": "string",
+            "enum": [
+                "invalid_request",
+                "validation_failed",
+                "unauthorized",
+                "forbidden",
+                "not_found",
+                "method_not_allowed",
+                "request_too_large",
+                "idempotency_key_reused",
+                "idempotency_key_in_progress",
+                "job_not_replayable",
+                "callbacks_disabled",
+                "callback_failed",
+                "quota_exceeded",
+                "queue_full",
+                "too_many_jobs",
+                "providers_unavailable",
+                "internal_error"
+            ],
+            "x-enum-comments": {
+                "ErrorCodeCallbackFailed": "details is the failed models.CallbackDelivery",
+                "ErrorCodeCallbacksDisabled": "webhook delivery is not configured on the server",
+                "ErrorCodeForbidden": "credentials lack the required role",
+                "ErrorCodeIdempotencyKeyInProgress": "the first request with the key has not finished",
+                "ErrorCodeIdempotencyKeyReused": "key used before with a different request",
+                "ErrorCodeInvalidRequest": "malformed body, header or query parameter",
+                "ErrorCodeJobNotReplayable": "the job has not finished or has no callback URL",
+                "ErrorCodeMethodNotAllowed": "route exists with another method",
+                "ErrorCodeNotFound": "unknown route, job or batch, or one of another principal",
+                "ErrorCodeProvidersUnavailable": "no AI model could serve the request, retry later",
+                "ErrorCodeQueueFull": "the job queue takes no more jobs, retry later",
+                "ErrorCodeQuotaExceeded": "retry after the Retry-After header",
+                "ErrorCodeRequestTooLarge": "body above the server limit",
+                "ErrorCodeTooManyJobs": "the board session has too many unfinished jobs",
+                "ErrorCodeUnauthorized": "missing or invalid credentials",
+                "ErrorCodeValidationFailed": "details lists the offending fields as FieldError"
+            },
+            "x-enum-varnames": [
+                "ErrorCodeInvalidRequest",
+                "ErrorCodeValidationFailed",
+                "ErrorCodeUnauthorized",
+                "ErrorCodeForbidden",
+                "ErrorCodeNotFound",
+                "ErrorCodeMethodNotAllowed",
+                "ErrorCodeRequestTooLarge",
+                "ErrorCodeIdempotencyKeyReused",
+                "ErrorCodeIdempotencyKeyInProgress",
+                "ErrorCodeJobNotReplayable",
+                "ErrorCodeCallbacksDisabled",
+                "ErrorCodeCallbackFailed",
+                "ErrorCodeQuotaExceeded",
+                "ErrorCodeQueueFull",
+                "ErrorCodeTooManyJobs",
+                "ErrorCodeProvidersUnavailable",
+                "ErrorCodeInternal"
+            ]
+        },
+        "models.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/models.ErrorBody"
+                }
+            }
+        },
+        "models.ExecutionMode": {
+            "type": "string",
+            "enum": [
+                "sync",
+                "async"
+            ],
+            "x-enum-varnames": [
+                "ExecutionSync",
+                "ExecutionAsync"
+            ]
+        },
         "models.File": {
             "type": "object",
             "properties": {
@@ -361,24 +1548,157 @@ const docTemplate = `{
                 }
             }
         },
-        "models.Job": {
+        "models.JobEvent": {
             "type": "object",
             "properties": {
                 "createdAt": {
-                    "type": "integer",
-                    "format": "int64"
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
                 },
                 "id": {
+                    "description": "sequence number within the job, 0 for snapshots of the stored job",
+                    "type": "integer"
+                },
+                "jobId": {
+                    "type": "string"
+                },
+                "nextRetryAt": {
+                    "type": "integer"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "result": {
+                    "$ref": "#/definitions/models.AnalyzeResponse"
+                },
+                "retry": {
+                    "type": "integer"
+                },
+                "status": {
+                    "$ref": "#/definitions/models.JobStatus"
+                },
+                "type": {
+                    "$ref": "#/definitions/models.JobEventType"
+                }
+            }
+        },
+        "models.JobEventType": {
+            "type": "string",
+            "enum": [
+                "status",
+                "retry",
+                "provider",
+                "result"
+            ],
+            "x-enum-varnames": [
+                "JobEventStatus",
+                "JobEventRetry",
+                "JobEventProvider",
+                "JobEventResult"
+            ]
+        },
+        "models.JobInfo": {
+            "type": "object",
+            "properties": {
+                "batchId": {
+                    "type": "string"
+                },
+                "boardId": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "jobId": {
+                    "type": "string"
+                },
+                "provider": {
+                    "description": "LLM provider that answered the job",
+                    "type": "string"
+                },
+                "requestType": {
+                    "type": "string"
+                },
+                "retries": {
+                    "type": "integer"
+                },
+                "status": {
+                    "$ref": "#/definitions/models.JobStatus"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.JobListResponse": {
+            "type": "object",
+            "properties": {
+                "jobs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.JobInfo"
+                    }
+                },
+                "nextCursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.JobPriority": {
+            "type": "string",
+            "enum": [
+                "low",
+                "normal",
+                "high"
+            ],
+            "x-enum-varnames": [
+                "JobPriorityLow",
+                "JobPriorityNormal",
+                "JobPriorityHigh"
+            ]
+        },
+        "models.JobResponse": {
+            "type": "object",
+            "properties": {
+                "batchId": {
+                    "type": "string"
+                },
+                "boardId": {
                     "type": "string"
                 },
-                "request": {
-                    "$ref": "#/definitions/models.AnalyzeRequest"
+                "createdAt": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "jobId": {
+                    "type": "string"
+                },
+                "provider": {
+                    "description": "LLM provider that answered the job",
+                    "type": "string"
+                },
+                "requestType": {
+                    "type": "string"
+                },
+                "result": {
+                    "description": "SummarizeResponse for summarize jobs, StructurizeResponse for structurize jobs",
+                    "type": "object"
                 },
                 "retries": {
                     "type": "integer"
                 },
                 "status": {
                     "$ref": "#/definitions/models.JobStatus"
+                },
+                "userId": {
+                    "type": "string"
                 }
             }
         },
@@ -399,15 +1719,119 @@ const docTemplate = `{
                 "JobStatusAborted"
             ]
         },
+        "models.QuotaLimits": {
+            "type": "object",
+            "properties": {
+                "concurrentJobs": {
+                    "type": "integer"
+                },
+                "dailyCost": {
+                    "description": "in the currency of the configured token prices",
+                    "type": "number"
+                },
+                "dailyTokens": {
+                    "type": "integer"
+                },
+                "requestsPerMinute": {
+                    "type": "integer"
+                },
+                "scope": {
+                    "$ref": "#/definitions/models.QuotaScope"
+                },
+                "subjectId": {
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.QuotaScope": {
+            "type": "string",
+            "enum": [
+                "user",
+                "tenant"
+            ],
+            "x-enum-varnames": [
+                "QuotaScopeUser",
+                "QuotaScopeTenant"
+            ]
+        },
+        "models.QuotaStatus": {
+            "type": "object",
+            "properties": {
+                "custom": {
+                    "description": "false when the configured defaults apply",
+                    "type": "boolean"
+                },
+                "limits": {
+                    "$ref": "#/definitions/models.QuotaLimits"
+                },
+                "usage": {
+                    "$ref": "#/definitions/models.QuotaUsage"
+                }
+            }
+        },
+        "models.QuotaUsage": {
+            "type": "object",
+            "properties": {
+                "concurrentJobs": {
+                    "type": "integer"
+                },
+                "costToday": {
+                    "type": "number"
+                },
+                "requestsThisMinute": {
+                    "type": "integer"
+                },
+                "tokensToday": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.StructurizeRequest": {
             "type": "object",
             "properties": {
                 "board": {
                     "$ref": "#/definitions/models.Board"
                 },
+                "callbackUrl": {
+                    "description": "webhook notified when an async job finishes",
+                    "type": "string"
+                },
                 "file": {
                     "$ref": "#/definitions/models.File"
                 },
+                "mode": {
+                    "description": "async returns the job ID right away, takes precedence over the Prefer header",
+                    "enum": [
+                        "sync",
+                        "async"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.ExecutionMode"
+                        }
+                    ]
+                },
+                "priority": {
+                    "description": "queued jobs run by priority, normal by default",
+                    "enum": [
+                        "low",
+                        "normal",
+                        "high"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.JobPriority"
+                        }
+                    ]
+                },
+                "region": {
+                    "description": "region the request is served from, only providers available there are used; X-Region header or the tenant's region by default",
+                    "type": "string",
+                    "example": "RU"
+                },
                 "requestId": {
                     "type": "string"
                 },
@@ -415,6 +1839,10 @@ const docTemplate = `{
                     "description": "structurize",
                     "type": "string"
                 },
+                "tenantId": {
+                    "description": "organization the user belongs to, quotas apply to both",
+                    "type": "string"
+                },
                 "userId": {
                     "type": "string"
                 }
@@ -430,6 +1858,10 @@ const docTemplate = `{
                 "file": {
                     "$ref": "#/definitions/models.File"
                 },
+                "provider": {
+                    "description": "LLM provider that produced the response",
+                    "type": "string"
+                },
                 "requestId": {
                     "type": "string"
                 },
@@ -448,6 +1880,40 @@ const docTemplate = `{
                 "board": {
                     "$ref": "#/definitions/models.Board"
                 },
+                "callbackUrl": {
+                    "description": "webhook notified when an async job finishes",
+                    "type": "string"
+                },
+                "mode": {
+                    "description": "async returns the job ID right away, takes precedence over the Prefer header",
+                    "enum": [
+                        "sync",
+                        "async"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.ExecutionMode"
+                        }
+                    ]
+                },
+                "priority": {
+                    "description": "queued jobs run by priority, normal by default",
+                    "enum": [
+                        "low",
+                        "normal",
+                        "high"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.JobPriority"
+                        }
+                    ]
+                },
+                "region": {
+                    "description": "region the request is served from, only providers available there are used; X-Region header or the tenant's region by default",
+                    "type": "string",
+                    "example": "RU"
+                },
                 "requestId": {
                     "type": "string"
                 },
@@ -455,6 +1921,10 @@ const docTemplate = `{
                     "description": "summarize",
                     "type": "string"
                 },
+                "tenantId": {
+                    "description": "organization the user belongs to, quotas apply to both",
+                    "type": "string"
+                },
                 "userId": {
                     "type": "string"
                 }
@@ -463,6 +1933,10 @@ const docTemplate = `{
         "models.SummarizeResponse": {
             "type": "object",
             "properties": {
+                "provider": {
+                    "description": "LLM provider that produced the response",
+                    "type": "string"
+                },
                 "requestId": {
                     "type": "string"
                 },
@@ -525,6 +1999,19 @@ const docTemplate = `{
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "APIKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "description": "API key or JWT as \"Bearer \u003ctoken\u003e\"",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -535,7 +2022,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/",
 	Schemes:          []string{"http", "https"},
 	Title:            "AIService API",
-	Description:      "AI Service for processing board data with summarization and structurization capabilities",
+	Description:      "AI Service for processing board data with summarization and structurization capabilities\nEvery error response is a models.ErrorResponse whose error.code is a stable, machine-readable identifier of the failure.",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 }
@@ -0,0 +1,140 @@
+// Package auth authenticates API callers with static API keys or JWTs
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/aiservice/internal/config"
+)
+
+// AdminPrincipal is the name of the principal authenticated by the admin token
+const AdminPrincipal = "admin"
+
+// Authentication methods a Principal was authenticated with
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+var (
+	// ErrNoCredentials reports a request without any credentials
+	ErrNoCredentials = errors.New("missing credentials")
+	// ErrInvalidCredentials reports credentials that did not check out
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	ID     string // API key name or JWT subject
+	Tenant string // tenant of the API key or "tenant" claim of the JWT, empty when it has none
+	Admin  bool
+	Method string
+}
+
+// CanAccess reports whether the principal may see a job recorded for owner
+func (p Principal) CanAccess(owner string) bool {
+	return p.Admin || p.ID == owner
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the authenticated caller, ok is false for anonymous
+// calls and internal work, which are not restricted
+func FromContext(ctx context.Context) (p Principal, ok bool) {
+	p, ok = ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator checks API keys and bearer tokens against the configured credentials
+type Authenticator struct {
+	keys     map[[sha256.Size]byte]Principal // by the hash of the key, so lookups do not leak the key through timing
+	jwt      *jwtVerifier                    // nil when JWTs are not accepted
+	required bool
+}
+
+// NewAuthenticator loads the configured credentials, reading the JWKS file if any
+func NewAuthenticator(cfg config.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{keys: make(map[[sha256.Size]byte]Principal)}
+
+	add := func(name, key string, admin bool) error {
+		if key == "" {
+			return fmt.Errorf("API key of %q is empty", name)
+		}
+		hash := sha256.Sum256([]byte(key))
+		if _, ok := a.keys[hash]; ok {
+			return fmt.Errorf("API key of %q is used twice", name)
+		}
+		a.keys[hash] = Principal{ID: name, Tenant: cfg.APIKeyTenants[name], Admin: admin, Method: MethodAPIKey}
+		return nil
+	}
+	if cfg.AdminToken != "" {
+		if err := add(AdminPrincipal, cfg.AdminToken, true); err != nil {
+			return nil, err
+		}
+	}
+	for name, key := range cfg.AdminAPIKeys {
+		if err := add(name, key, true); err != nil {
+			return nil, err
+		}
+	}
+	for name, key := range cfg.APIKeys {
+		if err := add(name, key, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.JWTSecret != "" || cfg.JWKSFile != "" {
+		verifier, err := newJWTVerifier(cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+
+	// The admin token alone only guards the admin API
+	a.required = len(cfg.APIKeys) > 0 || len(cfg.AdminAPIKeys) > 0 || a.jwt != nil
+	return a, nil
+}
+
+// Enabled reports whether any credentials are configured
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0 || a.jwt != nil
+}
+
+// Required reports whether every API call must be authenticated
+func (a *Authenticator) Required() bool {
+	return a.required
+}
+
+// Authenticate checks an API key or a bearer token, which may be an API key or a JWT
+func (a *Authenticator) Authenticate(apiKey, bearer string) (Principal, error) {
+	if apiKey == "" && bearer == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	if apiKey != "" {
+		if p, ok := a.keys[sha256.Sum256([]byte(apiKey))]; ok {
+			return p, nil
+		}
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+
+	if p, ok := a.keys[sha256.Sum256([]byte(bearer))]; ok {
+		return p, nil
+	}
+	if a.jwt == nil {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	p, err := a.jwt.verify(bearer)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// signedToken signs a token whose subject is alice, expiring in an hour
+func signedToken(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	base := jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	for k, v := range claims {
+		base[k] = v
+	}
+	token := jwt.NewWithClaims(method, base)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	require.NoError(t, err)
+	return raw
+}
+
+// writeJWKS stores the public half of key in a JWKS file
+func writeJWKS(t *testing.T, kid string, key *rsa.PrivateKey) string {
+	set := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestAuthenticator_APIKeys(t *testing.T) {
+	a, err := NewAuthenticator(config.AuthConfig{
+		AdminToken:    "root-token",
+		APIKeys:       map[string]string{"backend": "backend-key"},
+		AdminAPIKeys:  map[string]string{"ops": "ops-key"},
+		APIKeyTenants: map[string]string{"backend": "acme"},
+	})
+	require.NoError(t, err)
+	require.True(t, a.Enabled())
+	require.True(t, a.Required())
+
+	p, err := a.Authenticate("backend-key", "")
+	require.NoError(t, err)
+	require.Equal(t, Principal{ID: "backend", Tenant: "acme", Method: MethodAPIKey}, p)
+
+	p, err = a.Authenticate("", "ops-key")
+	require.NoError(t, err)
+	require.True(t, p.Admin)
+
+	p, err = a.Authenticate("", "root-token")
+	require.NoError(t, err)
+	require.Equal(t, AdminPrincipal, p.ID)
+	require.True(t, p.Admin)
+
+	_, err = a.Authenticate("wrong-key", "")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.Authenticate("", "")
+	require.ErrorIs(t, err, ErrNoCredentials)
+
+	_, err = NewAuthenticator(config.AuthConfig{APIKeys: map[string]string{"a": "same", "b": "same"}})
+	require.Error(t, err, "a key shared by two principals is rejected")
+}
+
+func TestAuthenticator_AdminTokenAlone(t *testing.T) {
+	a, err := NewAuthenticator(config.AuthConfig{AdminToken: "root-token"})
+	require.NoError(t, err)
+	require.True(t, a.Enabled())
+	require.False(t, a.Required(), "the admin token only guards the admin API")
+
+	a, err = NewAuthenticator(config.AuthConfig{})
+	require.NoError(t, err)
+	require.False(t, a.Enabled())
+}
+
+func TestAuthenticator_HS256(t *testing.T) {
+	secret := []byte("shared-secret")
+	a, err := NewAuthenticator(config.AuthConfig{JWTSecret: string(secret), JWTIssuer: "issuer", AdminRole: "admin"})
+	require.NoError(t, err)
+	require.True(t, a.Required())
+
+	p, err := a.Authenticate("", signedToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "issuer"}))
+	require.NoError(t, err)
+	require.Equal(t, Principal{ID: "alice", Method: MethodJWT}, p)
+
+	p, err = a.Authenticate("", signedToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "issuer", "roles": []string{"admin"}}))
+	require.NoError(t, err)
+	require.True(t, p.Admin)
+
+	p, err = a.Authenticate("", signedToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "issuer", "tenant": "acme"}))
+	require.NoError(t, err)
+	require.Equal(t, "acme", p.Tenant)
+
+	for name, token := range map[string]string{
+		"wrong secret":    signedToken(t, jwt.SigningMethodHS256, []byte("other"), "", jwt.MapClaims{"iss": "issuer"}),
+		"wrong issuer":    signedToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "other"}),
+		"expired":         signedToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "issuer", "exp": time.Now().Add(-time.Minute).Unix()}),
+		"no expiry":       signedToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "issuer", "exp": nil}),
+		"no subject":      signedToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "issuer", "sub": ""}),
+		"wrong algorithm": signedToken(t, jwt.SigningMethodHS384, secret, "", jwt.MapClaims{"iss": "issuer"}),
+		"not a token":     "garbage",
+	} {
+		_, err := a.Authenticate("", token)
+		require.ErrorIs(t, err, ErrInvalidCredentials, name)
+	}
+}
+
+func TestAuthenticator_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	a, err := NewAuthenticator(config.AuthConfig{JWKSFile: writeJWKS(t, "key-1", key), JWTAudience: "aiservice"})
+	require.NoError(t, err)
+
+	p, err := a.Authenticate("", signedToken(t, jwt.SigningMethodRS256, key, "key-1", jwt.MapClaims{"aud": "aiservice"}))
+	require.NoError(t, err)
+	require.Equal(t, "alice", p.ID)
+
+	// A set with a single key also verifies tokens without a key ID
+	_, err = a.Authenticate("", signedToken(t, jwt.SigningMethodRS256, key, "", jwt.MapClaims{"aud": "aiservice"}))
+	require.NoError(t, err)
+
+	_, err = a.Authenticate("", signedToken(t, jwt.SigningMethodRS256, other, "key-1", jwt.MapClaims{"aud": "aiservice"}))
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.Authenticate("", signedToken(t, jwt.SigningMethodRS256, key, "key-2", jwt.MapClaims{"aud": "aiservice"}))
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.Authenticate("", signedToken(t, jwt.SigningMethodRS256, key, "key-1", jwt.MapClaims{"aud": "other"}))
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	// HS256 tokens are refused without a secret, whatever they are signed with
+	_, err = a.Authenticate("", signedToken(t, jwt.SigningMethodHS256, []byte("secret"), "key-1", jwt.MapClaims{"aud": "aiservice"}))
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = NewAuthenticator(config.AuthConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")})
+	require.Error(t, err)
+}
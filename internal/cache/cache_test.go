@@ -103,7 +103,8 @@ func TestCachedJobStorage(t *testing.T) {
 
 // MockJobStorage is a mock implementation of the JobStorage interface for testing
 type MockJobStorage struct {
-	jobs map[string]models.Job
+	jobs       map[string]models.Job
+	deliveries []models.CallbackDelivery
 }
 
 func (m *MockJobStorage) Save(job models.Job) error {
@@ -126,6 +127,9 @@ func (m *MockJobStorage) Update(job models.Job) error {
 
 func (m *MockJobStorage) Abort(_ context.Context, id string) error {
 	if job, exists := m.jobs[id]; exists {
+		if job.Status != models.JobStatusPending && job.Status != models.JobStatusRunning {
+			return models.ErrJobNotAbortable
+		}
 		job.Status = models.JobStatusAborted
 		m.jobs[id] = job
 	}
@@ -140,6 +144,77 @@ func (m *MockJobStorage) GetAll() ([]models.Job, error) {
 	return jobs, nil
 }
 
+func (m *MockJobStorage) Query(_ context.Context, filter models.JobFilter) (models.JobPage, error) {
+	var jobs []models.Job
+	for _, job := range m.jobs {
+		if filter.Matches(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	return models.JobPage{Jobs: jobs}, nil
+}
+
+func (m *MockJobStorage) Claim(_ context.Context, id string, lease models.Lease) (models.Job, bool, error) {
+	job, ok := m.jobs[id]
+	if !ok || job.Status != models.JobStatusPending {
+		return models.Job{}, false, nil
+	}
+	job.Status = models.JobStatusRunning
+	job.LeaseOwner, job.LeaseExpiresAt = lease.Owner, lease.ExpiresAt
+	m.jobs[id] = job
+	return job, true, nil
+}
+
+func (m *MockJobStorage) ClaimPending(_ context.Context, limit int, now int64, lease models.Lease) ([]models.Job, error) {
+	var jobs []models.Job
+	for id, job := range m.jobs {
+		if len(jobs) == limit {
+			break
+		}
+		if job.Status == models.JobStatusPending && job.NextRetryAt <= now && job.LeaseExpiresAt < now {
+			job.Status = models.JobStatusRunning
+			job.LeaseOwner, job.LeaseExpiresAt = lease.Owner, lease.ExpiresAt
+			m.jobs[id] = job
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (m *MockJobStorage) HoldPending(_ context.Context, ids []string, lease models.Lease) error {
+	for _, id := range ids {
+		job, ok := m.jobs[id]
+		if ok && job.Status == models.JobStatusPending && job.LeaseOwner == lease.Owner {
+			job.LeaseExpiresAt = lease.ExpiresAt
+			m.jobs[id] = job
+		}
+	}
+	return nil
+}
+
+func (m *MockJobStorage) Heartbeat(_ context.Context, id string, lease models.Lease) (bool, error) {
+	job, ok := m.jobs[id]
+	if !ok || job.Status != models.JobStatusRunning || job.LeaseOwner != lease.Owner {
+		return false, nil
+	}
+	job.LeaseExpiresAt = lease.ExpiresAt
+	m.jobs[id] = job
+	return true, nil
+}
+
+func (m *MockJobStorage) Finish(_ context.Context, job models.Job, owner string) (bool, error) {
+	current, ok := m.jobs[job.ID]
+	if !ok || current.Status != models.JobStatusRunning || current.LeaseOwner != owner {
+		return false, nil
+	}
+	m.jobs[job.ID] = job
+	return true, nil
+}
+
+func (m *MockJobStorage) RecoverExpired(_ context.Context, now int64, maxRecoveries int) ([]models.Job, error) {
+	return nil, nil
+}
+
 func (m *MockJobStorage) DeleteJobs(ids ...string) error {
 	for _, id := range ids {
 		delete(m.jobs, id)
@@ -147,6 +222,85 @@ func (m *MockJobStorage) DeleteJobs(ids ...string) error {
 	return nil
 }
 
+func (m *MockJobStorage) SaveDelivery(delivery models.CallbackDelivery) error {
+	m.deliveries = append(m.deliveries, delivery)
+	return nil
+}
+
+func (m *MockJobStorage) GetDeliveries(jobID string) ([]models.CallbackDelivery, error) {
+	var deliveries []models.CallbackDelivery
+	for _, d := range m.deliveries {
+		if d.JobID == jobID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *MockJobStorage) ReserveIdempotencyKey(_ context.Context, rec models.IdempotencyRecord, now int64) (models.IdempotencyRecord, bool, error) {
+	return rec, true, nil
+}
+
+func (m *MockJobStorage) UpdateIdempotencyKey(_ context.Context, rec models.IdempotencyRecord) error {
+	return nil
+}
+
+func (m *MockJobStorage) DeleteIdempotencyKey(_ context.Context, userID, key string) error {
+	return nil
+}
+
+func (m *MockJobStorage) DeleteExpiredIdempotencyKeys(_ context.Context, now int64) error {
+	return nil
+}
+
+func (m *MockJobStorage) GetQuotaLimits(_ context.Context, subject models.QuotaSubject) (models.QuotaLimits, bool, error) {
+	return models.QuotaLimits{}, false, nil
+}
+
+func (m *MockJobStorage) ListQuotaLimits(_ context.Context) ([]models.QuotaLimits, error) {
+	return nil, nil
+}
+
+func (m *MockJobStorage) SaveQuotaLimits(_ context.Context, limits models.QuotaLimits) error {
+	return nil
+}
+
+func (m *MockJobStorage) DeleteQuotaLimits(_ context.Context, subject models.QuotaSubject) error {
+	return nil
+}
+
+func (m *MockJobStorage) CountQuotaRequest(_ context.Context, subject models.QuotaSubject, window int64, limit int) (bool, error) {
+	return true, nil
+}
+
+func (m *MockJobStorage) AcquireQuotaSlot(_ context.Context, subject models.QuotaSubject, jobID string, limit int, now, expiresAt int64) (bool, error) {
+	return true, nil
+}
+
+func (m *MockJobStorage) ReleaseQuotaSlots(_ context.Context, jobID string) error {
+	return nil
+}
+
+func (m *MockJobStorage) AddQuotaUsage(_ context.Context, subject models.QuotaSubject, day int64, tokens int64, cost float64) error {
+	return nil
+}
+
+func (m *MockJobStorage) GetQuotaUsage(_ context.Context, subject models.QuotaSubject, window, day, now int64) (models.QuotaUsage, error) {
+	return models.QuotaUsage{}, nil
+}
+
+func (m *MockJobStorage) DeleteExpiredQuota(_ context.Context, window, day, now int64) error {
+	return nil
+}
+
+func (m *MockJobStorage) SaveBatch(_ context.Context, batch models.Batch) error {
+	return nil
+}
+
+func (m *MockJobStorage) GetBatch(_ context.Context, id string) (models.Batch, error) {
+	return models.Batch{}, models.ErrBatchNotFound
+}
+
 func (m *MockJobStorage) Close() error {
 	// For testing purposes, no resources to close
 	return nil
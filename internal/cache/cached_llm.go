@@ -6,11 +6,17 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aiservice/internal/metrics"
 	"github.com/aiservice/internal/models"
 	"github.com/aiservice/internal/providers"
 	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/aiservice/internal/cache")
+
 // CachedLLMClient wraps an LLMClient with caching capabilities
 type CachedLLMClient struct {
 	client providers.LLMClient
@@ -34,10 +40,8 @@ func (c *CachedLLMClient) Summarize(ctx context.Context, parts []*ai.Part) (mode
 	}
 	
 	// Try to get from cache first
-	if cachedValue, found := c.cache.Get(cacheKey); found {
-		if response, ok := cachedValue.(models.SummarizeResponse); ok {
-			return response, nil
-		}
+	if response, ok := lookup[models.SummarizeResponse](ctx, c.cache, models.SummarizeType, cacheKey); ok {
+		return response, nil
 	}
 	
 	// Call the underlying client
@@ -61,10 +65,8 @@ func (c *CachedLLMClient) Structurize(ctx context.Context, parts []*ai.Part) (mo
 	}
 	
 	// Try to get from cache first
-	if cachedValue, found := c.cache.Get(cacheKey); found {
-		if response, ok := cachedValue.(models.StructurizeResponse); ok {
-			return response, nil
-		}
+	if response, ok := lookup[models.StructurizeResponse](ctx, c.cache, models.StructurizeType, cacheKey); ok {
+		return response, nil
 	}
 	
 	// Call the underlying client
@@ -79,6 +81,25 @@ func (c *CachedLLMClient) Structurize(ctx context.Context, parts []*ai.Part) (mo
 	return response, nil
 }
 
+// lookup returns the response cached under key, recording the lookup in a
+// span and the metrics
+func lookup[T any](ctx context.Context, cache Cache, requestType, key string) (T, bool) {
+	_, span := tracer.Start(ctx, "cache.lookup", trace.WithAttributes(attribute.String("request.type", requestType)))
+	defer span.End()
+
+	value, found := cache.Get(key)
+	response, ok := value.(T)
+	hit := found && ok
+
+	result := metrics.CacheMiss
+	if hit {
+		result = metrics.CacheHit
+	}
+	metrics.LLMCacheRequests.WithLabelValues(requestType, result).Inc()
+	span.SetAttributes(attribute.Bool("cache.hit", hit))
+	return response, hit
+}
+
 // generateCacheKey creates a unique key based on the operation type and input parts
 func (c *CachedLLMClient) generateCacheKey(operation string, parts []*ai.Part) (string, error) {
 	// Convert parts to a comparable representation for hashing
@@ -93,6 +93,77 @@ func (c *CachedJobStorage) GetAll() ([]models.Job, error) {
 	return c.storage.GetAll()
 }
 
+func (c *CachedJobStorage) Query(ctx context.Context, filter models.JobFilter) (models.JobPage, error) {
+	// Listings change with every write, so they always hit the underlying storage
+	return c.storage.Query(ctx, filter)
+}
+
+func (c *CachedJobStorage) Claim(ctx context.Context, id string, lease models.Lease) (models.Job, bool, error) {
+	job, ok, err := c.storage.Claim(ctx, id, lease)
+	if err != nil || !ok {
+		// Another worker owns the job, drop the possibly stale entry
+		c.cache.Delete(fmt.Sprintf("job:%s", id))
+		return job, ok, err
+	}
+
+	cacheKey := fmt.Sprintf("job:%s", job.ID)
+	c.cache.Set(cacheKey, job, 10*time.Minute) // Cache for 10 minutes
+
+	return job, true, nil
+}
+
+func (c *CachedJobStorage) ClaimPending(ctx context.Context, limit int, now int64, lease models.Lease) ([]models.Job, error) {
+	jobs, err := c.storage.ClaimPending(ctx, limit, now, lease)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		cacheKey := fmt.Sprintf("job:%s", job.ID)
+		c.cache.Set(cacheKey, job, 10*time.Minute) // Cache for 10 minutes
+	}
+
+	return jobs, nil
+}
+
+func (c *CachedJobStorage) HoldPending(ctx context.Context, ids []string, lease models.Lease) error {
+	// Like heartbeats, holds only move the lease expiry and skip the cache
+	return c.storage.HoldPending(ctx, ids, lease)
+}
+
+func (c *CachedJobStorage) Heartbeat(ctx context.Context, id string, lease models.Lease) (bool, error) {
+	// The lease expiry is not worth a cache write on every heartbeat
+	return c.storage.Heartbeat(ctx, id, lease)
+}
+
+func (c *CachedJobStorage) Finish(ctx context.Context, job models.Job, owner string) (bool, error) {
+	ok, err := c.storage.Finish(ctx, job, owner)
+	cacheKey := fmt.Sprintf("job:%s", job.ID)
+	if err != nil || !ok {
+		// The job moved on without this worker, drop the possibly stale entry
+		c.cache.Delete(cacheKey)
+		return ok, err
+	}
+
+	c.cache.Set(cacheKey, job, 10*time.Minute) // Cache for 10 minutes
+
+	return true, nil
+}
+
+func (c *CachedJobStorage) RecoverExpired(ctx context.Context, now int64, maxRecoveries int) ([]models.Job, error) {
+	jobs, err := c.storage.RecoverExpired(ctx, now, maxRecoveries)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		cacheKey := fmt.Sprintf("job:%s", job.ID)
+		c.cache.Set(cacheKey, job, 10*time.Minute) // Cache for 10 minutes
+	}
+
+	return jobs, nil
+}
+
 func (c *CachedJobStorage) DeleteJobs(ids ...string) error {
 	// Delete from underlying storage
 	err := c.storage.DeleteJobs(ids...)
@@ -109,6 +180,82 @@ func (c *CachedJobStorage) DeleteJobs(ids ...string) error {
 	return nil
 }
 
+func (c *CachedJobStorage) SaveDelivery(delivery models.CallbackDelivery) error {
+	return c.storage.SaveDelivery(delivery)
+}
+
+func (c *CachedJobStorage) GetDeliveries(jobID string) ([]models.CallbackDelivery, error) {
+	// Delivery logs are read rarely, so they are not cached
+	return c.storage.GetDeliveries(jobID)
+}
+
+func (c *CachedJobStorage) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, now int64) (models.IdempotencyRecord, bool, error) {
+	// Reservations must be atomic across replicas, so they always hit storage
+	return c.storage.ReserveIdempotencyKey(ctx, rec, now)
+}
+
+func (c *CachedJobStorage) UpdateIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	return c.storage.UpdateIdempotencyKey(ctx, rec)
+}
+
+func (c *CachedJobStorage) DeleteIdempotencyKey(ctx context.Context, userID, key string) error {
+	return c.storage.DeleteIdempotencyKey(ctx, userID, key)
+}
+
+func (c *CachedJobStorage) DeleteExpiredIdempotencyKeys(ctx context.Context, now int64) error {
+	return c.storage.DeleteExpiredIdempotencyKeys(ctx, now)
+}
+
+func (c *CachedJobStorage) GetQuotaLimits(ctx context.Context, subject models.QuotaSubject) (models.QuotaLimits, bool, error) {
+	// Quota limits and counters are shared across replicas, so they always hit storage
+	return c.storage.GetQuotaLimits(ctx, subject)
+}
+
+func (c *CachedJobStorage) ListQuotaLimits(ctx context.Context) ([]models.QuotaLimits, error) {
+	return c.storage.ListQuotaLimits(ctx)
+}
+
+func (c *CachedJobStorage) SaveQuotaLimits(ctx context.Context, limits models.QuotaLimits) error {
+	return c.storage.SaveQuotaLimits(ctx, limits)
+}
+
+func (c *CachedJobStorage) DeleteQuotaLimits(ctx context.Context, subject models.QuotaSubject) error {
+	return c.storage.DeleteQuotaLimits(ctx, subject)
+}
+
+func (c *CachedJobStorage) CountQuotaRequest(ctx context.Context, subject models.QuotaSubject, window int64, limit int) (bool, error) {
+	return c.storage.CountQuotaRequest(ctx, subject, window, limit)
+}
+
+func (c *CachedJobStorage) AcquireQuotaSlot(ctx context.Context, subject models.QuotaSubject, jobID string, limit int, now, expiresAt int64) (bool, error) {
+	return c.storage.AcquireQuotaSlot(ctx, subject, jobID, limit, now, expiresAt)
+}
+
+func (c *CachedJobStorage) ReleaseQuotaSlots(ctx context.Context, jobID string) error {
+	return c.storage.ReleaseQuotaSlots(ctx, jobID)
+}
+
+func (c *CachedJobStorage) AddQuotaUsage(ctx context.Context, subject models.QuotaSubject, day int64, tokens int64, cost float64) error {
+	return c.storage.AddQuotaUsage(ctx, subject, day, tokens, cost)
+}
+
+func (c *CachedJobStorage) GetQuotaUsage(ctx context.Context, subject models.QuotaSubject, window, day, now int64) (models.QuotaUsage, error) {
+	return c.storage.GetQuotaUsage(ctx, subject, window, day, now)
+}
+
+func (c *CachedJobStorage) DeleteExpiredQuota(ctx context.Context, window, day, now int64) error {
+	return c.storage.DeleteExpiredQuota(ctx, window, day, now)
+}
+
+func (c *CachedJobStorage) SaveBatch(ctx context.Context, batch models.Batch) error {
+	return c.storage.SaveBatch(ctx, batch)
+}
+
+func (c *CachedJobStorage) GetBatch(ctx context.Context, id string) (models.Batch, error) {
+	// Batches are read rarely, their progress comes from the job listing
+	return c.storage.GetBatch(ctx, id)
+}
+
 func (c *CachedJobStorage) Close() error {
 	return c.storage.Close()
 }
@@ -3,17 +3,27 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	LLM      LLMProviderConfig
-	OCR      OCRProviderConfig
-	Job      JobConfig
-	Timeouts TimeoutsConfig
-	Database DatabaseConfig
-	S3       S3Config
+	Server    ServerConfig
+	LLM       LLMProviderConfig
+	OpenAI    LLMProviderConfig // OpenAI-compatible Chat Completions provider
+	Yandex    YandexConfig
+	Anthropic LLMProviderConfig // Anthropic Messages API provider
+	OCR       OCRProviderConfig
+	Job       JobConfig
+	Timeouts  TimeoutsConfig
+	Database  DatabaseConfig
+	S3        S3Config
+	Callback  CallbackConfig
+	WebSocket WebSocketConfig
+	Quota     QuotaConfig
+	Auth      AuthConfig
+	Tracing   TracingConfig
+	Routing   RoutingConfig
 }
 
 type ServerConfig struct {
@@ -35,6 +45,17 @@ type LLMProviderConfig struct {
 	Timeout  time.Duration
 }
 
+// YandexConfig configures the YandexGPT provider of Yandex Cloud Foundation Models
+type YandexConfig struct {
+	APIKey   string // service account API key
+	IAMToken string // used when no API key is set
+	FolderID string // cloud folder billed for the requests
+	Model    string // model URI, or a model name such as yandexgpt/latest completed with the folder
+	BaseURL  string // Foundation Models API
+	OCRURL   string // Vision OCR API reading the board screenshots
+	Timeout  time.Duration
+}
+
 type MultiProviderConfig struct {
 	Providers []ProviderConfig `json:"providers"`
 }
@@ -63,6 +84,83 @@ type JobConfig struct {
 	DbWorkerCount int
 	MaxRetries    int
 	RetryBackoff  time.Duration
+
+	MaxRunningPerUser int // jobs of one user processed at once by the queue workers, 0 for no limit
+
+	WorkerID          string        // lease owner name, unique per process when empty
+	LeaseDuration     time.Duration // how long a running job stays owned without a heartbeat
+	HeartbeatInterval time.Duration // how often running jobs renew their lease
+	RecoveryInterval  time.Duration // how often expired leases are looked for
+	MaxRecoveries     int           // lease expirations after which a job is failed
+
+	IdempotencyTTL time.Duration // how long an Idempotency-Key keeps returning the same job
+
+	MaxBatchItems int // requests accepted by one POST /batches
+}
+
+type CallbackConfig struct {
+	Secret         string // HMAC key used to sign webhook payloads
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	AllowedHosts   []string // hosts delivered to even when they resolve to private or loopback addresses
+}
+
+type WebSocketConfig struct {
+	MaxJobsPerConnection int           // jobs a board session may have in progress at once
+	SendBuffer           int           // messages queued for a slow client before its jobs stop being forwarded
+	MaxMessageSize       int64         // largest client message in bytes
+	PingInterval         time.Duration // how often idle connections are checked, a missed pong closes them
+}
+
+type QuotaConfig struct {
+	User   QuotaLimitsConfig // defaults of every user without custom limits
+	Tenant QuotaLimitsConfig // defaults of every tenant without custom limits
+
+	TokenPrices       map[string]float64 // cost of 1000 tokens per provider name
+	DefaultTokenPrice float64            // cost of 1000 tokens of providers missing from TokenPrices
+}
+
+// QuotaLimitsConfig holds default quota limits, zero meaning unlimited
+type QuotaLimitsConfig struct {
+	RequestsPerMinute int
+	ConcurrentJobs    int
+	DailyTokens       int64
+	DailyCost         float64
+}
+
+// AuthConfig selects how callers authenticate. The API stays open when only
+// AdminToken is set, any other credential makes authentication mandatory.
+type AuthConfig struct {
+	AdminToken   string            // API key of the "admin" principal, the admin API is disabled without any credentials
+	APIKeys      map[string]string // API keys of service principals by principal name
+	AdminAPIKeys map[string]string // API keys of admin principals by principal name
+	// APIKeyTenants binds principals authenticated by API key to a tenant, by
+	// principal name; JWT principals get theirs from the "tenant" claim
+	APIKeyTenants map[string]string
+
+	JWTSecret   string // HS256 signing secret
+	JWKSFile    string // JSON Web Key Set with the RS256 public keys
+	JWTIssuer   string // required "iss" claim, unchecked when empty
+	JWTAudience string // required "aud" claim, unchecked when empty
+	AdminRole   string // role in the "roles" claim granting admin access
+}
+
+// RoutingConfig picks the region of the requests that name none, providers
+// are chosen among those available in the region of a request
+type RoutingConfig struct {
+	TenantRegions map[string]string // region of the requests of each tenant, by tenant ID
+	DefaultRegion string            // region of the other requests, every provider serves them when empty
+}
+
+// TracingConfig selects where spans are exported, tracing is off when
+// Exporter is empty
+type TracingConfig struct {
+	Exporter    string  // "otlp", "stdout" or empty
+	File        string  // file the stdout exporter appends spans to, standard output when empty
+	ServiceName string  // service.name of the exported spans
+	SampleRatio float64 // share of traces started here that are recorded, traces of callers follow their decision
 }
 
 type TimeoutsConfig struct {
@@ -72,7 +170,7 @@ type TimeoutsConfig struct {
 }
 
 type DatabaseConfig struct {
-	Type     string // "memory", "sqlite"
+	Type     string // "memory", "sqlite", "postgres"
 	Host     string
 	Port     string
 	Name     string
@@ -98,6 +196,29 @@ func LoadFromEnv() *Config {
 			Provider: getEnv("LLM_PROVIDER", "gemini"),
 			APIKey:   getEnv("GEMINI_API_KEY", ""),
 		},
+		OpenAI: LLMProviderConfig{
+			Provider: "openai",
+			APIKey:   getEnv("OPENAI_API_KEY", ""),
+			BaseURL:  getEnv("OPENAI_BASE_URL", ""),
+			Model:    getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+			Timeout:  getDurationEnv("OPENAI_TIMEOUT", 30*time.Second),
+		},
+		Yandex: YandexConfig{
+			APIKey:   getEnv("YANDEX_API_KEY", ""),
+			IAMToken: getEnv("YANDEX_IAM_TOKEN", ""),
+			FolderID: getEnv("YANDEX_FOLDER_ID", ""),
+			Model:    getEnv("YANDEX_MODEL", "yandexgpt/latest"),
+			BaseURL:  getEnv("YANDEX_BASE_URL", "https://llm.api.cloud.yandex.net"),
+			OCRURL:   getEnv("YANDEX_OCR_URL", "https://ocr.api.cloud.yandex.net"),
+			Timeout:  getDurationEnv("YANDEX_TIMEOUT", 30*time.Second),
+		},
+		Anthropic: LLMProviderConfig{
+			Provider: "anthropic",
+			APIKey:   getEnv("ANTHROPIC_API_KEY", ""),
+			BaseURL:  getEnv("ANTHROPIC_BASE_URL", ""),
+			Model:    getEnv("ANTHROPIC_MODEL", "claude-sonnet-4-5"),
+			Timeout:  getDurationEnv("ANTHROPIC_TIMEOUT", 60*time.Second),
+		},
 		OCR: OCRProviderConfig{
 			Provider: getEnv("OCR_PROVIDER", "gemini"),
 			APIKey:   getEnv("OCR_API_KEY", ""),
@@ -110,6 +231,18 @@ func LoadFromEnv() *Config {
 			DbWorkerCount: getIntEnv("DB_JOB_WORKERS", 1),
 			MaxRetries:    getIntEnv("JOB_MAX_RETRIES", 3),
 			RetryBackoff:  getDurationEnv("JOB_RETRY_BACKOFF", 2*time.Second),
+
+			MaxRunningPerUser: getIntEnv("JOB_MAX_RUNNING_PER_USER", 0),
+
+			WorkerID:          getEnv("JOB_WORKER_ID", ""),
+			LeaseDuration:     getDurationEnv("JOB_LEASE_DURATION", time.Minute),
+			HeartbeatInterval: getDurationEnv("JOB_HEARTBEAT_INTERVAL", 20*time.Second),
+			RecoveryInterval:  getDurationEnv("JOB_RECOVERY_INTERVAL", 30*time.Second),
+			MaxRecoveries:     getIntEnv("JOB_MAX_RECOVERIES", 3),
+
+			IdempotencyTTL: getDurationEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+
+			MaxBatchItems: getIntEnv("BATCH_MAX_ITEMS", 100),
 		},
 		Timeouts: TimeoutsConfig{
 			SyncProcess:  getDurationEnv("TIMEOUT_SYNC_PROCESS", 5*time.Minute),
@@ -132,6 +265,57 @@ func LoadFromEnv() *Config {
 			Endpoint:   getEnv("S3_ENDPOINT", "https://storage.yandexcloud.net"),
 			Region:     getEnv("S3_REGION", "ru-central1"),
 		},
+		Callback: CallbackConfig{
+			Secret:         getEnv("CALLBACK_SECRET", ""),
+			MaxAttempts:    getIntEnv("CALLBACK_MAX_ATTEMPTS", 5),
+			InitialBackoff: getDurationEnv("CALLBACK_BACKOFF", time.Second),
+			MaxBackoff:     getDurationEnv("CALLBACK_MAX_BACKOFF", time.Minute),
+			Timeout:        getDurationEnv("CALLBACK_TIMEOUT", 10*time.Second),
+			AllowedHosts:   getListEnv("CALLBACK_ALLOWED_HOSTS"),
+		},
+		WebSocket: WebSocketConfig{
+			MaxJobsPerConnection: getIntEnv("WS_MAX_JOBS_PER_CONNECTION", 8),
+			SendBuffer:           getIntEnv("WS_SEND_BUFFER", 64),
+			MaxMessageSize:       int64(getIntEnv("WS_MAX_MESSAGE_SIZE", 16<<20)),
+			PingInterval:         getDurationEnv("WS_PING_INTERVAL", 30*time.Second),
+		},
+		Quota: QuotaConfig{
+			User: QuotaLimitsConfig{
+				RequestsPerMinute: getIntEnv("QUOTA_USER_REQUESTS_PER_MINUTE", 0),
+				ConcurrentJobs:    getIntEnv("QUOTA_USER_CONCURRENT_JOBS", 0),
+				DailyTokens:       int64(getIntEnv("QUOTA_USER_DAILY_TOKENS", 0)),
+				DailyCost:         getFloatEnv("QUOTA_USER_DAILY_COST", 0),
+			},
+			Tenant: QuotaLimitsConfig{
+				RequestsPerMinute: getIntEnv("QUOTA_TENANT_REQUESTS_PER_MINUTE", 0),
+				ConcurrentJobs:    getIntEnv("QUOTA_TENANT_CONCURRENT_JOBS", 0),
+				DailyTokens:       int64(getIntEnv("QUOTA_TENANT_DAILY_TOKENS", 0)),
+				DailyCost:         getFloatEnv("QUOTA_TENANT_DAILY_COST", 0),
+			},
+			TokenPrices:       getPricesEnv("QUOTA_TOKEN_PRICES"),
+			DefaultTokenPrice: getFloatEnv("QUOTA_DEFAULT_TOKEN_PRICE", 0),
+		},
+		Auth: AuthConfig{
+			AdminToken:    getEnv("ADMIN_TOKEN", ""),
+			APIKeys:       getPairsEnv("AUTH_API_KEYS"),
+			AdminAPIKeys:  getPairsEnv("AUTH_ADMIN_API_KEYS"),
+			APIKeyTenants: getPairsEnv("AUTH_API_KEY_TENANTS"),
+			JWTSecret:     getEnv("AUTH_JWT_SECRET", ""),
+			JWKSFile:      getEnv("AUTH_JWKS_FILE", ""),
+			JWTIssuer:     getEnv("AUTH_JWT_ISSUER", ""),
+			JWTAudience:   getEnv("AUTH_JWT_AUDIENCE", ""),
+			AdminRole:     getEnv("AUTH_ADMIN_ROLE", "admin"),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("TRACING_EXPORTER", ""),
+			File:        getEnv("TRACING_FILE", ""),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "aiservice"),
+			SampleRatio: getFloatEnv("TRACING_SAMPLE_RATIO", 1),
+		},
+		Routing: RoutingConfig{
+			TenantRegions: getPairsEnv("ROUTING_TENANT_REGIONS"),
+			DefaultRegion: getEnv("ROUTING_DEFAULT_REGION", ""),
+		},
 	}
 }
 
@@ -159,3 +343,47 @@ func getDurationEnv(key string, def time.Duration) time.Duration {
 	}
 	return def
 }
+
+func getFloatEnv(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// getPricesEnv parses "name=price" pairs separated by commas, skipping malformed ones
+func getPricesEnv(key string) map[string]float64 {
+	prices := make(map[string]float64)
+	for name, value := range getPairsEnv(key) {
+		if price, err := strconv.ParseFloat(value, 64); err == nil {
+			prices[name] = price
+		}
+	}
+	return prices
+}
+
+// getListEnv reads a comma separated list, empty items are skipped
+func getListEnv(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getPairsEnv reads "name=value,name=value" pairs, values may contain "="
+func getPairsEnv(key string) map[string]string {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		pairs[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return pairs
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/services/quota"
+	"github.com/labstack/echo/v4"
+)
+
+type QuotaHandler struct {
+	quota *quota.Service
+}
+
+func NewQuotaHandler(quotaService *quota.Service) *QuotaHandler {
+	return &QuotaHandler{quota: quotaService}
+}
+
+// ListQuotas lists the users and tenants with custom limits
+// @Summary List custom quota limits
+// @Description List every user and tenant whose limits were set through the admin API; everyone else gets the configured defaults.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Success 200 {array} models.QuotaLimits
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/quotas [get]
+func (h *QuotaHandler) ListQuotas(c echo.Context) error {
+	limits, err := h.quota.ListLimits(c.Request().Context())
+	if err != nil {
+		return internalError("failed to list quotas", err)
+	}
+	if limits == nil {
+		limits = []models.QuotaLimits{}
+	}
+	return c.JSON(http.StatusOK, limits)
+}
+
+// GetQuota returns the limits and current usage of a user or tenant
+// @Summary Get a quota
+// @Description Get the limits of a user or tenant, custom or defaults, along with its usage this minute and today (UTC).
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param scope path string true "Quota scope" Enums(user, tenant)
+// @Param subjectId path string true "User or tenant ID"
+// @Success 200 {object} models.QuotaStatus
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/quotas/{scope}/{subjectId} [get]
+func (h *QuotaHandler) GetQuota(c echo.Context) error {
+	subject, err := quotaSubject(c)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	status, err := h.quota.Status(c.Request().Context(), subject)
+	if err != nil {
+		return internalError("failed to get quota", err)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// SetQuota replaces the limits of a user or tenant
+// @Summary Set a quota
+// @Description Set custom limits for a user or tenant, replacing the configured defaults. A zero limit means unlimited.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param scope path string true "Quota scope" Enums(user, tenant)
+// @Param subjectId path string true "User or tenant ID"
+// @Param limits body models.QuotaLimits true "New limits, scope and subjectId are taken from the path"
+// @Success 200 {object} models.QuotaLimits
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/quotas/{scope}/{subjectId} [put]
+func (h *QuotaHandler) SetQuota(c echo.Context) error {
+	subject, err := quotaSubject(c)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	var limits models.QuotaLimits
+	if err := c.Bind(&limits); err != nil {
+		return bindError(err)
+	}
+	// The subject comes from the path, whatever the body says
+	limits.Scope, limits.SubjectID = subject.Scope, subject.ID
+
+	saved, err := h.quota.SetLimits(c.Request().Context(), limits)
+	if err != nil {
+		if errors.Is(err, quota.ErrInvalidLimits) {
+			return badRequest(err)
+		}
+		return internalError("failed to set quota", err)
+	}
+	return c.JSON(http.StatusOK, saved)
+}
+
+// ResetQuota restores the default limits of a user or tenant
+// @Summary Reset a quota
+// @Description Delete the custom limits of a user or tenant so the configured defaults apply again. Usage counters are kept.
+// @Tags Admin
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param scope path string true "Quota scope" Enums(user, tenant)
+// @Param subjectId path string true "User or tenant ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/quotas/{scope}/{subjectId} [delete]
+func (h *QuotaHandler) ResetQuota(c echo.Context) error {
+	subject, err := quotaSubject(c)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	if err := h.quota.ResetLimits(c.Request().Context(), subject); err != nil {
+		return internalError("failed to reset quota", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// quotaSubject reads the :scope and :subjectId path parameters
+func quotaSubject(c echo.Context) (models.QuotaSubject, error) {
+	subject := models.QuotaSubject{Scope: models.QuotaScope(c.Param("scope")), ID: c.Param("subjectId")}
+	if !subject.Scope.Valid() {
+		return subject, fmt.Errorf("unknown scope %q, expected user or tenant", subject.Scope)
+	}
+	if strings.TrimSpace(subject.ID) == "" {
+		return subject, fmt.Errorf("subjectId is empty")
+	}
+	return subject, nil
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aiservice/internal/auth"
+	"github.com/aiservice/internal/models"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeyHeader carries the API key of service-to-service calls, which may
+// also send it as a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// accessTokenParam carries the credentials of WebSocket handshakes, browsers
+// cannot set headers on them
+const accessTokenParam = "access_token"
+
+// Authenticate identifies the caller of a request and records it in the
+// request context. Callers without credentials are let through anonymously
+// unless authentication is required.
+func Authenticate(authenticator *auth.Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !authenticator.Enabled() {
+				return next(c)
+			}
+
+			r := c.Request()
+			bearer, ok := strings.CutPrefix(r.Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok {
+				bearer = ""
+			}
+			if bearer == "" && websocket.IsWebSocketUpgrade(r) {
+				bearer = c.QueryParam(accessTokenParam)
+			}
+
+			principal, err := authenticator.Authenticate(r.Header.Get(APIKeyHeader), bearer)
+			if errors.Is(err, auth.ErrNoCredentials) && !authenticator.Required() {
+				return next(c)
+			}
+			if err != nil {
+				slog.Warn("authentication failed", "path", r.URL.Path, "err", err)
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return newAPIError(http.StatusUnauthorized, models.ErrorCodeUnauthorized, err.Error())
+			}
+
+			c.SetRequest(r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+			return next(c)
+		}
+	}
+}
+
+// bindPrincipal ties the user and tenant of a request to its authenticated
+// caller, so its quotas cannot be dodged by changing the body. Empty fields
+// are filled in and fields naming someone else are rejected. Admins may act
+// for any user, and the body is trusted as is when the API is open.
+func bindPrincipal(ctx context.Context, userID, tenantID *string) error {
+	principal, ok := auth.FromContext(ctx)
+	if !ok || principal.Admin {
+		return nil
+	}
+	if *userID != "" && *userID != principal.ID {
+		return invalidField("userId", models.FieldErrorInvalid, "userId must be empty or %q, the authenticated caller", principal.ID)
+	}
+	if *tenantID != "" && *tenantID != principal.Tenant {
+		return invalidField("tenantId", models.FieldErrorInvalid, "tenantId must be empty or the tenant of the authenticated caller")
+	}
+	*userID, *tenantID = principal.ID, principal.Tenant
+	return nil
+}
+
+// RequireAdmin only lets through admin principals, it runs after Authenticate
+func RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, ok := auth.FromContext(c.Request().Context())
+		if !ok {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+			return newAPIError(http.StatusUnauthorized, models.ErrorCodeUnauthorized, "admin credentials required")
+		}
+		if !principal.Admin {
+			return newAPIError(http.StatusForbidden, models.ErrorCodeForbidden, "admin role required")
+		}
+		return next(c)
+	}
+}
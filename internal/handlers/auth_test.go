@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aiservice/internal/auth"
+	"github.com/aiservice/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindPrincipal(t *testing.T) {
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{ID: "alice", Tenant: "acme"})
+	admin := auth.WithPrincipal(context.Background(), auth.Principal{ID: "ops", Admin: true})
+
+	tests := []struct {
+		name             string
+		ctx              context.Context
+		userID, tenantID string
+		wantUser         string
+		wantTenant       string
+		wantField        string
+	}{
+		{"anonymous trusts the body", context.Background(), "bob", "globex", "bob", "globex", ""},
+		{"filled from the principal", alice, "", "", "alice", "acme", ""},
+		{"matching body", alice, "alice", "acme", "alice", "acme", ""},
+		{"other user", alice, "bob", "", "", "", "userId"},
+		{"other tenant", alice, "", "globex", "", "", "tenantId"},
+		{"admin acts for anyone", admin, "bob", "globex", "bob", "globex", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, tenantID := tt.userID, tt.tenantID
+			err := bindPrincipal(tt.ctx, &userID, &tenantID)
+			if tt.wantField != "" {
+				var fieldErr *models.FieldError
+				require.ErrorAs(t, err, &fieldErr)
+				require.Equal(t, tt.wantField, fieldErr.Field)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantUser, userID)
+			require.Equal(t, tt.wantTenant, tenantID)
+		})
+	}
+}
+
+func TestBindBatchPrincipal(t *testing.T) {
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{ID: "alice"})
+	req := models.BatchRequest{Items: []models.BatchItem{
+		{Summarize: &models.SummarizeRequest{}},
+		{Structurize: &models.StructurizeRequest{UserID: "bob"}},
+	}}
+
+	err := bindBatchPrincipal(alice, req)
+	var fieldErr *models.FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	require.Equal(t, "items[1].structurize.userId", fieldErr.Field)
+	require.Equal(t, "alice", req.Items[0].Summarize.UserID)
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/aiservice/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultMaxBatchItems bounds a batch until SetMaxBatchItems is called
+const defaultMaxBatchItems = 100
+
+// SetMaxBatchItems bounds the number of requests in one POST /batches
+func (h *AnalyzeHandler) SetMaxBatchItems(n int) {
+	if n > 0 {
+		h.maxBatchItems = n
+	}
+}
+
+// bindBatchPrincipal ties every item of a batch to the authenticated caller,
+// see bindPrincipal
+func bindBatchPrincipal(ctx context.Context, req models.BatchRequest) error {
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		var err error
+		switch {
+		case item.Summarize != nil:
+			field += ".summarize"
+			err = bindPrincipal(ctx, &item.Summarize.UserID, &item.Summarize.TenantID)
+		case item.Structurize != nil:
+			field += ".structurize"
+			err = bindPrincipal(ctx, &item.Structurize.UserID, &item.Structurize.TenantID)
+		}
+
+		var fieldErr *models.FieldError
+		if errors.As(err, &fieldErr) {
+			return invalidField(field+"."+fieldErr.Field, fieldErr.Code, "%s", fieldErr.Message)
+		}
+	}
+	return nil
+}
+
+// validateBatchRequest validates every item like a single request, the
+// offending field is reported with its item path, e.g. items[2].summarize.userId
+func validateBatchRequest(req models.BatchRequest, maxItems int) error {
+	if len(req.Items) == 0 {
+		return invalidField("items", models.FieldErrorRequired, "batch has no items")
+	}
+	if len(req.Items) > maxItems {
+		return invalidField("items", models.FieldErrorTooMany, "too many items in batch, maximum allowed is %d", maxItems)
+	}
+
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		var err error
+		switch {
+		case item.Summarize != nil && item.Structurize == nil:
+			field += ".summarize"
+			err = validateSummarizeRequest(*item.Summarize)
+		case item.Structurize != nil && item.Summarize == nil:
+			field += ".structurize"
+			err = validateStructurizeRequest(*item.Structurize)
+		default:
+			return invalidField(field, models.FieldErrorInvalid, "item must hold exactly one of summarize or structurize")
+		}
+
+		var fieldErr *models.FieldError
+		if errors.As(err, &fieldErr) {
+			return invalidField(field+"."+fieldErr.Field, fieldErr.Code, "%s", fieldErr.Message)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateBatch queues a job for every request of a batch
+// @Summary Submit a batch
+// @Description Queue one summarize or structurize job per item, linked to a new batch. Items are validated like POST /summarize and POST /structurize and always run asynchronously.
+// @Description The batch is accepted or rejected as a whole; every item counts against the concurrent jobs quota of its user. Follow the batch with GET /batches/{id}.
+// @Tags Batches
+// @Accept json
+// @Produce json
+// @Param request body models.BatchRequest true "Batch Request"
+// @Param X-Region header string false "Region of the items that have no region field, e.g. RU"
+// @Success 202 {object} models.BatchResponse
+// @Header 202 {string} Location "URL of the batch"
+// @Failure 400 {object} models.ErrorResponse "invalid_request, or validation_failed with the offending field in details"
+// @Failure 429 {object} models.ErrorResponse "A quota is exceeded, see the Retry-After header"
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /batches [post]
+func (h *AnalyzeHandler) CreateBatch(c echo.Context) error {
+	var req models.BatchRequest
+	if err := c.Bind(&req); err != nil {
+		slog.Error("bind error:", "err", err)
+		return bindError(err)
+	}
+
+	if err := bindBatchPrincipal(c.Request().Context(), req); err != nil {
+		return validationError(err)
+	}
+	if err := validateBatchRequest(req, h.maxBatchItems); err != nil {
+		slog.Error("validation error:", "err", err)
+		return validationError(err)
+	}
+	// Items without a region field are in the region of the header
+	if err := validateRegion(parseRegion(c, "")); err != nil {
+		return validationError(err)
+	}
+
+	ctx := c.Request().Context()
+	reqs := make([]models.AnalyzeRequest, 0, len(req.Items))
+	counted := make(map[[2]string]bool)
+	for _, item := range req.Items {
+		r := item.AnalyzeRequest()
+		r.SetRegion(parseRegion(c, r.Region()))
+		// A batch is a single request for each of its users and tenants
+		if key := [2]string{r.UserID(), r.TenantID()}; !counted[key] {
+			if err := h.service.AllowRequest(ctx, r.UserID(), r.TenantID()); err != nil {
+				return startJobError(c, err)
+			}
+			counted[key] = true
+		}
+
+		switch r.RequestType {
+		case models.StructurizeType:
+			r.StructurizeRequest.Board.ImageURL = h.inlineBoardImage(ctx, r.StructurizeRequest.Board.ImageURL)
+		default:
+			r.SummarizeRequest.Board.ImageURL = h.inlineBoardImage(ctx, r.SummarizeRequest.Board.ImageURL)
+		}
+		reqs = append(reqs, r)
+	}
+
+	batch, jobs, err := h.service.SubmitBatch(ctx, reqs)
+	if err != nil {
+		return startJobError(c, err)
+	}
+	slog.Info("batch queued", "batchID", batch.ID, "jobs", len(jobs))
+
+	c.Response().Header().Set(echo.HeaderLocation, "/batches/"+batch.ID)
+	return c.JSON(http.StatusAccepted, models.NewBatchResponse(batch, jobs))
+}
+
+// GetBatch reports the progress of a batch
+// @Summary Get batch status
+// @Description Get the aggregate progress of a batch and the job of every item in submission order, with their results once completed.
+// @Description The batch is pending until an item starts, running until every item finished, then aborted, failed or completed.
+// @Description Batches submitted by another principal are reported as not found, except to admins.
+// @Tags Batches
+// @Accept json
+// @Produce json
+// @Param id path string true "Batch ID"
+// @Success 200 {object} models.BatchResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /batches/{id} [get]
+func (h *AnalyzeHandler) GetBatch(c echo.Context) error {
+	batchID := c.Param("id")
+	batch, jobs, err := h.service.GetBatch(c.Request().Context(), batchID)
+	if err != nil {
+		return batchError(batchID, err, "failed to get batch")
+	}
+	return c.JSON(http.StatusOK, models.NewBatchResponse(batch, jobs))
+}
+
+// AbortBatch aborts the unfinished jobs of a batch
+// @Summary Abort a batch
+// @Description Abort every pending or running job of a batch, as PUT /jobs/{id}/abort does. Finished items keep their results.
+// @Tags Batches
+// @Accept json
+// @Produce json
+// @Param id path string true "Batch ID"
+// @Success 200 {object} models.BatchResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /batches/{id}/abort [put]
+func (h *AnalyzeHandler) AbortBatch(c echo.Context) error {
+	batchID := c.Param("id")
+	ctx := c.Request().Context()
+	if err := h.service.AbortBatch(ctx, batchID); err != nil {
+		return batchError(batchID, err, "failed to abort batch")
+	}
+	batch, jobs, err := h.service.GetBatch(ctx, batchID)
+	if err != nil {
+		return batchError(batchID, err, "failed to get batch")
+	}
+	return c.JSON(http.StatusOK, models.NewBatchResponse(batch, jobs))
+}
+
+// batchError maps the error of a call on an existing batch to a response
+func batchError(batchID string, err error, message string) error {
+	if errors.Is(err, models.ErrBatchNotFound) {
+		return &APIError{
+			Status:  http.StatusNotFound,
+			Code:    models.ErrorCodeNotFound,
+			Message: fmt.Sprintf("batch %s not found", batchID),
+			Err:     err,
+		}
+	}
+	return internalError(message, err)
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/utils"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// boardWriteTimeout bounds every write to a board session connection
+const boardWriteTimeout = 10 * time.Second
+
+// SetWebSocketConfig configures board sessions. Browsers may only connect from
+// allowedOrigins ("*" allows any), without them only same-origin pages may.
+func (h *AnalyzeHandler) SetWebSocketConfig(cfg config.WebSocketConfig, allowedOrigins []string) {
+	h.socket = cfg
+	h.allowedOrigins = allowedOrigins
+}
+
+// BoardSession serves an interactive WebSocket session for one open board
+// @Summary Board session
+// @Description Upgrade to a WebSocket that submits and follows the jobs of one board. Client messages are JSON models.BoardClientMessage:
+// @Description "summarize" and "structurize" queue the request in the matching field (its board ID defaults to the path one) and are answered
+// @Description with "accepted" and the job ID, then every progress event of the job is sent as an "event" message (see GET /jobs/{id}/events).
+// @Description "cancel" aborts a job submitted on the same connection. Rejected messages are answered with "error", an error code and the client's requestId.
+// @Description At most WS_MAX_JOBS_PER_CONNECTION jobs may be unfinished at once. Jobs still unfinished when the connection closes are aborted.
+// @Tags Boards
+// @Param boardId path string true "Board ID"
+// @Param access_token query string false "API key or JWT, for browsers that cannot set the Authorization header on the handshake"
+// @Success 101 {object} models.BoardServerMessage
+// @Failure 400 {object} models.ErrorResponse "Not a WebSocket handshake"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Origin not allowed"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /boards/{boardId}/session [get]
+func (h *AnalyzeHandler) BoardSession(c echo.Context) error {
+	boardID := c.Param("boardId")
+
+	upgrader := websocket.Upgrader{
+		// Failed handshakes are answered with the usual error response
+		Error: func(_ http.ResponseWriter, _ *http.Request, status int, reason error) {
+			ErrorHandler(echo.NewHTTPError(status, reason.Error()), c)
+		},
+	}
+	if len(h.allowedOrigins) > 0 {
+		upgrader.CheckOrigin = h.checkOrigin
+	}
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// Upgrade has already answered with an HTTP error
+		slog.Warn("failed to upgrade board session", "boardId", boardID, "err", err)
+		return nil
+	}
+
+	slog.Info("board session opened", "boardId", boardID)
+	newBoardSession(h, conn, boardID).run(c.Request().Context())
+	slog.Info("board session closed", "boardId", boardID)
+	return nil
+}
+
+// checkOrigin accepts clients without an Origin header, which are not browsers
+func (h *AnalyzeHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get(echo.HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range h.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// boardSession is one board WebSocket connection. Only writeLoop writes
+// messages to the connection. Everything else queues them on out, which
+// blocks when the client falls behind. A blocked job forwarder is then
+// dropped by the event bus and catches up from the bus history. A blocked
+// read loop stops reading the client's submissions.
+type boardSession struct {
+	h       *AnalyzeHandler
+	conn    *websocket.Conn
+	boardID string
+	cfg     config.WebSocketConfig
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	out        chan models.BoardServerMessage
+	writerDone chan struct{}
+	forwarders sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]struct{} // unfinished jobs submitted on this connection
+}
+
+func newBoardSession(h *AnalyzeHandler, conn *websocket.Conn, boardID string) *boardSession {
+	cfg := h.socket
+	if cfg.MaxJobsPerConnection <= 0 {
+		cfg.MaxJobsPerConnection = 8
+	}
+	if cfg.SendBuffer <= 0 {
+		cfg.SendBuffer = 64
+	}
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = 16 << 20
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = 30 * time.Second
+	}
+	return &boardSession{
+		h:          h,
+		conn:       conn,
+		boardID:    boardID,
+		cfg:        cfg,
+		out:        make(chan models.BoardServerMessage, cfg.SendBuffer),
+		writerDone: make(chan struct{}),
+		jobs:       make(map[string]struct{}),
+	}
+}
+
+// run serves the session until the connection closes, then aborts the jobs
+// of the connection that are still in progress
+func (s *boardSession) run(parent context.Context) {
+	s.ctx, s.cancel = context.WithCancel(parent)
+	go s.writeLoop()
+
+	s.readLoop()
+	s.cancel()
+	s.forwarders.Wait()
+	<-s.writerDone
+
+	// Nobody is left to receive the results
+	ctx := context.WithoutCancel(parent)
+	for _, jobID := range s.unfinishedJobs() {
+		if err := s.h.service.Abort(ctx, jobID); err != nil {
+			slog.Error("failed to abort board session job", "boardId", s.boardID, "jobID", jobID, "err", err)
+			continue
+		}
+		slog.Info("aborted board session job", "boardId", s.boardID, "jobID", jobID)
+	}
+}
+
+// readLoop handles client messages until the connection fails or closes
+func (s *boardSession) readLoop() {
+	pongWait := 2 * s.cfg.PingInterval
+	s.conn.SetReadLimit(s.cfg.MaxMessageSize)
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && s.ctx.Err() == nil {
+				slog.Warn("board session read error", "boardId", s.boardID, "err", err)
+			}
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var msg models.BoardClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.replyError("", models.ErrorCodeInvalidRequest, fmt.Sprintf("failed to parse message: %v", err))
+			continue
+		}
+		switch msg.Type {
+		case models.BoardMessageSummarize, models.BoardMessageStructurize:
+			s.submit(msg)
+		case models.BoardMessageCancel:
+			s.cancelJob(msg)
+		default:
+			s.replyError(msg.RequestID, models.ErrorCodeInvalidRequest, fmt.Sprintf("unknown message type %q", msg.Type))
+		}
+	}
+}
+
+// writeLoop writes queued messages and keep-alive pings until the session
+// ends, closing the connection on its way out
+func (s *boardSession) writeLoop() {
+	defer close(s.writerDone)
+	defer s.conn.Close()
+
+	ping := time.NewTicker(s.cfg.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			_ = s.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(boardWriteTimeout))
+			return
+		case msg := <-s.out:
+			s.conn.SetWriteDeadline(time.Now().Add(boardWriteTimeout))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				slog.Warn("board session write error", "boardId", s.boardID, "err", err)
+				s.cancel()
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(boardWriteTimeout)); err != nil {
+				s.cancel()
+				return
+			}
+		}
+	}
+}
+
+// submit queues an analysis request and starts forwarding its events
+func (s *boardSession) submit(msg models.BoardClientMessage) {
+	if s.unfinishedCount() >= s.cfg.MaxJobsPerConnection {
+		s.replyError(msg.RequestID, models.ErrorCodeTooManyJobs, fmt.Sprintf("too many jobs in progress, at most %d per connection", s.cfg.MaxJobsPerConnection))
+		return
+	}
+
+	req, err := s.analyzeRequest(msg)
+	if err != nil {
+		code := models.ErrorCodeInvalidRequest
+		if _, ok := utils.MapErr[*models.FieldError](err); ok {
+			code = models.ErrorCodeValidationFailed
+		}
+		s.replyError(msg.RequestID, code, fmt.Sprintf("invalid request data: %v", err))
+		return
+	}
+	if err := s.h.service.AllowRequest(s.ctx, req.UserID(), req.TenantID()); err != nil {
+		s.submitError(msg.RequestID, err)
+		return
+	}
+	job, err := s.h.service.SubmitJob(s.ctx, req)
+	if err != nil {
+		s.submitError(msg.RequestID, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.jobs[job.ID] = struct{}{}
+	s.mu.Unlock()
+
+	// Queued ahead of the job's events, which replay from the start of its history
+	s.send(models.BoardServerMessage{Type: models.BoardMessageAccepted, RequestID: msg.RequestID, JobID: job.ID})
+	s.forwarders.Add(1)
+	go s.forward(job.ID)
+}
+
+// submitError reports a submission that could not be queued, rejections
+// such as quotas are the client's to handle and not logged as failures
+func (s *boardSession) submitError(requestID string, err error) {
+	apiErr := startError(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		slog.Error("failed to submit board session job", "boardId", s.boardID, "err", err)
+	}
+	s.replyError(requestID, apiErr.Code, apiErr.Message)
+}
+
+// analyzeRequest validates the request payload of a submission for this board
+func (s *boardSession) analyzeRequest(msg models.BoardClientMessage) (models.AnalyzeRequest, error) {
+	switch msg.Type {
+	case models.BoardMessageSummarize:
+		if msg.Summarize == nil {
+			return models.AnalyzeRequest{}, fmt.Errorf("summarize is empty")
+		}
+		req := *msg.Summarize
+		if err := s.checkBoard(&req.Board); err != nil {
+			return models.AnalyzeRequest{}, err
+		}
+		if err := bindPrincipal(s.ctx, &req.UserID, &req.TenantID); err != nil {
+			return models.AnalyzeRequest{}, err
+		}
+		if err := validateSummarizeRequest(req); err != nil {
+			return models.AnalyzeRequest{}, err
+		}
+		req.Board.ImageURL = s.h.inlineBoardImage(s.ctx, req.Board.ImageURL)
+		return models.NewSumAnalyzeReq(req), nil
+	default:
+		if msg.Structurize == nil {
+			return models.AnalyzeRequest{}, fmt.Errorf("structurize is empty")
+		}
+		req := *msg.Structurize
+		if err := s.checkBoard(&req.Board); err != nil {
+			return models.AnalyzeRequest{}, err
+		}
+		if err := bindPrincipal(s.ctx, &req.UserID, &req.TenantID); err != nil {
+			return models.AnalyzeRequest{}, err
+		}
+		if err := validateStructurizeRequest(req); err != nil {
+			return models.AnalyzeRequest{}, err
+		}
+		req.Board.ImageURL = s.h.inlineBoardImage(s.ctx, req.Board.ImageURL)
+		return models.NewStructAnalyzeReq(req), nil
+	}
+}
+
+// checkBoard defaults the board ID to the session's and rejects other boards
+func (s *boardSession) checkBoard(board *models.Board) error {
+	if board.BoardID == "" {
+		board.BoardID = s.boardID
+	}
+	if board.BoardID != s.boardID {
+		return fmt.Errorf("board %s does not belong to this session", board.BoardID)
+	}
+	return nil
+}
+
+// cancelJob aborts a job submitted on this connection
+func (s *boardSession) cancelJob(msg models.BoardClientMessage) {
+	s.mu.Lock()
+	_, ok := s.jobs[msg.JobID]
+	s.mu.Unlock()
+	if !ok {
+		s.replyError(msg.RequestID, models.ErrorCodeNotFound, fmt.Sprintf("job %q is not in progress on this connection", msg.JobID))
+		return
+	}
+
+	if err := s.h.service.Abort(s.ctx, msg.JobID); err != nil {
+		slog.Error("failed to abort board session job", "boardId", s.boardID, "jobID", msg.JobID, "err", err)
+		s.replyError(msg.RequestID, models.ErrorCodeInternal, "failed to abort job")
+		return
+	}
+	// The aborted status and result follow as events
+	s.send(models.BoardServerMessage{Type: models.BoardMessageCancelled, RequestID: msg.RequestID, JobID: msg.JobID})
+}
+
+// forward sends the events of a job until it finishes or the session ends
+func (s *boardSession) forward(jobID string) {
+	defer s.forwarders.Done()
+	// The job stops counting against the session once it finished or can no
+	// longer be followed, unless the session ended first and run is to abort it
+	var err error
+	defer func() {
+		if err != nil && s.ctx.Err() != nil {
+			return
+		}
+		s.mu.Lock()
+		delete(s.jobs, jobID)
+		s.mu.Unlock()
+	}()
+
+	send := func(event models.JobEvent) error {
+		if !s.send(models.BoardServerMessage{Type: models.BoardMessageEvent, JobID: jobID, Event: &event}) {
+			return s.ctx.Err()
+		}
+		return nil
+	}
+	if err = s.h.followJob(s.ctx, jobID, 0, send, nil); err != nil {
+		if s.ctx.Err() == nil {
+			slog.Error("failed to follow board session job", "boardId", s.boardID, "jobID", jobID, "err", err)
+			s.send(models.BoardServerMessage{Type: models.BoardMessageError, JobID: jobID, Code: models.ErrorCodeInternal, Error: "failed to follow job"})
+		}
+	}
+}
+
+// send queues a message for the client, waiting while the buffer is full.
+// It reports false once the session has ended.
+func (s *boardSession) send(msg models.BoardServerMessage) bool {
+	select {
+	case s.out <- msg:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+func (s *boardSession) replyError(requestID string, code models.ErrorCode, message string) {
+	s.send(models.BoardServerMessage{Type: models.BoardMessageError, RequestID: requestID, Code: code, Error: message})
+}
+
+func (s *boardSession) unfinishedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.jobs)
+}
+
+func (s *boardSession) unfinishedJobs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobIDs := make([]string, 0, len(s.jobs))
+	for jobID := range s.jobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	return jobIDs
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/aiservice/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// APIError is an error response, handlers return it and ErrorHandler renders
+// it as a models.ErrorResponse
+type APIError struct {
+	Status  int
+	Code    models.ErrorCode
+	Message string
+	Details any
+	Err     error // cause, logged but never sent to the client
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError returns an error response whose message is sent as is
+func newAPIError(status int, code models.ErrorCode, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// badRequest reports a malformed request
+func badRequest(err error) *APIError {
+	return newAPIError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, err.Error())
+}
+
+// bindError reports a request body echo could not bind, without the
+// internal details echo adds to its message
+func bindError(err error) *APIError {
+	message := err.Error()
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		message = fmt.Sprint(httpErr.Message)
+	}
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Code:    models.ErrorCodeInvalidRequest,
+		Message: fmt.Sprintf("failed to parse request: %s", message),
+		Err:     err,
+	}
+}
+
+// notFound reports an unknown job, or one the caller may not see
+func notFound(jobID string, err error) *APIError {
+	return &APIError{
+		Status:  http.StatusNotFound,
+		Code:    models.ErrorCodeNotFound,
+		Message: fmt.Sprintf("job %s not found", jobID),
+		Err:     err,
+	}
+}
+
+// internalError hides the cause of a server failure from the client
+func internalError(message string, err error) *APIError {
+	return &APIError{Status: http.StatusInternalServerError, Code: models.ErrorCodeInternal, Message: message, Err: err}
+}
+
+// validationError reports a request rejected by validateSummarizeRequest or
+// validateStructurizeRequest, listing the offending field in the details
+func validationError(err error) *APIError {
+	var field *models.FieldError
+	if !errors.As(err, &field) {
+		return newAPIError(http.StatusBadRequest, models.ErrorCodeValidationFailed, err.Error())
+	}
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Code:    models.ErrorCodeValidationFailed,
+		Message: fmt.Sprintf("invalid request data: %s", field.Message),
+		Details: []models.FieldError{*field},
+	}
+}
+
+// invalidField returns the validation error of a request field
+func invalidField(field, code, format string, args ...any) *models.FieldError {
+	return &models.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// echoErrorCodes maps the statuses of echo's own errors, e.g. for unknown
+// routes or oversized bodies
+var echoErrorCodes = map[int]models.ErrorCode{
+	http.StatusBadRequest:            models.ErrorCodeInvalidRequest,
+	http.StatusUnauthorized:          models.ErrorCodeUnauthorized,
+	http.StatusForbidden:             models.ErrorCodeForbidden,
+	http.StatusNotFound:              models.ErrorCodeNotFound,
+	http.StatusMethodNotAllowed:      models.ErrorCodeMethodNotAllowed,
+	http.StatusRequestEntityTooLarge: models.ErrorCodeRequestTooLarge,
+	http.StatusUnsupportedMediaType:  models.ErrorCodeInvalidRequest,
+}
+
+// toAPIError classifies an error returned by a handler or middleware
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		code, ok := echoErrorCodes[httpErr.Code]
+		if !ok {
+			return internalError(http.StatusText(http.StatusInternalServerError), err)
+		}
+		message := http.StatusText(httpErr.Code)
+		if m, ok := httpErr.Message.(string); ok {
+			message = m
+		}
+		return &APIError{Status: httpErr.Code, Code: code, Message: message, Err: httpErr.Internal}
+	}
+
+	return internalError(http.StatusText(http.StatusInternalServerError), err)
+}
+
+// ErrorHandler is the echo HTTPErrorHandler, it renders every error returned
+// by a handler or middleware as a models.ErrorResponse
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	apiErr := toAPIError(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		slog.Error("request failed", "method", c.Request().Method, "path", c.Path(), "err", err)
+	}
+
+	body := models.ErrorResponse{Error: models.ErrorBody{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		Details:   apiErr.Details,
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}}
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(apiErr.Status)
+	} else {
+		err = c.JSON(apiErr.Status, body)
+	}
+	if err != nil {
+		slog.Error("failed to write error response", "err", err)
+	}
+}
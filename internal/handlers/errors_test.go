@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aiservice/internal/models"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    models.ErrorCode
+		message string
+	}{
+		{"api error", notFound("job-1", models.ErrJobNotFound), http.StatusNotFound, models.ErrorCodeNotFound, "job job-1 not found"},
+		{"wrapped api error", fmt.Errorf("wrapped: %w", badRequest(errors.New("bad cursor"))), http.StatusBadRequest, models.ErrorCodeInvalidRequest, "bad cursor"},
+		{"echo error", echo.ErrNotFound, http.StatusNotFound, models.ErrorCodeNotFound, "Not Found"},
+		{"echo error with message", echo.NewHTTPError(http.StatusRequestEntityTooLarge, "body too large"), http.StatusRequestEntityTooLarge, models.ErrorCodeRequestTooLarge, "body too large"},
+		{"unmapped echo error", echo.NewHTTPError(http.StatusTeapot), http.StatusInternalServerError, models.ErrorCodeInternal, "Internal Server Error"},
+		{"plain error", errors.New("database is down"), http.StatusInternalServerError, models.ErrorCodeInternal, "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := toAPIError(tt.err)
+			require.Equal(t, tt.status, apiErr.Status)
+			require.Equal(t, tt.code, apiErr.Code)
+			require.Equal(t, tt.message, apiErr.Message)
+		})
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		status int
+		body   *models.ErrorBody
+	}{
+		{
+			name:   "api error",
+			method: http.MethodPost,
+			err:    newAPIError(http.StatusConflict, models.ErrorCodeIdempotencyKeyInProgress, "in progress"),
+			status: http.StatusConflict,
+			body:   &models.ErrorBody{Code: models.ErrorCodeIdempotencyKeyInProgress, Message: "in progress", RequestID: "req-1"},
+		},
+		{
+			name:   "internal error hides its cause",
+			method: http.MethodGet,
+			err:    errors.New("connection refused"),
+			status: http.StatusInternalServerError,
+			body:   &models.ErrorBody{Code: models.ErrorCodeInternal, Message: "Internal Server Error", RequestID: "req-1"},
+		},
+		{
+			name:   "head request has no body",
+			method: http.MethodHead,
+			err:    echo.ErrNotFound,
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(tt.method, "/jobs/job-1", nil), rec)
+			c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+
+			ErrorHandler(tt.err, c)
+
+			require.Equal(t, tt.status, rec.Code)
+			if tt.body == nil {
+				require.Empty(t, rec.Body.Bytes())
+				return
+			}
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			require.Equal(t, *tt.body, resp.Error)
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	field := invalidField("board.elements[3].id", models.FieldErrorRequired, "element ID cannot be empty")
+
+	tests := []struct {
+		name    string
+		err     error
+		message string
+		details any
+	}{
+		{"field error", field, "invalid request data: element ID cannot be empty", []models.FieldError{*field}},
+		{"wrapped field error", fmt.Errorf("item 2: %w", field), "invalid request data: element ID cannot be empty", []models.FieldError{*field}},
+		{"plain error", errors.New("board is empty"), "board is empty", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := validationError(tt.err)
+			require.Equal(t, http.StatusBadRequest, apiErr.Status)
+			require.Equal(t, models.ErrorCodeValidationFailed, apiErr.Code)
+			require.Equal(t, tt.message, apiErr.Message)
+			require.Equal(t, tt.details, apiErr.Details)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aiservice/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// LastEventIDHeader carries the id of the last event a reconnecting client received
+const LastEventIDHeader = "Last-Event-ID"
+
+const (
+	// eventPollInterval is how often a stream re-reads the stored job, which
+	// catches transitions made by other replicas that never reach this event bus
+	eventPollInterval = 2 * time.Second
+	// eventKeepAliveInterval keeps idle streams open through proxies
+	eventKeepAliveInterval = 15 * time.Second
+)
+
+// StreamJobEvents streams the progress of a job as Server-Sent Events
+// @Summary Stream job events
+// @Description Stream the progress of a job as Server-Sent Events: status transitions (event "status"), retry attempts ("retry"),
+// @Description the LLM provider being tried ("provider") and finally the result or failure reason ("result"), after which the stream ends.
+// @Description Each event carries its sequence number as the SSE id; reconnect with the Last-Event-ID header to resume after it.
+// @Description Events without an id are snapshots of the stored job, sent when no live events are known for it, e.g. it runs on another replica.
+// @Tags Jobs
+// @Produce text/event-stream
+// @Param id path string true "Job ID"
+// @Param Last-Event-ID header int false "Resume after this event"
+// @Success 200 {object} models.JobEvent
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /jobs/{id}/events [get]
+func (h *AnalyzeHandler) StreamJobEvents(c echo.Context) error {
+	ctx := c.Request().Context()
+	jobID := c.Param("id")
+
+	var lastEventID int64
+	if header := c.Request().Header.Get(LastEventIDHeader); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || id < 0 {
+			return newAPIError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Last-Event-ID must be a non-negative integer")
+		}
+		lastEventID = id
+	}
+
+	job, err := h.service.GetJob(ctx, jobID)
+	if err != nil {
+		return jobError(jobID, err, "failed to get job")
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event models.JobEvent) error {
+		return writeEvent(w, event)
+	}
+	keepAlive := func() error {
+		if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+	// The stream simply ends on errors, the response is already committed
+	_ = h.followJob(ctx, job.ID, lastEventID, send, keepAlive)
+	return nil
+}
+
+// followJob sends the events of a job after lastEventID until its final
+// event, send fails or ctx ends. Transitions not published on this process,
+// e.g. by another replica, are caught by polling the stored job. keepAlive,
+// when set, is called while the job stays idle.
+func (h *AnalyzeHandler) followJob(ctx context.Context, jobID string, lastEventID int64, send func(models.JobEvent) error, keepAlive func() error) error {
+	history, events, cancel, err := h.service.SubscribeJobEvents(jobID, lastEventID)
+	if err != nil {
+		return err
+	}
+	defer func() { cancel() }()
+
+	// lastStatus is the status the client knows about, snapshots are only sent when it is stale
+	var lastStatus models.JobStatus
+	deliver := func(event models.JobEvent) (done bool, err error) {
+		if event.Type == models.JobEventStatus || event.IsFinal() {
+			lastStatus = event.Status
+		}
+		if event.ID > 0 {
+			lastEventID = event.ID
+		}
+		return event.IsFinal(), send(event)
+	}
+	replay := func(history []models.JobEvent) (done bool, err error) {
+		for _, event := range history {
+			if done, err := deliver(event); err != nil || done {
+				return done, err
+			}
+		}
+		return false, nil
+	}
+
+	if done, err := replay(history); err != nil || done {
+		return err
+	}
+	if len(history) == 0 && lastEventID == 0 {
+		job, err := h.service.GetJob(ctx, jobID)
+		if err != nil {
+			return err
+		}
+		if done, err := sendSnapshot(deliver, job, lastStatus); err != nil || done {
+			return err
+		}
+	}
+
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+	var keepAliveC <-chan time.Time
+	if keepAlive != nil {
+		ticker := time.NewTicker(eventKeepAliveInterval)
+		defer ticker.Stop()
+		keepAliveC = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				// Dropped by the bus for falling behind, catch up from the last delivered event
+				cancel()
+				history, events, cancel, err = h.service.SubscribeJobEvents(jobID, lastEventID)
+				if err != nil {
+					return err
+				}
+				if done, err := replay(history); err != nil || done {
+					return err
+				}
+				continue
+			}
+			if done, err := deliver(event); err != nil || done {
+				return err
+			}
+		case <-poll.C:
+			job, err := h.service.GetJob(ctx, jobID)
+			if err != nil {
+				return err
+			}
+			if done, err := sendSnapshot(deliver, job, lastStatus); err != nil || done {
+				return err
+			}
+		case <-keepAliveC:
+			if err := keepAlive(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendSnapshot sends the stored state of a job when its status differs from
+// the one the client knows, done reports that the job is finished
+func sendSnapshot(deliver func(models.JobEvent) (bool, error), job models.Job, known models.JobStatus) (done bool, err error) {
+	if job.Status == known {
+		// A finished status seen on the bus is followed by its result event there
+		return false, nil
+	}
+
+	now := time.Now().Unix()
+	if _, err := deliver(models.JobEvent{JobID: job.ID, Type: models.JobEventStatus, Status: job.Status, Retry: job.Retries, CreatedAt: now}); err != nil {
+		return false, err
+	}
+	if !job.Status.IsFinished() {
+		return false, nil
+	}
+	return deliver(models.JobEvent{JobID: job.ID, Type: models.JobEventResult, Status: job.Status, Error: job.Error, Result: job.Result, CreatedAt: now})
+}
+
+// writeEvent writes one Server-Sent Event and flushes it to the client
+func writeEvent(w *echo.Response, event models.JobEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job event: %w", err)
+	}
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
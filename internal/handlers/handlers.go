@@ -1,21 +1,53 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/providers"
 	"github.com/aiservice/internal/s3"
 	analysis "github.com/aiservice/internal/services/analysis"
 	jobservice "github.com/aiservice/internal/services/jobService"
+	"github.com/aiservice/internal/services/quota"
+	"github.com/aiservice/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
+// IdempotencyKeyHeader lets clients safely retry POST /summarize and /structurize
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// Prefer lets clients choose between waiting for a response and getting a job
+// right away (RFC 7240), the honored preference is echoed in Preference-Applied
+const (
+	PreferHeader            = "Prefer"
+	PreferenceAppliedHeader = "Preference-Applied"
+)
+
+// RegionHeader names the region of a request that has no region field, only
+// the providers available in that region are tried
+const RegionHeader = "X-Region"
+
 type AnalyzeHandler struct {
 	service     *analysis.AnalysisService
 	jobQueue    *jobservice.JobQueueService
 	syncTimeout time.Duration
 	s3Client    *s3.YandexS3Client
+
+	socket         config.WebSocketConfig
+	allowedOrigins []string
+
+	maxBatchItems int
 }
 
 func NewAnalyzeHandler(
@@ -29,46 +61,173 @@ func NewAnalyzeHandler(
 		jobQueue:    jobQueue,
 		syncTimeout: syncTimeout,
 		s3Client:    s3Client,
+
+		maxBatchItems: defaultMaxBatchItems,
 	}
 }
 
+// ListJobs lists jobs matching the query filters
+// @Summary List jobs
+// @Description List jobs newest first (or oldest first with order=asc), filtered by status, request type, user, board, batch and creation time.
+// @Description Pass the returned nextCursor as cursor to fetch the next page; it is omitted on the last page.
+// @Description Authenticated callers only see the jobs they submitted, unless they are admins.
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param status query string false "Comma separated job statuses (pending, running, completed, failed, aborted)"
+// @Param requestType query string false "Request type (summarize or structurize)"
+// @Param userId query string false "User ID"
+// @Param boardId query string false "Board ID"
+// @Param batchId query string false "Batch ID"
+// @Param createdFrom query string false "Inclusive lower bound of creation time, unix seconds or RFC3339"
+// @Param createdTo query string false "Exclusive upper bound of creation time, unix seconds or RFC3339"
+// @Param cursor query string false "Pagination cursor from a previous page"
+// @Param limit query int false "Page size, 50 by default and at most 200"
+// @Param order query string false "Sort order by creation time (asc or desc, default desc)"
+// @Success 200 {object} models.JobListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /jobs [get]
+func (h *AnalyzeHandler) ListJobs(c echo.Context) error {
+	filter, err := parseJobFilter(c)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	page, err := h.service.ListJobs(c.Request().Context(), filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			return badRequest(err)
+		}
+		return internalError("failed to list jobs", err)
+	}
+
+	resp := models.JobListResponse{
+		Jobs:       make([]models.JobInfo, 0, len(page.Jobs)),
+		NextCursor: page.NextCursor,
+	}
+	for _, job := range page.Jobs {
+		resp.Jobs = append(resp.Jobs, models.NewJobInfo(job))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
 // GetJobStatus retrieves the status of a specific job
 // @Summary Get job status
-// @Description Get the status of a job by ID
+// @Description Get the status of a job by ID. Completed jobs carry their result and failed jobs the failure reason.
+// @Description Summarize jobs return models.SummarizeJobResponse, structurize jobs return models.StructurizeJobResponse.
+// @Description Jobs submitted by another principal are reported as not found, except to admins.
 // @Tags Jobs
 // @Accept json
 // @Produce json
 // @Param id path string true "Job ID"
-// @Success 200 {object} models.Job
-// @Failure 404 {object} map[string]string
+// @Success 200 {object} models.JobResponse "oneOf by requestType: summarize jobs carry a models.SummarizeResponse result, structurize jobs a models.StructurizeResponse result"
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /jobs/{id} [get]
 func (h *AnalyzeHandler) GetJobStatus(c echo.Context) error {
 	jobID := c.Param("id")
 	job, err := h.service.GetJob(c.Request().Context(), jobID)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, fmt.Errorf("failed to get job: %w", err))
+		return jobError(jobID, err, "failed to get job")
 	}
-	return c.JSON(http.StatusOK, job)
+	return c.JSON(http.StatusOK, models.NewJobResponse(job))
 }
 
 // Abort aborts a specific job
 // @Summary Abort a job
-// @Description Abort a job by ID
+// @Description Abort a pending or running job by ID. A running job has its provider call cancelled immediately and sends no callback.
 // @Tags Jobs
 // @Accept json
 // @Produce json
 // @Param id path string true "Job ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 404 {object} map[string]string
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /jobs/{id}/abort [put]
 func (h *AnalyzeHandler) Abort(c echo.Context) error {
 	jobID := c.Param("id")
 	if err := h.service.Abort(c.Request().Context(), jobID); err != nil {
-		return c.JSON(http.StatusNotFound, fmt.Errorf("failed to abort job: %w", err))
+		return jobError(jobID, err, "failed to abort job")
 	}
 	return c.JSON(http.StatusOK, nil)
 }
 
+// GetCallbackDeliveries lists the webhook delivery attempts of a job
+// @Summary Get job callback deliveries
+// @Description List every webhook delivery attempt recorded for a job
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {array} models.CallbackDelivery
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /jobs/{id}/callbacks [get]
+func (h *AnalyzeHandler) GetCallbackDeliveries(c echo.Context) error {
+	jobID := c.Param("id")
+	deliveries, err := h.service.GetCallbackDeliveries(c.Request().Context(), jobID)
+	if err != nil {
+		return jobError(jobID, err, "failed to get callback deliveries")
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayCallback re-sends the final webhook of a finished job
+// @Summary Replay job callback
+// @Description Re-deliver the completion or failure webhook of a finished job, with the usual retries
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.CallbackDelivery
+// @Failure 502 {object} models.ErrorResponse "Delivery failed, details is the models.CallbackDelivery"
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "The job has not finished or has no callback URL"
+// @Failure 501 {object} models.ErrorResponse "Webhook delivery is disabled"
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /jobs/{id}/callbacks/replay [post]
+func (h *AnalyzeHandler) ReplayCallback(c echo.Context) error {
+	jobID := c.Param("id")
+	delivery, err := h.service.ReplayCallback(c.Request().Context(), jobID)
+	if err != nil {
+		return replayError(jobID, delivery, err)
+	}
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// replayError maps a failed callback replay to its API error, delivery is the
+// last attempt if any was made
+func replayError(jobID string, delivery models.CallbackDelivery, err error) *APIError {
+	switch {
+	case errors.Is(err, models.ErrJobNotFound):
+		return notFound(jobID, err)
+	case errors.Is(err, models.ErrCallbacksDisabled):
+		return newAPIError(http.StatusNotImplemented, models.ErrorCodeCallbacksDisabled, err.Error())
+	case errors.Is(err, models.ErrJobNotReplayable), errors.Is(err, models.ErrNoCallbackURL):
+		return newAPIError(http.StatusConflict, models.ErrorCodeJobNotReplayable, fmt.Sprintf("failed to replay callback: %v", err))
+	case delivery.Attempt > 0:
+		return &APIError{
+			Status:  http.StatusBadGateway,
+			Code:    models.ErrorCodeCallbackFailed,
+			Message: fmt.Sprintf("callback delivery failed: %v", err),
+			Details: delivery,
+		}
+	default:
+		return internalError("failed to replay callback", err)
+	}
+}
+
 // HealthHandler returns the health status of the service
 // @Summary Health check
 // @Description Check if the service is running
@@ -83,3 +242,204 @@ func HealthHandler(c echo.Context) error {
 		"time":   time.Now().Format(time.RFC3339),
 	})
 }
+
+// validateCallbackURL accepts an empty value or an absolute http(s) URL
+func validateCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalidField("callbackUrl", models.FieldErrorInvalid, "callbackUrl must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// validateRegion accepts an empty region or a region code of letters such as RU
+func validateRegion(region string) error {
+	if region == "" {
+		return nil
+	}
+	if len(region) < 2 || len(region) > 8 || strings.IndexFunc(region, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z')
+	}) >= 0 {
+		return invalidField("region", models.FieldErrorInvalid, "region must be 2 to 8 letters, such as RU or EU")
+	}
+	return nil
+}
+
+// parseRegion returns the region field of a request, or else the X-Region header
+func parseRegion(c echo.Context, region string) string {
+	if region != "" {
+		return region
+	}
+	return strings.TrimSpace(c.Request().Header.Get(RegionHeader))
+}
+
+// parseIdempotency reads the Idempotency-Key header and fingerprints the request
+// as the client sent it, before the handler enriches it with e.g. S3 images
+func parseIdempotency(c echo.Context, req any) (analysis.Idempotency, error) {
+	key := strings.TrimSpace(c.Request().Header.Get(IdempotencyKeyHeader))
+	if key == "" {
+		return analysis.Idempotency{}, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return analysis.Idempotency{}, fmt.Errorf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)
+	}
+
+	hash, err := analysis.RequestHash(req)
+	if err != nil {
+		return analysis.Idempotency{}, err
+	}
+	return analysis.Idempotency{Key: key, RequestHash: hash}, nil
+}
+
+// parseExecution reads how the client wants its request run. The mode field
+// takes precedence over the Prefer header, where wait=N bounds the wait for a
+// response to N seconds and respond-async alone asks for the job right away.
+// Unknown or malformed preferences are ignored, as RFC 7240 requires.
+func parseExecution(c echo.Context, mode models.ExecutionMode) analysis.Execution {
+	respondAsync, wait, hasWait := false, 0, false
+	for _, header := range c.Request().Header.Values(PreferHeader) {
+		for _, preference := range strings.Split(header, ",") {
+			// Parameters after ';' do not matter for the preferences known here
+			preference, _, _ = strings.Cut(preference, ";")
+			name, value, _ := strings.Cut(strings.TrimSpace(preference), "=")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "respond-async":
+				respondAsync = true
+			case "wait":
+				if n, err := strconv.Atoi(strings.Trim(strings.TrimSpace(value), `"`)); err == nil && n >= 0 && !hasWait {
+					wait, hasWait = n, true
+				}
+			}
+		}
+	}
+
+	if mode == models.ExecutionAsync {
+		return analysis.Execution{Async: true}
+	}
+	if mode == models.ExecutionSync {
+		// Only the wait preference applies to explicit sync requests
+		respondAsync = false
+	}
+
+	if hasWait {
+		c.Response().Header().Set(PreferenceAppliedHeader, fmt.Sprintf("wait=%d", wait))
+		if wait == 0 {
+			return analysis.Execution{Async: true}
+		}
+		return analysis.Execution{Wait: time.Duration(wait) * time.Second}
+	}
+	if respondAsync {
+		c.Response().Header().Set(PreferenceAppliedHeader, "respond-async")
+		return analysis.Execution{Async: true}
+	}
+	return analysis.Execution{}
+}
+
+// startJobError maps a StartJob or AllowRequest error other than analysis.ErrAccepted to a response
+func startJobError(c echo.Context, err error) error {
+	if exceeded, ok := utils.MapErr[*quota.ExceededError](err); ok {
+		// Retry-After is in whole seconds, rounded up so clients never retry early
+		seconds := int64(math.Ceil(exceeded.RetryAfter.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.FormatInt(max(seconds, 1), 10))
+	}
+	return startError(err)
+}
+
+// startError classifies an error of starting or submitting a job
+func startError(err error) *APIError {
+	switch {
+	case errors.Is(err, analysis.ErrIdempotencyKeyReused):
+		return newAPIError(http.StatusUnprocessableEntity, models.ErrorCodeIdempotencyKeyReused, err.Error())
+	case errors.Is(err, analysis.ErrIdempotencyKeyInProgress):
+		return newAPIError(http.StatusConflict, models.ErrorCodeIdempotencyKeyInProgress, err.Error())
+	case errors.Is(err, providers.ErrNoProvidersAvailable):
+		return &APIError{
+			Status:  http.StatusServiceUnavailable,
+			Code:    models.ErrorCodeProvidersUnavailable,
+			Message: providers.ErrNoProvidersAvailable.Error(),
+			Err:     err,
+		}
+	}
+	if _, ok := utils.MapErr[jobservice.QueueFullErr](err); ok {
+		return newAPIError(http.StatusServiceUnavailable, models.ErrorCodeQueueFull, err.Error())
+	}
+	if _, ok := utils.MapErr[*quota.ExceededError](err); ok {
+		return newAPIError(http.StatusTooManyRequests, models.ErrorCodeQuotaExceeded, err.Error())
+	}
+	return internalError("failed to start job", err)
+}
+
+// jobError maps the error of a call on an existing job to a response
+func jobError(jobID string, err error, message string) error {
+	if errors.Is(err, models.ErrJobNotFound) {
+		return notFound(jobID, err)
+	}
+	return internalError(message, err)
+}
+
+// parseJobFilter reads the GET /jobs query parameters
+func parseJobFilter(c echo.Context) (models.JobFilter, error) {
+	filter := models.JobFilter{
+		RequestType: c.QueryParam("requestType"),
+		UserID:      c.QueryParam("userId"),
+		BoardID:     c.QueryParam("boardId"),
+		BatchID:     c.QueryParam("batchId"),
+		Cursor:      c.QueryParam("cursor"),
+		Order:       c.QueryParam("order"),
+	}
+
+	if filter.RequestType != "" && filter.RequestType != models.SummarizeType && filter.RequestType != models.StructurizeType {
+		return filter, fmt.Errorf("unknown requestType %q", filter.RequestType)
+	}
+	if filter.Order != "" && filter.Order != models.SortAsc && filter.Order != models.SortDesc {
+		return filter, fmt.Errorf("order must be %q or %q", models.SortAsc, models.SortDesc)
+	}
+
+	for _, param := range c.QueryParams()["status"] {
+		for _, status := range strings.Split(param, ",") {
+			switch s := models.JobStatus(strings.TrimSpace(status)); s {
+			case models.JobStatusPending, models.JobStatusRunning, models.JobStatusCompleted,
+				models.JobStatusFailed, models.JobStatusAborted:
+				filter.Statuses = append(filter.Statuses, s)
+			default:
+				return filter, fmt.Errorf("unknown status %q", status)
+			}
+		}
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return filter, fmt.Errorf("limit must be a positive integer")
+		}
+		filter.Limit = n
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseTimeParam(c.QueryParam("createdFrom")); err != nil {
+		return filter, fmt.Errorf("invalid createdFrom: %w", err)
+	}
+	if filter.CreatedTo, err = parseTimeParam(c.QueryParam("createdTo")); err != nil {
+		return filter, fmt.Errorf("invalid createdTo: %w", err)
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam accepts unix seconds or an RFC3339 timestamp, empty means unbounded
+func parseTimeParam(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ts, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("expected unix seconds or RFC3339 time")
+	}
+	return t.Unix(), nil
+}
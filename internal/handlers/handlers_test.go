@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/services/analysis"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExecution(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    models.ExecutionMode
+		prefer  []string
+		want    analysis.Execution
+		applied string
+	}{
+		{"default", "", nil, analysis.Execution{}, ""},
+		{"respond-async", "", []string{"respond-async"}, analysis.Execution{Async: true}, "respond-async"},
+		{"wait", "", []string{"wait=5"}, analysis.Execution{Wait: 5 * time.Second}, "wait=5"},
+		{"wait wins over respond-async", "", []string{"respond-async, wait=5"}, analysis.Execution{Wait: 5 * time.Second}, "wait=5"},
+		{"wait=0 queues the job", "", []string{"wait=0"}, analysis.Execution{Async: true}, "wait=0"},
+		{"first wait counts", "", []string{"wait=3", "wait=9"}, analysis.Execution{Wait: 3 * time.Second}, "wait=3"},
+		{"quoted wait with parameters", "", []string{`wait="4"; foo=bar`}, analysis.Execution{Wait: 4 * time.Second}, "wait=4"},
+		{"malformed wait is ignored", "", []string{"wait=soon"}, analysis.Execution{}, ""},
+		{"negative wait is ignored", "", []string{"wait=-1"}, analysis.Execution{}, ""},
+		{"unknown preference is ignored", "", []string{"handling=strict"}, analysis.Execution{}, ""},
+		{"async mode wins over Prefer", models.ExecutionAsync, []string{"wait=5"}, analysis.Execution{Async: true}, ""},
+		{"sync mode ignores respond-async", models.ExecutionSync, []string{"respond-async"}, analysis.Execution{}, ""},
+		{"sync mode keeps wait", models.ExecutionSync, []string{"respond-async, wait=5"}, analysis.Execution{Wait: 5 * time.Second}, "wait=5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/summarize", nil)
+			for _, prefer := range tt.prefer {
+				req.Header.Add(PreferHeader, prefer)
+			}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			require.Equal(t, tt.want, parseExecution(c, tt.mode))
+			require.Equal(t, tt.applied, rec.Header().Get(PreferenceAppliedHeader))
+		})
+	}
+}
+
+func TestParseJobFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    models.JobFilter
+		wantErr string
+	}{
+		{"empty", "", models.JobFilter{}, ""},
+		{
+			name:  "every parameter",
+			query: "requestType=summarize&userId=u1&boardId=b1&batchId=batch1&cursor=abc&order=asc&limit=20&createdFrom=100&createdTo=2024-01-02T00:00:00Z",
+			want: models.JobFilter{
+				RequestType: models.SummarizeType, UserID: "u1", BoardID: "b1", BatchID: "batch1",
+				Cursor: "abc", Order: models.SortAsc, Limit: 20, CreatedFrom: 100, CreatedTo: 1704153600,
+			},
+		},
+		{
+			name:  "statuses as list and repeated",
+			query: "status=pending,running&status=failed",
+			want:  models.JobFilter{Statuses: []models.JobStatus{models.JobStatusPending, models.JobStatusRunning, models.JobStatusFailed}},
+		},
+		{name: "unknown request type", query: "requestType=translate", wantErr: `unknown requestType "translate"`},
+		{name: "unknown order", query: "order=random", wantErr: `order must be "asc" or "desc"`},
+		{name: "unknown status", query: "status=pending,lost", wantErr: `unknown status "lost"`},
+		{name: "zero limit", query: "limit=0", wantErr: "limit must be a positive integer"},
+		{name: "malformed limit", query: "limit=ten", wantErr: "limit must be a positive integer"},
+		{name: "malformed createdFrom", query: "createdFrom=yesterday", wantErr: "invalid createdFrom"},
+		{name: "malformed createdTo", query: "createdTo=2024-01-02", wantErr: "invalid createdTo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/jobs?"+tt.query, nil), httptest.NewRecorder())
+
+			filter, err := parseJobFilter(c)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, filter)
+		})
+	}
+}
+
+func TestReplayError(t *testing.T) {
+	failed := models.CallbackDelivery{JobID: "job-1", Attempt: 3, StatusCode: 500}
+	tests := []struct {
+		name     string
+		delivery models.CallbackDelivery
+		err      error
+		status   int
+		code     models.ErrorCode
+	}{
+		{"unknown job", models.CallbackDelivery{}, models.ErrJobNotFound, http.StatusNotFound, models.ErrorCodeNotFound},
+		{"callbacks disabled", models.CallbackDelivery{}, models.ErrCallbacksDisabled, http.StatusNotImplemented, models.ErrorCodeCallbacksDisabled},
+		{"unfinished job", models.CallbackDelivery{}, fmt.Errorf("job job-1 is running: %w", models.ErrJobNotReplayable), http.StatusConflict, models.ErrorCodeJobNotReplayable},
+		{"no callback url", models.CallbackDelivery{}, fmt.Errorf("job job-1: %w", models.ErrNoCallbackURL), http.StatusConflict, models.ErrorCodeJobNotReplayable},
+		{"delivery failed", failed, errors.New("receiver responded with 500"), http.StatusBadGateway, models.ErrorCodeCallbackFailed},
+		{"storage error", models.CallbackDelivery{}, errors.New("database is down"), http.StatusInternalServerError, models.ErrorCodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := replayError("job-1", tt.delivery, tt.err)
+			require.Equal(t, tt.status, apiErr.Status)
+			require.Equal(t, tt.code, apiErr.Code)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aiservice/internal/metrics"
+	"github.com/labstack/echo/v4"
+)
+
+// unmatchedRoute labels requests no route matched, so unknown paths do not
+// each get their own series
+const unmatchedRoute = "unmatched"
+
+var metricsHandler = echo.WrapHandler(metrics.Handler())
+
+// Metrics counts the requests of each route and their latency. Errors are
+// counted with the status ErrorHandler renders them with.
+func Metrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		route, method := routeOf(c), c.Request().Method
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(responseStatus(c, err))).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// routeOf returns the route template matched by a request
+func routeOf(c echo.Context) string {
+	if route := c.Path(); route != "" {
+		return route
+	}
+	return unmatchedRoute
+}
+
+// responseStatus returns the status a request is answered with, including
+// the one ErrorHandler renders the error of a handler with
+func responseStatus(c echo.Context, err error) int {
+	if err != nil && !c.Response().Committed {
+		return toAPIError(err).Status
+	}
+	return c.Response().Status
+}
+
+// MetricsHandler serves the service metrics
+// @Summary Prometheus metrics
+// @Description Job queue, LLM provider, circuit breaker, cache and HTTP metrics in the Prometheus text format
+// @Tags Health
+// @Produce plain
+// @Success 200 {string} string "Prometheus text exposition"
+// @Router /metrics [get]
+func MetricsHandler(c echo.Context) error {
+	return metricsHandler(c)
+}
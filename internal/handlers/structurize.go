@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"encoding/base64"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -14,55 +13,45 @@ import (
 
 func validateStructurizeRequest(req models.StructurizeRequest) error {
 	if req.File.IsEmpty() {
-		return fmt.Errorf("file data is empty")
+		return invalidField("file", models.FieldErrorRequired, "file data is empty")
 	}
 	if req.UserID == "" {
-		return fmt.Errorf("userID is empty")
+		return invalidField("userId", models.FieldErrorRequired, "userID is empty")
 	}
-
-	// Validate file structure to prevent deep nesting
-	if err := validateFileStructure(req.File, 0); err != nil {
+	if err := validateCallbackURL(req.CallbackURL); err != nil {
 		return err
 	}
-
-	// Validate board elements
-	if len(req.Board.Elements) > 1000 { // Prevent too many elements
-		return fmt.Errorf("too many elements in board, maximum allowed is 1000")
+	if err := validateRegion(req.Region); err != nil {
+		return err
+	}
+	if !req.Priority.Valid() {
+		return invalidField("priority", models.FieldErrorInvalid, "unknown priority %q, expected low, normal or high", req.Priority)
+	}
+	if !req.Mode.Valid() {
+		return invalidField("mode", models.FieldErrorInvalid, "unknown mode %q, expected sync or async", req.Mode)
 	}
 
-	// Validate individual elements
-	for _, elem := range req.Board.Elements {
-		if elem.Id == "" {
-			return fmt.Errorf("element ID cannot be empty")
-		}
-
-		// Validate coordinates and dimensions are reasonable
-		if elem.Width < 0 || elem.Height < 0 {
-			return fmt.Errorf("element width and height must be non-negative")
-		}
-
-		// Validate content length if it's a text element
-		if elem.Type == "text" && len(elem.Content) > 10000 {
-			return fmt.Errorf("text content too long, maximum allowed is 10000 characters")
-		}
+	// Validate file structure to prevent deep nesting
+	if err := validateFileStructure(req.File, "file", 0); err != nil {
+		return err
 	}
 
-	return nil
+	return validateBoardElements(req.Board.Elements)
 }
 
 // validateFileStructure validates the file structure to prevent deep nesting and other issues
-func validateFileStructure(file models.File, depth int) error {
+func validateFileStructure(file models.File, field string, depth int) error {
 	if depth > 10 { // Prevent overly deep nesting
-		return fmt.Errorf("file structure too deep, maximum allowed depth is 10")
+		return invalidField(field, models.FieldErrorTooDeep, "file structure too deep, maximum allowed depth is 10")
 	}
 
 	if len(file.Name) > 255 { // Prevent overly long names
-		return fmt.Errorf("file name too long, maximum allowed length is 255 characters")
+		return invalidField(field+".name", models.FieldErrorTooLong, "file name too long, maximum allowed length is 255 characters")
 	}
 
-	for _, child := range file.Children {
+	for i, child := range file.Children {
 		if !child.IsEmpty() {
-			if err := validateFileStructure(child, depth+1); err != nil {
+			if err := validateFileStructure(child, fmt.Sprintf("%s.children[%d]", field, i), depth+1); err != nil {
 				return err
 			}
 		}
@@ -74,49 +63,63 @@ func validateFileStructure(file models.File, depth int) error {
 // Structurize processes a board and returns a structured file hierarchy
 // @Summary Structurize a board
 // @Description Process a board and return a structured file hierarchy
+// @Description The request is processed while the client waits, up to TIMEOUT_SYNC_PROCESS, then answered with 202 and the job ID; the job keeps the work already done.
+// @Description "Prefer: respond-async" (or mode=async) returns 202 right away, "Prefer: wait=N" waits at most N seconds. The honored preference is echoed in Preference-Applied.
 // @Tags Processing
 // @Accept json
 // @Produce json
 // @Param request body models.StructurizeRequest true "Structurize Request"
+// @Param Prefer header string false "respond-async or wait=N (seconds)"
+// @Param Idempotency-Key header string false "Repeated requests with the same key return the first response or job ID instead of starting a new job"
+// @Param X-Region header string false "Region of the request when the body has no region field, e.g. RU; only the providers available there are tried"
 // @Success 200 {object} models.StructurizeResponse
 // @Success 202 {string} string "Job ID"
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Header 200,202 {string} Preference-Applied "The honored Prefer preference"
+// @Failure 400 {object} models.ErrorResponse "invalid_request, or validation_failed with the offending field in details"
+// @Failure 409 {object} models.ErrorResponse "A request with the same Idempotency-Key is still in progress"
+// @Failure 422 {object} models.ErrorResponse "The Idempotency-Key was used with a different request"
+// @Failure 429 {object} models.ErrorResponse "A quota is exceeded, see the Retry-After header"
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse "providers_unavailable or queue_full, retry later"
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /structurize [post]
 func (h *AnalyzeHandler) Structurize(c echo.Context) error {
 	var req models.StructurizeRequest
 
 	if err := c.Bind(&req); err != nil {
 		slog.Error("bind error:", "err", err)
-		return c.JSON(http.StatusBadRequest, fmt.Errorf("failed to parse request: %w", err))
+		return bindError(err)
+	}
+	req.Region = parseRegion(c, req.Region)
+	if err := bindPrincipal(c.Request().Context(), &req.UserID, &req.TenantID); err != nil {
+		return validationError(err)
 	}
 
 	if err := validateStructurizeRequest(req); err != nil {
 		slog.Error("validation error:", "err", err)
-		return c.JSON(http.StatusBadRequest, fmt.Errorf("invalid request data: %w", err))
-	}
-
-	// If ImageURL is not empty, download the image from S3 and update the request
-	if req.Board.ImageURL != "" && h.s3Client != nil {
-		imageData, err := h.downloadImageFromS3(c.Request().Context(), req.Board.ImageURL)
-		if err != nil {
-			slog.Error("failed to download image from S3:", "err", err, "url", req.Board.ImageURL)
-			// Continue without the image if download fails
-		} else {
-			// Convert the image to a data URL and update the ImageURL field in the request
-			// This will be picked up by the preprocessing layer
-			req.Board.ImageURL = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(imageData)
-			slog.Info("Image downloaded from S3 and converted to data URL", "size", len(imageData))
-		}
+		return validationError(err)
 	}
 
-	resp, err := h.service.StartJob(c.Request().Context(), models.NewStructAnalyzeReq(req))
+	idempotency, err := parseIdempotency(c, req)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	if err := h.service.AllowRequest(c.Request().Context(), req.UserID, req.TenantID); err != nil {
+		return startJobError(c, err)
+	}
+
+	req.Board.ImageURL = h.inlineBoardImage(c.Request().Context(), req.Board.ImageURL)
+
+	resp, err := h.service.StartJob(c.Request().Context(), models.NewStructAnalyzeReq(req), idempotency, parseExecution(c, req.Mode))
 	if err != nil {
 		if acceptedErr, ok := utils.MapErr[analysis.ErrAccepted](err); ok {
 			slog.Info("enque job:", "jobID", acceptedErr.JobID)
 			return c.JSON(http.StatusAccepted, acceptedErr.JobID)
 		}
-		return c.JSON(http.StatusInternalServerError, fmt.Errorf("failed to start job for structurizing: %w", err))
+		return startJobError(c, err)
 	}
 	return c.JSON(http.StatusOK, resp.StructurizeResponse)
 }
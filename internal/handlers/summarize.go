@@ -16,31 +16,48 @@ import (
 
 func validateSummarizeRequest(req models.SummarizeRequest) error {
 	if req.Board.BoardID == "" {
-		return fmt.Errorf("boardID is empty")
+		return invalidField("board.boardId", models.FieldErrorRequired, "boardID is empty")
 	}
 	if req.UserID == "" {
-		return fmt.Errorf("userID is empty")
+		return invalidField("userId", models.FieldErrorRequired, "userID is empty")
 	}
+	if err := validateCallbackURL(req.CallbackURL); err != nil {
+		return err
+	}
+	if err := validateRegion(req.Region); err != nil {
+		return err
+	}
+	if !req.Priority.Valid() {
+		return invalidField("priority", models.FieldErrorInvalid, "unknown priority %q, expected low, normal or high", req.Priority)
+	}
+	if !req.Mode.Valid() {
+		return invalidField("mode", models.FieldErrorInvalid, "unknown mode %q, expected sync or async", req.Mode)
+	}
+
+	return validateBoardElements(req.Board.Elements)
+}
 
-	// Validate board elements
-	if len(req.Board.Elements) > 1000 { // Prevent too many elements
-		return fmt.Errorf("too many elements in board, maximum allowed is 1000")
+// validateBoardElements checks the elements of a board to analyze
+func validateBoardElements(elements []models.Element) error {
+	if len(elements) > 1000 { // Prevent too many elements
+		return invalidField("board.elements", models.FieldErrorTooMany, "too many elements in board, maximum allowed is 1000")
 	}
 
 	// Validate individual elements
-	for _, elem := range req.Board.Elements {
+	for i, elem := range elements {
+		field := fmt.Sprintf("board.elements[%d]", i)
 		if elem.Id == "" {
-			return fmt.Errorf("element ID cannot be empty")
+			return invalidField(field+".id", models.FieldErrorRequired, "element ID cannot be empty")
 		}
 
 		// Validate coordinates and dimensions are reasonable
 		if elem.Width < 0 || elem.Height < 0 {
-			return fmt.Errorf("element width and height must be non-negative")
+			return invalidField(field, models.FieldErrorInvalid, "element width and height must be non-negative")
 		}
 
 		// Validate content length if it's a text element
 		if elem.Type == "text" && len(elem.Content) > 10000 {
-			return fmt.Errorf("text content too long, maximum allowed is 10000 characters")
+			return invalidField(field+".content", models.FieldErrorTooLong, "text content too long, maximum allowed is 10000 characters")
 		}
 	}
 
@@ -50,54 +67,84 @@ func validateSummarizeRequest(req models.SummarizeRequest) error {
 // Summarize processes a board and returns a summary
 // @Summary Summarize a board
 // @Description Process a board and return a summary of the content
+// @Description The request is processed while the client waits, up to TIMEOUT_SYNC_PROCESS, then answered with 202 and the job ID; the job keeps the work already done.
+// @Description "Prefer: respond-async" (or mode=async) returns 202 right away, "Prefer: wait=N" waits at most N seconds. The honored preference is echoed in Preference-Applied.
 // @Tags Processing
 // @Accept json
 // @Produce json
 // @Param request body models.SummarizeRequest true "Summarize Request"
+// @Param Prefer header string false "respond-async or wait=N (seconds)"
+// @Param Idempotency-Key header string false "Repeated requests with the same key return the first response or job ID instead of starting a new job"
+// @Param X-Region header string false "Region of the request when the body has no region field, e.g. RU; only the providers available there are tried"
 // @Success 200 {object} models.SummarizeResponse
 // @Success 202 {string} string "Job ID"
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Header 200,202 {string} Preference-Applied "The honored Prefer preference"
+// @Failure 400 {object} models.ErrorResponse "invalid_request, or validation_failed with the offending field in details"
+// @Failure 409 {object} models.ErrorResponse "A request with the same Idempotency-Key is still in progress"
+// @Failure 422 {object} models.ErrorResponse "The Idempotency-Key was used with a different request"
+// @Failure 429 {object} models.ErrorResponse "A quota is exceeded, see the Retry-After header"
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse "providers_unavailable or queue_full, retry later"
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /summarize [post]
 func (h *AnalyzeHandler) Summarize(c echo.Context) error {
 	var req models.SummarizeRequest
 
 	if err := c.Bind(&req); err != nil {
 		slog.Error("bind error:", "err", err)
-		return c.JSON(http.StatusBadRequest, fmt.Errorf("failed to parse request: %w", err))
+		return bindError(err)
+	}
+	req.Region = parseRegion(c, req.Region)
+	if err := bindPrincipal(c.Request().Context(), &req.UserID, &req.TenantID); err != nil {
+		return validationError(err)
 	}
 
 	if err := validateSummarizeRequest(req); err != nil {
 		slog.Error("validation error:", "err", err)
-		return c.JSON(http.StatusBadRequest, fmt.Errorf("invalid request data: %w", err))
-	}
-
-	// If ImageURL is not empty, download the image from S3 and update the request
-	if req.Board.ImageURL != "" && h.s3Client != nil {
-		imageData, err := h.downloadImageFromS3(c.Request().Context(), req.Board.ImageURL)
-		if err != nil {
-			slog.Error("failed to download image from S3:", "err", err, "url", req.Board.ImageURL)
-			// Continue without the image if download fails
-		} else {
-			// Convert the image to a data URL and update the ImageURL field in the request
-			// This will be picked up by the preprocessing layer
-			req.Board.ImageURL = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(imageData)
-			slog.Info("Image downloaded from S3 and converted to data URL", "size", len(imageData))
-		}
+		return validationError(err)
 	}
 
-	resp, err := h.service.StartJob(c.Request().Context(), models.NewSumAnalyzeReq(req))
+	idempotency, err := parseIdempotency(c, req)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	if err := h.service.AllowRequest(c.Request().Context(), req.UserID, req.TenantID); err != nil {
+		return startJobError(c, err)
+	}
+
+	req.Board.ImageURL = h.inlineBoardImage(c.Request().Context(), req.Board.ImageURL)
+
+	resp, err := h.service.StartJob(c.Request().Context(), models.NewSumAnalyzeReq(req), idempotency, parseExecution(c, req.Mode))
 	if err != nil {
 		if acceptedErr, ok := utils.MapErr[analysis.ErrAccepted](err); ok {
 			slog.Info("enque job:", "jobID", acceptedErr.JobID)
 			return c.JSON(http.StatusAccepted, acceptedErr.JobID)
 		}
-		return c.JSON(http.StatusInternalServerError, fmt.Errorf("failed to start for analyzing: %w", err))
+		return startJobError(c, err)
 	}
 	return c.JSON(http.StatusOK, resp)
 
 }
 
+// inlineBoardImage downloads a board image from S3 and returns it as a data
+// URL for the preprocessing layer. The URL is returned unchanged when there is
+// no S3 client or the download fails, the board is analyzed without the image.
+func (h *AnalyzeHandler) inlineBoardImage(ctx context.Context, imageURL string) string {
+	if imageURL == "" || h.s3Client == nil {
+		return imageURL
+	}
+	imageData, err := h.downloadImageFromS3(ctx, imageURL)
+	if err != nil {
+		slog.Error("failed to download image from S3:", "err", err, "url", imageURL)
+		return imageURL
+	}
+	slog.Info("Image downloaded from S3 and converted to data URL", "size", len(imageData))
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(imageData)
+}
+
 // downloadImageFromS3 downloads an image from S3 using the provided URL
 func (h *AnalyzeHandler) downloadImageFromS3(ctx context.Context, imageURL string) ([]byte, error) {
 	// Extract the key from the S3 URL
@@ -0,0 +1,157 @@
+// Package metrics holds the Prometheus collectors of the service, Handler
+// serves them on /metrics
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "aiservice"
+
+// Label names shared by the collectors
+const (
+	LabelRequestType = "request_type" // models.SummarizeType or models.StructurizeType
+	LabelProvider    = "provider"     // provider name registered in the ProviderManager
+)
+
+// OutcomeSuccess is the outcome of successful ProviderRequests, failed ones
+// are labelled with their provider error type
+const OutcomeSuccess = "success"
+
+// Result label values of LLMCacheRequests
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// Circuit breaker states reported by CircuitBreakerState
+const (
+	CircuitClosed   = 0
+	CircuitHalfOpen = 1
+	CircuitOpen     = 2
+)
+
+var (
+	registry = prometheus.NewRegistry()
+	factory  = promauto.With(registry)
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the collectors in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// HTTP layer
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent handling HTTP requests, by method and route.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route"})
+)
+
+// Job queue
+var (
+	JobsEnqueued = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_enqueued_total",
+		Help:      "Jobs submitted to the queue, by request type.",
+	}, []string{LabelRequestType})
+
+	JobsFinished = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_finished_total",
+		Help:      "Jobs whose processing ended in a final status on this replica, by request type and status.",
+	}, []string{LabelRequestType, "status"})
+
+	JobRetries = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_retries_total",
+		Help:      "Job attempts that failed with a retryable error and were scheduled again, by request type.",
+	}, []string{LabelRequestType})
+
+	JobProcessingDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_processing_duration_seconds",
+		Help:      "Time spent processing one job attempt, by request type.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{LabelRequestType})
+
+	QueueDepth = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_queue_depth",
+		Help:      "Jobs waiting in the in-memory queue for a worker.",
+	})
+
+	Workers = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_workers",
+		Help:      "Job workers started on this replica.",
+	})
+
+	WorkersBusy = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_workers_busy",
+		Help:      "Job workers currently processing a job.",
+	})
+)
+
+// LLM providers
+var (
+	ProviderRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_requests_total",
+		Help:      "Requests sent to LLM providers, by provider, request type and outcome (success or the provider error type).",
+	}, []string{LabelProvider, LabelRequestType, "outcome"})
+
+	ProviderRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Latency of LLM provider requests, by provider and request type.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{LabelProvider, LabelRequestType})
+
+	ProviderFailovers = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_failovers_total",
+		Help:      "Requests moved on to the next provider after a critical error, by failed provider and request type.",
+	}, []string{LabelProvider, LabelRequestType})
+
+	CircuitBreakerState = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state per provider: 0 closed, 1 half-open, 2 open.",
+	}, []string{LabelProvider})
+
+	CircuitBreakerTrips = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_trips_total",
+		Help:      "Times the circuit breaker of a provider opened.",
+	}, []string{LabelProvider})
+)
+
+// LLM response cache
+var LLMCacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "llm_cache_requests_total",
+	Help:      "LLM response cache lookups, by request type and result (hit or miss).",
+}, []string{LabelRequestType, "result"})
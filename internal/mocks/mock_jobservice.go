@@ -94,6 +94,66 @@ func (mr *MockJobStorageMockRecorder) Abort(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Abort", reflect.TypeOf((*MockJobStorage)(nil).Abort), ctx, id)
 }
 
+// AcquireQuotaSlot mocks base method.
+func (m *MockJobStorage) AcquireQuotaSlot(ctx context.Context, subject models.QuotaSubject, jobID string, limit int, now, expiresAt int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcquireQuotaSlot", ctx, subject, jobID, limit, now, expiresAt)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireQuotaSlot indicates an expected call of AcquireQuotaSlot.
+func (mr *MockJobStorageMockRecorder) AcquireQuotaSlot(ctx, subject, jobID, limit, now, expiresAt any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcquireQuotaSlot", reflect.TypeOf((*MockJobStorage)(nil).AcquireQuotaSlot), ctx, subject, jobID, limit, now, expiresAt)
+}
+
+// AddQuotaUsage mocks base method.
+func (m *MockJobStorage) AddQuotaUsage(ctx context.Context, subject models.QuotaSubject, day, tokens int64, cost float64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddQuotaUsage", ctx, subject, day, tokens, cost)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddQuotaUsage indicates an expected call of AddQuotaUsage.
+func (mr *MockJobStorageMockRecorder) AddQuotaUsage(ctx, subject, day, tokens, cost any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddQuotaUsage", reflect.TypeOf((*MockJobStorage)(nil).AddQuotaUsage), ctx, subject, day, tokens, cost)
+}
+
+// Claim mocks base method.
+func (m *MockJobStorage) Claim(ctx context.Context, id string, lease models.Lease) (models.Job, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", ctx, id, lease)
+	ret0, _ := ret[0].(models.Job)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockJobStorageMockRecorder) Claim(ctx, id, lease any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockJobStorage)(nil).Claim), ctx, id, lease)
+}
+
+// ClaimPending mocks base method.
+func (m *MockJobStorage) ClaimPending(ctx context.Context, limit int, now int64, lease models.Lease) ([]models.Job, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimPending", ctx, limit, now, lease)
+	ret0, _ := ret[0].([]models.Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimPending indicates an expected call of ClaimPending.
+func (mr *MockJobStorageMockRecorder) ClaimPending(ctx, limit, now, lease any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimPending", reflect.TypeOf((*MockJobStorage)(nil).ClaimPending), ctx, limit, now, lease)
+}
+
 // Close mocks base method.
 func (m *MockJobStorage) Close() error {
 	m.ctrl.T.Helper()
@@ -108,6 +168,63 @@ func (mr *MockJobStorageMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockJobStorage)(nil).Close))
 }
 
+// CountQuotaRequest mocks base method.
+func (m *MockJobStorage) CountQuotaRequest(ctx context.Context, subject models.QuotaSubject, window int64, limit int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountQuotaRequest", ctx, subject, window, limit)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountQuotaRequest indicates an expected call of CountQuotaRequest.
+func (mr *MockJobStorageMockRecorder) CountQuotaRequest(ctx, subject, window, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountQuotaRequest", reflect.TypeOf((*MockJobStorage)(nil).CountQuotaRequest), ctx, subject, window, limit)
+}
+
+// DeleteExpiredIdempotencyKeys mocks base method.
+func (m *MockJobStorage) DeleteExpiredIdempotencyKeys(ctx context.Context, now int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredIdempotencyKeys", ctx, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteExpiredIdempotencyKeys indicates an expected call of DeleteExpiredIdempotencyKeys.
+func (mr *MockJobStorageMockRecorder) DeleteExpiredIdempotencyKeys(ctx, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredIdempotencyKeys", reflect.TypeOf((*MockJobStorage)(nil).DeleteExpiredIdempotencyKeys), ctx, now)
+}
+
+// DeleteExpiredQuota mocks base method.
+func (m *MockJobStorage) DeleteExpiredQuota(ctx context.Context, window, day, now int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredQuota", ctx, window, day, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteExpiredQuota indicates an expected call of DeleteExpiredQuota.
+func (mr *MockJobStorageMockRecorder) DeleteExpiredQuota(ctx, window, day, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredQuota", reflect.TypeOf((*MockJobStorage)(nil).DeleteExpiredQuota), ctx, window, day, now)
+}
+
+// DeleteIdempotencyKey mocks base method.
+func (m *MockJobStorage) DeleteIdempotencyKey(ctx context.Context, userID, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdempotencyKey", ctx, userID, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIdempotencyKey indicates an expected call of DeleteIdempotencyKey.
+func (mr *MockJobStorageMockRecorder) DeleteIdempotencyKey(ctx, userID, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdempotencyKey", reflect.TypeOf((*MockJobStorage)(nil).DeleteIdempotencyKey), ctx, userID, key)
+}
+
 // DeleteJobs mocks base method.
 func (m *MockJobStorage) DeleteJobs(ids ...string) error {
 	m.ctrl.T.Helper()
@@ -126,6 +243,35 @@ func (mr *MockJobStorageMockRecorder) DeleteJobs(ids ...any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteJobs", reflect.TypeOf((*MockJobStorage)(nil).DeleteJobs), ids...)
 }
 
+// DeleteQuotaLimits mocks base method.
+func (m *MockJobStorage) DeleteQuotaLimits(ctx context.Context, subject models.QuotaSubject) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteQuotaLimits", ctx, subject)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteQuotaLimits indicates an expected call of DeleteQuotaLimits.
+func (mr *MockJobStorageMockRecorder) DeleteQuotaLimits(ctx, subject any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteQuotaLimits", reflect.TypeOf((*MockJobStorage)(nil).DeleteQuotaLimits), ctx, subject)
+}
+
+// Finish mocks base method.
+func (m *MockJobStorage) Finish(ctx context.Context, job models.Job, owner string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Finish", ctx, job, owner)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Finish indicates an expected call of Finish.
+func (mr *MockJobStorageMockRecorder) Finish(ctx, job, owner any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Finish", reflect.TypeOf((*MockJobStorage)(nil).Finish), ctx, job, owner)
+}
+
 // Get mocks base method.
 func (m *MockJobStorage) Get(id string) (models.Job, error) {
 	m.ctrl.T.Helper()
@@ -156,6 +302,171 @@ func (mr *MockJobStorageMockRecorder) GetAll() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockJobStorage)(nil).GetAll))
 }
 
+// GetBatch mocks base method.
+func (m *MockJobStorage) GetBatch(ctx context.Context, id string) (models.Batch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBatch", ctx, id)
+	ret0, _ := ret[0].(models.Batch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBatch indicates an expected call of GetBatch.
+func (mr *MockJobStorageMockRecorder) GetBatch(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBatch", reflect.TypeOf((*MockJobStorage)(nil).GetBatch), ctx, id)
+}
+
+// GetDeliveries mocks base method.
+func (m *MockJobStorage) GetDeliveries(jobID string) ([]models.CallbackDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeliveries", jobID)
+	ret0, _ := ret[0].([]models.CallbackDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeliveries indicates an expected call of GetDeliveries.
+func (mr *MockJobStorageMockRecorder) GetDeliveries(jobID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeliveries", reflect.TypeOf((*MockJobStorage)(nil).GetDeliveries), jobID)
+}
+
+// GetQuotaLimits mocks base method.
+func (m *MockJobStorage) GetQuotaLimits(ctx context.Context, subject models.QuotaSubject) (models.QuotaLimits, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuotaLimits", ctx, subject)
+	ret0, _ := ret[0].(models.QuotaLimits)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetQuotaLimits indicates an expected call of GetQuotaLimits.
+func (mr *MockJobStorageMockRecorder) GetQuotaLimits(ctx, subject any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotaLimits", reflect.TypeOf((*MockJobStorage)(nil).GetQuotaLimits), ctx, subject)
+}
+
+// GetQuotaUsage mocks base method.
+func (m *MockJobStorage) GetQuotaUsage(ctx context.Context, subject models.QuotaSubject, window, day, now int64) (models.QuotaUsage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuotaUsage", ctx, subject, window, day, now)
+	ret0, _ := ret[0].(models.QuotaUsage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuotaUsage indicates an expected call of GetQuotaUsage.
+func (mr *MockJobStorageMockRecorder) GetQuotaUsage(ctx, subject, window, day, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotaUsage", reflect.TypeOf((*MockJobStorage)(nil).GetQuotaUsage), ctx, subject, window, day, now)
+}
+
+// Heartbeat mocks base method.
+func (m *MockJobStorage) Heartbeat(ctx context.Context, id string, lease models.Lease) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Heartbeat", ctx, id, lease)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Heartbeat indicates an expected call of Heartbeat.
+func (mr *MockJobStorageMockRecorder) Heartbeat(ctx, id, lease any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Heartbeat", reflect.TypeOf((*MockJobStorage)(nil).Heartbeat), ctx, id, lease)
+}
+
+// HoldPending mocks base method.
+func (m *MockJobStorage) HoldPending(ctx context.Context, ids []string, lease models.Lease) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HoldPending", ctx, ids, lease)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HoldPending indicates an expected call of HoldPending.
+func (mr *MockJobStorageMockRecorder) HoldPending(ctx, ids, lease any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HoldPending", reflect.TypeOf((*MockJobStorage)(nil).HoldPending), ctx, ids, lease)
+}
+
+// ListQuotaLimits mocks base method.
+func (m *MockJobStorage) ListQuotaLimits(ctx context.Context) ([]models.QuotaLimits, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListQuotaLimits", ctx)
+	ret0, _ := ret[0].([]models.QuotaLimits)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListQuotaLimits indicates an expected call of ListQuotaLimits.
+func (mr *MockJobStorageMockRecorder) ListQuotaLimits(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListQuotaLimits", reflect.TypeOf((*MockJobStorage)(nil).ListQuotaLimits), ctx)
+}
+
+// Query mocks base method.
+func (m *MockJobStorage) Query(ctx context.Context, filter models.JobFilter) (models.JobPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Query", ctx, filter)
+	ret0, _ := ret[0].(models.JobPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Query indicates an expected call of Query.
+func (mr *MockJobStorageMockRecorder) Query(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Query", reflect.TypeOf((*MockJobStorage)(nil).Query), ctx, filter)
+}
+
+// RecoverExpired mocks base method.
+func (m *MockJobStorage) RecoverExpired(ctx context.Context, now int64, maxRecoveries int) ([]models.Job, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecoverExpired", ctx, now, maxRecoveries)
+	ret0, _ := ret[0].([]models.Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecoverExpired indicates an expected call of RecoverExpired.
+func (mr *MockJobStorageMockRecorder) RecoverExpired(ctx, now, maxRecoveries any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecoverExpired", reflect.TypeOf((*MockJobStorage)(nil).RecoverExpired), ctx, now, maxRecoveries)
+}
+
+// ReleaseQuotaSlots mocks base method.
+func (m *MockJobStorage) ReleaseQuotaSlots(ctx context.Context, jobID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseQuotaSlots", ctx, jobID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseQuotaSlots indicates an expected call of ReleaseQuotaSlots.
+func (mr *MockJobStorageMockRecorder) ReleaseQuotaSlots(ctx, jobID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseQuotaSlots", reflect.TypeOf((*MockJobStorage)(nil).ReleaseQuotaSlots), ctx, jobID)
+}
+
+// ReserveIdempotencyKey mocks base method.
+func (m *MockJobStorage) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, now int64) (models.IdempotencyRecord, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveIdempotencyKey", ctx, rec, now)
+	ret0, _ := ret[0].(models.IdempotencyRecord)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReserveIdempotencyKey indicates an expected call of ReserveIdempotencyKey.
+func (mr *MockJobStorageMockRecorder) ReserveIdempotencyKey(ctx, rec, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveIdempotencyKey", reflect.TypeOf((*MockJobStorage)(nil).ReserveIdempotencyKey), ctx, rec, now)
+}
+
 // Save mocks base method.
 func (m *MockJobStorage) Save(job models.Job) error {
 	m.ctrl.T.Helper()
@@ -170,6 +481,48 @@ func (mr *MockJobStorageMockRecorder) Save(job any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockJobStorage)(nil).Save), job)
 }
 
+// SaveBatch mocks base method.
+func (m *MockJobStorage) SaveBatch(ctx context.Context, batch models.Batch) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveBatch", ctx, batch)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveBatch indicates an expected call of SaveBatch.
+func (mr *MockJobStorageMockRecorder) SaveBatch(ctx, batch any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveBatch", reflect.TypeOf((*MockJobStorage)(nil).SaveBatch), ctx, batch)
+}
+
+// SaveDelivery mocks base method.
+func (m *MockJobStorage) SaveDelivery(delivery models.CallbackDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveDelivery", delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveDelivery indicates an expected call of SaveDelivery.
+func (mr *MockJobStorageMockRecorder) SaveDelivery(delivery any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDelivery", reflect.TypeOf((*MockJobStorage)(nil).SaveDelivery), delivery)
+}
+
+// SaveQuotaLimits mocks base method.
+func (m *MockJobStorage) SaveQuotaLimits(ctx context.Context, limits models.QuotaLimits) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveQuotaLimits", ctx, limits)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveQuotaLimits indicates an expected call of SaveQuotaLimits.
+func (mr *MockJobStorageMockRecorder) SaveQuotaLimits(ctx, limits any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveQuotaLimits", reflect.TypeOf((*MockJobStorage)(nil).SaveQuotaLimits), ctx, limits)
+}
+
 // Update mocks base method.
 func (m *MockJobStorage) Update(job models.Job) error {
 	m.ctrl.T.Helper()
@@ -183,3 +536,17 @@ func (mr *MockJobStorageMockRecorder) Update(job any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockJobStorage)(nil).Update), job)
 }
+
+// UpdateIdempotencyKey mocks base method.
+func (m *MockJobStorage) UpdateIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateIdempotencyKey", ctx, rec)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateIdempotencyKey indicates an expected call of UpdateIdempotencyKey.
+func (mr *MockJobStorageMockRecorder) UpdateIdempotencyKey(ctx, rec any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateIdempotencyKey", reflect.TypeOf((*MockJobStorage)(nil).UpdateIdempotencyKey), ctx, rec)
+}
@@ -0,0 +1,110 @@
+package models
+
+import "errors"
+
+// ErrBatchNotFound is returned for unknown batch IDs
+var ErrBatchNotFound = errors.New("batch not found")
+
+// Batch groups the jobs submitted together by one POST /batches, each job
+// records the batch in its BatchID
+type Batch struct {
+	ID        string `json:"id"`
+	CreatedAt int64  `json:"createdAt"`
+	Size      int    `json:"size"` // number of jobs created for the batch
+	// Principal is the authenticated caller that submitted the batch, only it
+	// and admins may see the batch. Empty for batches submitted anonymously.
+	Principal string `json:"principal,omitempty"`
+}
+
+// BatchRequest is the body of POST /batches
+type BatchRequest struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchItem is one request of a batch, exactly one of its fields is set
+type BatchItem struct {
+	Summarize   *SummarizeRequest   `json:"summarize,omitempty"`
+	Structurize *StructurizeRequest `json:"structurize,omitempty"`
+}
+
+// AnalyzeRequest returns the request of the item for the job queue
+func (i BatchItem) AnalyzeRequest() AnalyzeRequest {
+	if i.Structurize != nil {
+		return NewStructAnalyzeReq(*i.Structurize)
+	}
+	return NewSumAnalyzeReq(*i.Summarize)
+}
+
+// BatchProgress counts the items of a batch by job status
+type BatchProgress struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Aborted   int `json:"aborted"`
+}
+
+// Add counts an item in the given status
+func (p *BatchProgress) Add(status JobStatus) {
+	switch status {
+	case JobStatusPending:
+		p.Pending++
+	case JobStatusRunning:
+		p.Running++
+	case JobStatusCompleted:
+		p.Completed++
+	case JobStatusFailed:
+		p.Failed++
+	case JobStatusAborted:
+		p.Aborted++
+	}
+}
+
+// Status aggregates the item statuses: pending until an item starts, running
+// until every item finished, then aborted if any item was aborted, failed if
+// any failed and completed otherwise
+func (p BatchProgress) Status() JobStatus {
+	switch {
+	case p.Pending == p.Total:
+		return JobStatusPending
+	case p.Pending > 0 || p.Running > 0:
+		return JobStatusRunning
+	case p.Aborted > 0:
+		return JobStatusAborted
+	case p.Failed > 0:
+		return JobStatusFailed
+	default:
+		return JobStatusCompleted
+	}
+}
+
+// BatchResponse reports the progress of a batch and the jobs of its items,
+// in submission order
+type BatchResponse struct {
+	BatchID   string        `json:"batchId"`
+	Status    JobStatus     `json:"status"`
+	CreatedAt int64         `json:"createdAt"`
+	Progress  BatchProgress `json:"progress"`
+	// Items are models.SummarizeJobResponse or models.StructurizeJobResponse,
+	// as returned by GET /jobs/{id}
+	Items []any `json:"items" swaggertype:"array,object"`
+}
+
+// NewBatchResponse builds the response of a batch from the jobs of its items.
+// Cleanup deletes aborted jobs, so items without a job count as aborted.
+func NewBatchResponse(batch Batch, jobs []Job) BatchResponse {
+	resp := BatchResponse{
+		BatchID:   batch.ID,
+		CreatedAt: batch.CreatedAt,
+		Progress:  BatchProgress{Total: max(batch.Size, len(jobs))},
+		Items:     make([]any, 0, len(jobs)),
+	}
+	for _, job := range jobs {
+		resp.Progress.Add(job.Status)
+		resp.Items = append(resp.Items, NewJobResponse(job))
+	}
+	resp.Progress.Aborted += resp.Progress.Total - len(jobs)
+	resp.Status = resp.Progress.Status()
+	return resp
+}
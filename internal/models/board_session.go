@@ -0,0 +1,41 @@
+package models
+
+// BoardMessageType names the kind of a board session message
+type BoardMessageType string
+
+const (
+	// BoardMessageSummarize submits a summarize request, client to server
+	BoardMessageSummarize BoardMessageType = "summarize"
+	// BoardMessageStructurize submits a structurize request, client to server
+	BoardMessageStructurize BoardMessageType = "structurize"
+	// BoardMessageCancel aborts a job submitted on the same connection, client to server
+	BoardMessageCancel BoardMessageType = "cancel"
+
+	// BoardMessageAccepted acknowledges a submission with the ID of its job
+	BoardMessageAccepted BoardMessageType = "accepted"
+	// BoardMessageEvent carries a progress event of one of the connection's jobs
+	BoardMessageEvent BoardMessageType = "event"
+	// BoardMessageCancelled acknowledges a cancel message
+	BoardMessageCancelled BoardMessageType = "cancelled"
+	// BoardMessageError reports a rejected client message
+	BoardMessageError BoardMessageType = "error"
+)
+
+// BoardClientMessage is sent by the frontend over a board WebSocket
+type BoardClientMessage struct {
+	Type        BoardMessageType    `json:"type"`
+	RequestID   string              `json:"requestId,omitempty"` // chosen by the client, echoed in the reply
+	JobID       string              `json:"jobId,omitempty"`     // job to cancel
+	Summarize   *SummarizeRequest   `json:"summarize,omitempty"`
+	Structurize *StructurizeRequest `json:"structurize,omitempty"`
+}
+
+// BoardServerMessage is sent to the frontend over a board WebSocket
+type BoardServerMessage struct {
+	Type      BoardMessageType `json:"type"`
+	RequestID string           `json:"requestId,omitempty"`
+	JobID     string           `json:"jobId,omitempty"`
+	Event     *JobEvent        `json:"event,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Code      ErrorCode        `json:"code,omitempty"` // machine-readable reason of an error
+}
@@ -0,0 +1,78 @@
+package models
+
+import "errors"
+
+// ErrJobNotFound is returned for unknown job IDs
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobNotAbortable is returned when aborting a job that already finished
+var ErrJobNotAbortable = errors.New("job is no longer pending or running")
+
+// ErrCallbacksDisabled is returned when replaying a callback while webhook
+// delivery is disabled
+var ErrCallbacksDisabled = errors.New("callback delivery is disabled")
+
+// ErrJobNotReplayable is returned when replaying the callback of a job that
+// has not finished
+var ErrJobNotReplayable = errors.New("only finished jobs can be replayed")
+
+// ErrNoCallbackURL is returned when delivering the callback of a job
+// submitted without a callback URL
+var ErrNoCallbackURL = errors.New("job has no callback url")
+
+// ErrorCode is a stable machine-readable identifier of an API error, clients
+// should branch on it rather than on the message
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidRequest           ErrorCode = "invalid_request"             // malformed body, header or query parameter
+	ErrorCodeValidationFailed         ErrorCode = "validation_failed"           // details lists the offending fields as FieldError
+	ErrorCodeUnauthorized             ErrorCode = "unauthorized"                // missing or invalid credentials
+	ErrorCodeForbidden                ErrorCode = "forbidden"                   // credentials lack the required role
+	ErrorCodeNotFound                 ErrorCode = "not_found"                   // unknown route, job or batch, or one of another principal
+	ErrorCodeMethodNotAllowed         ErrorCode = "method_not_allowed"          // route exists with another method
+	ErrorCodeRequestTooLarge          ErrorCode = "request_too_large"           // body above the server limit
+	ErrorCodeIdempotencyKeyReused     ErrorCode = "idempotency_key_reused"      // key used before with a different request
+	ErrorCodeIdempotencyKeyInProgress ErrorCode = "idempotency_key_in_progress" // the first request with the key has not finished
+	ErrorCodeJobNotReplayable         ErrorCode = "job_not_replayable"          // the job has not finished or has no callback URL
+	ErrorCodeCallbacksDisabled        ErrorCode = "callbacks_disabled"          // webhook delivery is not configured on the server
+	ErrorCodeCallbackFailed           ErrorCode = "callback_failed"             // details is the failed models.CallbackDelivery
+	ErrorCodeQuotaExceeded            ErrorCode = "quota_exceeded"              // retry after the Retry-After header
+	ErrorCodeQueueFull                ErrorCode = "queue_full"                  // the job queue takes no more jobs, retry later
+	ErrorCodeTooManyJobs              ErrorCode = "too_many_jobs"               // the board session has too many unfinished jobs
+	ErrorCodeProvidersUnavailable     ErrorCode = "providers_unavailable"       // no AI model could serve the request, retry later
+	ErrorCodeInternal                 ErrorCode = "internal_error"
+)
+
+// Field error codes of FieldError
+const (
+	FieldErrorRequired = "required" // missing or empty
+	FieldErrorInvalid  = "invalid"  // malformed or out of range
+	FieldErrorTooLong  = "too_long" // string above its maximum length
+	FieldErrorTooMany  = "too_many" // list above its maximum size
+	FieldErrorTooDeep  = "too_deep" // nesting above its maximum depth
+)
+
+// ErrorResponse is the body of every API error
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes an API error
+type ErrorBody struct {
+	Code      ErrorCode `json:"code" example:"validation_failed"`
+	Message   string    `json:"message" example:"invalid request data: boardID is empty"`
+	Details   any       `json:"details,omitempty" swaggertype:"object"`                         // see the ErrorCode
+	RequestID string    `json:"requestId,omitempty" example:"TpnrsJxITNxPvlAgnxmwaDpmmZbFEHoC"` // X-Request-Id of the request
+}
+
+// FieldError reports a request field that failed validation
+type FieldError struct {
+	Field   string `json:"field" example:"board.elements[3].id"` // JSON path of the field
+	Code    string `json:"code" example:"required" enums:"required,invalid,too_long,too_many,too_deep"`
+	Message string `json:"message" example:"element ID cannot be empty"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
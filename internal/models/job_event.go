@@ -0,0 +1,34 @@
+package models
+
+// JobEventType names the kind of a JobEvent
+type JobEventType string
+
+const (
+	// JobEventStatus reports a status transition of the job
+	JobEventStatus JobEventType = "status"
+	// JobEventRetry reports a retryable failure scheduled for another attempt
+	JobEventRetry JobEventType = "retry"
+	// JobEventProvider reports the LLM provider being tried
+	JobEventProvider JobEventType = "provider"
+	// JobEventResult is the last event of a job, with its result or failure reason
+	JobEventResult JobEventType = "result"
+)
+
+// JobEvent is one step of a job's progress, streamed by GET /jobs/{id}/events
+type JobEvent struct {
+	ID          int64            `json:"id,omitempty"` // sequence number within the job, 0 for snapshots of the stored job
+	JobID       string           `json:"jobId"`
+	Type        JobEventType     `json:"type"`
+	Status      JobStatus        `json:"status,omitempty"`
+	Retry       int              `json:"retry,omitempty"`
+	NextRetryAt int64            `json:"nextRetryAt,omitempty"`
+	Provider    string           `json:"provider,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Result      *AnalyzeResponse `json:"result,omitempty"`
+	CreatedAt   int64            `json:"createdAt"`
+}
+
+// IsFinal reports whether no event follows this one
+func (e JobEvent) IsFinal() bool {
+	return e.Type == JobEventResult
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+
+	DefaultJobPageSize = 50
+	MaxJobPageSize     = 200
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// JobFilter selects a page of jobs, empty fields do not filter
+type JobFilter struct {
+	Statuses    []JobStatus
+	RequestType string
+	UserID      string
+	BoardID     string
+	Principal   string
+	BatchID     string
+	CreatedFrom int64  // inclusive unix seconds
+	CreatedTo   int64  // exclusive unix seconds
+	Cursor      string // NextCursor of the previous page
+	Limit       int
+	Order       string // asc or desc by creation time, desc by default
+}
+
+// Normalize applies the default order and clamps the page size
+func (f JobFilter) Normalize() JobFilter {
+	if f.Order != SortAsc {
+		f.Order = SortDesc
+	}
+	if f.Limit <= 0 {
+		f.Limit = DefaultJobPageSize
+	}
+	if f.Limit > MaxJobPageSize {
+		f.Limit = MaxJobPageSize
+	}
+	return f
+}
+
+// Matches reports whether a job passes every filter except the cursor
+func (f JobFilter) Matches(job Job) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			if job.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.RequestType != "" && job.Request.RequestType != f.RequestType {
+		return false
+	}
+	if f.UserID != "" && job.UserID != f.UserID {
+		return false
+	}
+	if f.BoardID != "" && job.BoardID != f.BoardID {
+		return false
+	}
+	if f.Principal != "" && job.Principal != f.Principal {
+		return false
+	}
+	if f.BatchID != "" && job.BatchID != f.BatchID {
+		return false
+	}
+	if f.CreatedFrom > 0 && job.CreatedAt < f.CreatedFrom {
+		return false
+	}
+	if f.CreatedTo > 0 && job.CreatedAt >= f.CreatedTo {
+		return false
+	}
+	return true
+}
+
+// JobPage is one page of a job listing
+type JobPage struct {
+	Jobs       []Job
+	NextCursor string
+}
+
+// JobListResponse is returned by GET /jobs
+type JobListResponse struct {
+	Jobs       []JobInfo `json:"jobs"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// JobCursor is the keyset position of a job in a listing ordered by creation
+// time. Job IDs are time-sortable, so the ID orders jobs created in the same second.
+type JobCursor struct {
+	CreatedAt int64
+	ID        string
+}
+
+// EncodeJobCursor builds the opaque cursor pointing right after job
+func EncodeJobCursor(job Job) string {
+	raw := strconv.FormatInt(job.CreatedAt, 10) + ":" + job.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeJobCursor parses a cursor produced by EncodeJobCursor
+func DecodeJobCursor(cursor string) (JobCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return JobCursor{}, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return JobCursor{}, ErrInvalidCursor
+	}
+	ts, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return JobCursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return JobCursor{CreatedAt: ts, ID: id}, nil
+}
+
+// After reports whether job comes after the cursor in the given order
+func (c JobCursor) After(job Job, order string) bool {
+	if order == SortAsc {
+		return job.CreatedAt > c.CreatedAt || (job.CreatedAt == c.CreatedAt && job.ID > c.ID)
+	}
+	return job.CreatedAt < c.CreatedAt || (job.CreatedAt == c.CreatedAt && job.ID < c.ID)
+}
@@ -95,29 +95,122 @@ func NewStructAnalyzeReq(req StructurizeRequest) AnalyzeRequest {
 	return AnalyzeRequest{RequestType: StructurizeType, StructurizeRequest: req}
 }
 
+// UserID returns the user that issued the underlying request
+func (r AnalyzeRequest) UserID() string {
+	switch r.RequestType {
+	case SummarizeType:
+		return r.SummarizeRequest.UserID
+	case StructurizeType:
+		return r.StructurizeRequest.UserID
+	default:
+		return ""
+	}
+}
+
+// BoardID returns the board the underlying request is about
+func (r AnalyzeRequest) BoardID() string {
+	switch r.RequestType {
+	case SummarizeType:
+		return r.SummarizeRequest.Board.BoardID
+	case StructurizeType:
+		return r.StructurizeRequest.Board.BoardID
+	default:
+		return ""
+	}
+}
+
+// TenantID returns the tenant of the user who made the request
+func (r AnalyzeRequest) TenantID() string {
+	switch r.RequestType {
+	case SummarizeType:
+		return r.SummarizeRequest.TenantID
+	case StructurizeType:
+		return r.StructurizeRequest.TenantID
+	default:
+		return ""
+	}
+}
+
+// Priority returns the scheduling priority of the request
+func (r AnalyzeRequest) Priority() JobPriority {
+	switch r.RequestType {
+	case SummarizeType:
+		return r.SummarizeRequest.Priority
+	case StructurizeType:
+		return r.StructurizeRequest.Priority
+	default:
+		return ""
+	}
+}
+
+// CallbackURL returns the webhook URL supplied with the underlying request
+func (r AnalyzeRequest) CallbackURL() string {
+	switch r.RequestType {
+	case SummarizeType:
+		return r.SummarizeRequest.CallbackURL
+	case StructurizeType:
+		return r.StructurizeRequest.CallbackURL
+	default:
+		return ""
+	}
+}
+
+// Region returns the region the underlying request is served from
+func (r AnalyzeRequest) Region() string {
+	switch r.RequestType {
+	case SummarizeType:
+		return r.SummarizeRequest.Region
+	case StructurizeType:
+		return r.StructurizeRequest.Region
+	default:
+		return ""
+	}
+}
+
+// SetRegion sets the region the underlying request is served from
+func (r *AnalyzeRequest) SetRegion(region string) {
+	switch r.RequestType {
+	case SummarizeType:
+		r.SummarizeRequest.Region = region
+	case StructurizeType:
+		r.StructurizeRequest.Region = region
+	}
+}
+
 type AnalyzeResponse struct {
 	SummarizeResponse   SummarizeResponse
 	StructurizeResponse StructurizeResponse
 }
 
 type SummarizeRequest struct {
-	RequestID   string `json:"requestId,omitempty"`
-	UserID      string `json:"userId,omitempty"`
-	RequestType string `json:"requestType"` // summarize
-	Board       Board  `json:"board"`
+	RequestID   string        `json:"requestId,omitempty"`
+	UserID      string        `json:"userId,omitempty"`
+	TenantID    string        `json:"tenantId,omitempty"` // organization the user belongs to, quotas apply to both
+	RequestType string        `json:"requestType"`        // summarize
+	Board       Board         `json:"board"`
+	CallbackURL string        `json:"callbackUrl,omitempty"`                      // webhook notified when an async job finishes
+	Priority    JobPriority   `json:"priority,omitempty" enums:"low,normal,high"` // queued jobs run by priority, normal by default
+	Mode        ExecutionMode `json:"mode,omitempty" enums:"sync,async"`          // async returns the job ID right away, takes precedence over the Prefer header
+	Region      string        `json:"region,omitempty" example:"RU"`              // region the request is served from, only providers available there are used; X-Region header or the tenant's region by default
 }
 type SummarizeResponse struct {
 	RequestID   string `json:"requestId"`
 	UserID      string `json:"userId"`
-	RequestType string `json:"requestType"` // summarize
-	Element     Text   `json:"text"`        // конкретный элемент - текст, который суммаризовал инфу по доске, расположенный в свободном пространстве доски
+	RequestType string `json:"requestType"`        // summarize
+	Element     Text   `json:"text"`               // конкретный элемент - текст, который суммаризовал инфу по доске, расположенный в свободном пространстве доски
+	Provider    string `json:"provider,omitempty"` // LLM provider that produced the response
 }
 type StructurizeRequest struct {
-	RequestID   string `json:"requestId"`
-	UserID      string `json:"userId"`
-	RequestType string `json:"requestType"` // structurize
-	Board       Board  `json:"board"`
-	File        File   `json:"file"`
+	RequestID   string        `json:"requestId"`
+	UserID      string        `json:"userId"`
+	TenantID    string        `json:"tenantId,omitempty"` // organization the user belongs to, quotas apply to both
+	RequestType string        `json:"requestType"`        // structurize
+	Board       Board         `json:"board"`
+	File        File          `json:"file"`
+	CallbackURL string        `json:"callbackUrl,omitempty"`                      // webhook notified when an async job finishes
+	Priority    JobPriority   `json:"priority,omitempty" enums:"low,normal,high"` // queued jobs run by priority, normal by default
+	Mode        ExecutionMode `json:"mode,omitempty" enums:"sync,async"`          // async returns the job ID right away, takes precedence over the Prefer header
+	Region      string        `json:"region,omitempty" example:"RU"`              // region the request is served from, only providers available there are used; X-Region header or the tenant's region by default
 }
 type StructurizeResponse struct {
 	RequestID      string `json:"requestId"`
@@ -125,6 +218,7 @@ type StructurizeResponse struct {
 	RequestType    string `json:"requestType"`    // structurize
 	AiTreeResponse string `json:"aiTreeResponse"` // дерево ASCII файлов
 	File           File   `json:"file"`
+	Provider       string `json:"provider,omitempty"` // LLM provider that produced the response
 }
 
 type File struct {
@@ -148,11 +242,45 @@ type Abort struct {
 
 // Job represents a unit of work in the system.
 type Job struct {
-	ID        string
-	Request   AnalyzeRequest
-	CreatedAt int64
-	Retries   int
-	Status    JobStatus
+	ID        string           `json:"id"`
+	Request   AnalyzeRequest   `json:"request"`
+	CreatedAt int64            `json:"createdAt"`
+	Retries   int              `json:"retries"`
+	Status    JobStatus        `json:"status"`
+	UserID    string           `json:"userId,omitempty"`
+	BoardID   string           `json:"boardId,omitempty"`
+	Result    *AnalyzeResponse `json:"result,omitempty"` // set once the job is completed
+	Error     string           `json:"error,omitempty"`  // failure reason for failed jobs
+	// CallbackURL receives a webhook when the job completes or fails
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	// NextRetryAt is the unix time before which a retried job is not picked up again
+	NextRetryAt int64 `json:"nextRetryAt,omitempty"`
+	// LeaseOwner and LeaseExpiresAt identify the worker running the job, a
+	// running job whose lease expired is considered abandoned by a crash
+	LeaseOwner     string `json:"leaseOwner,omitempty"`
+	LeaseExpiresAt int64  `json:"leaseExpiresAt,omitempty"`
+	// Recoveries counts how often the job was re-queued after its lease expired
+	Recoveries int `json:"recoveries,omitempty"`
+	// Principal is the authenticated caller that submitted the job, only it
+	// and admins may see the job. Empty for jobs submitted anonymously.
+	Principal string `json:"principal,omitempty"`
+	// BatchID is the batch the job was submitted with, if any
+	BatchID string `json:"batchId,omitempty"`
+	// TraceParent is the W3C trace context of the request that submitted the
+	// job, its processing continues that trace
+	TraceParent string `json:"traceParent,omitempty"`
+	// Provider is the LLM provider that answered the job, or the last one
+	// tried when every attempt failed
+	Provider string `json:"provider,omitempty"`
+}
+
+// JobAbandonedError is the failure reason of a job whose lease expired more often than allowed
+const JobAbandonedError = "job abandoned: its worker stopped responding too many times"
+
+// Lease grants a worker ownership of a running job until ExpiresAt (unix seconds)
+type Lease struct {
+	Owner     string
+	ExpiresAt int64
 }
 
 type JobStatus string
@@ -165,6 +293,151 @@ const (
 	JobStatusAborted   JobStatus = "aborted"
 )
 
+// IsFinished reports whether a job in this status will not change anymore
+func (s JobStatus) IsFinished() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed || s == JobStatusAborted
+}
+
+// ExecutionMode is whether the client waits for the response or gets a job ID
+type ExecutionMode string
+
+const (
+	// ExecutionSync waits for the response, falling back to a job after the sync timeout
+	ExecutionSync ExecutionMode = "sync"
+	// ExecutionAsync queues the request and returns its job ID right away
+	ExecutionAsync ExecutionMode = "async"
+)
+
+// Valid reports whether m is a known mode, empty leaving the choice to the Prefer header
+func (m ExecutionMode) Valid() bool {
+	return m == "" || m == ExecutionSync || m == ExecutionAsync
+}
+
+// JobPriority orders queued jobs, higher priorities are picked up first
+type JobPriority string
+
+const (
+	JobPriorityLow    JobPriority = "low"
+	JobPriorityNormal JobPriority = "normal"
+	JobPriorityHigh   JobPriority = "high"
+)
+
+// Valid reports whether p is a known priority, empty meaning normal
+func (p JobPriority) Valid() bool {
+	switch p {
+	case "", JobPriorityLow, JobPriorityNormal, JobPriorityHigh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Level ranks the priority from 0 (low) to 2 (high)
+func (p JobPriority) Level() int {
+	switch p {
+	case JobPriorityLow:
+		return 0
+	case JobPriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// JobInfo holds the job metadata shared by every job response envelope
+type JobInfo struct {
+	JobID       string    `json:"jobId"`
+	RequestType string    `json:"requestType"`
+	Status      JobStatus `json:"status"`
+	UserID      string    `json:"userId,omitempty"`
+	BoardID     string    `json:"boardId,omitempty"`
+	BatchID     string    `json:"batchId,omitempty"`
+	CreatedAt   int64     `json:"createdAt"`
+	Retries     int       `json:"retries"`
+	Error       string    `json:"error,omitempty"`
+	Provider    string    `json:"provider,omitempty"` // LLM provider that answered the job
+}
+
+// SummarizeJobResponse is the job status envelope for summarize jobs
+type SummarizeJobResponse struct {
+	JobInfo
+	Result *SummarizeResponse `json:"result,omitempty"`
+}
+
+// StructurizeJobResponse is the job status envelope for structurize jobs
+type StructurizeJobResponse struct {
+	JobInfo
+	Result *StructurizeResponse `json:"result,omitempty"`
+}
+
+// JobResponse documents the job status envelope in the API docs, which have
+// no oneOf: it is a SummarizeJobResponse or a StructurizeJobResponse depending
+// on requestType. NewJobResponse builds the actual envelope.
+type JobResponse struct {
+	JobInfo
+	Result any `json:"result,omitempty" swaggertype:"object"` // SummarizeResponse for summarize jobs, StructurizeResponse for structurize jobs
+}
+
+// NewJobInfo extracts the response metadata of a job
+func NewJobInfo(job Job) JobInfo {
+	return JobInfo{
+		JobID:       job.ID,
+		RequestType: job.Request.RequestType,
+		Status:      job.Status,
+		UserID:      job.UserID,
+		BoardID:     job.BoardID,
+		BatchID:     job.BatchID,
+		CreatedAt:   job.CreatedAt,
+		Retries:     job.Retries,
+		Error:       job.Error,
+		Provider:    job.Provider,
+	}
+}
+
+// NewJobResponse builds the typed response envelope matching the job request type
+func NewJobResponse(job Job) any {
+	info := NewJobInfo(job)
+
+	switch job.Request.RequestType {
+	case StructurizeType:
+		resp := StructurizeJobResponse{JobInfo: info}
+		if job.Result != nil {
+			resp.Result = &job.Result.StructurizeResponse
+		}
+		return resp
+	default:
+		resp := SummarizeJobResponse{JobInfo: info}
+		if job.Result != nil {
+			resp.Result = &job.Result.SummarizeResponse
+		}
+		return resp
+	}
+}
+
+// CallbackDelivery records a single webhook delivery attempt for a job
+type CallbackDelivery struct {
+	ID         int64  `json:"id"`
+	JobID      string `json:"jobId"`
+	URL        string `json:"url"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Success    bool   `json:"success"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// IdempotencyRecord maps a user's Idempotency-Key to the job it started or
+// the response it was answered with
+type IdempotencyRecord struct {
+	UserID      string
+	Key         string
+	RequestHash string // fingerprint of the request body, a reused key must send the same body
+	JobID       string
+	Response    *AnalyzeResponse // set once the request completed synchronously
+	CreatedAt   int64
+	ExpiresAt   int64
+}
+
 type TranscriptionResult struct {
 	Text     string
 	Language string
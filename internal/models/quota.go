@@ -0,0 +1,51 @@
+package models
+
+// QuotaScope names who a quota applies to
+type QuotaScope string
+
+const (
+	QuotaScopeUser   QuotaScope = "user"
+	QuotaScopeTenant QuotaScope = "tenant"
+)
+
+// Valid reports whether s is a known scope
+func (s QuotaScope) Valid() bool {
+	return s == QuotaScopeUser || s == QuotaScopeTenant
+}
+
+// QuotaSubject identifies the user or tenant a quota is counted for
+type QuotaSubject struct {
+	Scope QuotaScope
+	ID    string
+}
+
+// QuotaLimits caps the usage of a user or tenant, a zero limit means unlimited
+type QuotaLimits struct {
+	Scope             QuotaScope `json:"scope"`
+	SubjectID         string     `json:"subjectId"`
+	RequestsPerMinute int        `json:"requestsPerMinute"`
+	ConcurrentJobs    int        `json:"concurrentJobs"`
+	DailyTokens       int64      `json:"dailyTokens"`
+	DailyCost         float64    `json:"dailyCost"` // in the currency of the configured token prices
+	UpdatedAt         int64      `json:"updatedAt,omitempty"`
+}
+
+// Subject returns the user or tenant the limits belong to
+func (l QuotaLimits) Subject() QuotaSubject {
+	return QuotaSubject{Scope: l.Scope, ID: l.SubjectID}
+}
+
+// QuotaUsage is the consumption of a user or tenant counted against its limits
+type QuotaUsage struct {
+	RequestsThisMinute int     `json:"requestsThisMinute"`
+	ConcurrentJobs     int     `json:"concurrentJobs"`
+	TokensToday        int64   `json:"tokensToday"`
+	CostToday          float64 `json:"costToday"`
+}
+
+// QuotaStatus reports the limits of a user or tenant and its current usage
+type QuotaStatus struct {
+	Limits QuotaLimits `json:"limits"`
+	Custom bool        `json:"custom"` // false when the configured defaults apply
+	Usage  QuotaUsage  `json:"usage"`
+}
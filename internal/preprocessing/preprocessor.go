@@ -1,6 +1,7 @@
 package preprocessing
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -9,8 +10,13 @@ import (
 
 	"github.com/aiservice/internal/models"
 	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/aiservice/internal/preprocessing")
+
 const summarizePrompt = `
 Тебе нужно следовать строго моей инструкции.
 Ты получаешь набор "сырых" данных, которые нужно будет суметь обработать и ним выдать суммаризацию всего на доске.
@@ -122,7 +128,9 @@ func NewPreprocessor() *Preprocessor {
 }
 
 // PreprocessSummarizeRequest transforms a raw summarize request into a structured format
-func (p *Preprocessor) PreprocessSummarizeRequest(req models.SummarizeRequest) ([]*ai.Part, error) {
+func (p *Preprocessor) PreprocessSummarizeRequest(ctx context.Context, req models.SummarizeRequest) ([]*ai.Part, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("board.elements", len(req.Board.Elements)))
+
 	// Check for potential memory issues
 	if len(req.Board.Elements) > 1000 {
 		return nil, fmt.Errorf("too many elements in board, maximum allowed is 1000")
@@ -139,15 +147,15 @@ func (p *Preprocessor) PreprocessSummarizeRequest(req models.SummarizeRequest) (
 		return nil, fmt.Errorf("board data too large, maximum allowed is 10MB")
 	}
 
-	// Perform spatial analysis
-	clusters := p.analyzeSpatialRelationships(req.Board.Elements)
-	relationships := p.identifyElementRelationships(req.Board.Elements)
-
-	// Create spatial analysis summary
-	spatialAnalysis := p.createSpatialAnalysisSummary(clusters, relationships)
+	// Perform spatial analysis and create its summary
+	spatialAnalysis := phase(ctx, "spatial_analysis", func() string {
+		return p.analyzeSpatial(req.Board.Elements)
+	})
 
 	// Create semantic annotations
-	semanticAnnotations := p.annotateSemantics(req.Board.Elements)
+	semanticAnnotations := phase(ctx, "semantic_annotation", func() string {
+		return p.annotateSemantics(req.Board.Elements)
+	})
 
 	// Check if combined analysis is too large
 	totalSize := len(rawData) + len(spatialAnalysis) + len(semanticAnnotations)
@@ -182,7 +190,9 @@ Please provide a summary of the key points and conclusions from this board, cons
 }
 
 // PreprocessStructurizeRequest transforms a raw structurize request into a structured format
-func (p *Preprocessor) PreprocessStructurizeRequest(req models.StructurizeRequest) ([]*ai.Part, error) {
+func (p *Preprocessor) PreprocessStructurizeRequest(ctx context.Context, req models.StructurizeRequest) ([]*ai.Part, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("board.elements", len(req.Board.Elements)))
+
 	// Check for potential memory issues
 	if len(req.Board.Elements) > 1000 {
 		return nil, fmt.Errorf("too many elements in board, maximum allowed is 1000")
@@ -199,18 +209,20 @@ func (p *Preprocessor) PreprocessStructurizeRequest(req models.StructurizeReques
 		return nil, fmt.Errorf("board data too large, maximum allowed is 10MB")
 	}
 
-	// Perform spatial analysis
-	clusters := p.analyzeSpatialRelationships(req.Board.Elements)
-	relationships := p.identifyElementRelationships(req.Board.Elements)
-
-	// Create spatial analysis summary
-	spatialAnalysis := p.createSpatialAnalysisSummary(clusters, relationships)
+	// Perform spatial analysis and create its summary
+	spatialAnalysis := phase(ctx, "spatial_analysis", func() string {
+		return p.analyzeSpatial(req.Board.Elements)
+	})
 
 	// Create semantic annotations
-	semanticAnnotations := p.annotateSemantics(req.Board.Elements)
+	semanticAnnotations := phase(ctx, "semantic_annotation", func() string {
+		return p.annotateSemantics(req.Board.Elements)
+	})
 
 	// Create a structured representation of the file hierarchy
-	fileStructure := p.createFileHierarchyDescription(req.File)
+	fileStructure := phase(ctx, "file_hierarchy", func() string {
+		return p.createFileHierarchyDescription(req.File)
+	})
 
 	// Check if combined analysis is too large
 	totalSize := len(rawData) + len(spatialAnalysis) + len(semanticAnnotations) + len(fileStructure)
@@ -249,6 +261,20 @@ Please create a proper file structure based on the board content, considering th
 	return parts, nil
 }
 
+// phase runs one preprocessing phase in its own span
+func phase[T any](ctx context.Context, name string, run func() T) T {
+	_, span := tracer.Start(ctx, "preprocess."+name)
+	defer span.End()
+	return run()
+}
+
+// analyzeSpatial clusters the elements, finds their relationships and summarizes both
+func (p *Preprocessor) analyzeSpatial(elements []models.Element) string {
+	clusters := p.analyzeSpatialRelationships(elements)
+	relationships := p.identifyElementRelationships(elements)
+	return p.createSpatialAnalysisSummary(clusters, relationships)
+}
+
 // analyzeSpatialRelationships performs clustering and relationship analysis
 func (p *Preprocessor) analyzeSpatialRelationships(elements []models.Element) []SpatialCluster {
 	if len(elements) == 0 {
@@ -1,6 +1,7 @@
 package preprocessing
 
 import (
+	"context"
 	"testing"
 
 	"github.com/aiservice/internal/models"
@@ -37,7 +38,7 @@ func TestPreprocessor(t *testing.T) {
 			},
 		}
 
-		parts, err := preprocessor.PreprocessSummarizeRequest(req)
+		parts, err := preprocessor.PreprocessSummarizeRequest(context.Background(), req)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, parts)
 		assert.Contains(t, parts[0].Text, "Project Goals")
@@ -77,7 +78,7 @@ func TestPreprocessor(t *testing.T) {
 			},
 		}
 
-		parts, err := preprocessor.PreprocessStructurizeRequest(req)
+		parts, err := preprocessor.PreprocessStructurizeRequest(context.Background(), req)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, parts)
 		assert.Contains(t, parts[0].Text, "project-root")
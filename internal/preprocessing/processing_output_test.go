@@ -1,6 +1,7 @@
 package preprocessing
 
 import (
+	"context"
 	"testing"
 
 	"github.com/aiservice/internal/models"
@@ -316,7 +317,7 @@ func TestProcessingCatDrawingData(t *testing.T) {
 		Board: board,
 	}
 
-	parts, err := preprocessor.PreprocessSummarizeRequest(req)
+	parts, err := preprocessor.PreprocessSummarizeRequest(context.Background(), req)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, parts)
 
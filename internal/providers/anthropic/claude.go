@@ -0,0 +1,263 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/providers"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// DefaultBaseURL is the Anthropic API
+const DefaultBaseURL = "https://api.anthropic.com"
+
+const (
+	apiVersion = "2023-06-01"
+	maxTokens  = 8192
+
+	maxErrorBody = 4 << 10
+)
+
+// Tools the model is made to call with the flow output as input
+const (
+	summarizeTool   = "record_summary"
+	structurizeTool = "record_structure"
+)
+
+// AnthropicClient calls the Anthropic Messages API. Structured output is a
+// forced call of a tool whose input schema is the flow schema.
+type AnthropicClient struct {
+	cfg    providers.ProviderConfig
+	client *http.Client
+}
+
+// NewAnthropicClient creates a client for the API key and model of cfg
+func NewAnthropicClient(cfg providers.ProviderConfig) *AnthropicClient {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &AnthropicClient{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (c *AnthropicClient) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
+	var out providers.SummarizeFlow
+	outputTool := tool{
+		Name:        summarizeTool,
+		Description: "Record the summary of the board as a text element placed in free space on the board.",
+		InputSchema: providers.SummarizeSchema(),
+	}
+	if err := c.generate(ctx, parts, outputTool, &out); err != nil {
+		return models.SummarizeResponse{}, err
+	}
+	return models.SummarizeResponse{Element: out.Element}, nil
+}
+
+func (c *AnthropicClient) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
+	var out providers.SimpleStructurizeFlow
+	outputTool := tool{
+		Name:        structurizeTool,
+		Description: "Record the file hierarchy structuring the board content.",
+		InputSchema: providers.StructurizeSchema(),
+	}
+	if err := c.generate(ctx, parts, outputTool, &out); err != nil {
+		return models.StructurizeResponse{}, err
+	}
+	return models.StructurizeResponse{
+		AiTreeResponse: out.AiTreeResponse,
+		File:           out.File.ToModelFile(),
+	}, nil
+}
+
+// GetName returns the name the client is configured with
+func (c *AnthropicClient) GetName() string {
+	return c.cfg.Name
+}
+
+type messagesRequest struct {
+	Model      string     `json:"model"`
+	MaxTokens  int        `json:"max_tokens"`
+	Messages   []message  `json:"messages"`
+	Tools      []tool     `json:"tools"`
+	ToolChoice toolChoice `json:"tool_choice"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type   string       `json:"type"` // text or image
+	Text   string       `json:"text,omitempty"`
+	Source *imageSource `json:"source,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"` // base64 or url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type toolChoice struct {
+	Type string `json:"type"` // tool, to force the call of Name
+	Name string `json:"name"`
+}
+
+type messagesResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// generate sends parts as the user message forcing a call of outputTool, and
+// decodes the tool input into out
+func (c *AnthropicClient) generate(ctx context.Context, parts []*ai.Part, outputTool tool, out any) error {
+	content, err := toContent(parts)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(messagesRequest{
+		Model:      c.cfg.Model,
+		MaxTokens:  maxTokens,
+		Messages:   []message{{Role: "user", Content: content}},
+		Tools:      []tool{outputTool},
+		ToolChoice: toolChoice{Type: "tool", Name: outputTool.Name},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal messages request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.BaseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create messages request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", c.cfg.APIKey)
+	req.Header.Set("Anthropic-Version", apiVersion)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", c.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return c.providerError(resp)
+	}
+
+	var msg messagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", c.cfg.Name, err)
+	}
+	providers.ReportUsage(ctx, &ai.GenerationUsage{
+		InputTokens:  msg.Usage.InputTokens,
+		OutputTokens: msg.Usage.OutputTokens,
+	})
+
+	if msg.StopReason == "max_tokens" {
+		return fmt.Errorf("%s response was cut at the token limit", c.cfg.Name)
+	}
+	for _, block := range msg.Content {
+		if block.Type == "tool_use" && block.Name == outputTool.Name {
+			if err := json.Unmarshal(block.Input, out); err != nil {
+				return fmt.Errorf("failed to parse %s tool input: %w", c.cfg.Name, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%s did not call the %s tool", c.cfg.Name, outputTool.Name)
+}
+
+// toContent converts Genkit parts to Messages API content blocks
+func toContent(parts []*ai.Part) ([]contentBlock, error) {
+	content := make([]contentBlock, 0, len(parts))
+	for _, p := range parts {
+		switch {
+		case p.IsText():
+			content = append(content, contentBlock{Type: "text", Text: p.Text})
+		case p.IsImage():
+			source, err := toImageSource(p)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, contentBlock{Type: "image", Source: source})
+		default:
+			return nil, fmt.Errorf("unsupported %s part", p.ContentType)
+		}
+	}
+	return content, nil
+}
+
+// toImageSource returns the source of an image given as a data URL, whose
+// media type wins over the one of the part, or as a URL the API downloads
+func toImageSource(p *ai.Part) (*imageSource, error) {
+	if !strings.HasPrefix(p.Text, "data:") {
+		return &imageSource{Type: "url", URL: p.Text}, nil
+	}
+	header, data, ok := strings.Cut(strings.TrimPrefix(p.Text, "data:"), ";base64,")
+	if !ok {
+		return nil, fmt.Errorf("image data URL is not base64 encoded")
+	}
+	mediaType := p.ContentType
+	if header != "" {
+		mediaType = header
+	}
+	return &imageSource{Type: "base64", MediaType: mediaType, Data: data}, nil
+}
+
+// errorTypes maps the error types of the API to provider error types, see
+// https://docs.anthropic.com/en/api/errors
+var errorTypes = map[string]providers.ProviderErrorType{
+	"authentication_error": providers.AuthError,
+	"permission_error":     providers.AccessDeniedError,
+	"rate_limit_error":     providers.RateLimitError,
+	"api_error":            providers.InternalError,
+	"overloaded_error":     providers.InternalError,
+	"timeout_error":        providers.TimeoutError,
+}
+
+// providerError converts an error response into a ProviderError, typed by the
+// error type of the body or else by the status code
+func (c *AnthropicClient) providerError(resp *http.Response) *providers.ProviderError {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var body struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	message := string(data)
+	if json.Unmarshal(data, &body) == nil && body.Error.Message != "" {
+		message = body.Error.Message
+	}
+
+	providerErr := providers.NewStatusError(c.cfg.Name, resp, body.Error.Type, message)
+	if errorType, ok := errorTypes[body.Error.Type]; ok {
+		providerErr.Type = errorType
+	}
+	return providerErr
+}
@@ -0,0 +1,152 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/providers"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureServer replays the recorded response testdata/<fixture>.json with
+// status, the decoded requests are sent to requests when it is not nil
+func fixtureServer(t *testing.T, status int, fixture string, requests chan<- map[string]any) *httptest.Server {
+	data, err := os.ReadFile(filepath.Join("testdata", fixture+".json"))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("X-Api-Key"))
+		assert.Equal(t, apiVersion, r.Header.Get("Anthropic-Version"))
+
+		if requests != nil {
+			var body map[string]any
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			requests <- body
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(name, baseURL string) *AnthropicClient {
+	return NewAnthropicClient(providers.ProviderConfig{
+		Name:    name,
+		APIKey:  "test-key",
+		BaseURL: baseURL,
+		Model:   "claude-sonnet-4-5",
+		Timeout: 5 * time.Second,
+	})
+}
+
+func TestAnthropicClient_Summarize(t *testing.T) {
+	requests := make(chan map[string]any, 1)
+	server := fixtureServer(t, http.StatusOK, "summarize", requests)
+	client := newTestClient("anthropic", server.URL)
+
+	var usage providers.Usage
+	ctx := providers.WithUsageObserver(context.Background(), func(u providers.Usage) { usage = u })
+	resp, err := client.Summarize(ctx, []*ai.Part{
+		ai.NewTextPart("Summarize the board"),
+		ai.NewMediaPart("image/jpeg", "data:image/png;base64,iVBORw0KGgo="),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Sprint 12: release on Friday, two blockers left in review.", resp.Element.Content)
+	assert.Equal(t, float32(640), resp.Element.X)
+	assert.Equal(t, 1843, usage.InputTokens)
+	assert.Equal(t, 112, usage.OutputTokens)
+
+	body := <-requests
+	assert.Equal(t, "claude-sonnet-4-5", body["model"])
+	assert.Equal(t, map[string]any{"type": "tool", "name": summarizeTool}, body["tool_choice"])
+	tools := body["tools"].([]any)
+	require.Len(t, tools, 1)
+	assert.Equal(t, summarizeTool, tools[0].(map[string]any)["name"])
+	assert.Contains(t, tools[0].(map[string]any)["input_schema"].(map[string]any)["properties"], "element")
+
+	content := body["messages"].([]any)[0].(map[string]any)["content"]
+	assert.Equal(t, []any{
+		map[string]any{"type": "text", "text": "Summarize the board"},
+		// The media type of the data URL wins over the one of the part
+		map[string]any{"type": "image", "source": map[string]any{"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}},
+	}, content)
+}
+
+func TestAnthropicClient_Structurize(t *testing.T) {
+	server := fixtureServer(t, http.StatusOK, "structurize", nil)
+	client := newTestClient("anthropic", server.URL)
+
+	resp, err := client.Structurize(context.Background(), []*ai.Part{
+		ai.NewTextPart("Structurize the board"),
+		ai.NewMediaPart("image/jpeg", "https://example.com/board.jpg"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Sprint 12 board grouped by workstream", resp.AiTreeResponse)
+	assert.Equal(t, "Sprint 12", resp.File.Name)
+	require.Len(t, resp.File.Children, 1)
+	assert.Equal(t, "Backend", resp.File.Children[0].Name)
+}
+
+func TestAnthropicClient_ErrorTypes(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		status    int
+		errorType providers.ProviderErrorType
+		retryable bool
+	}{
+		{"authentication_error", http.StatusUnauthorized, providers.AuthError, false},
+		{"permission_error", http.StatusForbidden, providers.AccessDeniedError, false},
+		{"rate_limit_error", http.StatusTooManyRequests, providers.RateLimitError, true},
+		{"overloaded_error", 529, providers.InternalError, true},
+		{"invalid_request_error", http.StatusBadRequest, providers.UnknownError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			server := fixtureServer(t, tt.status, tt.fixture, nil)
+			client := newTestClient("anthropic", server.URL)
+
+			_, err := client.Summarize(context.Background(), []*ai.Part{ai.NewTextPart("Summarize the board")})
+
+			var providerErr *providers.ProviderError
+			require.True(t, errors.As(err, &providerErr), err)
+			assert.Equal(t, tt.errorType, providerErr.Type)
+			assert.Equal(t, tt.status, providerErr.StatusCode)
+			assert.Equal(t, "anthropic", providerErr.ProviderName)
+			assert.Equal(t, tt.retryable, providers.IsRetryable(err))
+		})
+	}
+}
+
+func TestAnthropicClient_ManagerFailsOverOnOverload(t *testing.T) {
+	overloaded := fixtureServer(t, 529, "overloaded_error", nil)
+	healthy := fixtureServer(t, http.StatusOK, "summarize", nil)
+
+	pm := providers.NewProviderManager(&providers.MultiProviderConfig{Providers: []providers.ProviderConfig{
+		{Name: "anthropic", Priority: 1, Enabled: true},
+		{Name: "anthropic-backup", Priority: 2, Enabled: true},
+	}})
+	pm.RegisterProvider("anthropic", newTestClient("anthropic", overloaded.URL))
+	pm.RegisterProvider("anthropic-backup", newTestClient("anthropic-backup", healthy.URL))
+
+	var attempts []string
+	ctx := providers.WithAttemptObserver(context.Background(), func(provider string) { attempts = append(attempts, provider) })
+	resp, err := pm.Summarize(ctx, []*ai.Part{ai.NewTextPart("Summarize the board")})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"anthropic", "anthropic-backup"}, attempts)
+	assert.Equal(t, "summary-1", resp.Element.Id)
+}
@@ -3,6 +3,8 @@ package providers
 import (
 	"sync"
 	"time"
+
+	"github.com/aiservice/internal/metrics"
 )
 
 // CircuitBreakerState represents the state of a circuit breaker
@@ -57,6 +59,7 @@ func (cb *CircuitBreaker) IsOpen(providerName string) bool {
 		breaker.state = HalfOpenState
 		breaker.halfOpenTryAt = now.Add(1 * time.Second) // Allow one test request after 1 second
 		breaker.halfOpenTryNum = 0
+		metrics.CircuitBreakerState.WithLabelValues(providerName).Set(metrics.CircuitHalfOpen)
 	}
 
 	// In half-open state, allow one request after the timeout
@@ -97,8 +100,59 @@ func (cb *CircuitBreaker) Trip(providerName string) {
 
 	// Trip the circuit if we've exceeded the failure threshold
 	if breaker.failureCount >= breaker.maxFailures {
+		if breaker.state != OpenState {
+			metrics.CircuitBreakerTrips.WithLabelValues(providerName).Inc()
+		}
 		breaker.state = OpenState
 		breaker.openUntil = time.Now().Add(breaker.resetTimeout)
+		metrics.CircuitBreakerState.WithLabelValues(providerName).Set(metrics.CircuitOpen)
+	}
+}
+
+// OpenFor opens the circuit breaker for the given provider for at least d,
+// e.g. the Retry-After of its last response, whatever its failure count
+func (cb *CircuitBreaker) OpenFor(providerName string, d time.Duration) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	breaker, exists := cb.breakers[providerName]
+	if !exists {
+		breaker = &singleCircuitBreaker{
+			maxFailures:  3,
+			resetTimeout: 30 * time.Second,
+		}
+		cb.breakers[providerName] = breaker
+	}
+
+	breaker.failureCount++
+	breaker.lastFailure = time.Now()
+	if breaker.state != OpenState {
+		metrics.CircuitBreakerTrips.WithLabelValues(providerName).Inc()
+	}
+	breaker.state = OpenState
+	if until := breaker.lastFailure.Add(d); until.After(breaker.openUntil) {
+		breaker.openUntil = until
+	}
+	metrics.CircuitBreakerState.WithLabelValues(providerName).Set(metrics.CircuitOpen)
+}
+
+// RemainingOpen returns how long the circuit breaker for the given provider
+// keeps blocking requests, zero when it lets them through
+func (cb *CircuitBreaker) RemainingOpen(providerName string) time.Duration {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	breaker, exists := cb.breakers[providerName]
+	if !exists {
+		return 0
+	}
+	switch breaker.state {
+	case OpenState:
+		return max(time.Until(breaker.openUntil), 0)
+	case HalfOpenState:
+		return max(time.Until(breaker.halfOpenTryAt), 0)
+	default:
+		return 0
 	}
 }
 
@@ -122,6 +176,7 @@ func (cb *CircuitBreaker) Reset(providerName string) {
 	breaker.openUntil = time.Time{}
 	breaker.halfOpenTryAt = time.Time{}
 	breaker.halfOpenTryNum = 0
+	metrics.CircuitBreakerState.WithLabelValues(providerName).Set(metrics.CircuitClosed)
 }
 
 // Success should be called when a request succeeds
@@ -148,5 +203,6 @@ func (cb *CircuitBreaker) Success(providerName string) {
 		breaker.openUntil = time.Time{}
 		breaker.halfOpenTryAt = time.Time{}
 		breaker.halfOpenTryNum = 0
+		metrics.CircuitBreakerState.WithLabelValues(providerName).Set(metrics.CircuitClosed)
 	}
 }
\ No newline at end of file
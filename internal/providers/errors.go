@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewStatusError is the error provider clients return for an error response
+// of their API, typed by its status code. code is the error code of the API
+// body if any, message its error message, and the wait of a Retry-After
+// header is kept for the circuit breaker and job retries.
+func NewStatusError(providerName string, resp *http.Response, code, message string) *ProviderError {
+	return &ProviderError{
+		Type:         ErrorTypeForStatus(resp.StatusCode),
+		Message:      fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(message)),
+		StatusCode:   resp.StatusCode,
+		Code:         code,
+		RetryAfter:   parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		ProviderName: providerName,
+	}
+}
+
+// ErrorTypeForStatus types an error response by its HTTP status code
+func ErrorTypeForStatus(status int) ProviderErrorType {
+	switch {
+	case status == http.StatusUnauthorized:
+		return AuthError
+	case status == http.StatusForbidden:
+		return AccessDeniedError
+	case status == http.StatusTooManyRequests:
+		return RateLimitError
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return TimeoutError
+	case status >= http.StatusInternalServerError:
+		return InternalError
+	default:
+		return UnknownError
+	}
+}
+
+// parseRetryAfter returns the wait of a Retry-After header given in seconds
+// or as an HTTP date, zero when there is none or it has passed
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// RetryAfter returns how long the provider that failed a request asked to
+// wait before it is sent again, or when every provider failed, how long
+// until the first of them that asked to wait takes requests again. It is
+// zero when none said.
+func RetryAfter(err error) time.Duration {
+	var allFailed *AllProvidersFailedError
+	if errors.As(err, &allFailed) && allFailed.RetryAfter > 0 {
+		return allFailed.RetryAfter
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
+
+// transportErrorType types the errors of requests that got no response. A
+// cancelled request is not the provider's fault and stays unknown.
+func transportErrorType(err error) ProviderErrorType {
+	if errors.Is(err, context.Canceled) {
+		return UnknownError
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return TimeoutError
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return TimeoutError
+		}
+		return ConnectionError
+	}
+	return UnknownError
+}
@@ -2,8 +2,10 @@ package gemini
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/aiservice/internal/config"
 	"github.com/aiservice/internal/models"
@@ -11,6 +13,7 @@ import (
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/firebase/genkit/go/plugins/googlegenai"
+	"google.golang.org/genai"
 )
 
 type GeminiClient struct {
@@ -34,7 +37,7 @@ func (g *GeminiClient) Summarize(ctx context.Context, parts []*ai.Part) (models.
 	aiResp, err := providers.RunSummarizeGeneration(ctx, g.gkit, parts)
 	if err != nil {
 		slog.Error("could not generate response:", "err", err)
-		return models.SummarizeResponse{}, err
+		return models.SummarizeResponse{}, g.providerError(err)
 	}
 	return models.SummarizeResponse{Element: aiResp.Element}, nil
 }
@@ -43,7 +46,7 @@ func (g *GeminiClient) Structurize(ctx context.Context, parts []*ai.Part) (model
 	file, aiTreeResponse, err := providers.RunStructurizeGenerationAndConvert(ctx, g.gkit, parts)
 	if err != nil {
 		slog.Error("could not generate response:", "err", err)
-		return models.StructurizeResponse{}, err
+		return models.StructurizeResponse{}, g.providerError(err)
 	}
 
 	return models.StructurizeResponse{
@@ -55,3 +58,37 @@ func (g *GeminiClient) Structurize(ctx context.Context, parts []*ai.Part) (model
 func (g *GeminiClient) GetName() string {
 	return "gemini"
 }
+
+// providerError types the API errors of Gemini by their status code, other
+// errors are returned as they are
+func (g *GeminiClient) providerError(err error) error {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	return &providers.ProviderError{
+		Type:         providers.ErrorTypeForStatus(apiErr.Code),
+		Message:      apiErr.Message,
+		StatusCode:   apiErr.Code,
+		Code:         apiErr.Status,
+		RetryAfter:   retryDelay(apiErr.Details),
+		ProviderName: g.GetName(),
+		OriginalErr:  err,
+	}
+}
+
+// retryDelay returns the delay of the RetryInfo detail of an API error, which
+// Gemini sends with its 429 responses
+func retryDelay(details []map[string]any) time.Duration {
+	for _, detail := range details {
+		if detail["@type"] != "type.googleapis.com/google.rpc.RetryInfo" {
+			continue
+		}
+		if delay, ok := detail["retryDelay"].(string); ok {
+			if d, err := time.ParseDuration(delay); err == nil {
+				return d
+			}
+		}
+	}
+	return 0
+}
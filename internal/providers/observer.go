@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// AttemptObserver is told the name of every provider about to handle a request
+type AttemptObserver func(provider string)
+
+type attemptObserverKey struct{}
+
+// WithAttemptObserver returns a context whose provider attempts are reported to observe
+func WithAttemptObserver(ctx context.Context, observe AttemptObserver) context.Context {
+	return context.WithValue(ctx, attemptObserverKey{}, observe)
+}
+
+// notifyAttempt reports a provider attempt to the observer of ctx, if any
+func notifyAttempt(ctx context.Context, provider string) {
+	if observe, ok := ctx.Value(attemptObserverKey{}).(AttemptObserver); ok {
+		observe(provider)
+	}
+}
+
+// Usage is the token consumption of one LLM call
+type Usage struct {
+	Provider     string // empty when the client is not run by a ProviderManager
+	InputTokens  int
+	OutputTokens int
+}
+
+// UsageObserver is told the token usage of every completed LLM call
+type UsageObserver func(usage Usage)
+
+type usageObserverKey struct{}
+
+type providerNameKey struct{}
+
+// WithUsageObserver returns a context whose LLM token usage is reported to observe
+func WithUsageObserver(ctx context.Context, observe UsageObserver) context.Context {
+	return context.WithValue(ctx, usageObserverKey{}, observe)
+}
+
+// withProviderName tags the calls made with ctx with the provider handling them
+func withProviderName(ctx context.Context, provider string) context.Context {
+	return context.WithValue(ctx, providerNameKey{}, provider)
+}
+
+// ReportUsage reports the usage of a generation to the observer of ctx, if any
+func ReportUsage(ctx context.Context, usage *ai.GenerationUsage) {
+	observe, ok := ctx.Value(usageObserverKey{}).(UsageObserver)
+	if !ok || usage == nil {
+		return
+	}
+	provider, _ := ctx.Value(providerNameKey{}).(string)
+	observe(Usage{Provider: provider, InputTokens: usage.InputTokens, OutputTokens: usage.OutputTokens})
+}
@@ -1,132 +1,219 @@
 package openai
 
-// type OpenAIClient struct {
-// 	cfg    config.LLMProviderConfig
-// 	client *http.Client
-// }
-
-// func NewOpenAIClient(cfg config.LLMProviderConfig) *OpenAIClient {
-// 	return &OpenAIClient{
-// 		cfg:    cfg,
-// 		client: &http.Client{Timeout: cfg.Timeout},
-// 	}
-// }
-
-// func (c *OpenAIClient) Analyze(ctx context.Context, transcription, contextData string) (models.SummarizeResponse, error) {
-// 	prompt := c.buildPrompt(transcription, contextData)
-
-// 	body := map[string]any{
-// 		"model":           c.cfg.Model,
-// 		"messages":        []map[string]string{{"role": "user", "content": prompt}},
-// 		"temperature":     0.7,
-// 		"response_format": map[string]string{"type": "json_object"},
-// 	}
-
-// 	bodyBytes, _ := json.Marshal(body)
-// 	req, _ := http.NewRequestWithContext(ctx, "POST", c.cfg.BaseURL+"/chat/completions", bytes.NewReader(bodyBytes))
-// 	req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
-// 	req.Header.Set("Content-Type", "application/json")
-
-// 	resp, err := c.client.Do(req)
-// 	if err != nil {
-// 		return models.SummarizeResponse{}, fmt.Errorf("openai request failed: %w", err)
-// 	}
-// 	defer resp.Body.Close()
-
-// 	if resp.StatusCode != http.StatusOK {
-// 		body, _ := io.ReadAll(resp.Body)
-// 		return models.SummarizeResponse{}, fmt.Errorf("openai error %d: %s", resp.StatusCode, string(body))
-// 	}
-
-// 	var result map[string]any
-// 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-// 		return models.SummarizeResponse{}, fmt.Errorf("failed to parse openai response: %w", err)
-// 	}
-
-// 	return c.parseResponse(result)
-// }
-
-// func (c *OpenAIClient) RecognizeImage(ctx context.Context, input models.ImageInput) (models.TranscriptionResult, error) {
-// 	body := map[string]any{
-// 		"url": input.ImageURL,
-// 	}
-
-// 	bodyBytes, _ := json.Marshal(body)
-// 	req, _ := http.NewRequestWithContext(ctx, "POST", c.cfg.BaseURL+"/recognizeText", bytes.NewReader(bodyBytes))
-// 	req.Header.Set("Ocp-Apim-Subscription-Key", c.cfg.APIKey)
-// 	req.Header.Set("Content-Type", "application/json")
-
-// 	resp, err := c.client.Do(req)
-// 	if err != nil {
-// 		return models.TranscriptionResult{}, fmt.Errorf("azure ocr request failed: %w", err)
-// 	}
-// 	defer resp.Body.Close()
-
-// 	var result map[string]any
-// 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-// 		return models.TranscriptionResult{}, fmt.Errorf("failed to parse azure ocr response: %w", err)
-// 	}
-
-// 	return models.TranscriptionResult{
-// 		Text:     extractString(result, "recognitionResult", "lines", "0", "text"),
-// 		Language: "en",
-// 		Metadata: result,
-// 	}, nil
-// }
-
-// func extractString(data map[string]any, keys ...string) string {
-// 	current := any(data)
-// 	for _, key := range keys {
-// 		switch v := current.(type) {
-// 		case map[string]any:
-// 			current = v[key]
-// 		case []any:
-// 			idx := 0
-// 			// Try to parse as index
-// 			if i, err := json.Number(key).Int64(); err == nil {
-// 				idx = int(i)
-// 			}
-// 			if idx < len(v) {
-// 				current = v[idx]
-// 			} else {
-// 				return ""
-// 			}
-// 		default:
-// 			return ""
-// 		}
-// 	}
-// 	if s, ok := current.(string); ok {
-// 		return s
-// 	}
-// 	return ""
-// }
-
-// func (c *OpenAIClient) buildPrompt(transcription, contextData string) string {
-// 	return fmt.Sprintf(`Analyze this board input and return a JSON response with:
-// {
-//   "intent": "action_type",
-//   "confidence": 0.0-1.0,
-//   "actions": [{
-//     "type": "action_name",
-//     "payload": {}
-//   }],
-//   "explanation": "why this action"
-// }
-
-// Input text: %s
-// Context: %s`, transcription, contextData)
-// }
-
-// func (c *OpenAIClient) parseResponse(data map[string]any) (models.SummarizeResponse, error) {
-// 	if choices, ok := data["choices"].([]any); ok && len(choices) > 0 {
-// 		choice := choices[0].(map[string]any)
-// 		content := choice["message"].(map[string]any)["content"].(string)
-
-// 		var resp models.SummarizeResponse
-// 		if err := json.Unmarshal([]byte(content), &resp); err != nil {
-// 			return models.SummarizeResponse{}, fmt.Errorf("failed to parse openai json response: %w", err)
-// 		}
-// 		return resp, nil
-// 	}
-// 	return models.SummarizeResponse{}, fmt.Errorf("unexpected openai response format")
-// }
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/providers"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// DefaultBaseURL is the OpenAI API, vLLM, Ollama, LM Studio and other servers
+// implementing Chat Completions are used by setting their own base URL
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// maxErrorBody bounds how much of an error response is read into the error
+const maxErrorBody = 4 << 10
+
+// OpenAIClient calls an OpenAI-compatible Chat Completions endpoint, asking
+// for output matching the JSON schema of the flow
+type OpenAIClient struct {
+	cfg    providers.ProviderConfig
+	client *http.Client
+}
+
+// NewOpenAIClient creates a client for the endpoint and model of cfg, the API
+// key is optional as local servers usually do not check it
+func NewOpenAIClient(cfg providers.ProviderConfig) *OpenAIClient {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &OpenAIClient{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (c *OpenAIClient) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
+	var out providers.SummarizeFlow
+	if err := c.generate(ctx, parts, "summarize_flow", providers.SummarizeSchema(), &out); err != nil {
+		return models.SummarizeResponse{}, err
+	}
+	return models.SummarizeResponse{Element: out.Element}, nil
+}
+
+func (c *OpenAIClient) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
+	var out providers.SimpleStructurizeFlow
+	if err := c.generate(ctx, parts, "structurize_flow", providers.StructurizeSchema(), &out); err != nil {
+		return models.StructurizeResponse{}, err
+	}
+	return models.StructurizeResponse{
+		AiTreeResponse: out.AiTreeResponse,
+		File:           out.File.ToModelFile(),
+	}, nil
+}
+
+// GetName returns the name the client is configured with
+func (c *OpenAIClient) GetName() string {
+	return c.cfg.Name
+}
+
+type chatRequest struct {
+	Model          string         `json:"model"`
+	Messages       []chatMessage  `json:"messages"`
+	ResponseFormat responseFormat `json:"response_format"`
+}
+
+type chatMessage struct {
+	Role    string        `json:"role"`
+	Content []contentPart `json:"content"`
+}
+
+type contentPart struct {
+	Type     string    `json:"type"` // text or image_url
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+	URL string `json:"url"` // http(s) or data URL
+}
+
+type responseFormat struct {
+	Type       string     `json:"type"` // json_schema
+	JSONSchema jsonSchema `json:"json_schema"`
+}
+
+type jsonSchema struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+	Strict bool           `json:"strict"` // strict mode requires every property, the flows have optional ones
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		// Code is a string for OpenAI and an integer for compatible
+		// servers such as vLLM
+		Code any `json:"code"`
+	} `json:"error"`
+}
+
+// generate sends parts as the user message and decodes the reply, which the
+// endpoint is asked to match to schema, into out
+func (c *OpenAIClient) generate(ctx context.Context, parts []*ai.Part, name string, schema map[string]any, out any) error {
+	content, err := toContent(parts)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(chatRequest{
+		Model:    c.cfg.Model,
+		Messages: []chatMessage{{Role: "user", Content: content}},
+		ResponseFormat: responseFormat{
+			Type:       "json_schema",
+			JSONSchema: jsonSchema{Name: name, Schema: schema},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create chat request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", c.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return c.providerError(resp)
+	}
+
+	var chat chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chat); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", c.cfg.Name, err)
+	}
+	providers.ReportUsage(ctx, &ai.GenerationUsage{
+		InputTokens:  chat.Usage.PromptTokens,
+		OutputTokens: chat.Usage.CompletionTokens,
+	})
+
+	if len(chat.Choices) == 0 {
+		return fmt.Errorf("%s returned no choices", c.cfg.Name)
+	}
+	choice := chat.Choices[0]
+	switch {
+	case choice.Message.Refusal != "":
+		return fmt.Errorf("%s refused the request: %s", c.cfg.Name, choice.Message.Refusal)
+	case choice.FinishReason == "length":
+		return fmt.Errorf("%s response was cut at the token limit", c.cfg.Name)
+	}
+	if err := json.Unmarshal([]byte(choice.Message.Content), out); err != nil {
+		return fmt.Errorf("failed to parse %s output: %w", c.cfg.Name, err)
+	}
+	return nil
+}
+
+// toContent converts Genkit parts to Chat Completions content parts
+func toContent(parts []*ai.Part) ([]contentPart, error) {
+	content := make([]contentPart, 0, len(parts))
+	for _, p := range parts {
+		switch {
+		case p.IsText():
+			content = append(content, contentPart{Type: "text", Text: p.Text})
+		case p.IsImage():
+			content = append(content, contentPart{Type: "image_url", ImageURL: &imageURL{URL: p.Text}})
+		default:
+			return nil, fmt.Errorf("unsupported %s part", p.ContentType)
+		}
+	}
+	return content, nil
+}
+
+// providerError converts an error response into a ProviderError typed by its
+// status code, with the message and code of the OpenAI error object if any
+func (c *OpenAIClient) providerError(resp *http.Response) *providers.ProviderError {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var e errorResponse
+	if json.Unmarshal(data, &e) != nil || e.Error.Message == "" {
+		return providers.NewStatusError(c.cfg.Name, resp, "", string(data))
+	}
+	var code string
+	if e.Error.Code != nil {
+		code = fmt.Sprint(e.Error.Code)
+	}
+	if code == "" {
+		code = e.Error.Type
+	}
+	return providers.NewStatusError(c.cfg.Name, resp, code, e.Error.Message)
+}
@@ -0,0 +1,139 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/providers"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer serves Chat Completions replying with content, the decoded
+// requests are sent to requests
+func fakeServer(t *testing.T, content string, requests chan<- map[string]any) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests <- body
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{
+				"message":       map[string]any{"role": "assistant", "content": content},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]any{"prompt_tokens": 120, "completion_tokens": 30},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(baseURL string) *OpenAIClient {
+	return NewOpenAIClient(providers.ProviderConfig{
+		Name:    "vllm",
+		APIKey:  "test-key",
+		BaseURL: baseURL + "/v1/",
+		Model:   "qwen2.5-vl",
+		Timeout: 5 * time.Second,
+	})
+}
+
+func TestOpenAIClient_Summarize(t *testing.T) {
+	requests := make(chan map[string]any, 1)
+	server := fakeServer(t, `{"userPrompt":"","element":{"id":"s1","type":"text","x":10,"y":20,"width":200,"height":80,"rotation":0,"content":"Summary"}}`, requests)
+	client := newTestClient(server.URL)
+
+	var usage providers.Usage
+	ctx := providers.WithUsageObserver(context.Background(), func(u providers.Usage) { usage = u })
+	resp, err := client.Summarize(ctx, []*ai.Part{
+		ai.NewTextPart("Summarize the board"),
+		ai.NewMediaPart("image/jpeg", "https://example.com/board.jpg"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Summary", resp.Element.Content)
+	assert.Equal(t, float32(200), resp.Element.Width)
+	assert.Equal(t, 120, usage.InputTokens)
+	assert.Equal(t, 30, usage.OutputTokens)
+
+	body := <-requests
+	assert.Equal(t, "qwen2.5-vl", body["model"])
+	messages := body["messages"].([]any)
+	require.Len(t, messages, 1)
+	assert.Equal(t, []any{
+		map[string]any{"type": "text", "text": "Summarize the board"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/board.jpg"}},
+	}, messages[0].(map[string]any)["content"])
+
+	format := body["response_format"].(map[string]any)
+	assert.Equal(t, "json_schema", format["type"])
+	schema := format["json_schema"].(map[string]any)
+	assert.Equal(t, "summarize_flow", schema["name"])
+	assert.Contains(t, schema["schema"].(map[string]any)["properties"], "element")
+}
+
+func TestOpenAIClient_Structurize(t *testing.T) {
+	requests := make(chan map[string]any, 1)
+	server := fakeServer(t, `{"userPrompt":"","answer":"","aiTreeResponse":"tree","children":{"rootIds":["r"],"nodes":[{"id":"r","name":"project","type":"section"},{"id":"c","name":"notes","type":"doc","parentId":"r"}]}}`, requests)
+	client := newTestClient(server.URL)
+
+	resp, err := client.Structurize(context.Background(), []*ai.Part{ai.NewTextPart("Structurize the board")})
+	require.NoError(t, err)
+
+	assert.Equal(t, "tree", resp.AiTreeResponse)
+	assert.Equal(t, "project", resp.File.Name)
+	require.Len(t, resp.File.Children, 1)
+	assert.Equal(t, "notes", resp.File.Children[0].Name)
+
+	body := <-requests
+	schema := body["response_format"].(map[string]any)["json_schema"].(map[string]any)
+	assert.Equal(t, "structurize_flow", schema["name"])
+}
+
+func TestOpenAIClient_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(server.URL)
+
+	_, err := client.Summarize(context.Background(), []*ai.Part{ai.NewTextPart("Summarize the board")})
+
+	var providerErr *providers.ProviderError
+	require.True(t, errors.As(err, &providerErr), err)
+	assert.Equal(t, providers.RateLimitError, providerErr.Type)
+	assert.Equal(t, http.StatusTooManyRequests, providerErr.StatusCode)
+	assert.Equal(t, "rate_limit_exceeded", providerErr.Code)
+	assert.Equal(t, 20*time.Second, providerErr.RetryAfter)
+	assert.Contains(t, err.Error(), "Rate limit reached")
+}
+
+func TestOpenAIClient_ErrorStatusWithIntegerCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"max_tokens is too large","type":"BadRequestError","param":null,"code":400}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(server.URL)
+
+	_, err := client.Summarize(context.Background(), []*ai.Part{ai.NewTextPart("Summarize the board")})
+
+	var providerErr *providers.ProviderError
+	require.True(t, errors.As(err, &providerErr), err)
+	assert.Equal(t, http.StatusBadRequest, providerErr.StatusCode)
+	assert.Equal(t, "400", providerErr.Code)
+	assert.Contains(t, err.Error(), "max_tokens is too large")
+}
@@ -9,20 +9,20 @@ import (
 	"github.com/firebase/genkit/go/ai"
 )
 
-// OpenAIClient represents a mock OpenAI client
-type OpenAIClient struct {
+// MockOpenAIClient represents a mock OpenAI client
+type MockOpenAIClient struct {
 	name string
 }
 
-// NewOpenAIClient creates a new mock OpenAI client
-func NewOpenAIClient() *OpenAIClient {
-	return &OpenAIClient{
+// NewMockOpenAIClient creates a new mock OpenAI client
+func NewMockOpenAIClient() *MockOpenAIClient {
+	return &MockOpenAIClient{
 		name: "openai-mock",
 	}
 }
 
 // Summarize implements the LLMClient interface
-func (o *OpenAIClient) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
+func (o *MockOpenAIClient) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
 	// Simulate API call delay
 	time.Sleep(100 * time.Millisecond)
 
@@ -46,7 +46,7 @@ func (o *OpenAIClient) Summarize(ctx context.Context, parts []*ai.Part) (models.
 }
 
 // Structurize implements the LLMClient interface
-func (o *OpenAIClient) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
+func (o *MockOpenAIClient) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
 	// Simulate API call delay
 	time.Sleep(150 * time.Millisecond)
 
@@ -70,6 +70,6 @@ func (o *OpenAIClient) Structurize(ctx context.Context, parts []*ai.Part) (model
 }
 
 // GetName returns the provider name
-func (o *OpenAIClient) GetName() string {
+func (o *MockOpenAIClient) GetName() string {
 	return o.name
 }
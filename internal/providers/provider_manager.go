@@ -7,15 +7,25 @@ import (
 	"sync"
 	"time"
 
+	"github.com/aiservice/internal/metrics"
 	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/tracing"
 	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// ProviderError represents an error from a specific provider
+var tracer = otel.Tracer("github.com/aiservice/internal/providers")
+
+// ProviderError represents an error from a specific provider. Provider clients
+// return it for the error responses of their API, see NewStatusError.
 type ProviderError struct {
 	Type         ProviderErrorType
 	Message      string
-	StatusCode   int
+	StatusCode   int           // HTTP status of the error response, zero when there was none
+	Code         string        // Error code of the provider API, e.g. overloaded_error
+	RetryAfter   time.Duration // Wait the provider asked for before the next request
 	ProviderName string
 	OriginalErr  error
 }
@@ -29,6 +39,60 @@ func (e *ProviderError) Unwrap() error {
 	return e.OriginalErr
 }
 
+// ErrNoProvidersAvailable is matched by errors.Is when no provider could serve a request
+var ErrNoProvidersAvailable = errors.New("no AI models currently working")
+
+// AllProvidersFailedError is returned when every available provider failed with a critical error
+type AllProvidersFailedError struct {
+	LastErr *ProviderError // error of the last provider tried, nil if none was available
+	// RetryAfter is the shortest wait before a provider that asked to wait,
+	// or whose circuit breaker is open, takes requests again, zero if none did
+	RetryAfter time.Duration
+}
+
+func (e *AllProvidersFailedError) Error() string {
+	return ErrNoProvidersAvailable.Error()
+}
+
+// Is makes errors.Is(err, ErrNoProvidersAvailable) match
+func (e *AllProvidersFailedError) Is(target error) bool {
+	return target == ErrNoProvidersAvailable
+}
+
+// Unwrap returns the last provider error
+func (e *AllProvidersFailedError) Unwrap() error {
+	if e.LastErr == nil {
+		return nil
+	}
+	return e.LastErr
+}
+
+// IsRetryable reports whether a failed request is worth retrying later.
+// Transient provider failures (5xx, rate limits, timeouts, connection issues)
+// are retryable; access and auth errors are not. When all providers failed the
+// error of the last one decides, and none being available is retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	// AllProvidersFailedError unwraps to the error of the last provider tried
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		switch providerErr.Type {
+		case InternalError, RateLimitError, TimeoutError, ConnectionError:
+			return true
+		default:
+			return false
+		}
+	}
+	if errors.Is(err, ErrNoProvidersAvailable) {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
 // ProviderErrorType represents different types of provider errors
 type ProviderErrorType string
 
@@ -48,8 +112,8 @@ type ProviderStatus string
 const (
 	StatusHealthy     ProviderStatus = "healthy"
 	StatusUnhealthy   ProviderStatus = "unhealthy"
-	StatusRestricted  ProviderStatus = "restricted" // Regional restrictions
-	StatusRateLimited ProviderStatus = "rate_limited"
+	StatusRestricted  ProviderStatus = "restricted"   // Regional restrictions, reported per region by StatusIn
+	StatusRateLimited ProviderStatus = "rate_limited" // Asked to wait with Retry-After
 )
 
 // ProviderInfo contains information about a provider
@@ -59,9 +123,12 @@ type ProviderInfo struct {
 	LastCheck   time.Time
 	ErrorCount  int
 	LastError   *ProviderError
-	Region      string // Target region for this provider
-	Priority    int    // Lower number = higher priority
+	Regions     []string // Allowed ("RU") and denied ("!RU") regions, every region not denied when none is allowed
+	Priority    int      // Lower number = higher priority
 	Enabled     bool
+	// RestrictedRegions holds the regions the provider denied access from,
+	// until when it is not tried for their requests
+	RestrictedRegions map[string]time.Time
 }
 
 // MultiProviderConfig holds configuration for multiple providers
@@ -104,7 +171,7 @@ func NewProviderManager(config *MultiProviderConfig) *ProviderManager {
 				Name:     providerCfg.Name,
 				Status:   StatusHealthy,
 				Priority: providerCfg.Priority,
-				Region:   "", // Will be set based on request
+				Regions:  providerCfg.Regions,
 				Enabled:  true,
 			}
 		}
@@ -133,53 +200,20 @@ func (pm *ProviderManager) RegisterProvider(name string, client LLMClient) {
 
 // classifyError categorizes an error from a provider
 func (pm *ProviderManager) classifyError(err error, providerName string) *ProviderError {
-	// This is a simplified classification - in practice, you'd need more sophisticated error parsing
-	errStr := err.Error()
-	
-	// Check for common error patterns
-	if containsAny(errStr, []string{"403", "Forbidden", "access denied", "unauthorized"}) {
-		return &ProviderError{
-			Type:         AccessDeniedError,
-			Message:      errStr,
-			StatusCode:   403,
-			ProviderName: providerName,
-			OriginalErr:  err,
-		}
-	}
-	
-	if containsAny(errStr, []string{"500", "Internal Server Error", "internal error", "server error"}) {
-		return &ProviderError{
-			Type:         InternalError,
-			Message:      errStr,
-			StatusCode:   500,
-			ProviderName: providerName,
-			OriginalErr:  err,
-		}
-	}
-	
-	if containsAny(errStr, []string{"429", "Too Many Requests", "rate limit", "quota"}) {
-		return &ProviderError{
-			Type:         RateLimitError,
-			Message:      errStr,
-			StatusCode:   429,
-			ProviderName: providerName,
-			OriginalErr:  err,
-		}
-	}
-	
-	if containsAny(errStr, []string{"timeout", "deadline exceeded", "connection refused", "connection reset"}) {
-		return &ProviderError{
-			Type:         TimeoutError,
-			Message:      errStr,
-			ProviderName: providerName,
-			OriginalErr:  err,
+	// Clients that know the error types of their API return them already
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		if providerErr.ProviderName == "" {
+			providerErr.ProviderName = providerName
 		}
+		return providerErr
 	}
 
-	// Default to unknown error
+	// Requests that got no response are typed by their transport error, the
+	// text of other errors says nothing reliable about the failure
 	return &ProviderError{
-		Type:         UnknownError,
-		Message:      errStr,
+		Type:         transportErrorType(err),
+		Message:      err.Error(),
 		ProviderName: providerName,
 		OriginalErr:  err,
 	}
@@ -190,6 +224,8 @@ func (pm *ProviderManager) isCriticalError(errorType ProviderErrorType) bool {
 	switch errorType {
 	case AccessDeniedError:  // 403 - regional restrictions
 		return true
+	case AuthError:          // 401 - credentials rejected by this provider only
+		return true
 	case InternalError:      // 500 - provider infrastructure failure
 		return true
 	case RateLimitError:     // 429 - rate limiting (might be temporary)
@@ -201,14 +237,16 @@ func (pm *ProviderManager) isCriticalError(errorType ProviderErrorType) bool {
 	}
 }
 
-// getAvailableProviders returns provider names in priority order
-func (pm *ProviderManager) getAvailableProviders() []string {
+// getAvailableProviders returns the names of the providers available in
+// region in priority order
+func (pm *ProviderManager) getAvailableProviders(region string) []string {
 	pm.mutex.RLock()
 	defer pm.mutex.RUnlock()
 
+	now := time.Now()
 	var providers []string
 	for name, info := range pm.providerInfos {
-		if info.Enabled && info.Status != StatusUnhealthy {
+		if info.Enabled && info.Status != StatusUnhealthy && info.availableIn(region, now) {
 			providers = append(providers, name)
 		}
 	}
@@ -245,6 +283,55 @@ func (pm *ProviderManager) markProviderHealthy(providerName string) {
 	}
 }
 
+// markProviderFailed takes a provider out of rotation after a critical error.
+// Access denied while serving a region is a regional restriction, the
+// provider keeps serving the other regions. A provider that said when to
+// retry is back in rotation then.
+func (pm *ProviderManager) markProviderFailed(providerName, region string, providerErr *ProviderError) {
+	switch {
+	case providerErr.Type == AccessDeniedError && region != "":
+		pm.markProviderRestricted(providerName, region, providerErr)
+	case providerErr.RetryAfter > 0:
+		pm.markProviderRateLimited(providerName, providerErr)
+	default:
+		pm.markProviderUnhealthy(providerName, providerErr)
+	}
+}
+
+// markProviderRateLimited opens the circuit breaker of a provider for the
+// Retry-After of its error, it gets a trial request once that has passed
+func (pm *ProviderManager) markProviderRateLimited(providerName string, providerErr *ProviderError) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if info, exists := pm.providerInfos[providerName]; exists {
+		info.Status = StatusRateLimited
+		info.LastCheck = time.Now()
+		info.ErrorCount++
+		info.LastError = providerErr
+
+		pm.circuitBreaker.OpenFor(providerName, providerErr.RetryAfter)
+	}
+}
+
+// markProviderRestricted stops sending the requests of region to a provider
+// for restrictionTTL. Its status is left alone as it keeps serving the other
+// regions, StatusIn reports the restriction.
+func (pm *ProviderManager) markProviderRestricted(providerName, region string, providerErr *ProviderError) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if info, exists := pm.providerInfos[providerName]; exists {
+		info.LastCheck = time.Now()
+		info.ErrorCount++
+		info.LastError = providerErr
+		if info.RestrictedRegions == nil {
+			info.RestrictedRegions = make(map[string]time.Time)
+		}
+		info.RestrictedRegions[region] = info.LastCheck.Add(restrictionTTL)
+	}
+}
+
 // markProviderUnhealthy marks a provider as unhealthy
 func (pm *ProviderManager) markProviderUnhealthy(providerName string, providerErr *ProviderError) {
 	pm.mutex.Lock()
@@ -261,66 +348,51 @@ func (pm *ProviderManager) markProviderUnhealthy(providerName string, providerEr
 	}
 }
 
-// containsAny checks if a string contains any of the substrings
-func containsAny(str string, substrs []string) bool {
-	for _, substr := range substrs {
-		if containsIgnoreCase(str, substr) {
-			return true
-		}
+// shortestWait returns the shorter of two waits, ignoring zero ones
+func shortestWait(current, wait time.Duration) time.Duration {
+	if wait <= 0 || (current > 0 && current <= wait) {
+		return current
 	}
-	return false
+	return wait
 }
 
-// containsIgnoreCase checks if a string contains a substring ignoring case
-func containsIgnoreCase(str, substr string) bool {
-	return len(str) >= len(substr) && 
-		   (contains(str[:len(str)-len(substr)+1], substr) ||
-		    contains(str[len(str)-len(substr):], substr))
+// startAttempt starts the span of a request sent to a provider
+func startAttempt(ctx context.Context, providerName, requestType string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "provider."+requestType,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("provider.name", providerName),
+			attribute.String("request.type", requestType),
+		))
 }
 
-// contains is a helper function for case-insensitive substring search
-func contains(str, substr string) bool {
-	if len(substr) == 0 {
-		return true
+// endAttempt records the outcome and latency of a request sent to a provider
+// in its span and the metrics, providerErr is nil on success
+func endAttempt(span trace.Span, providerName, requestType string, start time.Time, providerErr *ProviderError) {
+	outcome := metrics.OutcomeSuccess
+	var err error
+	if providerErr != nil {
+		outcome, err = string(providerErr.Type), providerErr
 	}
-	if len(substr) > len(str) {
-		return false
-	}
-	
-	lowerStr := toLower(str)
-	lowerSubstr := toLower(substr)
-	
-	for i := 0; i <= len(lowerStr)-len(lowerSubstr); i++ {
-		if lowerStr[i:i+len(lowerSubstr)] == lowerSubstr {
-			return true
-		}
-	}
-	return false
-}
+	metrics.ProviderRequests.WithLabelValues(providerName, requestType, outcome).Inc()
+	metrics.ProviderRequestDuration.WithLabelValues(providerName, requestType).Observe(time.Since(start).Seconds())
 
-// toLower converts a string to lowercase
-func toLower(s string) string {
-	var result []byte
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c >= 'A' && c <= 'Z' {
-			result = append(result, c+'a'-'A')
-		} else {
-			result = append(result, c)
-		}
-	}
-	return string(result)
+	span.SetAttributes(attribute.String("provider.outcome", outcome))
+	tracing.End(span, err)
 }
 
 // Summarize implements the LLMClient interface
 func (pm *ProviderManager) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
-	// Get available providers in priority order
-	availableProviders := pm.getAvailableProviders()
+	// Get the providers available in the region of the request in priority order
+	region := regionFrom(ctx)
+	availableProviders := pm.getAvailableProviders(region)
 
 	if len(availableProviders) == 0 {
-		return models.SummarizeResponse{}, errors.New("no AI models currently working")
+		return models.SummarizeResponse{}, &AllProvidersFailedError{}
 	}
 
+	var lastErr *ProviderError
+	var retryAfter time.Duration
 	for _, providerName := range availableProviders {
 		provider, exists := pm.providers[providerName]
 		if !exists {
@@ -329,44 +401,57 @@ func (pm *ProviderManager) Summarize(ctx context.Context, parts []*ai.Part) (mod
 
 		// Skip if circuit breaker is open for this provider
 		if pm.circuitBreaker.IsOpen(providerName) {
+			retryAfter = shortestWait(retryAfter, pm.circuitBreaker.RemainingOpen(providerName))
 			continue
 		}
 
 		// Attempt to process with this provider
-		resp, err := provider.Summarize(ctx, parts)
+		notifyAttempt(ctx, providerName)
+		attemptCtx, span := startAttempt(ctx, providerName, models.SummarizeType)
+		start := time.Now()
+		resp, err := provider.Summarize(withProviderName(attemptCtx, providerName), parts)
 
 		if err == nil {
 			// Success - mark provider as healthy and return
+			endAttempt(span, providerName, models.SummarizeType, start, nil)
 			pm.markProviderHealthy(providerName)
+			resp.Provider = providerName
 			return resp, nil
 		}
 
 		// Handle provider-specific error
 		providerErr := pm.classifyError(err, providerName)
+		endAttempt(span, providerName, models.SummarizeType, start, providerErr)
 
-		// If it's a critical error (403/500), mark provider as unhealthy and try next
+		// If it's a critical error (403/500), take the provider out of rotation and try next
 		if pm.isCriticalError(providerErr.Type) {
-			pm.markProviderUnhealthy(providerName, providerErr)
+			metrics.ProviderFailovers.WithLabelValues(providerName, models.SummarizeType).Inc()
+			pm.markProviderFailed(providerName, region, providerErr)
+			lastErr = providerErr
+			retryAfter = shortestWait(retryAfter, providerErr.RetryAfter)
 			continue
 		}
 
 		// For other errors, return immediately
-		return models.SummarizeResponse{}, err
+		return models.SummarizeResponse{}, providerErr
 	}
 
 	// All providers failed
-	return models.SummarizeResponse{}, errors.New("no AI models currently working")
+	return models.SummarizeResponse{}, &AllProvidersFailedError{LastErr: lastErr, RetryAfter: retryAfter}
 }
 
 // Structurize implements the LLMClient interface
 func (pm *ProviderManager) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
-	// Get available providers in priority order
-	availableProviders := pm.getAvailableProviders()
+	// Get the providers available in the region of the request in priority order
+	region := regionFrom(ctx)
+	availableProviders := pm.getAvailableProviders(region)
 
 	if len(availableProviders) == 0 {
-		return models.StructurizeResponse{}, errors.New("no AI models currently working")
+		return models.StructurizeResponse{}, &AllProvidersFailedError{}
 	}
 
+	var lastErr *ProviderError
+	var retryAfter time.Duration
 	for _, providerName := range availableProviders {
 		provider, exists := pm.providers[providerName]
 		if !exists {
@@ -375,33 +460,43 @@ func (pm *ProviderManager) Structurize(ctx context.Context, parts []*ai.Part) (m
 
 		// Skip if circuit breaker is open for this provider
 		if pm.circuitBreaker.IsOpen(providerName) {
+			retryAfter = shortestWait(retryAfter, pm.circuitBreaker.RemainingOpen(providerName))
 			continue
 		}
 
 		// Attempt to process with this provider
-		resp, err := provider.Structurize(ctx, parts)
+		notifyAttempt(ctx, providerName)
+		attemptCtx, span := startAttempt(ctx, providerName, models.StructurizeType)
+		start := time.Now()
+		resp, err := provider.Structurize(withProviderName(attemptCtx, providerName), parts)
 
 		if err == nil {
 			// Success - mark provider as healthy and return
+			endAttempt(span, providerName, models.StructurizeType, start, nil)
 			pm.markProviderHealthy(providerName)
+			resp.Provider = providerName
 			return resp, nil
 		}
 
 		// Handle provider-specific error
 		providerErr := pm.classifyError(err, providerName)
+		endAttempt(span, providerName, models.StructurizeType, start, providerErr)
 
-		// If it's a critical error (403/500), mark provider as unhealthy and try next
+		// If it's a critical error (403/500), take the provider out of rotation and try next
 		if pm.isCriticalError(providerErr.Type) {
-			pm.markProviderUnhealthy(providerName, providerErr)
+			metrics.ProviderFailovers.WithLabelValues(providerName, models.StructurizeType).Inc()
+			pm.markProviderFailed(providerName, region, providerErr)
+			lastErr = providerErr
+			retryAfter = shortestWait(retryAfter, providerErr.RetryAfter)
 			continue
 		}
 
 		// For other errors, return immediately
-		return models.StructurizeResponse{}, err
+		return models.StructurizeResponse{}, providerErr
 	}
 
 	// All providers failed
-	return models.StructurizeResponse{}, errors.New("no AI models currently working")
+	return models.StructurizeResponse{}, &AllProvidersFailedError{LastErr: lastErr, RetryAfter: retryAfter}
 }
 
 // GetName returns the provider name for the manager
@@ -3,10 +3,17 @@ package providers
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/aiservice/internal/metrics"
 	"github.com/aiservice/internal/models"
 	"github.com/firebase/genkit/go/ai"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -31,6 +38,11 @@ func (m *MockLLMClient) GetName() string {
 	return m.name
 }
 
+// internalError returns the error of a provider whose API answered 500
+func internalError() *ProviderError {
+	return &ProviderError{Type: InternalError, StatusCode: 500, Message: "500 Internal Server Error"}
+}
+
 func TestProviderManager_Summarize_Success(t *testing.T) {
 	pm := NewProviderManager(&MultiProviderConfig{})
 
@@ -60,7 +72,7 @@ func TestProviderManager_Summarize_Failover(t *testing.T) {
 	// Create a mock provider that fails with a critical error
 	failingProvider := &MockLLMClient{name: "failing-provider"}
 	failingProvider.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{},
-		fmt.Errorf("500 error"))
+		internalError())
 
 	// Create a mock provider that succeeds
 	workingProvider := &MockLLMClient{name: "working-provider"}
@@ -82,6 +94,100 @@ func TestProviderManager_Summarize_Failover(t *testing.T) {
 	workingProvider.AssertNumberOfCalls(t, "Summarize", 1)
 }
 
+func TestProviderManager_ReportsAttempts(t *testing.T) {
+	pm := NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{
+			{Name: "failing-provider", Priority: 1, Enabled: true},
+			{Name: "working-provider", Priority: 2, Enabled: true},
+		},
+	})
+
+	failingProvider := &MockLLMClient{name: "failing-provider"}
+	failingProvider.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{},
+		internalError())
+	workingProvider := &MockLLMClient{name: "working-provider"}
+	workingProvider.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{}, nil)
+
+	pm.RegisterProvider("failing-provider", failingProvider)
+	pm.RegisterProvider("working-provider", workingProvider)
+
+	var attempts []string
+	ctx := WithAttemptObserver(context.Background(), func(provider string) {
+		attempts = append(attempts, provider)
+	})
+
+	_, err := pm.Summarize(ctx, []*ai.Part{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"failing-provider", "working-provider"}, attempts)
+}
+
+func TestProviderManager_ReportsUsage(t *testing.T) {
+	pm := NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{
+			{Name: "working-provider", Priority: 1, Enabled: true},
+		},
+	})
+
+	workingProvider := &MockLLMClient{name: "working-provider"}
+	workingProvider.On("Summarize", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		ReportUsage(args.Get(0).(context.Context), &ai.GenerationUsage{InputTokens: 120, OutputTokens: 30})
+	}).Return(models.SummarizeResponse{}, nil)
+	pm.RegisterProvider("working-provider", workingProvider)
+
+	var usages []Usage
+	ctx := WithUsageObserver(context.Background(), func(usage Usage) {
+		usages = append(usages, usage)
+	})
+
+	_, err := pm.Summarize(ctx, []*ai.Part{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Usage{{Provider: "working-provider", InputTokens: 120, OutputTokens: 30}}, usages)
+}
+
+func TestProviderManager_ReportsMetrics(t *testing.T) {
+	// The collectors are global, the provider names keep this test's series apart
+	pm := NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{
+			{Name: "metrics-failing", Priority: 1, Enabled: true},
+			{Name: "metrics-working", Priority: 2, Enabled: true},
+		},
+	})
+
+	failingProvider := &MockLLMClient{name: "metrics-failing"}
+	failingProvider.On("Structurize", mock.Anything, mock.Anything).Return(models.StructurizeResponse{},
+		internalError())
+	workingProvider := &MockLLMClient{name: "metrics-working"}
+	workingProvider.On("Structurize", mock.Anything, mock.Anything).Return(models.StructurizeResponse{}, nil)
+
+	pm.RegisterProvider("metrics-failing", failingProvider)
+	pm.RegisterProvider("metrics-working", workingProvider)
+
+	_, err := pm.Structurize(context.Background(), []*ai.Part{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.ProviderRequests.WithLabelValues("metrics-failing", models.StructurizeType, string(InternalError))))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.ProviderRequests.WithLabelValues("metrics-working", models.StructurizeType, metrics.OutcomeSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.ProviderFailovers.WithLabelValues("metrics-failing", models.StructurizeType)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.ProviderFailovers.WithLabelValues("metrics-working", models.StructurizeType)))
+	assert.Equal(t, float64(metrics.CircuitClosed), testutil.ToFloat64(metrics.CircuitBreakerState.WithLabelValues("metrics-working")))
+}
+
+func TestCircuitBreaker_ReportsState(t *testing.T) {
+	cb := NewCircuitBreaker()
+	for range 3 {
+		cb.Trip("metrics-breaker")
+	}
+	assert.True(t, cb.IsOpen("metrics-breaker"))
+	assert.Equal(t, float64(metrics.CircuitOpen), testutil.ToFloat64(metrics.CircuitBreakerState.WithLabelValues("metrics-breaker")))
+
+	// Tripping an open breaker again does not count as another trip
+	cb.Trip("metrics-breaker")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.CircuitBreakerTrips.WithLabelValues("metrics-breaker")))
+
+	cb.Reset("metrics-breaker")
+	assert.Equal(t, float64(metrics.CircuitClosed), testutil.ToFloat64(metrics.CircuitBreakerState.WithLabelValues("metrics-breaker")))
+}
+
 func TestProviderManager_Summarize_AllProvidersFailed(t *testing.T) {
 	pm := NewProviderManager(&MultiProviderConfig{
 		Providers: []ProviderConfig{
@@ -93,11 +199,11 @@ func TestProviderManager_Summarize_AllProvidersFailed(t *testing.T) {
 	// Create mock providers that both fail
 	failingProvider1 := &MockLLMClient{name: "failing-provider-1"}
 	failingProvider1.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{},
-		fmt.Errorf("500 error"))
+		internalError())
 
 	failingProvider2 := &MockLLMClient{name: "failing-provider-2"}
 	failingProvider2.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{},
-		fmt.Errorf("403 error"))
+		&ProviderError{Type: AccessDeniedError, StatusCode: 403, Message: "403 Forbidden"})
 
 	pm.RegisterProvider("failing-provider-1", failingProvider1)
 	pm.RegisterProvider("failing-provider-2", failingProvider2)
@@ -122,7 +228,7 @@ func TestProviderManager_CircuitBreaker(t *testing.T) {
 	// Create a mock provider that keeps failing
 	failingProvider := &MockLLMClient{name: "failing-provider"}
 	failingProvider.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{},
-		fmt.Errorf("500 error")).Times(3) // Trip circuit breaker
+		internalError()).Times(3) // Trip circuit breaker
 
 	// Create a mock provider that succeeds
 	workingProvider := &MockLLMClient{name: "working-provider"}
@@ -148,4 +254,246 @@ func TestProviderManager_CircuitBreaker(t *testing.T) {
 	// Verify that the failing provider was only called twice (due to circuit breaker)
 	// Note: This depends on the exact implementation of the circuit breaker
 	// The working provider should be called both times
-}
\ No newline at end of file
+}
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(&ProviderError{Type: InternalError}))
+	assert.True(t, IsRetryable(&ProviderError{Type: RateLimitError}))
+	assert.True(t, IsRetryable(&ProviderError{Type: TimeoutError}))
+	assert.True(t, IsRetryable(&AllProvidersFailedError{}))
+	assert.True(t, IsRetryable(&AllProvidersFailedError{LastErr: &ProviderError{Type: RateLimitError}}))
+	assert.True(t, IsRetryable(fmt.Errorf("processing pipeline failed: %w", context.DeadlineExceeded)))
+
+	assert.False(t, IsRetryable(&ProviderError{Type: AccessDeniedError}))
+	assert.False(t, IsRetryable(&ProviderError{Type: AuthError}))
+	assert.False(t, IsRetryable(&AllProvidersFailedError{LastErr: &ProviderError{Type: AuthError}}))
+	assert.False(t, IsRetryable(fmt.Errorf("summarize failed: %w", &AllProvidersFailedError{LastErr: &ProviderError{Type: AccessDeniedError}})))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.False(t, IsRetryable(fmt.Errorf("failed to build pipeline")))
+}
+
+func TestClassifyError(t *testing.T) {
+	pm := NewProviderManager(&MultiProviderConfig{})
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	tests := []struct {
+		name      string
+		err       error
+		errorType ProviderErrorType
+	}{
+		{"typed", &ProviderError{Type: AuthError, StatusCode: 401}, AuthError},
+		{"connection refused", fmt.Errorf("openai request failed: %w", &url.Error{Op: "Post", URL: "http://llm", Err: dial}), ConnectionError},
+		{"client timeout", &url.Error{Op: "Post", URL: "http://llm", Err: &timeoutError{}}, TimeoutError},
+		{"deadline", fmt.Errorf("failed to generate: %w", context.DeadlineExceeded), TimeoutError},
+		{"cancelled", &url.Error{Op: "Post", URL: "http://llm", Err: context.Canceled}, UnknownError},
+		// Numbers in the text of an untyped error are not status codes
+		{"untyped", fmt.Errorf("board 500 has 403 elements"), UnknownError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providerErr := pm.classifyError(tt.err, "openai")
+			assert.Equal(t, tt.errorType, providerErr.Type)
+			assert.Equal(t, "openai", providerErr.ProviderName)
+		})
+	}
+}
+
+// timeoutError is the net.Error of a request that timed out
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func TestNewStatusError(t *testing.T) {
+	resp := &http.Response{
+		Status:     "429 Too Many Requests",
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"120"}},
+	}
+	providerErr := NewStatusError("openai", resp, "rate_limit_exceeded", "Rate limit reached")
+	assert.Equal(t, RateLimitError, providerErr.Type)
+	assert.Equal(t, 2*time.Minute, providerErr.RetryAfter)
+	assert.Equal(t, "rate_limit_exceeded", providerErr.Code)
+	assert.Equal(t, "429 Too Many Requests: Rate limit reached", providerErr.Message)
+	assert.Equal(t, 2*time.Minute, RetryAfter(&AllProvidersFailedError{LastErr: providerErr}))
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Sun, 01 Jun 2025 12:01:30 GMT", now))
+	assert.Zero(t, parseRetryAfter("Sun, 01 Jun 2025 11:00:00 GMT", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
+
+func TestProviderManager_HonorsRetryAfter(t *testing.T) {
+	pm := NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{
+			{Name: "openai", Priority: 1, Enabled: true},
+			{Name: "yandex", Priority: 2, Enabled: true},
+		},
+	})
+	openai := &MockLLMClient{name: "openai"}
+	openai.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{},
+		&ProviderError{Type: RateLimitError, StatusCode: 429, RetryAfter: time.Hour}).Once()
+	pm.RegisterProvider("openai", openai)
+	pm.RegisterProvider("yandex", summarizingProvider("yandex"))
+
+	resp, err := pm.Summarize(context.Background(), []*ai.Part{})
+	assert.NoError(t, err)
+	assert.Equal(t, "yandex", resp.Provider)
+	assert.Equal(t, StatusRateLimited, pm.providerInfos["openai"].Status)
+	assert.True(t, pm.circuitBreaker.IsOpen("openai"), "a single 429 with Retry-After opens the breaker")
+
+	// openai is not tried again before its Retry-After has passed
+	resp, err = pm.Summarize(context.Background(), []*ai.Part{})
+	assert.NoError(t, err)
+	assert.Equal(t, "yandex", resp.Provider)
+	openai.AssertNumberOfCalls(t, "Summarize", 1)
+}
+
+func TestProviderManager_ReportsRetryAfterOfSkippedProviders(t *testing.T) {
+	pm := NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{{Name: "openai", Priority: 1, Enabled: true}},
+	})
+	openai := &MockLLMClient{name: "openai"}
+	openai.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{},
+		&ProviderError{Type: RateLimitError, StatusCode: 429, RetryAfter: time.Minute}).Once()
+	pm.RegisterProvider("openai", openai)
+
+	_, err := pm.Summarize(context.Background(), []*ai.Part{})
+	assert.ErrorIs(t, err, ErrNoProvidersAvailable)
+	assert.Equal(t, time.Minute, RetryAfter(err))
+
+	// The provider is skipped now, the wait left on its breaker is reported
+	_, err = pm.Summarize(context.Background(), []*ai.Part{})
+	var allFailed *AllProvidersFailedError
+	assert.ErrorAs(t, err, &allFailed)
+	assert.Nil(t, allFailed.LastErr)
+	assert.InDelta(t, time.Minute, RetryAfter(err), float64(time.Second))
+	openai.AssertNumberOfCalls(t, "Summarize", 1)
+}
+
+// summarizingProvider returns a provider answering every Summarize with its name
+func summarizingProvider(name string) *MockLLMClient {
+	provider := &MockLLMClient{name: name}
+	provider.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{
+		Element: models.Text{Content: name},
+	}, nil)
+	return provider
+}
+
+func TestProviderManager_RoutesByRegion(t *testing.T) {
+	pm := NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{
+			{Name: "gemini", Regions: []string{"!RU"}, Priority: 1, Enabled: true},
+			{Name: "yandex", Regions: []string{"RU", "CIS"}, Priority: 2, Enabled: true},
+		},
+	})
+	pm.RegisterProvider("gemini", summarizingProvider("gemini"))
+	pm.RegisterProvider("yandex", summarizingProvider("yandex"))
+
+	tests := []struct {
+		region   string
+		provider string
+	}{
+		{"", "gemini"},
+		{"US", "gemini"},
+		{"ru", "yandex"},
+		{"CIS", "gemini"},
+	}
+	for _, tt := range tests {
+		resp, err := pm.Summarize(WithRegion(context.Background(), tt.region), []*ai.Part{})
+		assert.NoError(t, err, tt.region)
+		assert.Equal(t, tt.provider, resp.Provider, tt.region)
+		assert.Equal(t, tt.provider, resp.Element.Content, tt.region)
+	}
+
+	// No provider is allowed in a region listed by none of them and denied by gemini
+	pm = NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{{Name: "gemini", Regions: []string{"!RU"}, Priority: 1, Enabled: true}},
+	})
+	pm.RegisterProvider("gemini", summarizingProvider("gemini"))
+	_, err := pm.Summarize(WithRegion(context.Background(), "RU"), []*ai.Part{})
+	assert.ErrorIs(t, err, ErrNoProvidersAvailable)
+}
+
+func TestProviderManager_RestrictsProviderInRegion(t *testing.T) {
+	pm := NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{
+			{Name: "gemini", Priority: 1, Enabled: true},
+			{Name: "openai", Priority: 2, Enabled: true},
+		},
+	})
+	gemini := &MockLLMClient{name: "gemini"}
+	gemini.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{},
+		&ProviderError{Type: AccessDeniedError, StatusCode: 403, Message: "User location is not supported"}).Once()
+	gemini.On("Summarize", mock.Anything, mock.Anything).Return(models.SummarizeResponse{}, nil)
+	pm.RegisterProvider("gemini", gemini)
+	pm.RegisterProvider("openai", summarizingProvider("openai"))
+
+	ru := WithRegion(context.Background(), "RU")
+	resp, err := pm.Summarize(ru, []*ai.Part{})
+	assert.NoError(t, err)
+	assert.Equal(t, "openai", resp.Provider)
+
+	assert.Equal(t, StatusRestricted, pm.StatusIn("gemini", "RU"))
+	assert.Equal(t, StatusHealthy, pm.StatusIn("gemini", "US"))
+	assert.False(t, pm.circuitBreaker.IsOpen("gemini"), "a regional restriction must not trip the breaker")
+
+	// The restriction only applies to requests from the region
+	resp, err = pm.Summarize(ru, []*ai.Part{})
+	assert.NoError(t, err)
+	assert.Equal(t, "openai", resp.Provider)
+
+	resp, err = pm.Summarize(WithRegion(context.Background(), "US"), []*ai.Part{})
+	assert.NoError(t, err)
+	assert.Equal(t, "gemini", resp.Provider)
+	gemini.AssertNumberOfCalls(t, "Summarize", 2)
+
+	// Succeeding in another region does not lift the restriction
+	assert.Equal(t, StatusHealthy, pm.providerInfos["gemini"].Status)
+	assert.Equal(t, StatusRestricted, pm.StatusIn("gemini", "RU"))
+	assert.Equal(t, StatusHealthy, pm.StatusIn("gemini", "US"))
+}
+
+func TestProviderManager_StatusInRegion(t *testing.T) {
+	pm := NewProviderManager(&MultiProviderConfig{
+		Providers: []ProviderConfig{
+			{Name: "gemini", Regions: []string{"!RU"}, Priority: 1, Enabled: true},
+			{Name: "yandex", Regions: []string{"RU"}, Priority: 2, Enabled: true},
+		},
+	})
+
+	tests := []struct {
+		provider string
+		region   string
+		status   ProviderStatus
+	}{
+		{"gemini", "RU", StatusRestricted},
+		{"gemini", "US", StatusHealthy},
+		{"gemini", "", StatusHealthy},
+		{"yandex", "RU", StatusHealthy},
+		{"yandex", "US", StatusRestricted},
+		{"unknown", "US", StatusUnhealthy},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.status, pm.StatusIn(tt.provider, tt.region), "%s in %q", tt.provider, tt.region)
+	}
+}
+
+func TestAllowsRegion(t *testing.T) {
+	tests := []struct {
+		rules   []string
+		region  string
+		allowed bool
+	}{
+		{nil, "RU", true},
+		{[]string{"!RU"}, "RU", false},
+		{[]string{"!RU"}, "US", true},
+		{[]string{"RU", "CIS"}, "CIS", true},
+		{[]string{"RU", "CIS"}, "US", false},
+		{[]string{"RU", "!RU"}, "RU", false},
+		{[]string{"!RU"}, "", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, allowsRegion(tt.rules, tt.region), "%v %q", tt.rules, tt.region)
+	}
+}
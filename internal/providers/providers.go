@@ -40,10 +40,11 @@ func GetSummarizeFlow(gkit *genkit.Genkit) *core.Flow[*SummarizeFlow, *Summarize
 
 func RunSummarizeGeneration(ctx context.Context, gkit *genkit.Genkit, parts []*ai.Part) (*SummarizeFlow, error) {
 	prompt := ai.NewUserMessage(parts...)
-	resp, _, err := genkit.GenerateData[SummarizeFlow](ctx, gkit, ai.WithMessages(prompt))
+	resp, modelResp, err := genkit.GenerateData[SummarizeFlow](ctx, gkit, ai.WithMessages(prompt))
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate llm request: %w", err)
 	}
+	reportResponseUsage(ctx, modelResp)
 	return resp, nil
 }
 
@@ -139,23 +140,32 @@ func GetStructurizeFlow(gkit *genkit.Genkit) *core.Flow[*SimpleStructurizeFlow,
 
 func RunStructurizeGeneration(ctx context.Context, gkit *genkit.Genkit, parts []*ai.Part) (*SimpleStructurizeFlow, error) {
 	prompt := ai.NewUserMessage(parts...)
-	resp, _, err := genkit.GenerateData[SimpleStructurizeFlow](ctx, gkit, ai.WithMessages(prompt))
+	resp, modelResp, err := genkit.GenerateData[SimpleStructurizeFlow](ctx, gkit, ai.WithMessages(prompt))
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate llm request: %w", err)
 	}
+	reportResponseUsage(ctx, modelResp)
 	return resp, nil
 }
 
 // RunStructurizeGenerationAndConvert executes the structurize generation and converts the result to the original File model
 func RunStructurizeGenerationAndConvert(ctx context.Context, gkit *genkit.Genkit, parts []*ai.Part) (models.File, string, error) {
 	prompt := ai.NewUserMessage(parts...)
-	resp, _, err := genkit.GenerateData[SimpleStructurizeFlow](ctx, gkit, ai.WithMessages(prompt))
+	resp, modelResp, err := genkit.GenerateData[SimpleStructurizeFlow](ctx, gkit, ai.WithMessages(prompt))
 	if err != nil {
 		return models.File{}, "", fmt.Errorf("failed to generate llm request: %w", err)
 	}
+	reportResponseUsage(ctx, modelResp)
 
 	// Convert the flat hierarchy to the original recursive File model
 	modelFile := resp.File.ToModelFile()
 
 	return modelFile, resp.AiTreeResponse, nil
 }
+
+// reportResponseUsage reports the token usage of a model response, see ReportUsage
+func reportResponseUsage(ctx context.Context, resp *ai.ModelResponse) {
+	if resp != nil {
+		ReportUsage(ctx, resp.Usage)
+	}
+}
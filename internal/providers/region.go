@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// restrictionTTL is how long a provider that denied access from a region is
+// not tried again for requests from that region
+const restrictionTTL = time.Hour
+
+type regionKey struct{}
+
+// WithRegion returns a context whose requests are only sent to the providers
+// available in region, an empty region allows every provider
+func WithRegion(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, regionKey{}, strings.ToUpper(region))
+}
+
+// regionFrom returns the region of the requests made with ctx
+func regionFrom(ctx context.Context) string {
+	region, _ := ctx.Value(regionKey{}).(string)
+	return region
+}
+
+// allowsRegion reports whether region rules such as {"RU", "CIS"} or {"!RU"}
+// allow a region. A region denied with "!" is never allowed, a region is
+// allowed when it is listed or when the rules list no allowed region at all.
+func allowsRegion(rules []string, region string) bool {
+	if region == "" {
+		return true
+	}
+	listed := false
+	hasAllowed := false
+	for _, rule := range rules {
+		if denied, ok := strings.CutPrefix(rule, "!"); ok {
+			if strings.EqualFold(denied, region) {
+				return false
+			}
+			continue
+		}
+		hasAllowed = true
+		if strings.EqualFold(rule, region) {
+			listed = true
+		}
+	}
+	return listed || !hasAllowed
+}
+
+// availableIn reports whether the provider may serve a request from region at
+// now: its rules allow the region and it did not recently deny access from it
+func (info *ProviderInfo) availableIn(region string, now time.Time) bool {
+	if !allowsRegion(info.Regions, region) {
+		return false
+	}
+	until, restricted := info.RestrictedRegions[region]
+	return !restricted || now.After(until)
+}
+
+// StatusIn returns the status of a provider for the requests of region, it is
+// restricted there when its region rules deny the region or it recently
+// denied access from it
+func (pm *ProviderManager) StatusIn(providerName, region string) ProviderStatus {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	info, exists := pm.providerInfos[providerName]
+	if !exists {
+		return StatusUnhealthy
+	}
+	if !info.availableIn(region, time.Now()) {
+		return StatusRestricted
+	}
+	return info.Status
+}
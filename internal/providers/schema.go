@@ -0,0 +1,43 @@
+package providers
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/invopop/jsonschema"
+)
+
+// Output schemas for providers that take structured output as a JSON schema
+// instead of going through Genkit
+var (
+	summarizeSchema   = sync.OnceValue(func() map[string]any { return inferSchema(&SummarizeFlow{}) })
+	structurizeSchema = sync.OnceValue(func() map[string]any { return inferSchema(&SimpleStructurizeFlow{}) })
+)
+
+// SummarizeSchema returns the JSON schema of SummarizeFlow
+func SummarizeSchema() map[string]any {
+	return summarizeSchema()
+}
+
+// StructurizeSchema returns the JSON schema of SimpleStructurizeFlow
+func StructurizeSchema() map[string]any {
+	return structurizeSchema()
+}
+
+// inferSchema returns the JSON schema of v with every definition inlined,
+// as most providers do not resolve references
+func inferSchema(v any) map[string]any {
+	r := jsonschema.Reflector{DoNotReference: true, ExpandedStruct: true}
+	s := r.Reflect(v)
+	s.Version, s.ID = "", ""
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		panic("failed to marshal output schema: " + err.Error())
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		panic("failed to unmarshal output schema: " + err.Error())
+	}
+	return schema
+}
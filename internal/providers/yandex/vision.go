@@ -0,0 +1,76 @@
+package yandex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+const recognizeTextPath = "/ocr/v1/recognizeText"
+
+// ocrMimeTypes maps image content types to the mime types Vision OCR takes
+var ocrMimeTypes = map[string]string{
+	"image/jpeg": "JPEG",
+	"image/jpg":  "JPEG",
+	"image/png":  "PNG",
+}
+
+type recognizeTextRequest struct {
+	MimeType      string   `json:"mimeType"`
+	LanguageCodes []string `json:"languageCodes"`
+	Model         string   `json:"model"` // page, for text laid out freely
+	Content       string   `json:"content"`
+}
+
+type recognizeTextResponse struct {
+	Result struct {
+		TextAnnotation struct {
+			FullText string `json:"fullText"`
+		} `json:"textAnnotation"`
+	} `json:"result"`
+}
+
+// recognizeText reads the text on an image part with Vision OCR
+func (y *YandexGPTClient) recognizeText(ctx context.Context, part *ai.Part) (string, error) {
+	mimeType, ok := ocrMimeTypes[part.ContentType]
+	if !ok {
+		return "", fmt.Errorf("unsupported image type %s", part.ContentType)
+	}
+	content, err := y.imageContent(part.Text)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(recognizeTextRequest{
+		MimeType:      mimeType,
+		LanguageCodes: []string{"*"},
+		Model:         "page",
+		Content:       content,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal OCR request: %w", err)
+	}
+
+	var resp recognizeTextResponse
+	if err := y.post(ctx, y.cfg.OCRURL+recognizeTextPath, body, &resp); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Result.TextAnnotation.FullText), nil
+}
+
+// imageContent returns the base64 content of an image given as a data URL.
+// Image URLs are refused rather than downloaded, they come from clients and
+// may point at internal addresses.
+func (y *YandexGPTClient) imageContent(url string) (string, error) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", fmt.Errorf("image must be a data URL, image URLs are not downloaded")
+	}
+	_, data, ok := strings.Cut(url, ";base64,")
+	if !ok {
+		return "", fmt.Errorf("image data URL is not base64 encoded")
+	}
+	return data, nil
+}
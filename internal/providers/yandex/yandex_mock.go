@@ -9,20 +9,20 @@ import (
 	"github.com/firebase/genkit/go/ai"
 )
 
-// YandexGPTClient represents a mock Yandex GPT client
-type YandexGPTClient struct {
+// MockYandexGPTClient represents a mock Yandex GPT client
+type MockYandexGPTClient struct {
 	name string
 }
 
-// NewYandexGPTClient creates a new mock Yandex GPT client
-func NewYandexGPTClient() *YandexGPTClient {
-	return &YandexGPTClient{
+// NewMockYandexGPTClient creates a new mock Yandex GPT client
+func NewMockYandexGPTClient() *MockYandexGPTClient {
+	return &MockYandexGPTClient{
 		name: "yandex-gpt-mock",
 	}
 }
 
 // Summarize implements the LLMClient interface
-func (y *YandexGPTClient) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
+func (y *MockYandexGPTClient) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
 	// Simulate API call delay
 	time.Sleep(80 * time.Millisecond)
 
@@ -46,7 +46,7 @@ func (y *YandexGPTClient) Summarize(ctx context.Context, parts []*ai.Part) (mode
 }
 
 // Structurize implements the LLMClient interface
-func (y *YandexGPTClient) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
+func (y *MockYandexGPTClient) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
 	// Simulate API call delay
 	time.Sleep(120 * time.Millisecond)
 
@@ -70,6 +70,6 @@ func (y *YandexGPTClient) Structurize(ctx context.Context, parts []*ai.Part) (mo
 }
 
 // GetName returns the provider name
-func (y *YandexGPTClient) GetName() string {
+func (y *MockYandexGPTClient) GetName() string {
 	return y.name
 }
@@ -0,0 +1,276 @@
+package yandex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/providers"
+	"github.com/firebase/genkit/go/ai"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	completionPath = "/foundationModels/v1/completion"
+
+	temperature = 0.3
+	maxTokens   = "8000" // the API takes int64 fields as strings
+
+	maxErrorBody = 4 << 10
+)
+
+// YandexGPTClient calls the completion API of Yandex Cloud Foundation Models.
+// The API has no structured output for every model, so the flow schema is
+// given in the system prompt and the JSON is extracted from the reply. Board
+// screenshots are read with Vision OCR, as YandexGPT only takes text.
+type YandexGPTClient struct {
+	name   string
+	cfg    config.YandexConfig
+	client *http.Client
+}
+
+// NewYandexGPTClient creates a client registered as name, authenticated with
+// the API key of cfg or else its IAM token
+func NewYandexGPTClient(name string, cfg config.YandexConfig) *YandexGPTClient {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	cfg.OCRURL = strings.TrimRight(cfg.OCRURL, "/")
+	return &YandexGPTClient{
+		name:   name,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (y *YandexGPTClient) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
+	var out providers.SummarizeFlow
+	if err := y.generate(ctx, parts, providers.SummarizeSchema(), &out); err != nil {
+		return models.SummarizeResponse{}, err
+	}
+	return models.SummarizeResponse{Element: out.Element}, nil
+}
+
+func (y *YandexGPTClient) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
+	var out providers.SimpleStructurizeFlow
+	if err := y.generate(ctx, parts, providers.StructurizeSchema(), &out); err != nil {
+		return models.StructurizeResponse{}, err
+	}
+	return models.StructurizeResponse{
+		AiTreeResponse: out.AiTreeResponse,
+		File:           out.File.ToModelFile(),
+	}, nil
+}
+
+// GetName returns the name the client is registered with
+func (y *YandexGPTClient) GetName() string {
+	return y.name
+}
+
+type completionRequest struct {
+	ModelURI          string            `json:"modelUri"`
+	CompletionOptions completionOptions `json:"completionOptions"`
+	Messages          []message         `json:"messages"`
+}
+
+type completionOptions struct {
+	Stream      bool    `json:"stream"`
+	Temperature float64 `json:"temperature"`
+	MaxTokens   string  `json:"maxTokens"`
+}
+
+type message struct {
+	Role string `json:"role"` // system, user or assistant
+	Text string `json:"text"`
+}
+
+type completionResponse struct {
+	Result struct {
+		Alternatives []struct {
+			Message message `json:"message"`
+			Status  string  `json:"status"`
+		} `json:"alternatives"`
+		Usage struct {
+			InputTextTokens  int `json:"inputTextTokens,string"`
+			CompletionTokens int `json:"completionTokens,string"`
+		} `json:"usage"`
+	} `json:"result"`
+}
+
+// Alternative statuses that do not carry a complete answer
+const (
+	statusTruncated     = "ALTERNATIVE_STATUS_TRUNCATED_FINAL"
+	statusContentFilter = "ALTERNATIVE_STATUS_CONTENT_FILTER"
+)
+
+// generate sends parts with the instruction to answer as JSON matching
+// schema, and decodes the JSON of the reply into out
+func (y *YandexGPTClient) generate(ctx context.Context, parts []*ai.Part, schema map[string]any, out any) error {
+	prompt, err := y.promptText(ctx, parts)
+	if err != nil {
+		return err
+	}
+	instruction, err := jsonInstruction(schema)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(completionRequest{
+		ModelURI: y.modelURI(),
+		CompletionOptions: completionOptions{
+			Temperature: temperature,
+			MaxTokens:   maxTokens,
+		},
+		Messages: []message{
+			{Role: "system", Text: instruction},
+			{Role: "user", Text: prompt},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal completion request: %w", err)
+	}
+
+	var resp completionResponse
+	if err := y.post(ctx, y.cfg.BaseURL+completionPath, body, &resp); err != nil {
+		return err
+	}
+	providers.ReportUsage(ctx, &ai.GenerationUsage{
+		InputTokens:  resp.Result.Usage.InputTextTokens,
+		OutputTokens: resp.Result.Usage.CompletionTokens,
+	})
+
+	if len(resp.Result.Alternatives) == 0 {
+		return fmt.Errorf("%s returned no alternatives", y.name)
+	}
+	alternative := resp.Result.Alternatives[0]
+	switch alternative.Status {
+	case statusTruncated:
+		return fmt.Errorf("%s response was cut at the token limit", y.name)
+	case statusContentFilter:
+		return fmt.Errorf("%s response was blocked by the content filter", y.name)
+	}
+
+	data, ok := extractJSON(alternative.Message.Text)
+	if !ok {
+		return fmt.Errorf("%s output has no JSON object", y.name)
+	}
+	if err := json.Unmarshal([]byte(data), out); err != nil {
+		return fmt.Errorf("failed to parse %s output: %w", y.name, err)
+	}
+	return nil
+}
+
+// promptText joins the text parts with the text recognized on the images
+func (y *YandexGPTClient) promptText(ctx context.Context, parts []*ai.Part) (string, error) {
+	var texts []string
+	for _, p := range parts {
+		switch {
+		case p.IsText():
+			texts = append(texts, p.Text)
+		case p.IsImage():
+			text, err := y.recognizeText(ctx, p)
+			if err != nil {
+				return "", err
+			}
+			if text != "" {
+				texts = append(texts, "Text recognized on the board screenshot:\n"+text)
+			}
+		default:
+			return "", fmt.Errorf("unsupported %s part", p.ContentType)
+		}
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// modelURI returns the configured model, completed with the folder when it
+// is only a model name
+func (y *YandexGPTClient) modelURI() string {
+	if strings.Contains(y.cfg.Model, "://") {
+		return y.cfg.Model
+	}
+	return "gpt://" + y.cfg.FolderID + "/" + y.cfg.Model
+}
+
+// post sends a JSON request to a Yandex Cloud API and decodes the response
+// into out
+func (y *YandexGPTClient) post(ctx context.Context, url string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", y.name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-folder-id", y.cfg.FolderID)
+	if y.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Api-Key "+y.cfg.APIKey)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+y.cfg.IAMToken)
+	}
+
+	resp, err := y.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", y.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return y.providerError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", y.name, err)
+	}
+	return nil
+}
+
+// jsonInstruction returns the system prompt asking for a reply matching schema
+func jsonInstruction(schema map[string]any) (string, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal output schema: %w", err)
+	}
+	return "Reply with a single JSON object conforming to the following JSON schema, without any text or markdown around it:\n" + string(data), nil
+}
+
+// extractJSON returns the outermost JSON object of a reply, which YandexGPT
+// often wraps in a markdown code block or comments on
+func extractJSON(text string) (string, bool) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return "", false
+	}
+	return text[start : end+1], true
+}
+
+// providerError converts a Yandex Cloud error response into a ProviderError
+// typed by its status code, with the gRPC code and message of the body if any
+func (y *YandexGPTClient) providerError(resp *http.Response) *providers.ProviderError {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	// Errors come as {"error": {...}} or, from the gRPC gateway, at the top level
+	var e struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Error   struct {
+			GRPCCode int    `json:"grpcCode"`
+			Message  string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &e) != nil {
+		return providers.NewStatusError(y.name, resp, "", string(data))
+	}
+	code, message := e.Error.GRPCCode, e.Error.Message
+	if message == "" {
+		code, message = e.Code, e.Message
+	}
+	if message == "" {
+		return providers.NewStatusError(y.name, resp, "", string(data))
+	}
+	grpcCode := ""
+	if code != 0 {
+		grpcCode = codes.Code(code).String()
+	}
+	return providers.NewStatusError(y.name, resp, grpcCode, message)
+}
@@ -0,0 +1,169 @@
+package yandex
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/providers"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubServer serves the completion and OCR APIs, answering completions with
+// text. The last request of each path and the last headers are recorded.
+type stubServer struct {
+	*httptest.Server
+	requests map[string]map[string]any
+	headers  http.Header
+}
+
+func newStubServer(t *testing.T, text string) *stubServer {
+	s := &stubServer{requests: map[string]map[string]any{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+completionPath, func(w http.ResponseWriter, r *http.Request) {
+		s.record(t, r)
+		json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{
+			"alternatives": []any{map[string]any{
+				"message": map[string]any{"role": "assistant", "text": text},
+				"status":  "ALTERNATIVE_STATUS_FINAL",
+			}},
+			"usage":        map[string]any{"inputTextTokens": "210", "completionTokens": "45", "totalTokens": "255"},
+			"modelVersion": "23.10.2024",
+		}})
+	})
+	mux.HandleFunc("POST "+recognizeTextPath, func(w http.ResponseWriter, r *http.Request) {
+		s.record(t, r)
+		json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{
+			"textAnnotation": map[string]any{"fullText": "Спринт 12\nРелиз в пятницу"},
+		}})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubServer) record(t *testing.T, r *http.Request) {
+	var body map[string]any
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	s.requests[r.URL.Path] = body
+	s.headers = r.Header
+}
+
+func newTestClient(url string, cfg config.YandexConfig) *YandexGPTClient {
+	cfg.FolderID = "b1gfolder"
+	cfg.Model = "yandexgpt/latest"
+	cfg.BaseURL = url
+	cfg.OCRURL = url
+	cfg.Timeout = 5 * time.Second
+	return NewYandexGPTClient("yandex-gpt", cfg)
+}
+
+func TestYandexGPTClient_Summarize(t *testing.T) {
+	server := newStubServer(t, "Вот результат:\n```json\n{\"userPrompt\":\"\",\"element\":{\"id\":\"s1\",\"type\":\"text\",\"x\":10,\"y\":20,\"width\":200,\"height\":80,\"rotation\":0,\"content\":\"Сводка\"}}\n```")
+	client := newTestClient(server.URL, config.YandexConfig{APIKey: "test-key"})
+
+	var usage providers.Usage
+	ctx := providers.WithUsageObserver(context.Background(), func(u providers.Usage) { usage = u })
+	resp, err := client.Summarize(ctx, []*ai.Part{ai.NewTextPart("Summarize the board")})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Сводка", resp.Element.Content)
+	assert.Equal(t, float32(200), resp.Element.Width)
+	assert.Equal(t, 210, usage.InputTokens)
+	assert.Equal(t, 45, usage.OutputTokens)
+
+	assert.Equal(t, "Api-Key test-key", server.headers.Get("Authorization"))
+	assert.Equal(t, "b1gfolder", server.headers.Get("x-folder-id"))
+
+	body := server.requests[completionPath]
+	assert.Equal(t, "gpt://b1gfolder/yandexgpt/latest", body["modelUri"])
+	assert.Equal(t, map[string]any{"stream": false, "temperature": 0.3, "maxTokens": maxTokens}, body["completionOptions"])
+	messages := body["messages"].([]any)
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0].(map[string]any)["text"], `"element"`)
+	assert.Equal(t, map[string]any{"role": "user", "text": "Summarize the board"}, messages[1])
+}
+
+func TestYandexGPTClient_StructurizeScreenshot(t *testing.T) {
+	server := newStubServer(t, `{"userPrompt":"","answer":"","aiTreeResponse":"tree","children":{"rootIds":["r"],"nodes":[{"id":"r","name":"Спринт 12","type":"section"},{"id":"c","name":"Релиз","type":"doc","parentId":"r"}]}}`)
+	client := newTestClient(server.URL, config.YandexConfig{IAMToken: "t1.iam"})
+
+	image := base64.StdEncoding.EncodeToString([]byte("jpeg bytes"))
+	resp, err := client.Structurize(context.Background(), []*ai.Part{
+		ai.NewTextPart("Structurize the board"),
+		ai.NewMediaPart("image/jpeg", "data:image/jpeg;base64,"+image),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "tree", resp.AiTreeResponse)
+	assert.Equal(t, "Спринт 12", resp.File.Name)
+	require.Len(t, resp.File.Children, 1)
+	assert.Equal(t, "Bearer t1.iam", server.headers.Get("Authorization"))
+
+	ocr := server.requests[recognizeTextPath]
+	assert.Equal(t, "JPEG", ocr["mimeType"])
+	assert.Equal(t, image, ocr["content"])
+
+	messages := server.requests[completionPath]["messages"].([]any)
+	assert.Equal(t, "Structurize the board\n\nText recognized on the board screenshot:\nСпринт 12\nРелиз в пятницу", messages[1].(map[string]any)["text"])
+}
+
+func TestYandexGPTClient_RefusesImageURLs(t *testing.T) {
+	var fetched atomic.Bool
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Store(true)
+	}))
+	defer internal.Close()
+	server := newStubServer(t, `{}`)
+	client := newTestClient(server.URL, config.YandexConfig{IAMToken: "t1.iam"})
+
+	_, err := client.Summarize(context.Background(), []*ai.Part{
+		ai.NewTextPart("Summarize the board"),
+		ai.NewMediaPart("image/png", internal.URL+"/latest/meta-data"),
+	})
+	require.ErrorContains(t, err, "data URL")
+	assert.False(t, fetched.Load(), "the image URL must not be fetched")
+	assert.NotContains(t, server.requests, completionPath)
+}
+
+func TestYandexGPTClient_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"grpcCode":8,"httpCode":429,"message":"ai.languageModels.userInputTokens.count gauge quota limit exceed","httpStatus":"Too Many Requests"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(server.URL, config.YandexConfig{APIKey: "test-key"})
+
+	_, err := client.Summarize(context.Background(), []*ai.Part{ai.NewTextPart("Summarize the board")})
+
+	var providerErr *providers.ProviderError
+	require.True(t, errors.As(err, &providerErr), err)
+	assert.Equal(t, providers.RateLimitError, providerErr.Type)
+	assert.Equal(t, http.StatusTooManyRequests, providerErr.StatusCode)
+	assert.Equal(t, "ResourceExhausted", providerErr.Code)
+	assert.Contains(t, err.Error(), "quota limit exceed")
+}
+
+func TestExtractJSON(t *testing.T) {
+	for _, text := range []string{
+		`{"a":{"b":1}}`,
+		"```json\n{\"a\":{\"b\":1}}\n```",
+		"Конечно! {\"a\":{\"b\":1}} Надеюсь, это поможет.",
+	} {
+		data, ok := extractJSON(text)
+		assert.True(t, ok, text)
+		assert.Equal(t, `{"a":{"b":1}}`, data)
+	}
+
+	_, ok := extractJSON("Не могу помочь с этим")
+	assert.False(t, ok)
+}
@@ -2,14 +2,23 @@ package analysis
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/aiservice/internal/auth"
+	"github.com/aiservice/internal/config"
 	"github.com/aiservice/internal/models"
 	"github.com/aiservice/internal/providers"
 	jobservice "github.com/aiservice/internal/services/jobService"
 	"github.com/aiservice/internal/services/pipeline"
+	"github.com/aiservice/internal/services/quota"
+	"github.com/aiservice/internal/tracing"
 	"github.com/aiservice/internal/utils"
 )
 
@@ -21,10 +30,41 @@ func (e ErrAccepted) Error() string {
 	return fmt.Sprintf("job: %s in processing", e.JobID)
 }
 
+var (
+	// ErrIdempotencyKeyReused reports an Idempotency-Key sent again with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+	// ErrIdempotencyKeyInProgress reports a repeated request whose first attempt is still processing
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+	// ErrJobNotFound reports a job that does not exist or belongs to another
+	// principal, it is models.ErrJobNotFound
+	ErrJobNotFound = models.ErrJobNotFound
+	// ErrBatchNotFound reports a batch that does not exist or belongs to
+	// another principal, it is models.ErrBatchNotFound
+	ErrBatchNotFound = models.ErrBatchNotFound
+)
+
+// idempotencyMargin keeps an in-flight Idempotency-Key reserved past the sync
+// timeout, long enough for the request to be handed over to the job queue
+const idempotencyMargin = time.Minute
+
+// Execution is how the client of StartJob wants its request run
+type Execution struct {
+	Async bool          // queue the request and return its job right away
+	Wait  time.Duration // longest wait for a synchronous response, 0 or above the sync timeout means the sync timeout
+}
+
+// Idempotency identifies repeated submissions of one request by a user
+type Idempotency struct {
+	Key         string // the client's Idempotency-Key, empty disables deduplication
+	RequestHash string // fingerprint of the request as the client sent it, see RequestHash
+}
+
 type AnalysisService struct {
 	llm       providers.LLMClient
 	timeout   time.Duration
 	jobQueue  *jobservice.JobQueueService
+	quota     *quota.Service
+	routing   config.RoutingConfig
 }
 
 func NewAnalysisService(timeout time.Duration, llm providers.LLMClient, jobQueue *jobservice.JobQueueService) *AnalysisService {
@@ -47,16 +87,36 @@ func (s *AnalysisService) SetJobQueueService(jobQueueService *jobservice.JobQueu
 	s.jobQueue = jobQueueService
 }
 
+// SetQuotaService enforces per-user and per-tenant quotas, requests are unlimited without it
+func (s *AnalysisService) SetQuotaService(quotaService *quota.Service) {
+	s.quota = quotaService
+}
+
+// SetRouting sets the regions of the requests that name none, every
+// provider serves them otherwise
+func (s *AnalysisService) SetRouting(routing config.RoutingConfig) {
+	s.routing = routing
+}
+
+// AllowRequest counts a request against the requests per minute of its user
+// and tenant, failing with *quota.ExceededError over the limit
+func (s *AnalysisService) AllowRequest(ctx context.Context, userID, tenantID string) error {
+	if s.quota == nil {
+		return nil
+	}
+	return s.quota.AllowRequest(ctx, userID, tenantID)
+}
+
 func (s *AnalysisService) Abort(ctx context.Context, jobID string) error {
 	if s.jobQueue == nil {
 		return fmt.Errorf("job queue service not initialized")
 	}
-	job, err := s.jobQueue.GetJob(ctx, jobID)
-	if err != nil {
+	if _, err := s.ownedJob(ctx, jobID); err != nil {
 		return err
 	}
-	if job.Status == models.JobStatusPending {
-		return s.jobQueue.Abort(ctx, jobID)
+	// Aborting a job that finished, possibly just now, leaves it as it is
+	if err := s.jobQueue.Abort(ctx, jobID); err != nil && !errors.Is(err, models.ErrJobNotAbortable) {
+		return err
 	}
 	return nil
 }
@@ -65,43 +125,322 @@ func (s *AnalysisService) GetJob(ctx context.Context, jobID string) (models.Job,
 	if s.jobQueue == nil {
 		return models.Job{}, fmt.Errorf("job queue service not initialized")
 	}
-	return s.jobQueue.GetJob(ctx, jobID)
+	return s.ownedJob(ctx, jobID)
 }
 
-func (s *AnalysisService) StartJob(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
-	syncCtx, cancel := context.WithTimeout(ctx, s.timeout)
-	defer cancel()
+// ListJobs lists the jobs matching filter, only those of the caller unless it is an admin
+func (s *AnalysisService) ListJobs(ctx context.Context, filter models.JobFilter) (models.JobPage, error) {
+	if s.jobQueue == nil {
+		return models.JobPage{}, fmt.Errorf("job queue service not initialized")
+	}
+	if p, ok := auth.FromContext(ctx); ok && !p.Admin {
+		filter.Principal = p.ID
+	}
+	return s.jobQueue.ListJobs(ctx, filter)
+}
 
-	resultCh := make(chan models.AnalyzeResponse, 1)
-	errCh := make(chan error, 1)
+// ownedJob returns a job the caller of ctx may see, hiding the jobs of other principals
+func (s *AnalysisService) ownedJob(ctx context.Context, jobID string) (models.Job, error) {
+	job, err := s.jobQueue.GetJob(ctx, jobID)
+	if err != nil {
+		return models.Job{}, err
+	}
+	if p, ok := auth.FromContext(ctx); ok && !p.CanAccess(job.Principal) {
+		return models.Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
 
-	go func() {
-		resp, err := s.Process(syncCtx, req)
+// SubscribeJobEvents follows the progress events of a job, see jobservice.EventBus.Subscribe
+func (s *AnalysisService) SubscribeJobEvents(jobID string, lastEventID int64) ([]models.JobEvent, <-chan models.JobEvent, func(), error) {
+	if s.jobQueue == nil {
+		return nil, nil, nil, fmt.Errorf("job queue service not initialized")
+	}
+	history, events, cancel := s.jobQueue.SubscribeEvents(jobID, lastEventID)
+	return history, events, cancel, nil
+}
+
+func (s *AnalysisService) GetCallbackDeliveries(ctx context.Context, jobID string) ([]models.CallbackDelivery, error) {
+	if s.jobQueue == nil {
+		return nil, fmt.Errorf("job queue service not initialized")
+	}
+	if _, err := s.ownedJob(ctx, jobID); err != nil {
+		return nil, err
+	}
+	return s.jobQueue.GetCallbackDeliveries(ctx, jobID)
+}
+
+func (s *AnalysisService) ReplayCallback(ctx context.Context, jobID string) (models.CallbackDelivery, error) {
+	if s.jobQueue == nil {
+		return models.CallbackDelivery{}, fmt.Errorf("job queue service not initialized")
+	}
+	if _, err := s.ownedJob(ctx, jobID); err != nil {
+		return models.CallbackDelivery{}, err
+	}
+	return s.jobQueue.ReplayCallback(ctx, jobID)
+}
+
+// StartJob processes a request synchronously and falls back to a job once
+// the wait of exec elapses, the job keeps the processing already under way.
+// An async exec queues the request right away. With an idempotency key,
+// repeated submissions of the same request by the same user return the first
+// submission's response or job instead of starting a new one.
+func (s *AnalysisService) StartJob(ctx context.Context, req models.AnalyzeRequest, idempotency Idempotency, exec Execution) (models.AnalyzeResponse, error) {
+	if s.jobQueue == nil {
+		return models.AnalyzeResponse{}, fmt.Errorf("job queue service not initialized")
+	}
+	req = s.withRegion(req)
+	job := newJob(ctx, req)
+	wait := s.wait(exec)
+
+	var idem *models.IdempotencyRecord
+	if idempotency.Key != "" {
+		rec, ok, err := s.jobQueue.ReserveIdempotencyKey(ctx, req.UserID(), idempotency.Key, idempotency.RequestHash, job.ID, wait+idempotencyMargin)
 		if err != nil {
-			errCh <- err
-			return
+			return models.AnalyzeResponse{}, err
 		}
-		resultCh <- resp
-	}()
-
-	select {
-	case <-syncCtx.Done():
-		job := jobservice.NewJob(req)
-		if err := s.jobQueue.Enqueue(job); err != nil {
-			if _, ok := utils.MapErr[jobservice.QueueFullErr](err); ok {
-				slog.Warn("job queue is full")
-				return models.AnalyzeResponse{}, ErrAccepted{JobID: job.ID}
-			}
-			slog.Warn("enqueue error: %s", slog.Any("err", err))
+		if !ok {
+			return s.replayIdempotent(ctx, rec, idempotency.RequestHash)
+		}
+		idem = &rec
+	}
+
+	if err := s.admit(ctx, req, job.ID, wait+idempotencyMargin); err != nil {
+		s.releaseIdempotencyKey(ctx, idem)
+		return models.AnalyzeResponse{}, err
+	}
+
+	if exec.Async {
+		if err := s.enqueue(ctx, req, job); err != nil {
+			s.releaseIdempotencyKey(ctx, idem)
 			return models.AnalyzeResponse{}, err
 		}
+		s.completeIdempotencyKey(ctx, idem, nil)
 		return models.AnalyzeResponse{}, ErrAccepted{JobID: job.ID}
-	case err := <-errCh:
-		slog.Warn("process error: %s", slog.Any("err", err))
+	}
+
+	run := s.jobQueue.RunInline(ctx, job)
+	resp, finished, err := run.Wait(ctx, wait)
+	if !finished {
+		if err := run.Detach(); err != nil {
+			slog.Warn("failed to hand over request to the job queue", "jobID", job.ID, "err", err)
+			s.release(ctx, job.ID)
+			s.releaseIdempotencyKey(ctx, idem)
+			return models.AnalyzeResponse{}, err
+		}
+		s.handOver(ctx, req, job.ID)
+		s.completeIdempotencyKey(ctx, idem, nil)
+		return models.AnalyzeResponse{}, ErrAccepted{JobID: job.ID}
+	}
+
+	s.release(ctx, job.ID)
+	if err != nil {
+		slog.Warn("process error", "err", err)
+		s.releaseIdempotencyKey(ctx, idem)
 		return models.AnalyzeResponse{}, fmt.Errorf("failed to process request: %w", err)
+	}
+	s.completeIdempotencyKey(ctx, idem, &resp)
+	return resp, nil
+}
+
+// wait is how long StartJob waits for a synchronous response, the configured
+// sync timeout bounds the wait clients ask for
+func (s *AnalysisService) wait(exec Execution) time.Duration {
+	if exec.Async {
+		return 0
+	}
+	if exec.Wait > 0 && exec.Wait < s.timeout {
+		return exec.Wait
+	}
+	return s.timeout
+}
+
+// SubmitJob queues a request without trying it synchronously first. A full
+// in-memory queue still accepts the job, the database workers pick it up.
+func (s *AnalysisService) SubmitJob(ctx context.Context, req models.AnalyzeRequest) (models.Job, error) {
+	if s.jobQueue == nil {
+		return models.Job{}, fmt.Errorf("job queue service not initialized")
+	}
+	req = s.withRegion(req)
+	job := newJob(ctx, req)
+	if err := s.admit(ctx, req, job.ID, idempotencyMargin); err != nil {
+		return models.Job{}, err
+	}
+	if err := s.enqueue(ctx, req, job); err != nil {
+		return models.Job{}, err
+	}
+	return job, nil
+}
+
+// SubmitBatch queues one job per request, all linked to a new batch. Every
+// job is admitted against the quotas before any is queued, so the batch is
+// accepted or rejected as a whole. The jobs are returned in request order.
+func (s *AnalysisService) SubmitBatch(ctx context.Context, reqs []models.AnalyzeRequest) (models.Batch, []models.Job, error) {
+	if s.jobQueue == nil {
+		return models.Batch{}, nil, fmt.Errorf("job queue service not initialized")
+	}
+	batch := jobservice.NewBatch(len(reqs))
+	if p, ok := auth.FromContext(ctx); ok {
+		batch.Principal = p.ID
+	}
+
+	jobs := make([]models.Job, 0, len(reqs))
+	for _, req := range reqs {
+		job := newJob(ctx, s.withRegion(req))
+		job.BatchID = batch.ID
+		if err := s.admit(ctx, req, job.ID, idempotencyMargin); err != nil {
+			s.releaseAll(ctx, jobs)
+			return models.Batch{}, nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := s.jobQueue.SaveBatch(ctx, batch); err != nil {
+		s.releaseAll(ctx, jobs)
+		return models.Batch{}, nil, err
+	}
+	for i, job := range jobs {
+		if err := s.enqueue(ctx, job.Request, job); err != nil {
+			// The jobs already queued must not run for a batch the client never got
+			s.releaseAll(ctx, jobs[i+1:])
+			if _, abortErr := s.jobQueue.AbortBatch(context.WithoutCancel(ctx), batch.ID); abortErr != nil {
+				slog.Error("failed to abort partially queued batch", "batchID", batch.ID, "err", abortErr)
+			}
+			return models.Batch{}, nil, err
+		}
+	}
+	return batch, jobs, nil
+}
 
-	case resp := <-resultCh:
-		return resp, nil
+// GetBatch returns a batch the caller of ctx may see and its jobs in submission order
+func (s *AnalysisService) GetBatch(ctx context.Context, batchID string) (models.Batch, []models.Job, error) {
+	if s.jobQueue == nil {
+		return models.Batch{}, nil, fmt.Errorf("job queue service not initialized")
+	}
+	batch, jobs, err := s.jobQueue.GetBatch(ctx, batchID)
+	if err != nil {
+		return models.Batch{}, nil, err
+	}
+	if p, ok := auth.FromContext(ctx); ok && !p.CanAccess(batch.Principal) {
+		return models.Batch{}, nil, ErrBatchNotFound
+	}
+	return batch, jobs, nil
+}
+
+// AbortBatch aborts the unfinished jobs of a batch the caller of ctx may see
+func (s *AnalysisService) AbortBatch(ctx context.Context, batchID string) error {
+	if _, _, err := s.GetBatch(ctx, batchID); err != nil {
+		return err
+	}
+	_, err := s.jobQueue.AbortBatch(ctx, batchID)
+	return err
+}
+
+// enqueue stores an admitted job and queues it, handing its quota slots over
+// to it. A full in-memory queue still accepts the job, the database workers
+// pick it up.
+func (s *AnalysisService) enqueue(ctx context.Context, req models.AnalyzeRequest, job models.Job) error {
+	if err := s.jobQueue.Enqueue(job); err != nil {
+		if _, ok := utils.MapErr[jobservice.QueueFullErr](err); !ok {
+			s.release(ctx, job.ID)
+			return err
+		}
+		slog.Warn("job queue is full")
+	}
+	s.handOver(ctx, req, job.ID)
+	return nil
+}
+
+// withRegion returns req in the region of its tenant, or the default region,
+// when it names none
+func (s *AnalysisService) withRegion(req models.AnalyzeRequest) models.AnalyzeRequest {
+	region := req.Region()
+	if region == "" {
+		var ok bool
+		if region, ok = s.routing.TenantRegions[req.TenantID()]; !ok {
+			region = s.routing.DefaultRegion
+		}
+	}
+	req.SetRegion(strings.ToUpper(region))
+	return req
+}
+
+// newJob creates the job of a request, recording the caller of ctx as its
+// principal and the trace of ctx for its processing to continue
+func newJob(ctx context.Context, req models.AnalyzeRequest) models.Job {
+	job := jobservice.NewJob(req)
+	if p, ok := auth.FromContext(ctx); ok {
+		job.Principal = p.ID
+	}
+	job.TraceParent = tracing.TraceParent(ctx)
+	return job
+}
+
+// admit checks the daily budgets of the request's user and tenant and holds
+// a concurrent job slot for jobID, see quota.Service.Admit
+func (s *AnalysisService) admit(ctx context.Context, req models.AnalyzeRequest, jobID string, hold time.Duration) error {
+	if s.quota == nil {
+		return nil
+	}
+	return s.quota.Admit(ctx, req.UserID(), req.TenantID(), jobID, hold)
+}
+
+// handOver keeps the slots of a queued job for as long as it is pending or running
+func (s *AnalysisService) handOver(ctx context.Context, req models.AnalyzeRequest, jobID string) {
+	if s.quota != nil {
+		s.quota.HandOver(ctx, req.UserID(), req.TenantID(), jobID)
+	}
+}
+
+// release frees the slots of a request that finished synchronously or failed
+func (s *AnalysisService) release(ctx context.Context, jobID string) {
+	if s.quota != nil {
+		s.quota.Release(ctx, jobID)
+	}
+}
+
+// releaseAll frees the slots of admitted jobs that will not be queued
+func (s *AnalysisService) releaseAll(ctx context.Context, jobs []models.Job) {
+	for _, job := range jobs {
+		s.release(ctx, job.ID)
+	}
+}
+
+// replayIdempotent answers a repeated request from the record its key holds:
+// the stored response, the queued job, or a conflict while the first attempt runs
+func (s *AnalysisService) replayIdempotent(ctx context.Context, rec models.IdempotencyRecord, hash string) (models.AnalyzeResponse, error) {
+	if rec.RequestHash != hash {
+		return models.AnalyzeResponse{}, ErrIdempotencyKeyReused
+	}
+	if rec.Response != nil {
+		return *rec.Response, nil
+	}
+	// The job is only saved once the request fell back to the queue
+	if _, err := s.jobQueue.GetJob(ctx, rec.JobID); err == nil {
+		return models.AnalyzeResponse{}, ErrAccepted{JobID: rec.JobID}
+	}
+	return models.AnalyzeResponse{}, ErrIdempotencyKeyInProgress
+}
+
+// completeIdempotencyKey stores the outcome of a reserved key, a nil resp means it was queued
+func (s *AnalysisService) completeIdempotencyKey(ctx context.Context, idem *models.IdempotencyRecord, resp *models.AnalyzeResponse) {
+	if idem == nil {
+		return
+	}
+	idem.Response = resp
+	// The client may be gone, the outcome must be recorded anyway
+	if err := s.jobQueue.CompleteIdempotencyKey(context.WithoutCancel(ctx), *idem); err != nil {
+		slog.Error("failed to store idempotency key outcome", "key", idem.Key, "err", err)
+	}
+}
+
+// releaseIdempotencyKey frees a reserved key after a failure so the client can retry
+func (s *AnalysisService) releaseIdempotencyKey(ctx context.Context, idem *models.IdempotencyRecord) {
+	if idem == nil {
+		return
+	}
+	if err := s.jobQueue.ReleaseIdempotencyKey(context.WithoutCancel(ctx), *idem); err != nil {
+		slog.Error("failed to release idempotency key", "key", idem.Key, "err", err)
 	}
 }
 
@@ -110,9 +449,27 @@ func (s *AnalysisService) Process(ctx context.Context, req models.AnalyzeRequest
 	if err != nil {
 		return models.AnalyzeResponse{}, fmt.Errorf("failed to build pipeline: %w", err)
 	}
+	if s.quota != nil {
+		// Queued runs are charged too, Process is also the job queue's processor
+		ctx = providers.WithUsageObserver(ctx, func(usage providers.Usage) {
+			s.quota.RecordUsage(ctx, req.UserID(), req.TenantID(), usage.Provider, int64(usage.InputTokens+usage.OutputTokens))
+		})
+	}
+	// Only the providers available in the region of the request are tried
+	ctx = providers.WithRegion(ctx, req.Region())
 	state := &pipeline.PipelineState{AnalyzeRequest: req}
 	if err := p.Execute(ctx, state); err != nil {
 		return models.AnalyzeResponse{}, fmt.Errorf("processing pipeline failed: %w", err)
 	}
 	return state.AnalyzeResponse, nil
 }
+
+// RequestHash fingerprints a request so a reused Idempotency-Key can be checked against it
+func RequestHash(req any) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -1,5 +1,22 @@
 package analysis
 
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/auth"
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	jobservice "github.com/aiservice/internal/services/jobService"
+	"github.com/aiservice/internal/services/quota"
+	"github.com/aiservice/internal/services/storage"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/require"
+)
+
 // func TestProcess_UnsupportedType(t *testing.T) {
 // 	ctrl := gomock.NewController(t)
 // 	defer ctrl.Finish()
@@ -49,3 +66,328 @@ package analysis
 // 	require.NoError(t, err)
 // 	require.Equal(t, expected.ResponseMessage, resp.ResponseMessage)
 // }
+
+// fakeLLM answers summarize requests, holding each call until release is closed when set
+type fakeLLM struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (f *fakeLLM) Summarize(ctx context.Context, parts []*ai.Part) (models.SummarizeResponse, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			return models.SummarizeResponse{}, ctx.Err()
+		}
+	}
+	if f.err != nil {
+		return models.SummarizeResponse{}, f.err
+	}
+	return models.SummarizeResponse{Element: models.Text{Content: "summary"}}, nil
+}
+
+func (f *fakeLLM) Structurize(ctx context.Context, parts []*ai.Part) (models.StructurizeResponse, error) {
+	return models.StructurizeResponse{}, errors.New("not implemented")
+}
+
+func (f *fakeLLM) GetName() string {
+	return "fake"
+}
+
+func newTestService(t *testing.T, timeout time.Duration, llm *fakeLLM) (*AnalysisService, *storage.InMemoryJobStorage) {
+	st := storage.NewInMemoryJobStorage()
+	svc := NewAnalysisServiceWithoutJobQueue(timeout, llm)
+	// No workers, queued jobs stay pending
+	queue := jobservice.NewJobQueueService(config.JobConfig{QueueSize: 10}, st, svc, nil)
+	t.Cleanup(queue.Shutdown)
+	svc.SetJobQueueService(queue)
+	return svc, st
+}
+
+func testSummarizeRequest(boardID string) models.AnalyzeRequest {
+	return models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user", Board: models.Board{BoardID: boardID}})
+}
+
+func testIdempotency(t *testing.T, key string, req models.AnalyzeRequest) Idempotency {
+	hash, err := RequestHash(req)
+	require.NoError(t, err)
+	return Idempotency{Key: key, RequestHash: hash}
+}
+
+func TestStartJob_IdempotencyKeyReplaysResponse(t *testing.T) {
+	llm := &fakeLLM{}
+	svc, _ := newTestService(t, time.Second, llm)
+	req := testSummarizeRequest("board-1")
+
+	first, err := svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	require.NoError(t, err)
+	second, err := svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+	require.Equal(t, int32(1), llm.calls.Load())
+
+	// A different key runs the request again
+	_, err = svc.StartJob(context.Background(), req, testIdempotency(t, "key-2", req), Execution{})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), llm.calls.Load())
+
+	// Reusing a key for another request is rejected
+	other := testSummarizeRequest("board-2")
+	_, err = svc.StartJob(context.Background(), other, testIdempotency(t, "key-1", other), Execution{})
+	require.ErrorIs(t, err, ErrIdempotencyKeyReused)
+}
+
+func TestStartJob_IdempotencyKeyReplaysQueuedJob(t *testing.T) {
+	llm := &fakeLLM{release: make(chan struct{})}
+	defer close(llm.release)
+	svc, st := newTestService(t, 50*time.Millisecond, llm)
+	req := testSummarizeRequest("board-1")
+
+	_, err := svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	var accepted ErrAccepted
+	require.ErrorAs(t, err, &accepted)
+
+	_, err = svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	var replayed ErrAccepted
+	require.ErrorAs(t, err, &replayed)
+	require.Equal(t, accepted.JobID, replayed.JobID)
+
+	jobs, err := st.GetAll()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+}
+
+func TestStartJob_IdempotencyKeyInProgress(t *testing.T) {
+	llm := &fakeLLM{release: make(chan struct{})}
+	svc, _ := newTestService(t, 5*time.Second, llm)
+	req := testSummarizeRequest("board-1")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return llm.calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	_, err := svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	require.ErrorIs(t, err, ErrIdempotencyKeyInProgress)
+
+	close(llm.release)
+	require.NoError(t, <-done)
+}
+
+func TestStartJob_IdempotencyKeyReleasedOnFailure(t *testing.T) {
+	llm := &fakeLLM{err: errors.New("llm failed")}
+	svc, _ := newTestService(t, time.Second, llm)
+	req := testSummarizeRequest("board-1")
+
+	_, err := svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	require.Error(t, err)
+
+	// Failures are not remembered, the retry runs again
+	llm.err = nil
+	resp, err := svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	require.NoError(t, err)
+	require.Equal(t, "summary", resp.SummarizeResponse.Element.Content)
+	require.Equal(t, int32(2), llm.calls.Load())
+}
+
+func TestSubmitJob_QueuesWithoutProcessing(t *testing.T) {
+	llm := &fakeLLM{}
+	svc, st := newTestService(t, time.Second, llm)
+
+	job, err := svc.SubmitJob(context.Background(), testSummarizeRequest("board-1"))
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusPending, job.Status)
+	require.Equal(t, "board-1", job.BoardID)
+	require.Zero(t, llm.calls.Load())
+
+	stored, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusPending, stored.Status)
+
+	history, _, cancel, err := svc.SubscribeJobEvents(job.ID, 0)
+	require.NoError(t, err)
+	defer cancel()
+	require.Len(t, history, 1)
+	require.Equal(t, models.JobStatusPending, history[0].Status)
+}
+
+func TestSubmitJob_ResolvesRegion(t *testing.T) {
+	svc, _ := newTestService(t, time.Second, &fakeLLM{})
+	svc.SetRouting(config.RoutingConfig{TenantRegions: map[string]string{"acme": "ru"}, DefaultRegion: "EU"})
+
+	tests := []struct {
+		name   string
+		req    models.SummarizeRequest
+		region string
+	}{
+		{"field", models.SummarizeRequest{UserID: "user", TenantID: "acme", Region: "us"}, "US"},
+		{"tenant", models.SummarizeRequest{UserID: "user", TenantID: "acme"}, "RU"},
+		{"default", models.SummarizeRequest{UserID: "user", TenantID: "other"}, "EU"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job, err := svc.SubmitJob(context.Background(), models.NewSumAnalyzeReq(tt.req))
+			require.NoError(t, err)
+			require.Equal(t, tt.region, job.Request.Region())
+		})
+	}
+}
+
+func TestStartJob_ConcurrentJobsQuota(t *testing.T) {
+	llm := &fakeLLM{release: make(chan struct{})}
+	defer close(llm.release)
+	svc, st := newTestService(t, 50*time.Millisecond, llm)
+	svc.SetQuotaService(quota.NewService(config.QuotaConfig{User: config.QuotaLimitsConfig{ConcurrentJobs: 1}}, st))
+	req := testSummarizeRequest("board-1")
+
+	// The queued job keeps the user's only slot while it is pending
+	_, err := svc.StartJob(context.Background(), req, Idempotency{}, Execution{})
+	var accepted ErrAccepted
+	require.ErrorAs(t, err, &accepted)
+
+	_, err = svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	var exceeded *quota.ExceededError
+	require.ErrorAs(t, err, &exceeded)
+	require.Equal(t, "concurrentJobs", exceeded.Limit)
+	_, err = svc.SubmitJob(context.Background(), req)
+	require.ErrorAs(t, err, &exceeded)
+
+	// Finishing the job frees the slot, and the rejected key was not kept
+	job, err := st.Get(accepted.JobID)
+	require.NoError(t, err)
+	job.Status = models.JobStatusCompleted
+	require.NoError(t, st.Update(job))
+
+	_, err = svc.StartJob(context.Background(), req, testIdempotency(t, "key-1", req), Execution{})
+	require.ErrorAs(t, err, &accepted)
+}
+
+func TestJobs_OnlyVisibleToTheirPrincipal(t *testing.T) {
+	svc, _ := newTestService(t, time.Second, &fakeLLM{})
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{ID: "alice"})
+	bob := auth.WithPrincipal(context.Background(), auth.Principal{ID: "bob"})
+	admin := auth.WithPrincipal(context.Background(), auth.Principal{ID: "ops", Admin: true})
+
+	job, err := svc.SubmitJob(alice, testSummarizeRequest("board-1"))
+	require.NoError(t, err)
+	require.Equal(t, "alice", job.Principal)
+
+	_, err = svc.GetJob(alice, job.ID)
+	require.NoError(t, err)
+	_, err = svc.GetJob(admin, job.ID)
+	require.NoError(t, err)
+	_, err = svc.GetJob(bob, job.ID)
+	require.ErrorIs(t, err, ErrJobNotFound)
+	require.ErrorIs(t, svc.Abort(bob, job.ID), ErrJobNotFound)
+	_, err = svc.ReplayCallback(bob, job.ID)
+	require.ErrorIs(t, err, ErrJobNotFound)
+
+	page, err := svc.ListJobs(bob, models.JobFilter{})
+	require.NoError(t, err)
+	require.Empty(t, page.Jobs)
+	page, err = svc.ListJobs(admin, models.JobFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 1)
+
+	require.NoError(t, svc.Abort(alice, job.ID))
+	stored, err := svc.GetJob(alice, job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusAborted, stored.Status)
+}
+
+func TestStartJob_FallbackKeepsProcessing(t *testing.T) {
+	llm := &fakeLLM{release: make(chan struct{})}
+	svc, st := newTestService(t, 50*time.Millisecond, llm)
+
+	_, err := svc.StartJob(context.Background(), testSummarizeRequest("board-1"), Idempotency{}, Execution{})
+	var accepted ErrAccepted
+	require.ErrorAs(t, err, &accepted)
+
+	job, err := st.Get(accepted.JobID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusRunning, job.Status)
+
+	close(llm.release)
+	require.Eventually(t, func() bool {
+		job, err := st.Get(accepted.JobID)
+		return err == nil && job.Status == models.JobStatusCompleted
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, int32(1), llm.calls.Load())
+}
+
+func TestStartJob_Execution(t *testing.T) {
+	llm := &fakeLLM{release: make(chan struct{})}
+	defer close(llm.release)
+	svc, st := newTestService(t, 5*time.Second, llm)
+
+	// Async requests are queued without being processed here
+	_, err := svc.StartJob(context.Background(), testSummarizeRequest("board-1"), Idempotency{}, Execution{Async: true})
+	var accepted ErrAccepted
+	require.ErrorAs(t, err, &accepted)
+	job, err := st.Get(accepted.JobID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusPending, job.Status)
+	require.Zero(t, llm.calls.Load())
+
+	// A bounded wait falls back long before the sync timeout
+	start := time.Now()
+	_, err = svc.StartJob(context.Background(), testSummarizeRequest("board-2"), Idempotency{}, Execution{Wait: 20 * time.Millisecond})
+	require.ErrorAs(t, err, &accepted)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, int32(1), llm.calls.Load())
+}
+
+func TestSubmitBatch(t *testing.T) {
+	svc, _ := newTestService(t, time.Second, &fakeLLM{})
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{ID: "alice"})
+	bob := auth.WithPrincipal(context.Background(), auth.Principal{ID: "bob"})
+
+	reqs := []models.AnalyzeRequest{testSummarizeRequest("board-1"), testSummarizeRequest("board-2"), testSummarizeRequest("board-3")}
+	batch, jobs, err := svc.SubmitBatch(alice, reqs)
+	require.NoError(t, err)
+	require.Equal(t, 3, batch.Size)
+	require.Equal(t, "alice", batch.Principal)
+	require.Len(t, jobs, 3)
+
+	_, got, err := svc.GetBatch(alice, batch.ID)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	for i, job := range got {
+		require.Equal(t, jobs[i].ID, job.ID, "jobs are listed in submission order")
+		require.Equal(t, batch.ID, job.BatchID)
+		require.Equal(t, models.JobStatusPending, job.Status)
+	}
+
+	_, _, err = svc.GetBatch(bob, batch.ID)
+	require.ErrorIs(t, err, ErrBatchNotFound)
+	require.ErrorIs(t, svc.AbortBatch(bob, batch.ID), ErrBatchNotFound)
+
+	require.NoError(t, svc.AbortBatch(alice, batch.ID))
+	batch, got, err = svc.GetBatch(alice, batch.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusAborted, models.NewBatchResponse(batch, got).Status)
+}
+
+func TestSubmitBatch_RejectedAsAWholeOverQuota(t *testing.T) {
+	svc, st := newTestService(t, time.Second, &fakeLLM{})
+	quotas := quota.NewService(config.QuotaConfig{User: config.QuotaLimitsConfig{ConcurrentJobs: 2}}, st)
+	svc.SetQuotaService(quotas)
+
+	reqs := []models.AnalyzeRequest{testSummarizeRequest("board-1"), testSummarizeRequest("board-2"), testSummarizeRequest("board-3")}
+	_, _, err := svc.SubmitBatch(context.Background(), reqs)
+	var exceeded *quota.ExceededError
+	require.ErrorAs(t, err, &exceeded)
+
+	all, err := st.GetAll()
+	require.NoError(t, err)
+	require.Empty(t, all, "no job of a rejected batch is queued")
+
+	// The slots of the admitted items were given back
+	_, _, err = svc.SubmitBatch(context.Background(), reqs[:2])
+	require.NoError(t, err)
+}
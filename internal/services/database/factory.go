@@ -13,6 +13,8 @@ func NewStorage(cfg config.DatabaseConfig) (jobservice.JobStorage, error) {
 		return storage.NewInMemoryJobStorage(), nil
 	case "sqlite":
 		return NewSQLiteStorage(cfg)
+	case "postgres":
+		return NewPostgresStorage(cfg)
 	default:
 		return NewSQLiteStorage(cfg) // Default to SQLite
 	}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sqliteColumns lists the columns of a SQLite table
+func sqliteColumns(t *testing.T, db *sql.DB, table string) []string {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []string{DialectSQLite, DialectPostgres} {
+		migrations, err := loadMigrations(dialect)
+		require.NoError(t, err, dialect)
+		require.NotEmpty(t, migrations, dialect)
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.Version, "%s migrations must be numbered without gaps", dialect)
+			assert.NotEmpty(t, m.Up)
+			assert.NotEmpty(t, m.Down)
+		}
+	}
+}
+
+func TestMigrator_UpDownStatus(t *testing.T) {
+	cfg := config.DatabaseConfig{Type: "sqlite", FilePath: filepath.Join(t.TempDir(), "jobs.sqlite")}
+	ctx := context.Background()
+
+	m, err := NewMigrator(cfg)
+	require.NoError(t, err)
+	defer m.Close()
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.False(t, status.Applied)
+	}
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(statuses))
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied, "a second run is a no-op")
+	assert.Contains(t, sqliteColumns(t, m.db, "jobs"), "user_id")
+
+	rolledBack, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, rolledBack, 1)
+	assert.Equal(t, statuses[len(statuses)-1].Version, rolledBack[0].Version)
+
+	// Roll back to 0003_job_retry_schedule, dropping the owner columns of 0004
+	_, err = m.Down(ctx, len(statuses)-4)
+	require.NoError(t, err)
+	columns := sqliteColumns(t, m.db, "jobs")
+	assert.NotContains(t, columns, "user_id")
+	assert.Contains(t, columns, "next_retry_at")
+
+	statuses, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, statuses[3].Applied)
+	assert.True(t, statuses[2].Applied)
+	assert.NotZero(t, statuses[0].AppliedAt)
+
+	_, err = m.Down(ctx, len(statuses))
+	require.NoError(t, err)
+	assert.Empty(t, sqliteColumns(t, m.db, "jobs"))
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(statuses))
+}
+
+func TestSQLiteStorage_MigratesLegacyDatabase(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "legacy.sqlite")
+
+	// A database created before migrations existed
+	legacy, err := sql.Open("sqlite3", dbFile)
+	require.NoError(t, err)
+	_, err = legacy.Exec(`
+	CREATE TABLE jobs (
+		id TEXT PRIMARY KEY,
+		request_type TEXT NOT NULL,
+		request_data TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		retries INTEGER DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'pending',
+		result_data TEXT
+	);
+	INSERT INTO jobs (id, request_type, request_data, created_at, status)
+	VALUES ('legacy-job', 'summarize', '{"requestType":"summarize","SummarizeRequest":{"userId":"user-1","board":{"boardId":"board-1"}}}', 100, 'completed');
+	`)
+	require.NoError(t, err)
+	require.NoError(t, legacy.Close())
+
+	storage, err := NewSQLiteStorage(config.DatabaseConfig{Type: "sqlite", FilePath: dbFile})
+	require.NoError(t, err)
+	defer storage.Close()
+
+	job, err := storage.Get("legacy-job")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", job.UserID)
+	assert.Equal(t, "board-1", job.BoardID)
+
+	page, err := storage.Query(context.Background(), models.JobFilter{UserID: "user-1"})
+	require.NoError(t, err)
+	assert.Len(t, page.Jobs, 1)
+
+	job.Error = "stored in a migrated column"
+	require.NoError(t, storage.Update(job))
+	job, err = storage.Get("legacy-job")
+	require.NoError(t, err)
+	assert.Equal(t, "stored in a migrated column", job.Error)
+}
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT PRIMARY KEY,
+	request_type TEXT NOT NULL,
+	request_data JSONB NOT NULL,
+	created_at BIGINT NOT NULL,
+	retries INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'pending',
+	result_data JSONB,
+	error_message TEXT,
+	callback_url TEXT,
+	next_retry_at BIGINT NOT NULL DEFAULT 0,
+	user_id TEXT,
+	board_id TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs(created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_board_id ON jobs(board_id, created_at);
+
+CREATE TABLE IF NOT EXISTS callback_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	job_id TEXT NOT NULL,
+	url TEXT NOT NULL,
+	attempt INTEGER NOT NULL,
+	status_code INTEGER,
+	error_message TEXT,
+	success BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_callback_deliveries_job_id ON callback_deliveries(job_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_jobs_lease;
+ALTER TABLE jobs DROP COLUMN IF EXISTS recoveries;
+ALTER TABLE jobs DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS lease_owner;
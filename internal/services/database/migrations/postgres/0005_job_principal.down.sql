@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_jobs_principal;
+ALTER TABLE jobs DROP COLUMN IF EXISTS principal;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS batches (
+	id TEXT PRIMARY KEY,
+	created_at BIGINT NOT NULL,
+	size BIGINT NOT NULL,
+	principal TEXT
+);
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS batch_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_batch_id ON jobs(batch_id, created_at);
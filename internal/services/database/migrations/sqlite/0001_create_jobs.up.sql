@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT PRIMARY KEY,
+	request_type TEXT NOT NULL,
+	request_data TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	retries INTEGER DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'pending',
+	result_data TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs(created_at);
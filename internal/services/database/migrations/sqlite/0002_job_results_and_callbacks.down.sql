@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS callback_deliveries;
+ALTER TABLE jobs DROP COLUMN callback_url;
+ALTER TABLE jobs DROP COLUMN error_message;
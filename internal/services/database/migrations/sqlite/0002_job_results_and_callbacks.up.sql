@@ -0,0 +1,14 @@
+ALTER TABLE jobs ADD COLUMN error_message TEXT;
+ALTER TABLE jobs ADD COLUMN callback_url TEXT;
+
+CREATE TABLE IF NOT EXISTS callback_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	job_id TEXT NOT NULL,
+	url TEXT NOT NULL,
+	attempt INTEGER NOT NULL,
+	status_code INTEGER,
+	error_message TEXT,
+	success INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_callback_deliveries_job_id ON callback_deliveries(job_id);
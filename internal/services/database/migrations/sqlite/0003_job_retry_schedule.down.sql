@@ -0,0 +1 @@
+ALTER TABLE jobs DROP COLUMN next_retry_at;
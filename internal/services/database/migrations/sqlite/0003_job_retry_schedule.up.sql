@@ -0,0 +1 @@
+ALTER TABLE jobs ADD COLUMN next_retry_at INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_jobs_board_id;
+DROP INDEX IF EXISTS idx_jobs_user_id;
+ALTER TABLE jobs DROP COLUMN board_id;
+ALTER TABLE jobs DROP COLUMN user_id;
@@ -0,0 +1,17 @@
+ALTER TABLE jobs ADD COLUMN user_id TEXT;
+ALTER TABLE jobs ADD COLUMN board_id TEXT;
+
+-- Backfill from the stored request so existing jobs show up in filtered listings
+UPDATE jobs SET
+	user_id = NULLIF(CASE request_type
+		WHEN 'summarize' THEN json_extract(request_data, '$.SummarizeRequest.userId')
+		ELSE json_extract(request_data, '$.StructurizeRequest.userId')
+	END, ''),
+	board_id = NULLIF(CASE request_type
+		WHEN 'summarize' THEN json_extract(request_data, '$.SummarizeRequest.board.boardId')
+		ELSE json_extract(request_data, '$.StructurizeRequest.board.boardId')
+	END, '')
+WHERE json_valid(request_data);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_board_id ON jobs(board_id, created_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS quota_slots;
+DROP TABLE IF EXISTS quota_usage;
+DROP TABLE IF EXISTS quota_requests;
+DROP TABLE IF EXISTS quota_limits;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS quota_limits (
+	scope TEXT NOT NULL,
+	subject_id TEXT NOT NULL,
+	requests_per_minute INTEGER NOT NULL DEFAULT 0,
+	concurrent_jobs INTEGER NOT NULL DEFAULT 0,
+	daily_tokens INTEGER NOT NULL DEFAULT 0,
+	daily_cost REAL NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (scope, subject_id)
+);
+CREATE TABLE IF NOT EXISTS quota_requests (
+	scope TEXT NOT NULL,
+	subject_id TEXT NOT NULL,
+	window_start INTEGER NOT NULL,
+	requests INTEGER NOT NULL,
+	PRIMARY KEY (scope, subject_id, window_start)
+);
+CREATE TABLE IF NOT EXISTS quota_usage (
+	scope TEXT NOT NULL,
+	subject_id TEXT NOT NULL,
+	day INTEGER NOT NULL,
+	tokens INTEGER NOT NULL DEFAULT 0,
+	cost REAL NOT NULL DEFAULT 0,
+	PRIMARY KEY (scope, subject_id, day)
+);
+CREATE TABLE IF NOT EXISTS quota_slots (
+	job_id TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	subject_id TEXT NOT NULL,
+	expires_at INTEGER NOT NULL,
+	PRIMARY KEY (job_id, scope, subject_id)
+);
+CREATE INDEX IF NOT EXISTS idx_quota_slots_subject ON quota_slots(scope, subject_id);
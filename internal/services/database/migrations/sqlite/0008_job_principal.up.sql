@@ -0,0 +1,3 @@
+ALTER TABLE jobs ADD COLUMN principal TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_principal ON jobs(principal, created_at);
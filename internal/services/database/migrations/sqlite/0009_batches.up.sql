@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS batches (
+	id TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	size INTEGER NOT NULL,
+	principal TEXT
+);
+ALTER TABLE jobs ADD COLUMN batch_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_batch_id ON jobs(batch_id, created_at);
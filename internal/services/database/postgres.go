@@ -0,0 +1,704 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// PostgresJobStorage keeps jobs in PostgreSQL. Claims use row level locks, so
+// several service replicas can safely share one job table.
+type PostgresJobStorage struct {
+	db *sql.DB
+}
+
+// NewPostgresStorage creates a new PostgreSQL storage instance
+func NewPostgresStorage(cfg config.DatabaseConfig) (*PostgresJobStorage, error) {
+	db, err := openTraced("pgx", postgresDSN(cfg), semconv.DBSystemNamePostgreSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PostgreSQL database: %w", err)
+	}
+
+	// Set connection pool settings
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+
+	if err := migrate(ctx, db, DialectPostgres); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate PostgreSQL database: %w", err)
+	}
+
+	return &PostgresJobStorage{db: db}, nil
+}
+
+// postgresDSN builds a connection URL from the database config
+func postgresDSN(cfg config.DatabaseConfig) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     cfg.Host + ":" + cfg.Port,
+		Path:     "/" + cfg.Name,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+func (s *PostgresJobStorage) Save(job models.Job) error {
+	requestData, err := json.Marshal(job.Request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request data: %w", err)
+	}
+
+	resultData, err := marshalResult(job.Result)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO jobs (id, request_type, request_data, created_at, retries, status, result_data, error_message, callback_url, next_retry_at, user_id, board_id, lease_owner, lease_expires_at, recoveries, principal, batch_id, trace_parent, provider)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+	ON CONFLICT (id) DO UPDATE SET
+		request_type = excluded.request_type,
+		request_data = excluded.request_data,
+		created_at = excluded.created_at,
+		retries = excluded.retries,
+		status = excluded.status,
+		result_data = excluded.result_data,
+		error_message = excluded.error_message,
+		callback_url = excluded.callback_url,
+		next_retry_at = excluded.next_retry_at,
+		user_id = excluded.user_id,
+		board_id = excluded.board_id,
+		lease_owner = excluded.lease_owner,
+		lease_expires_at = excluded.lease_expires_at,
+		recoveries = excluded.recoveries,
+		principal = excluded.principal,
+		batch_id = excluded.batch_id,
+		trace_parent = excluded.trace_parent,
+		provider = excluded.provider
+	`
+
+	_, err = s.db.Exec(query, job.ID, job.Request.RequestType, string(requestData), job.CreatedAt, job.Retries, string(job.Status), resultData, nullString(job.Error), nullString(job.CallbackURL), job.NextRetryAt, nullString(job.UserID), nullString(job.BoardID), nullString(job.LeaseOwner), job.LeaseExpiresAt, job.Recoveries, nullString(job.Principal), nullString(job.BatchID), nullString(job.TraceParent), nullString(job.Provider))
+	if err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresJobStorage) Get(id string) (models.Job, error) {
+	query := "SELECT " + jobColumns + " FROM jobs WHERE id = $1"
+	row := s.db.QueryRow(query, id)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Job{}, models.ErrJobNotFound
+		}
+		return models.Job{}, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return job, nil
+}
+
+func (s *PostgresJobStorage) Update(job models.Job) error {
+	_, err := s.updateJob(context.Background(), job, "WHERE id = $19", job.ID)
+	return err
+}
+
+func (s *PostgresJobStorage) Finish(ctx context.Context, job models.Job, owner string) (bool, error) {
+	rowsAffected, err := s.updateJob(ctx, job, "WHERE id = $19 AND status = $20 AND lease_owner = $21",
+		job.ID, string(models.JobStatusRunning), owner)
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// updateJob writes every column of job to the rows matching where, whose
+// arguments are given in whereArgs numbered from $19, and returns the number
+// of rows written
+func (s *PostgresJobStorage) updateJob(ctx context.Context, job models.Job, where string, whereArgs ...any) (int64, error) {
+	requestData, err := json.Marshal(job.Request)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request data: %w", err)
+	}
+
+	resultData, err := marshalResult(job.Result)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	UPDATE jobs
+	SET request_type = $1, request_data = $2, created_at = $3, retries = $4, status = $5, result_data = $6, error_message = $7, callback_url = $8, next_retry_at = $9, user_id = $10, board_id = $11, lease_owner = $12, lease_expires_at = $13, recoveries = $14, principal = $15, batch_id = $16, trace_parent = $17, provider = $18
+	` + where
+
+	args := []any{
+		job.Request.RequestType,
+		string(requestData),
+		job.CreatedAt,
+		job.Retries,
+		string(job.Status),
+		resultData,
+		nullString(job.Error),
+		nullString(job.CallbackURL),
+		job.NextRetryAt,
+		nullString(job.UserID),
+		nullString(job.BoardID),
+		nullString(job.LeaseOwner),
+		job.LeaseExpiresAt,
+		job.Recoveries,
+		nullString(job.Principal),
+		nullString(job.BatchID),
+		nullString(job.TraceParent),
+		nullString(job.Provider),
+	}
+
+	result, err := s.db.ExecContext(ctx, query, append(args, whereArgs...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update job: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+func (s *PostgresJobStorage) Abort(ctx context.Context, id string) error {
+	// Only unfinished jobs are aborted, a job finishing meanwhile keeps its outcome
+	query := "UPDATE jobs SET status = $1, lease_owner = NULL, lease_expires_at = 0 WHERE id = $2 AND status IN ($3, $4)"
+	result, err := s.db.Exec(query, string(models.JobStatusAborted), id,
+		string(models.JobStatusPending), string(models.JobStatusRunning))
+	if err != nil {
+		return fmt.Errorf("failed to abort job: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		var exists bool
+		if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM jobs WHERE id = $1)", id).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check job: %w", err)
+		}
+		if exists {
+			return models.ErrJobNotAbortable
+		}
+		return models.ErrJobNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresJobStorage) GetAll() ([]models.Job, error) {
+	rows, err := s.db.Query("SELECT " + jobColumns + " FROM jobs ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all jobs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+func (s *PostgresJobStorage) Query(ctx context.Context, filter models.JobFilter) (models.JobPage, error) {
+	filter = filter.Normalize()
+
+	var args []any
+	query, err := buildJobQuery(filter, dollarBinder(&args))
+	if err != nil {
+		return models.JobPage{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return models.JobPage{}, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return models.JobPage{}, err
+	}
+
+	return newJobPage(jobs, filter.Limit), nil
+}
+
+// Claim moves a pending job to running under the lease. The update takes the
+// row lock, so a concurrent claim waits, re-checks the status and matches no row.
+func (s *PostgresJobStorage) Claim(ctx context.Context, id string, lease models.Lease) (models.Job, bool, error) {
+	query := "UPDATE jobs SET status = $1, lease_owner = $2, lease_expires_at = $3 WHERE id = $4 AND status = $5 RETURNING " + jobColumns
+	row := s.db.QueryRowContext(ctx, query, string(models.JobStatusRunning), lease.Owner, lease.ExpiresAt, id, string(models.JobStatusPending))
+
+	job, err := scanJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Job{}, false, nil
+		}
+		return models.Job{}, false, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	return job, true, nil
+}
+
+// ClaimPending moves up to limit due pending jobs to running. Rows locked by
+// another replica's claim are skipped instead of waited on.
+func (s *PostgresJobStorage) ClaimPending(ctx context.Context, limit int, now int64, lease models.Lease) ([]models.Job, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	query := `
+	UPDATE jobs SET status = $1, lease_owner = $2, lease_expires_at = $3
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE status = $4 AND next_retry_at <= $5 AND lease_expires_at < $5
+		ORDER BY created_at, id
+		LIMIT $6
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+
+	rows, err := s.db.QueryContext(ctx, query, string(models.JobStatusRunning), lease.Owner, lease.ExpiresAt, string(models.JobStatusPending), now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending jobs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+func (s *PostgresJobStorage) HoldPending(ctx context.Context, ids []string, lease models.Lease) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := "UPDATE jobs SET lease_expires_at = $1 WHERE status = $2 AND lease_owner = $3 AND id = ANY($4)"
+	if _, err := s.db.ExecContext(ctx, query, lease.ExpiresAt, string(models.JobStatusPending), lease.Owner, ids); err != nil {
+		return fmt.Errorf("failed to hold pending jobs: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) Heartbeat(ctx context.Context, id string, lease models.Lease) (bool, error) {
+	query := "UPDATE jobs SET lease_expires_at = $1 WHERE id = $2 AND status = $3 AND lease_owner = $4"
+	result, err := s.db.ExecContext(ctx, query, lease.ExpiresAt, id, string(models.JobStatusRunning), lease.Owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to renew job lease: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// RecoverExpired requeues or fails running jobs with expired leases. Rows
+// being recovered by another replica are skipped.
+func (s *PostgresJobStorage) RecoverExpired(ctx context.Context, now int64, maxRecoveries int) ([]models.Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Jobs that already used up their recoveries fail instead of looping forever
+	failQuery := `
+	UPDATE jobs SET status = $1, error_message = $2, lease_owner = NULL, lease_expires_at = 0
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE status = $3 AND lease_expires_at < $4 AND recoveries >= $5
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+	failed, err := queryJobs(ctx, tx, failQuery, string(models.JobStatusFailed), models.JobAbandonedError, string(models.JobStatusRunning), now, maxRecoveries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fail abandoned jobs: %w", err)
+	}
+
+	recoverQuery := `
+	UPDATE jobs SET status = $1, recoveries = recoveries + 1, next_retry_at = 0, lease_owner = NULL, lease_expires_at = 0
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE status = $2 AND lease_expires_at < $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+	recovered, err := queryJobs(ctx, tx, recoverQuery, string(models.JobStatusPending), string(models.JobStatusRunning), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover expired jobs: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit job recovery: %w", err)
+	}
+
+	return append(failed, recovered...), nil
+}
+
+func (s *PostgresJobStorage) DeleteJobs(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM jobs WHERE id = ANY($1)", ids)
+	if err != nil {
+		return fmt.Errorf("failed to delete jobs: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM callback_deliveries WHERE job_id = ANY($1)", ids); err != nil {
+		return fmt.Errorf("failed to delete callback deliveries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit job deletion: %w", err)
+	}
+
+	slog.Info("deleted jobs", "count", rowsAffected)
+	return nil
+}
+
+func (s *PostgresJobStorage) SaveDelivery(delivery models.CallbackDelivery) error {
+	query := `
+	INSERT INTO callback_deliveries (job_id, url, attempt, status_code, error_message, success, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := s.db.Exec(query,
+		delivery.JobID,
+		delivery.URL,
+		delivery.Attempt,
+		delivery.StatusCode,
+		nullString(delivery.Error),
+		delivery.Success,
+		delivery.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save callback delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresJobStorage) GetDeliveries(jobID string) ([]models.CallbackDelivery, error) {
+	query := `
+	SELECT id, job_id, url, attempt, status_code, error_message, success, created_at
+	FROM callback_deliveries WHERE job_id = $1 ORDER BY id
+	`
+	rows, err := s.db.Query(query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get callback deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+func (s *PostgresJobStorage) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, now int64) (models.IdempotencyRecord, bool, error) {
+	responseData, err := marshalResult(rec.Response)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	// Take the key over only when its previous record has expired
+	query := `
+	INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, job_id, response_data, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT(user_id, idempotency_key) DO UPDATE SET
+		request_hash = excluded.request_hash,
+		job_id = excluded.job_id,
+		response_data = excluded.response_data,
+		created_at = excluded.created_at,
+		expires_at = excluded.expires_at
+	WHERE idempotency_keys.expires_at <= $8
+	`
+
+	result, err := s.db.ExecContext(ctx, query, rec.UserID, rec.Key, rec.RequestHash, rec.JobID, responseData, rec.CreatedAt, rec.ExpiresAt, now)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected > 0 {
+		return rec, true, nil
+	}
+
+	query = "SELECT " + idempotencyColumns + " FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2"
+	existing, err := scanIdempotencyRecord(s.db.QueryRowContext(ctx, query, rec.UserID, rec.Key))
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return existing, false, nil
+}
+
+func (s *PostgresJobStorage) UpdateIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	responseData, err := marshalResult(rec.Response)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE idempotency_keys
+	SET request_hash = $1, job_id = $2, response_data = $3, created_at = $4, expires_at = $5
+	WHERE user_id = $6 AND idempotency_key = $7
+	`
+
+	result, err := s.db.ExecContext(ctx, query, rec.RequestHash, rec.JobID, responseData, rec.CreatedAt, rec.ExpiresAt, rec.UserID, rec.Key)
+	if err != nil {
+		return fmt.Errorf("failed to update idempotency key: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("idempotency key not found")
+	}
+
+	return nil
+}
+
+func (s *PostgresJobStorage) DeleteIdempotencyKey(ctx context.Context, userID, key string) error {
+	query := "DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2"
+	if _, err := s.db.ExecContext(ctx, query, userID, key); err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) DeleteExpiredIdempotencyKeys(ctx context.Context, now int64) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", now); err != nil {
+		return fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) GetQuotaLimits(ctx context.Context, subject models.QuotaSubject) (models.QuotaLimits, bool, error) {
+	query := "SELECT " + quotaLimitsColumns + " FROM quota_limits WHERE scope = $1 AND subject_id = $2"
+	limits, err := scanQuotaLimits(s.db.QueryRowContext(ctx, query, string(subject.Scope), subject.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.QuotaLimits{}, false, nil
+	}
+	if err != nil {
+		return models.QuotaLimits{}, false, fmt.Errorf("failed to get quota limits: %w", err)
+	}
+	return limits, true, nil
+}
+
+func (s *PostgresJobStorage) ListQuotaLimits(ctx context.Context) ([]models.QuotaLimits, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+quotaLimitsColumns+" FROM quota_limits ORDER BY scope, subject_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quota limits: %w", err)
+	}
+	defer rows.Close()
+
+	return scanQuotaLimitsRows(rows)
+}
+
+func (s *PostgresJobStorage) SaveQuotaLimits(ctx context.Context, limits models.QuotaLimits) error {
+	query := `
+	INSERT INTO quota_limits (scope, subject_id, requests_per_minute, concurrent_jobs, daily_tokens, daily_cost, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT(scope, subject_id) DO UPDATE SET
+		requests_per_minute = excluded.requests_per_minute,
+		concurrent_jobs = excluded.concurrent_jobs,
+		daily_tokens = excluded.daily_tokens,
+		daily_cost = excluded.daily_cost,
+		updated_at = excluded.updated_at
+	`
+	_, err := s.db.ExecContext(ctx, query, string(limits.Scope), limits.SubjectID, limits.RequestsPerMinute, limits.ConcurrentJobs, limits.DailyTokens, limits.DailyCost, limits.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save quota limits: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) DeleteQuotaLimits(ctx context.Context, subject models.QuotaSubject) error {
+	query := "DELETE FROM quota_limits WHERE scope = $1 AND subject_id = $2"
+	if _, err := s.db.ExecContext(ctx, query, string(subject.Scope), subject.ID); err != nil {
+		return fmt.Errorf("failed to delete quota limits: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) CountQuotaRequest(ctx context.Context, subject models.QuotaSubject, window int64, limit int) (bool, error) {
+	// The counter only moves while it is below the limit
+	query := `
+	INSERT INTO quota_requests (scope, subject_id, window_start, requests)
+	VALUES ($1, $2, $3, 1)
+	ON CONFLICT(scope, subject_id, window_start) DO UPDATE SET requests = quota_requests.requests + 1
+	WHERE $4 = 0 OR quota_requests.requests < $4
+	`
+	result, err := s.db.ExecContext(ctx, query, string(subject.Scope), subject.ID, window, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to count quota request: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (s *PostgresJobStorage) AcquireQuotaSlot(ctx context.Context, subject models.QuotaSubject, jobID string, limit int, now, expiresAt int64) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Replicas count the slots of a subject one at a time, the lock is
+	// released with the transaction
+	lockKey := string(subject.Scope) + ":" + subject.ID
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", lockKey); err != nil {
+		return false, fmt.Errorf("failed to lock quota subject: %w", err)
+	}
+
+	query := `
+	INSERT INTO quota_slots (job_id, scope, subject_id, expires_at)
+	SELECT $1, $2, $3, $4
+	WHERE $5 = 0 OR (
+		SELECT COUNT(*) FROM quota_slots
+		WHERE scope = $2 AND subject_id = $3 AND (quota_slots.expires_at > $6
+			OR EXISTS (SELECT 1 FROM jobs WHERE jobs.id = quota_slots.job_id AND jobs.status IN ($7, $8)))
+	) < $5
+	ON CONFLICT(job_id, scope, subject_id) DO UPDATE SET expires_at = excluded.expires_at
+	`
+	result, err := tx.ExecContext(ctx, query,
+		jobID, string(subject.Scope), subject.ID, expiresAt,
+		limit, now, string(models.JobStatusPending), string(models.JobStatusRunning))
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire quota slot: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (s *PostgresJobStorage) ReleaseQuotaSlots(ctx context.Context, jobID string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM quota_slots WHERE job_id = $1", jobID); err != nil {
+		return fmt.Errorf("failed to release quota slots: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) AddQuotaUsage(ctx context.Context, subject models.QuotaSubject, day int64, tokens int64, cost float64) error {
+	query := `
+	INSERT INTO quota_usage (scope, subject_id, day, tokens, cost)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT(scope, subject_id, day) DO UPDATE SET
+		tokens = quota_usage.tokens + excluded.tokens,
+		cost = quota_usage.cost + excluded.cost
+	`
+	if _, err := s.db.ExecContext(ctx, query, string(subject.Scope), subject.ID, day, tokens, cost); err != nil {
+		return fmt.Errorf("failed to add quota usage: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) GetQuotaUsage(ctx context.Context, subject models.QuotaSubject, window, day, now int64) (models.QuotaUsage, error) {
+	query := `
+	SELECT
+		COALESCE((SELECT requests FROM quota_requests WHERE scope = $1 AND subject_id = $2 AND window_start = $3), 0),
+		(SELECT COUNT(*) FROM quota_slots WHERE scope = $1 AND subject_id = $2 AND (quota_slots.expires_at > $5
+			OR EXISTS (SELECT 1 FROM jobs WHERE jobs.id = quota_slots.job_id AND jobs.status IN ($6, $7)))),
+		COALESCE((SELECT tokens FROM quota_usage WHERE scope = $1 AND subject_id = $2 AND day = $4), 0),
+		COALESCE((SELECT cost FROM quota_usage WHERE scope = $1 AND subject_id = $2 AND day = $4), 0)
+	`
+	var usage models.QuotaUsage
+	err := s.db.QueryRowContext(ctx, query,
+		string(subject.Scope), subject.ID, window, day,
+		now, string(models.JobStatusPending), string(models.JobStatusRunning),
+	).Scan(&usage.RequestsThisMinute, &usage.ConcurrentJobs, &usage.TokensToday, &usage.CostToday)
+	if err != nil {
+		return models.QuotaUsage{}, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	return usage, nil
+}
+
+func (s *PostgresJobStorage) DeleteExpiredQuota(ctx context.Context, window, day, now int64) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM quota_requests WHERE window_start < $1", window); err != nil {
+		return fmt.Errorf("failed to delete expired quota requests: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM quota_usage WHERE day < $1", day); err != nil {
+		return fmt.Errorf("failed to delete expired quota usage: %w", err)
+	}
+	query := `
+	DELETE FROM quota_slots
+	WHERE quota_slots.expires_at <= $1
+	AND NOT EXISTS (SELECT 1 FROM jobs WHERE jobs.id = quota_slots.job_id AND jobs.status IN ($2, $3))
+	`
+	if _, err := s.db.ExecContext(ctx, query, now, string(models.JobStatusPending), string(models.JobStatusRunning)); err != nil {
+		return fmt.Errorf("failed to delete expired quota slots: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) SaveBatch(ctx context.Context, batch models.Batch) error {
+	query := "INSERT INTO batches (id, created_at, size, principal) VALUES ($1, $2, $3, $4)"
+	if _, err := s.db.ExecContext(ctx, query, batch.ID, batch.CreatedAt, batch.Size, nullString(batch.Principal)); err != nil {
+		return fmt.Errorf("failed to save batch: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresJobStorage) GetBatch(ctx context.Context, id string) (models.Batch, error) {
+	query := "SELECT " + batchColumns + " FROM batches WHERE id = $1"
+	batch, err := scanBatch(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Batch{}, models.ErrBatchNotFound
+	}
+	if err != nil {
+		return models.Batch{}, fmt.Errorf("failed to get batch: %w", err)
+	}
+	return batch, nil
+}
+
+// Close closes the database connection
+func (s *PostgresJobStorage) Close() error {
+	return s.db.Close()
+}
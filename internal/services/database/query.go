@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiservice/internal/models"
+)
+
+// binder appends a query argument and returns its placeholder
+type binder func(arg any) string
+
+// questionBinder binds arguments with SQLite "?" placeholders
+func questionBinder(args *[]any) binder {
+	return func(arg any) string {
+		*args = append(*args, arg)
+		return "?"
+	}
+}
+
+// dollarBinder binds arguments with Postgres "$n" placeholders
+func dollarBinder(args *[]any) binder {
+	return func(arg any) string {
+		*args = append(*args, arg)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+}
+
+// buildJobQuery renders the SELECT for a normalized job filter. It fetches
+// one extra row so the caller can tell whether another page exists.
+func buildJobQuery(filter models.JobFilter, bind binder) (string, error) {
+	var conditions []string
+
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = bind(string(status))
+		}
+		conditions = append(conditions, fmt.Sprintf("status IN (%s)", strings.Join(placeholders, ",")))
+	}
+	if filter.RequestType != "" {
+		conditions = append(conditions, "request_type = "+bind(filter.RequestType))
+	}
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = "+bind(filter.UserID))
+	}
+	if filter.BoardID != "" {
+		conditions = append(conditions, "board_id = "+bind(filter.BoardID))
+	}
+	if filter.Principal != "" {
+		conditions = append(conditions, "principal = "+bind(filter.Principal))
+	}
+	if filter.BatchID != "" {
+		conditions = append(conditions, "batch_id = "+bind(filter.BatchID))
+	}
+	if filter.CreatedFrom > 0 {
+		conditions = append(conditions, "created_at >= "+bind(filter.CreatedFrom))
+	}
+	if filter.CreatedTo > 0 {
+		conditions = append(conditions, "created_at < "+bind(filter.CreatedTo))
+	}
+
+	direction, cmp := "DESC", "<"
+	if filter.Order == models.SortAsc {
+		direction, cmp = "ASC", ">"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := models.DecodeJobCursor(filter.Cursor)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, fmt.Sprintf("(created_at %s %s OR (created_at = %s AND id %s %s))",
+			cmp, bind(cursor.CreatedAt), bind(cursor.CreatedAt), cmp, bind(cursor.ID)))
+	}
+
+	query := "SELECT " + jobColumns + " FROM jobs"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT %s", direction, direction, bind(filter.Limit+1))
+
+	return query, nil
+}
+
+// newJobPage trims the extra row fetched by buildJobQuery into the next cursor
+func newJobPage(jobs []models.Job, limit int) models.JobPage {
+	page := models.JobPage{Jobs: jobs}
+	if len(jobs) > limit {
+		page.Jobs = jobs[:limit]
+		page.NextCursor = models.EncodeJobCursor(page.Jobs[limit-1])
+	}
+	return page
+}
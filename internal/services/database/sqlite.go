@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/aiservice/internal/config"
 	"github.com/aiservice/internal/models"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -21,7 +23,7 @@ type SQLiteJobStorage struct {
 
 // NewSQLiteStorage creates a new SQLite storage instance
 func NewSQLiteStorage(cfg config.DatabaseConfig) (*SQLiteJobStorage, error) {
-	db, err := sql.Open("sqlite3", cfg.FilePath+"?cache=shared&_busy_timeout=10000")
+	db, err := openTraced("sqlite3", cfg.FilePath+"?cache=shared&_busy_timeout=10000", semconv.DBSystemNameSqlite)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
 	}
@@ -31,9 +33,10 @@ func NewSQLiteStorage(cfg config.DatabaseConfig) (*SQLiteJobStorage, error) {
 	db.SetMaxIdleConns(25)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	// Create the jobs table if it doesn't exist
-	if err := createJobsTable(db); err != nil {
-		return nil, fmt.Errorf("failed to create jobs table: %w", err)
+	// Bring the schema up to date
+	if err := migrate(context.Background(), db, DialectSQLite); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate SQLite database: %w", err)
 	}
 
 	storage := &SQLiteJobStorage{
@@ -43,44 +46,42 @@ func NewSQLiteStorage(cfg config.DatabaseConfig) (*SQLiteJobStorage, error) {
 	return storage, nil
 }
 
-// createJobsTable creates the jobs table if it doesn't exist
-func createJobsTable(db *sql.DB) error {
-	query := `
-	CREATE TABLE IF NOT EXISTS jobs (
-		id TEXT PRIMARY KEY,
-		request_type TEXT NOT NULL,
-		request_data TEXT NOT NULL,
-		created_at INTEGER NOT NULL,
-		retries INTEGER DEFAULT 0,
-		status TEXT NOT NULL DEFAULT 'pending',
-		result_data TEXT
-	);
-	CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
-	CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs(created_at);
-	`
-
-	_, err := db.Exec(query)
-	return err
-}
-
 func (s *SQLiteJobStorage) Save(job models.Job) error {
 	requestData, err := json.Marshal(job.Request)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request data: %w", err)
 	}
 
+	resultData, err := marshalResult(job.Result)
+	if err != nil {
+		return err
+	}
+
 	query := `
-	INSERT INTO jobs (id, request_type, request_data, created_at, retries, status)
-	VALUES (?, ?, ?, ?, ?, ?)
+	INSERT INTO jobs (id, request_type, request_data, created_at, retries, status, result_data, error_message, callback_url, next_retry_at, user_id, board_id, lease_owner, lease_expires_at, recoveries, principal, batch_id, trace_parent, provider)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(id) DO UPDATE SET
 		request_type = excluded.request_type,
 		request_data = excluded.request_data,
 		created_at = excluded.created_at,
 		retries = excluded.retries,
-		status = excluded.status
+		status = excluded.status,
+		result_data = excluded.result_data,
+		error_message = excluded.error_message,
+		callback_url = excluded.callback_url,
+		next_retry_at = excluded.next_retry_at,
+		user_id = excluded.user_id,
+		board_id = excluded.board_id,
+		lease_owner = excluded.lease_owner,
+		lease_expires_at = excluded.lease_expires_at,
+		recoveries = excluded.recoveries,
+		principal = excluded.principal,
+		batch_id = excluded.batch_id,
+		trace_parent = excluded.trace_parent,
+		provider = excluded.provider
 	`
 
-	_, err = s.db.Exec(query, job.ID, job.Request.RequestType, string(requestData), job.CreatedAt, job.Retries, string(job.Status))
+	_, err = s.db.Exec(query, job.ID, job.Request.RequestType, string(requestData), job.CreatedAt, job.Retries, string(job.Status), resultData, nullString(job.Error), nullString(job.CallbackURL), job.NextRetryAt, nullString(job.UserID), nullString(job.BoardID), nullString(job.LeaseOwner), job.LeaseExpiresAt, job.Recoveries, nullString(job.Principal), nullString(job.BatchID), nullString(job.TraceParent), nullString(job.Provider))
 	if err != nil {
 		return fmt.Errorf("failed to save job: %w", err)
 	}
@@ -89,74 +90,92 @@ func (s *SQLiteJobStorage) Save(job models.Job) error {
 }
 
 func (s *SQLiteJobStorage) Get(id string) (models.Job, error) {
-	query := "SELECT id, request_type, request_data, created_at, retries, status, result_data FROM jobs WHERE id = ?"
+	query := "SELECT " + jobColumns + " FROM jobs WHERE id = ?"
 	row := s.db.QueryRow(query, id)
 
-	var jobID, requestType, requestData, status, resultData sql.NullString
-	var createdAt int64
-	var retries int
-
-	err := row.Scan(&jobID, &requestType, &requestData, &createdAt, &retries, &status, &resultData)
+	job, err := scanJob(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return models.Job{}, fmt.Errorf("job not found")
+			return models.Job{}, models.ErrJobNotFound
 		}
 		return models.Job{}, fmt.Errorf("failed to get job: %w", err)
 	}
 
-	var request models.AnalyzeRequest
-	if err := json.Unmarshal([]byte(requestData.String), &request); err != nil {
-		return models.Job{}, fmt.Errorf("failed to unmarshal request data: %w", err)
-	}
+	return job, nil
+}
 
-	job := models.Job{
-		ID:        jobID.String,
-		Request:   request,
-		CreatedAt: createdAt,
-		Retries:   retries,
-		Status:    models.JobStatus(status.String),
+func (s *SQLiteJobStorage) Update(job models.Job) error {
+	_, err := s.updateJob(context.Background(), job, "WHERE id = ?", job.ID)
+	return err
+}
+
+func (s *SQLiteJobStorage) Finish(ctx context.Context, job models.Job, owner string) (bool, error) {
+	rowsAffected, err := s.updateJob(ctx, job, "WHERE id = ? AND status = ? AND lease_owner = ?",
+		job.ID, string(models.JobStatusRunning), owner)
+	if err != nil {
+		return false, err
 	}
 
-	return job, nil
+	return rowsAffected == 1, nil
 }
 
-func (s *SQLiteJobStorage) Update(job models.Job) error {
+// updateJob writes every column of job to the rows matching where, whose
+// arguments are given in whereArgs, and returns the number of rows written
+func (s *SQLiteJobStorage) updateJob(ctx context.Context, job models.Job, where string, whereArgs ...any) (int64, error) {
 	requestData, err := json.Marshal(job.Request)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request data: %w", err)
+		return 0, fmt.Errorf("failed to marshal request data: %w", err)
 	}
 
-	var resultData *string
-	if job.Status == models.JobStatusCompleted {
-		// In a real implementation, we would store the result data
-		// For now, we'll leave it as null
+	resultData, err := marshalResult(job.Result)
+	if err != nil {
+		return 0, err
 	}
 
 	query := `
 	UPDATE jobs
-	SET request_type = ?, request_data = ?, created_at = ?, retries = ?, status = ?, result_data = ?
-	WHERE id = ?
-	`
+	SET request_type = ?, request_data = ?, created_at = ?, retries = ?, status = ?, result_data = ?, error_message = ?, callback_url = ?, next_retry_at = ?, user_id = ?, board_id = ?, lease_owner = ?, lease_expires_at = ?, recoveries = ?, principal = ?, batch_id = ?, trace_parent = ?, provider = ?
+	` + where
 
-	_, err = s.db.Exec(query,
+	args := []any{
 		job.Request.RequestType,
 		string(requestData),
 		job.CreatedAt,
 		job.Retries,
 		string(job.Status),
 		resultData,
-		job.ID)
+		nullString(job.Error),
+		nullString(job.CallbackURL),
+		job.NextRetryAt,
+		nullString(job.UserID),
+		nullString(job.BoardID),
+		nullString(job.LeaseOwner),
+		job.LeaseExpiresAt,
+		job.Recoveries,
+		nullString(job.Principal),
+		nullString(job.BatchID),
+		nullString(job.TraceParent),
+		nullString(job.Provider),
+	}
 
+	result, err := s.db.ExecContext(ctx, query, append(args, whereArgs...)...)
 	if err != nil {
-		return fmt.Errorf("failed to update job: %w", err)
+		return 0, fmt.Errorf("failed to update job: %w", err)
 	}
 
-	return nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
 }
 
 func (s *SQLiteJobStorage) Abort(ctx context.Context, id string) error {
-	query := "UPDATE jobs SET status = ? WHERE id = ?"
-	result, err := s.db.Exec(query, string(models.JobStatusAborted), id)
+	// Only unfinished jobs are aborted, a job finishing meanwhile keeps its outcome
+	query := "UPDATE jobs SET status = ?, lease_owner = NULL, lease_expires_at = 0 WHERE id = ? AND status IN (?, ?)"
+	result, err := s.db.Exec(query, string(models.JobStatusAborted), id,
+		string(models.JobStatusPending), string(models.JobStatusRunning))
 	if err != nil {
 		return fmt.Errorf("failed to abort job: %w", err)
 	}
@@ -167,49 +186,162 @@ func (s *SQLiteJobStorage) Abort(ctx context.Context, id string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("job not found")
+		var exists bool
+		if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM jobs WHERE id = ?)", id).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check job: %w", err)
+		}
+		if exists {
+			return models.ErrJobNotAbortable
+		}
+		return models.ErrJobNotFound
 	}
 
 	return nil
 }
 
 func (s *SQLiteJobStorage) GetAll() ([]models.Job, error) {
-	query := "SELECT id, request_type, request_data, created_at, retries, status, result_data FROM jobs ORDER BY created_at DESC"
+	query := "SELECT " + jobColumns + " FROM jobs ORDER BY created_at DESC, id DESC"
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all jobs: %w", err)
 	}
 	defer rows.Close()
 
-	var jobs []models.Job
-	for rows.Next() {
-		var jobID, requestType, requestData, status, resultData sql.NullString
-		var createdAt int64
-		var retries int
+	return scanJobs(rows)
+}
 
-		err := rows.Scan(&jobID, &requestType, &requestData, &createdAt, &retries, &status, &resultData)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan job row: %w", err)
-		}
+// Query returns one page of jobs matching the filter, ordered by creation time.
+// Pagination is keyset based on (created_at, id) so pages stay stable while
+// new jobs are inserted, and every filter maps onto an indexed column.
+func (s *SQLiteJobStorage) Query(ctx context.Context, filter models.JobFilter) (models.JobPage, error) {
+	filter = filter.Normalize()
 
-		var request models.AnalyzeRequest
-		if err := json.Unmarshal([]byte(requestData.String), &request); err != nil {
-			slog.Error("failed to unmarshal request data", "job_id", jobID.String, "error", err)
-			continue
-		}
+	var args []any
+	query, err := buildJobQuery(filter, questionBinder(&args))
+	if err != nil {
+		return models.JobPage{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return models.JobPage{}, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return models.JobPage{}, err
+	}
 
-		job := models.Job{
-			ID:        jobID.String,
-			Request:   request,
-			CreatedAt: createdAt,
-			Retries:   retries,
-			Status:    models.JobStatus(status.String),
+	return newJobPage(jobs, filter.Limit), nil
+}
+
+// Claim moves a pending job to running under the lease. SQLite serializes
+// writers, so the conditional update alone guarantees a single winner.
+func (s *SQLiteJobStorage) Claim(ctx context.Context, id string, lease models.Lease) (models.Job, bool, error) {
+	query := "UPDATE jobs SET status = ?, lease_owner = ?, lease_expires_at = ? WHERE id = ? AND status = ? RETURNING " + jobColumns
+	row := s.db.QueryRowContext(ctx, query, string(models.JobStatusRunning), lease.Owner, lease.ExpiresAt, id, string(models.JobStatusPending))
+
+	job, err := scanJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Job{}, false, nil
 		}
+		return models.Job{}, false, fmt.Errorf("failed to claim job: %w", err)
+	}
 
-		jobs = append(jobs, job)
+	return job, true, nil
+}
+
+func (s *SQLiteJobStorage) ClaimPending(ctx context.Context, limit int, now int64, lease models.Lease) ([]models.Job, error) {
+	if limit <= 0 {
+		return nil, nil
 	}
 
-	return jobs, nil
+	query := `
+	UPDATE jobs SET status = ?, lease_owner = ?, lease_expires_at = ?
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE status = ? AND next_retry_at <= ? AND lease_expires_at < ?
+		ORDER BY created_at, id
+		LIMIT ?
+	)
+	RETURNING ` + jobColumns
+
+	rows, err := s.db.QueryContext(ctx, query, string(models.JobStatusRunning), lease.Owner, lease.ExpiresAt, string(models.JobStatusPending), now, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending jobs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+func (s *SQLiteJobStorage) HoldPending(ctx context.Context, ids []string, lease models.Lease) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := []any{lease.ExpiresAt, string(models.JobStatusPending), lease.Owner}
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+
+	query := fmt.Sprintf("UPDATE jobs SET lease_expires_at = ? WHERE status = ? AND lease_owner = ? AND id IN (%s)", strings.Join(placeholders, ","))
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to hold pending jobs: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) Heartbeat(ctx context.Context, id string, lease models.Lease) (bool, error) {
+	query := "UPDATE jobs SET lease_expires_at = ? WHERE id = ? AND status = ? AND lease_owner = ?"
+	result, err := s.db.ExecContext(ctx, query, lease.ExpiresAt, id, string(models.JobStatusRunning), lease.Owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to renew job lease: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (s *SQLiteJobStorage) RecoverExpired(ctx context.Context, now int64, maxRecoveries int) ([]models.Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Jobs that already used up their recoveries fail instead of looping forever
+	failQuery := `
+	UPDATE jobs SET status = ?, error_message = ?, lease_owner = NULL, lease_expires_at = 0
+	WHERE status = ? AND lease_expires_at < ? AND recoveries >= ?
+	RETURNING ` + jobColumns
+	failed, err := queryJobs(ctx, tx, failQuery, string(models.JobStatusFailed), models.JobAbandonedError, string(models.JobStatusRunning), now, maxRecoveries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fail abandoned jobs: %w", err)
+	}
+
+	recoverQuery := `
+	UPDATE jobs SET status = ?, recoveries = recoveries + 1, next_retry_at = 0, lease_owner = NULL, lease_expires_at = 0
+	WHERE status = ? AND lease_expires_at < ?
+	RETURNING ` + jobColumns
+	recovered, err := queryJobs(ctx, tx, recoverQuery, string(models.JobStatusPending), string(models.JobStatusRunning), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover expired jobs: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit job recovery: %w", err)
+	}
+
+	return append(failed, recovered...), nil
 }
 
 func (s *SQLiteJobStorage) DeleteJobs(ids ...string) error {
@@ -240,10 +372,507 @@ func (s *SQLiteJobStorage) DeleteJobs(ids ...string) error {
 
 	slog.Info("deleted jobs", "count", rowsAffected)
 
+	deliveriesQuery := fmt.Sprintf("DELETE FROM callback_deliveries WHERE job_id IN (%s)", strings.Join(placeholders, ","))
+	if _, err := s.db.Exec(deliveriesQuery, args...); err != nil {
+		return fmt.Errorf("failed to delete callback deliveries: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteJobStorage) SaveDelivery(delivery models.CallbackDelivery) error {
+	query := `
+	INSERT INTO callback_deliveries (job_id, url, attempt, status_code, error_message, success, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		delivery.JobID,
+		delivery.URL,
+		delivery.Attempt,
+		delivery.StatusCode,
+		nullString(delivery.Error),
+		delivery.Success,
+		delivery.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save callback delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteJobStorage) GetDeliveries(jobID string) ([]models.CallbackDelivery, error) {
+	query := `
+	SELECT id, job_id, url, attempt, status_code, error_message, success, created_at
+	FROM callback_deliveries WHERE job_id = ? ORDER BY id
+	`
+	rows, err := s.db.Query(query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get callback deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+func (s *SQLiteJobStorage) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, now int64) (models.IdempotencyRecord, bool, error) {
+	responseData, err := marshalResult(rec.Response)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	// Take the key over only when its previous record has expired
+	query := `
+	INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, job_id, response_data, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(user_id, idempotency_key) DO UPDATE SET
+		request_hash = excluded.request_hash,
+		job_id = excluded.job_id,
+		response_data = excluded.response_data,
+		created_at = excluded.created_at,
+		expires_at = excluded.expires_at
+	WHERE idempotency_keys.expires_at <= ?
+	`
+
+	result, err := s.db.ExecContext(ctx, query, rec.UserID, rec.Key, rec.RequestHash, rec.JobID, responseData, rec.CreatedAt, rec.ExpiresAt, now)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected > 0 {
+		return rec, true, nil
+	}
+
+	query = "SELECT " + idempotencyColumns + " FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?"
+	existing, err := scanIdempotencyRecord(s.db.QueryRowContext(ctx, query, rec.UserID, rec.Key))
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return existing, false, nil
+}
+
+func (s *SQLiteJobStorage) UpdateIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	responseData, err := marshalResult(rec.Response)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE idempotency_keys
+	SET request_hash = ?, job_id = ?, response_data = ?, created_at = ?, expires_at = ?
+	WHERE user_id = ? AND idempotency_key = ?
+	`
+
+	result, err := s.db.ExecContext(ctx, query, rec.RequestHash, rec.JobID, responseData, rec.CreatedAt, rec.ExpiresAt, rec.UserID, rec.Key)
+	if err != nil {
+		return fmt.Errorf("failed to update idempotency key: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("idempotency key not found")
+	}
+
 	return nil
 }
 
+func (s *SQLiteJobStorage) DeleteIdempotencyKey(ctx context.Context, userID, key string) error {
+	query := "DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?"
+	if _, err := s.db.ExecContext(ctx, query, userID, key); err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) DeleteExpiredIdempotencyKeys(ctx context.Context, now int64) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= ?", now); err != nil {
+		return fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) GetQuotaLimits(ctx context.Context, subject models.QuotaSubject) (models.QuotaLimits, bool, error) {
+	query := "SELECT " + quotaLimitsColumns + " FROM quota_limits WHERE scope = ? AND subject_id = ?"
+	limits, err := scanQuotaLimits(s.db.QueryRowContext(ctx, query, string(subject.Scope), subject.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.QuotaLimits{}, false, nil
+	}
+	if err != nil {
+		return models.QuotaLimits{}, false, fmt.Errorf("failed to get quota limits: %w", err)
+	}
+	return limits, true, nil
+}
+
+func (s *SQLiteJobStorage) ListQuotaLimits(ctx context.Context) ([]models.QuotaLimits, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+quotaLimitsColumns+" FROM quota_limits ORDER BY scope, subject_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quota limits: %w", err)
+	}
+	defer rows.Close()
+
+	return scanQuotaLimitsRows(rows)
+}
+
+func (s *SQLiteJobStorage) SaveQuotaLimits(ctx context.Context, limits models.QuotaLimits) error {
+	query := `
+	INSERT INTO quota_limits (scope, subject_id, requests_per_minute, concurrent_jobs, daily_tokens, daily_cost, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(scope, subject_id) DO UPDATE SET
+		requests_per_minute = excluded.requests_per_minute,
+		concurrent_jobs = excluded.concurrent_jobs,
+		daily_tokens = excluded.daily_tokens,
+		daily_cost = excluded.daily_cost,
+		updated_at = excluded.updated_at
+	`
+	_, err := s.db.ExecContext(ctx, query, string(limits.Scope), limits.SubjectID, limits.RequestsPerMinute, limits.ConcurrentJobs, limits.DailyTokens, limits.DailyCost, limits.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save quota limits: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) DeleteQuotaLimits(ctx context.Context, subject models.QuotaSubject) error {
+	query := "DELETE FROM quota_limits WHERE scope = ? AND subject_id = ?"
+	if _, err := s.db.ExecContext(ctx, query, string(subject.Scope), subject.ID); err != nil {
+		return fmt.Errorf("failed to delete quota limits: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) CountQuotaRequest(ctx context.Context, subject models.QuotaSubject, window int64, limit int) (bool, error) {
+	// The counter only moves while it is below the limit
+	query := `
+	INSERT INTO quota_requests (scope, subject_id, window_start, requests)
+	VALUES (?, ?, ?, 1)
+	ON CONFLICT(scope, subject_id, window_start) DO UPDATE SET requests = quota_requests.requests + 1
+	WHERE ? = 0 OR quota_requests.requests < ?
+	`
+	result, err := s.db.ExecContext(ctx, query, string(subject.Scope), subject.ID, window, limit, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to count quota request: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (s *SQLiteJobStorage) AcquireQuotaSlot(ctx context.Context, subject models.QuotaSubject, jobID string, limit int, now, expiresAt int64) (bool, error) {
+	// Counting and inserting in one statement keeps concurrent acquisitions from overbooking
+	query := `
+	INSERT INTO quota_slots (job_id, scope, subject_id, expires_at)
+	SELECT ?, ?, ?, ?
+	WHERE ? = 0 OR (
+		SELECT COUNT(*) FROM quota_slots
+		WHERE scope = ? AND subject_id = ? AND ` + quotaSlotLive + `
+	) < ?
+	ON CONFLICT(job_id, scope, subject_id) DO UPDATE SET expires_at = excluded.expires_at
+	`
+	result, err := s.db.ExecContext(ctx, query,
+		jobID, string(subject.Scope), subject.ID, expiresAt,
+		limit, string(subject.Scope), subject.ID, now, string(models.JobStatusPending), string(models.JobStatusRunning), limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire quota slot: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (s *SQLiteJobStorage) ReleaseQuotaSlots(ctx context.Context, jobID string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM quota_slots WHERE job_id = ?", jobID); err != nil {
+		return fmt.Errorf("failed to release quota slots: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) AddQuotaUsage(ctx context.Context, subject models.QuotaSubject, day int64, tokens int64, cost float64) error {
+	query := `
+	INSERT INTO quota_usage (scope, subject_id, day, tokens, cost)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(scope, subject_id, day) DO UPDATE SET
+		tokens = quota_usage.tokens + excluded.tokens,
+		cost = quota_usage.cost + excluded.cost
+	`
+	if _, err := s.db.ExecContext(ctx, query, string(subject.Scope), subject.ID, day, tokens, cost); err != nil {
+		return fmt.Errorf("failed to add quota usage: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) GetQuotaUsage(ctx context.Context, subject models.QuotaSubject, window, day, now int64) (models.QuotaUsage, error) {
+	query := `
+	SELECT
+		COALESCE((SELECT requests FROM quota_requests WHERE scope = ? AND subject_id = ? AND window_start = ?), 0),
+		(SELECT COUNT(*) FROM quota_slots WHERE scope = ? AND subject_id = ? AND ` + quotaSlotLive + `),
+		COALESCE((SELECT tokens FROM quota_usage WHERE scope = ? AND subject_id = ? AND day = ?), 0),
+		COALESCE((SELECT cost FROM quota_usage WHERE scope = ? AND subject_id = ? AND day = ?), 0)
+	`
+	scope := string(subject.Scope)
+	var usage models.QuotaUsage
+	err := s.db.QueryRowContext(ctx, query,
+		scope, subject.ID, window,
+		scope, subject.ID, now, string(models.JobStatusPending), string(models.JobStatusRunning),
+		scope, subject.ID, day,
+		scope, subject.ID, day,
+	).Scan(&usage.RequestsThisMinute, &usage.ConcurrentJobs, &usage.TokensToday, &usage.CostToday)
+	if err != nil {
+		return models.QuotaUsage{}, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	return usage, nil
+}
+
+func (s *SQLiteJobStorage) DeleteExpiredQuota(ctx context.Context, window, day, now int64) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM quota_requests WHERE window_start < ?", window); err != nil {
+		return fmt.Errorf("failed to delete expired quota requests: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM quota_usage WHERE day < ?", day); err != nil {
+		return fmt.Errorf("failed to delete expired quota usage: %w", err)
+	}
+	query := "DELETE FROM quota_slots WHERE NOT " + quotaSlotLive
+	if _, err := s.db.ExecContext(ctx, query, now, string(models.JobStatusPending), string(models.JobStatusRunning)); err != nil {
+		return fmt.Errorf("failed to delete expired quota slots: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) SaveBatch(ctx context.Context, batch models.Batch) error {
+	query := "INSERT INTO batches (id, created_at, size, principal) VALUES (?, ?, ?, ?)"
+	if _, err := s.db.ExecContext(ctx, query, batch.ID, batch.CreatedAt, batch.Size, nullString(batch.Principal)); err != nil {
+		return fmt.Errorf("failed to save batch: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteJobStorage) GetBatch(ctx context.Context, id string) (models.Batch, error) {
+	query := "SELECT " + batchColumns + " FROM batches WHERE id = ?"
+	batch, err := scanBatch(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Batch{}, models.ErrBatchNotFound
+	}
+	if err != nil {
+		return models.Batch{}, fmt.Errorf("failed to get batch: %w", err)
+	}
+	return batch, nil
+}
+
 // Close closes the database connection
 func (s *SQLiteJobStorage) Close() error {
 	return s.db.Close()
 }
+
+// jobColumns lists the columns read by scanJob, in scan order
+const jobColumns = "id, request_type, request_data, created_at, retries, status, result_data, error_message, callback_url, next_retry_at, user_id, board_id, lease_owner, lease_expires_at, recoveries, principal, batch_id, trace_parent, provider"
+
+// jobDecodeError reports a row whose JSON payload could not be decoded
+type jobDecodeError struct {
+	jobID string
+	err   error
+}
+
+func (e jobDecodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e jobDecodeError) Unwrap() error {
+	return e.err
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanJob reads a single job row selected with jobColumns
+func scanJob(row rowScanner) (models.Job, error) {
+	var jobID, requestType, requestData, status, resultData, errorMessage, callbackURL, userID, boardID, leaseOwner, principal, batchID, traceParent, provider sql.NullString
+	var createdAt, nextRetryAt, leaseExpiresAt int64
+	var retries, recoveries int
+
+	if err := row.Scan(&jobID, &requestType, &requestData, &createdAt, &retries, &status, &resultData, &errorMessage, &callbackURL, &nextRetryAt, &userID, &boardID, &leaseOwner, &leaseExpiresAt, &recoveries, &principal, &batchID, &traceParent, &provider); err != nil {
+		return models.Job{}, err
+	}
+
+	var request models.AnalyzeRequest
+	if err := json.Unmarshal([]byte(requestData.String), &request); err != nil {
+		return models.Job{}, jobDecodeError{jobID: jobID.String, err: fmt.Errorf("failed to unmarshal request data: %w", err)}
+	}
+
+	job := models.Job{
+		ID:          jobID.String,
+		Request:     request,
+		CreatedAt:   createdAt,
+		Retries:     retries,
+		Status:      models.JobStatus(status.String),
+		Error:       errorMessage.String,
+		CallbackURL: callbackURL.String,
+		NextRetryAt: nextRetryAt,
+		UserID:      userID.String,
+		BoardID:     boardID.String,
+
+		LeaseOwner:     leaseOwner.String,
+		LeaseExpiresAt: leaseExpiresAt,
+		Recoveries:     recoveries,
+		Principal:      principal.String,
+		BatchID:        batchID.String,
+		TraceParent:    traceParent.String,
+		Provider:       provider.String,
+	}
+
+	if resultData.Valid && resultData.String != "" {
+		var result models.AnalyzeResponse
+		if err := json.Unmarshal([]byte(resultData.String), &result); err != nil {
+			return models.Job{}, jobDecodeError{jobID: jobID.String, err: fmt.Errorf("failed to unmarshal result data: %w", err)}
+		}
+		job.Result = &result
+	}
+
+	return job, nil
+}
+
+// queryJobs runs a query returning jobColumns inside a transaction
+func queryJobs(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]models.Job, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+// scanJobs reads every job row, skipping rows whose payload cannot be decoded
+func scanJobs(rows *sql.Rows) ([]models.Job, error) {
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			var decodeErr jobDecodeError
+			if errors.As(err, &decodeErr) {
+				slog.Error("failed to decode job row", "job_id", decodeErr.jobID, "error", err)
+				continue
+			}
+			return nil, fmt.Errorf("failed to scan job row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job rows: %w", err)
+	}
+	return jobs, nil
+}
+
+// scanDeliveries reads callback delivery rows
+func scanDeliveries(rows *sql.Rows) ([]models.CallbackDelivery, error) {
+	deliveries := []models.CallbackDelivery{}
+	for rows.Next() {
+		var d models.CallbackDelivery
+		var statusCode sql.NullInt64
+		var errorMessage sql.NullString
+		if err := rows.Scan(&d.ID, &d.JobID, &d.URL, &d.Attempt, &statusCode, &errorMessage, &d.Success, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan callback delivery row: %w", err)
+		}
+		d.StatusCode = int(statusCode.Int64)
+		d.Error = errorMessage.String
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// idempotencyColumns lists the columns read by scanIdempotencyRecord, in scan order
+const idempotencyColumns = "user_id, idempotency_key, request_hash, job_id, response_data, created_at, expires_at"
+
+// scanIdempotencyRecord reads a single idempotency_keys row selected with idempotencyColumns
+func scanIdempotencyRecord(row rowScanner) (models.IdempotencyRecord, error) {
+	var rec models.IdempotencyRecord
+	var responseData sql.NullString
+	if err := row.Scan(&rec.UserID, &rec.Key, &rec.RequestHash, &rec.JobID, &responseData, &rec.CreatedAt, &rec.ExpiresAt); err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+
+	if responseData.Valid && responseData.String != "" {
+		var response models.AnalyzeResponse
+		if err := json.Unmarshal([]byte(responseData.String), &response); err != nil {
+			return models.IdempotencyRecord{}, fmt.Errorf("failed to unmarshal response data: %w", err)
+		}
+		rec.Response = &response
+	}
+
+	return rec, nil
+}
+
+// batchColumns lists the columns read by scanBatch, in scan order
+const batchColumns = "id, created_at, size, principal"
+
+// scanBatch reads a single batches row selected with batchColumns
+func scanBatch(row rowScanner) (models.Batch, error) {
+	var batch models.Batch
+	var principal sql.NullString
+	if err := row.Scan(&batch.ID, &batch.CreatedAt, &batch.Size, &principal); err != nil {
+		return models.Batch{}, err
+	}
+	batch.Principal = principal.String
+	return batch, nil
+}
+
+// quotaLimitsColumns lists the columns read by scanQuotaLimits, in scan order
+const quotaLimitsColumns = "scope, subject_id, requests_per_minute, concurrent_jobs, daily_tokens, daily_cost, updated_at"
+
+// quotaSlotLive matches the quota_slots rows still holding a slot: not
+// expired at the first argument, or whose job is in one of the two statuses
+// bound next, pending and running
+const quotaSlotLive = "(quota_slots.expires_at > ? OR EXISTS (SELECT 1 FROM jobs WHERE jobs.id = quota_slots.job_id AND jobs.status IN (?, ?)))"
+
+// scanQuotaLimits reads a single quota_limits row selected with quotaLimitsColumns
+func scanQuotaLimits(row rowScanner) (models.QuotaLimits, error) {
+	var limits models.QuotaLimits
+	var scope string
+	if err := row.Scan(&scope, &limits.SubjectID, &limits.RequestsPerMinute, &limits.ConcurrentJobs, &limits.DailyTokens, &limits.DailyCost, &limits.UpdatedAt); err != nil {
+		return models.QuotaLimits{}, err
+	}
+	limits.Scope = models.QuotaScope(scope)
+	return limits, nil
+}
+
+// scanQuotaLimitsRows reads every row selected with quotaLimitsColumns
+func scanQuotaLimitsRows(rows *sql.Rows) ([]models.QuotaLimits, error) {
+	var list []models.QuotaLimits
+	for rows.Next() {
+		limits, err := scanQuotaLimits(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan quota limits: %w", err)
+		}
+		list = append(list, limits)
+	}
+	return list, rows.Err()
+}
+
+// marshalResult encodes a job result for the result_data column, nil stays NULL
+func marshalResult(result *models.AnalyzeResponse) (*string, error) {
+	if result == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result data: %w", err)
+	}
+	str := string(data)
+	return &str, nil
+}
+
+// nullString maps an empty string to NULL
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -1,11 +1,16 @@
 package database
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aiservice/internal/config"
 	"github.com/aiservice/internal/models"
+	jobservice "github.com/aiservice/internal/services/jobService"
+	"github.com/aiservice/internal/services/storage/storagetest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -67,4 +72,157 @@ func TestSQLiteStorage(t *testing.T) {
 	// Verify the job is gone
 	_, err = storage.Get("test-job-1")
 	assert.Error(t, err)
-}
\ No newline at end of file
+}
+
+func TestSQLiteStorage_ResultAndError(t *testing.T) {
+	tempDBFile := "./test_db_result.sqlite"
+	defer os.Remove(tempDBFile)
+
+	storage, err := NewSQLiteStorage(config.DatabaseConfig{Type: "sqlite", FilePath: tempDBFile})
+	assert.NoError(t, err)
+	defer storage.Close()
+
+	completed := models.Job{
+		ID:        "completed-job",
+		CreatedAt: 1234567890,
+		Status:    models.JobStatusPending,
+		Request:   models.AnalyzeRequest{RequestType: models.SummarizeType},
+	}
+	assert.NoError(t, storage.Save(completed))
+
+	completed.Status = models.JobStatusCompleted
+	completed.Result = &models.AnalyzeResponse{
+		SummarizeResponse: models.SummarizeResponse{
+			RequestType: models.SummarizeType,
+			Element:     models.Text{Content: "summary"},
+		},
+	}
+	assert.NoError(t, storage.Update(completed))
+
+	got, err := storage.Get("completed-job")
+	assert.NoError(t, err)
+	assert.Equal(t, models.JobStatusCompleted, got.Status)
+	if assert.NotNil(t, got.Result) {
+		assert.Equal(t, "summary", got.Result.SummarizeResponse.Element.Content)
+	}
+	assert.Empty(t, got.Error)
+
+	failed := models.Job{
+		ID:        "failed-job",
+		CreatedAt: 1234567891,
+		Status:    models.JobStatusFailed,
+		Request:   models.AnalyzeRequest{RequestType: models.StructurizeType},
+		Error:     "no AI models currently working",
+	}
+	assert.NoError(t, storage.Save(failed))
+
+	jobs, err := storage.GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "failed-job", jobs[0].ID)
+	assert.Nil(t, jobs[0].Result)
+	assert.Equal(t, "no AI models currently working", jobs[0].Error)
+}
+
+func TestSQLiteStorage_CallbackDeliveries(t *testing.T) {
+	tempDBFile := "./test_db_callbacks.sqlite"
+	defer os.Remove(tempDBFile)
+
+	storage, err := NewSQLiteStorage(config.DatabaseConfig{Type: "sqlite", FilePath: tempDBFile})
+	assert.NoError(t, err)
+	defer storage.Close()
+
+	job := models.Job{
+		ID:          "callback-job",
+		CreatedAt:   1234567890,
+		Status:      models.JobStatusCompleted,
+		CallbackURL: "https://example.com/hook",
+		Request:     models.AnalyzeRequest{RequestType: models.SummarizeType},
+	}
+	assert.NoError(t, storage.Save(job))
+
+	got, err := storage.Get(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, job.CallbackURL, got.CallbackURL)
+
+	assert.NoError(t, storage.SaveDelivery(models.CallbackDelivery{JobID: job.ID, URL: job.CallbackURL, Attempt: 1, StatusCode: 500, Error: "receiver responded with 500", CreatedAt: 1}))
+	assert.NoError(t, storage.SaveDelivery(models.CallbackDelivery{JobID: job.ID, URL: job.CallbackURL, Attempt: 2, StatusCode: 200, Success: true, CreatedAt: 2}))
+
+	deliveries, err := storage.GetDeliveries(job.ID)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.False(t, deliveries[0].Success)
+	assert.Equal(t, "receiver responded with 500", deliveries[0].Error)
+	assert.True(t, deliveries[1].Success)
+
+	assert.NoError(t, storage.DeleteJobs(job.ID))
+	deliveries, err = storage.GetDeliveries(job.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func TestSQLiteStorage_Query(t *testing.T) {
+	tempDBFile := "./test_db_query.sqlite"
+	defer os.Remove(tempDBFile)
+
+	storage, err := NewSQLiteStorage(config.DatabaseConfig{Type: "sqlite", FilePath: tempDBFile})
+	assert.NoError(t, err)
+	defer storage.Close()
+
+	for i, requestType := range []string{models.SummarizeType, models.StructurizeType, models.SummarizeType, models.SummarizeType} {
+		job := models.Job{
+			ID:        fmt.Sprintf("job-%d", i),
+			CreatedAt: 1000,
+			Status:    models.JobStatusCompleted,
+			UserID:    "user-1",
+			BoardID:   fmt.Sprintf("board-%d", i%2),
+			Request:   models.AnalyzeRequest{RequestType: requestType},
+		}
+		assert.NoError(t, storage.Save(job))
+	}
+	assert.NoError(t, storage.Save(models.Job{ID: "job-other", CreatedAt: 2000, Status: models.JobStatusFailed, UserID: "user-2", Request: models.AnalyzeRequest{RequestType: models.SummarizeType}}))
+
+	// Jobs created in the same second are ordered by ID and paged without gaps
+	var ids []string
+	filter := models.JobFilter{UserID: "user-1", RequestType: models.SummarizeType, Limit: 2}
+	for {
+		page, err := storage.Query(context.Background(), filter)
+		assert.NoError(t, err)
+		for _, job := range page.Jobs {
+			ids = append(ids, job.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"job-3", "job-2", "job-0"}, ids)
+
+	page, err := storage.Query(context.Background(), models.JobFilter{BoardID: "board-1", Order: models.SortAsc})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Jobs, 2) {
+		assert.Equal(t, "job-1", page.Jobs[0].ID)
+		assert.Equal(t, "board-1", page.Jobs[0].BoardID)
+	}
+
+	page, err = storage.Query(context.Background(), models.JobFilter{
+		Statuses:    []models.JobStatus{models.JobStatusFailed, models.JobStatusPending},
+		CreatedFrom: 1500,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Jobs, 1) {
+		assert.Equal(t, "job-other", page.Jobs[0].ID)
+	}
+
+	_, err = storage.Query(context.Background(), models.JobFilter{Cursor: "%%%"})
+	assert.ErrorIs(t, err, models.ErrInvalidCursor)
+}
+
+func TestSQLiteStorage_Contract(t *testing.T) {
+	storagetest.RunJobStorageContract(t, func(t *testing.T) jobservice.JobStorage {
+		storage, err := NewSQLiteStorage(config.DatabaseConfig{Type: "sqlite", FilePath: filepath.Join(t.TempDir(), "jobs.sqlite")})
+		assert.NoError(t, err)
+		t.Cleanup(func() { storage.Close() })
+		return storage
+	})
+}
@@ -0,0 +1,75 @@
+package jobservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aiservice/internal/models"
+)
+
+// BatchIDPrefix starts every batch ID, the rest is generated like a job ID
+const BatchIDPrefix = "batch_"
+
+// NewBatch creates a batch of size jobs, its jobs must carry its ID in BatchID
+func NewBatch(size int) models.Batch {
+	now := time.Now()
+	return models.Batch{
+		ID:        BatchIDPrefix + strings.TrimPrefix(generateJobID(now), JobIDPrefix),
+		CreatedAt: now.Unix(),
+		Size:      size,
+	}
+}
+
+// SaveBatch records a batch, before its jobs are enqueued
+func (q *JobQueueService) SaveBatch(ctx context.Context, batch models.Batch) error {
+	if err := q.storage.SaveBatch(ctx, batch); err != nil {
+		return fmt.Errorf("failed to save batch: %w", err)
+	}
+	return nil
+}
+
+// GetBatch returns a batch and its jobs in submission order
+func (q *JobQueueService) GetBatch(ctx context.Context, batchID string) (models.Batch, []models.Job, error) {
+	batch, err := q.storage.GetBatch(ctx, batchID)
+	if err != nil {
+		return models.Batch{}, nil, err
+	}
+	jobs, err := q.queryJobs(ctx, models.JobFilter{BatchID: batchID})
+	if err != nil {
+		return models.Batch{}, nil, fmt.Errorf("failed to query batch jobs: %w", err)
+	}
+	return batch, jobs, nil
+}
+
+// AbortBatch aborts every pending or running job of a batch, see Abort, and
+// returns how many were aborted. Finished jobs keep their outcome.
+func (q *JobQueueService) AbortBatch(ctx context.Context, batchID string) (int, error) {
+	if _, err := q.storage.GetBatch(ctx, batchID); err != nil {
+		return 0, err
+	}
+	ids, err := q.queryJobIDs(ctx, models.JobFilter{
+		BatchID:  batchID,
+		Statuses: []models.JobStatus{models.JobStatusPending, models.JobStatusRunning},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query batch jobs: %w", err)
+	}
+
+	aborted := 0
+	for _, id := range ids {
+		if err := q.Abort(ctx, id); err != nil {
+			// The job may have finished or been deleted by cleanup in the meantime
+			if errors.Is(err, models.ErrJobNotFound) || errors.Is(err, models.ErrJobNotAbortable) {
+				continue
+			}
+			return aborted, fmt.Errorf("failed to abort job %s: %w", id, err)
+		}
+		aborted++
+	}
+	slog.Info("batch aborted", "batch_id", batchID, "aborted_jobs", aborted)
+	return aborted, nil
+}
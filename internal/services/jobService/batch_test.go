@@ -0,0 +1,67 @@
+package jobservice
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/services/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbortBatch_CascadesToUnfinishedJobs(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	st := storage.NewInMemoryJobStorage()
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return models.AnalyzeResponse{}, ctx.Err()
+	})
+	svc := NewJobQueueService(testJobConfig(), st, proc, nil)
+	defer svc.Shutdown()
+
+	batch := NewBatch(3)
+	require.True(t, strings.HasPrefix(batch.ID, BatchIDPrefix))
+	require.NoError(t, svc.SaveBatch(context.Background(), batch))
+
+	var ids []string
+	for _, status := range []models.JobStatus{models.JobStatusCompleted, models.JobStatusPending} {
+		job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+		job.BatchID = batch.ID
+		job.Status = status
+		require.NoError(t, st.Save(job))
+		ids = append(ids, job.ID)
+	}
+	// The only worker runs the last job until it is aborted
+	running := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	running.BatchID = batch.ID
+	require.NoError(t, svc.Enqueue(running))
+	ids = append(ids, running.ID)
+	<-started
+
+	aborted, err := svc.AbortBatch(context.Background(), batch.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, aborted)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("running batch job was not cancelled")
+	}
+
+	_, jobs, err := svc.GetBatch(context.Background(), batch.ID)
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+	for i, job := range jobs {
+		require.Equal(t, ids[i], job.ID)
+	}
+	require.Equal(t, models.JobStatusCompleted, jobs[0].Status, "finished jobs keep their outcome")
+	require.Equal(t, models.JobStatusAborted, jobs[1].Status)
+	require.Equal(t, models.JobStatusAborted, jobs[2].Status)
+
+	_, err = svc.AbortBatch(context.Background(), "batch_unknown")
+	require.ErrorIs(t, err, models.ErrBatchNotFound)
+}
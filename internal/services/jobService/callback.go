@@ -0,0 +1,235 @@
+package jobservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of "<timestamp>.<body>"
+	SignatureHeader = "X-Signature-256"
+	// SignatureTimestampHeader carries the unix timestamp used in the signature
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+)
+
+// CallbackSender delivers signed job status webhooks and records every attempt
+type CallbackSender struct {
+	cfg    config.CallbackConfig
+	log    CallbackLog
+	client *http.Client
+}
+
+// NewCallbackSender creates a webhook sender that records attempts in log
+func NewCallbackSender(cfg config.CallbackConfig, log CallbackLog) *CallbackSender {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &CallbackSender{
+		cfg: cfg,
+		log: log,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: callbackTransport(cfg.AllowedHosts),
+			// A redirect could point the signed payload anywhere, it fails the delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// errForbiddenAddress rejects callbacks to addresses of the internal network
+var errForbiddenAddress = errors.New("callback address is not public")
+
+// callbackTransport dials callback receivers, refusing the loopback, private,
+// link-local and other non-public addresses their host resolves to unless
+// the host is allowed. The check is made on the address actually dialed, so
+// a host resolving to another address at delivery time cannot bypass it.
+func callbackTransport(allowedHosts []string) *http.Transport {
+	allowed := make(map[string]bool, len(allowedHosts))
+	for _, host := range allowedHosts {
+		allowed[strings.ToLower(host)] = true
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	publicDialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil || !isPublicAddr(ip) {
+				return fmt.Errorf("%w: %s", errForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if allowed[strings.ToLower(host)] {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return publicDialer.DialContext(ctx, network, address)
+	}
+	return transport
+}
+
+// isPublicAddr reports whether ip is a globally routable unicast address
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Deliver sends the job status to its callback URL, retrying with exponential
+// backoff until the receiver answers 2xx, returns a non-retryable status or
+// the attempts are exhausted. It returns the last recorded delivery. Every
+// attempt carries the W3C trace context of ctx.
+func (s *CallbackSender) Deliver(ctx context.Context, job models.Job) (delivery models.CallbackDelivery, err error) {
+	ctx, span := tracer.Start(ctx, "callback.deliver", trace.WithAttributes(attribute.String("job.id", job.ID)))
+	defer func() { tracing.End(span, err) }()
+
+	if job.CallbackURL == "" {
+		return models.CallbackDelivery{}, fmt.Errorf("job %s: %w", job.ID, models.ErrNoCallbackURL)
+	}
+
+	body, err := json.Marshal(models.NewJobResponse(job))
+	if err != nil {
+		return models.CallbackDelivery{}, fmt.Errorf("failed to marshal callback payload: %w", err)
+	}
+
+	backoff := s.cfg.InitialBackoff
+	for attempt := 1; attempt <= s.cfg.MaxAttempts; attempt++ {
+		var retryable bool
+		delivery, retryable = s.send(ctx, job, body, attempt)
+
+		if err := s.log.SaveDelivery(delivery); err != nil {
+			slog.Error("failed to record callback delivery", "job_id", job.ID, "err", err)
+		}
+
+		if delivery.Success {
+			slog.Info("callback sent", "job_id", job.ID, "status_code", delivery.StatusCode, "attempt", attempt)
+			return delivery, nil
+		}
+		if !retryable || attempt == s.cfg.MaxAttempts {
+			break
+		}
+
+		slog.Warn("callback delivery failed, retrying",
+			"job_id", job.ID, "attempt", attempt, "status_code", delivery.StatusCode, "err", delivery.Error, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return delivery, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if s.cfg.MaxBackoff > 0 && backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+	}
+
+	slog.Error("callback delivery failed", "job_id", job.ID, "attempts", delivery.Attempt, "err", delivery.Error)
+	return delivery, fmt.Errorf("callback delivery failed after %d attempt(s): %s", delivery.Attempt, delivery.Error)
+}
+
+// send performs a single delivery attempt and reports whether a failure is worth retrying
+func (s *CallbackSender) send(ctx context.Context, job models.Job, body []byte, attempt int) (models.CallbackDelivery, bool) {
+	ctx, span := tracer.Start(ctx, "callback.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodPost,
+			attribute.Int("callback.attempt", attempt),
+		))
+	defer span.End()
+
+	delivery := models.CallbackDelivery{
+		JobID:     job.ID,
+		URL:       job.CallbackURL,
+		Attempt:   attempt,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = fmt.Sprintf("failed to create callback request: %v", err)
+		return delivery, false
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Callback-Type", "job-status-update")
+	req.Header.Set("X-Request-ID", job.ID)
+	req.Header.Set("X-Delivery-Attempt", strconv.Itoa(attempt))
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	if s.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+SignPayload(s.cfg.Secret, timestamp, body))
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		// The receiver will not become public by retrying
+		return delivery, !errors.Is(err, errForbiddenAddress)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	delivery.StatusCode = resp.StatusCode
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		delivery.Success = true
+		return delivery, false
+	}
+
+	delivery.Error = fmt.Sprintf("receiver responded with %d", resp.StatusCode)
+	retryable := resp.StatusCode >= 500 ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout
+	return delivery, retryable
+}
+
+// SignPayload computes the hex encoded HMAC-SHA256 signature of a callback body
+func SignPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
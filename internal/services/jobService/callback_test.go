@@ -0,0 +1,239 @@
+package jobservice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/services/storage"
+	"github.com/aiservice/internal/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testCallbackConfig() config.CallbackConfig {
+	return config.CallbackConfig{
+		Secret:         "test-secret",
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Timeout:        time.Second,
+		// httptest receivers listen on loopback
+		AllowedHosts: []string{"127.0.0.1"},
+	}
+}
+
+func TestCallbackSender_SignsAndRetries(t *testing.T) {
+	var calls atomic.Int32
+	var payload models.SummarizeJobResponse
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(SignatureTimestampHeader)
+		require.Equal(t, "sha256="+SignPayload("test-secret", timestamp, body), r.Header.Get(SignatureHeader))
+
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		require.NoError(t, json.Unmarshal(body, &payload))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	st := storage.NewInMemoryJobStorage()
+	sender := NewCallbackSender(testCallbackConfig(), st)
+
+	job := models.Job{
+		ID:          "job-callback",
+		Status:      models.JobStatusCompleted,
+		Request:     models.AnalyzeRequest{RequestType: models.SummarizeType},
+		Result:      &models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "done"}}},
+		CallbackURL: receiver.URL,
+		Provider:    "openai",
+	}
+
+	delivery, err := sender.Deliver(context.Background(), job)
+	require.NoError(t, err)
+	require.True(t, delivery.Success)
+	require.Equal(t, 2, delivery.Attempt)
+	require.Equal(t, int32(2), calls.Load())
+	require.Equal(t, "done", payload.Result.Element.Content)
+	require.Equal(t, models.JobStatusCompleted, payload.Status)
+	require.Equal(t, "openai", payload.Provider)
+
+	deliveries, err := st.GetDeliveries(job.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.False(t, deliveries[0].Success)
+	require.Equal(t, http.StatusServiceUnavailable, deliveries[0].StatusCode)
+	require.True(t, deliveries[1].Success)
+}
+
+func TestCallbackSender_StopsOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer receiver.Close()
+
+	st := storage.NewInMemoryJobStorage()
+	sender := NewCallbackSender(testCallbackConfig(), st)
+
+	job := models.Job{ID: "job-gone", Status: models.JobStatusFailed, Error: "boom", CallbackURL: receiver.URL}
+	_, err := sender.Deliver(context.Background(), job)
+	require.Error(t, err)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestCallbackSender_RejectsInternalAddresses(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	cfg := testCallbackConfig()
+	cfg.AllowedHosts = nil
+	st := storage.NewInMemoryJobStorage()
+	sender := NewCallbackSender(cfg, st)
+
+	for _, url := range []string{receiver.URL + "/hook", "http://localhost:1/hook", "http://169.254.169.254/latest/meta-data"} {
+		job := models.Job{ID: "job-ssrf", Status: models.JobStatusCompleted, CallbackURL: url}
+		delivery, err := sender.Deliver(context.Background(), job)
+		require.Error(t, err, url)
+		require.Equal(t, 1, delivery.Attempt, "a forbidden address is not retried: %s", url)
+		require.Contains(t, delivery.Error, "callback address is not public", url)
+	}
+	require.Zero(t, calls.Load())
+}
+
+func TestCallbackSender_DoesNotFollowRedirects(t *testing.T) {
+	var redirected atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Add(1)
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	sender := NewCallbackSender(testCallbackConfig(), storage.NewInMemoryJobStorage())
+	delivery, err := sender.Deliver(context.Background(), models.Job{ID: "job-redirect", CallbackURL: receiver.URL})
+	require.Error(t, err)
+	require.Equal(t, http.StatusTemporaryRedirect, delivery.StatusCode)
+	require.Zero(t, redirected.Load())
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		require.Equal(t, public, isPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestJobQueueService_DeliversAndReplaysCallback(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	fail.Store(true)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	st := storage.NewInMemoryJobStorage()
+	svc := NewJobQueueService(testJobConfig(), st, processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		return models.AnalyzeResponse{}, nil
+	}), NewCallbackSender(testCallbackConfig(), st))
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user", CallbackURL: receiver.URL}))
+	require.Equal(t, receiver.URL, job.CallbackURL)
+	require.NoError(t, svc.Enqueue(job))
+
+	require.Eventually(t, func() bool {
+		deliveries, _ := svc.GetCallbackDeliveries(context.Background(), job.ID)
+		return len(deliveries) == 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	fail.Store(false)
+	delivery, err := svc.ReplayCallback(context.Background(), job.ID)
+	require.NoError(t, err)
+	require.True(t, delivery.Success)
+	require.Equal(t, int32(4), calls.Load())
+}
+
+func TestJobQueueService_ContinuesSubmitterTrace(t *testing.T) {
+	// Without an exporter Setup only installs the W3C propagator
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{})
+	require.NoError(t, err)
+	defer shutdown(context.Background())
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	callbackTrace := make(chan string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbackTrace <- r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	processTrace := make(chan string, 1)
+	st := storage.NewInMemoryJobStorage()
+	svc := NewJobQueueService(testJobConfig(), st, processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		processTrace <- trace.SpanContextFromContext(ctx).TraceID().String()
+		return models.AnalyzeResponse{}, nil
+	}), NewCallbackSender(testCallbackConfig(), st))
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user", CallbackURL: receiver.URL}))
+	job.TraceParent = "00-" + traceID + "-00f067aa0ba902b7-01"
+	require.NoError(t, svc.Enqueue(job))
+
+	select {
+	case got := <-processTrace:
+		require.Equal(t, traceID, got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("job was not processed")
+	}
+	select {
+	case got := <-callbackTrace:
+		require.Contains(t, got, traceID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+}
+
+// processorFunc adapts a function to the Processor interface
+type processorFunc func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error)
+
+func (f processorFunc) Process(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+	return f(ctx, req)
+}
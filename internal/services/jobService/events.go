@@ -0,0 +1,143 @@
+package jobservice
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aiservice/internal/models"
+)
+
+const (
+	// eventHistorySize bounds the events kept per job for Last-Event-ID resumption
+	eventHistorySize = 64
+	// eventRetention keeps the history of a finished job for late subscribers
+	eventRetention = 10 * time.Minute
+	// eventBufferSize is how far a subscriber may fall behind before it is dropped
+	eventBufferSize = 32
+)
+
+// EventBus fans job events out to subscribers and keeps a short history per
+// job, so a client reconnecting with its Last-Event-ID resumes where it left
+// off. It only sees the jobs processed by this process.
+type EventBus struct {
+	mu      sync.Mutex
+	streams map[string]*eventStream
+	// floor is the last event ID of the unfinished jobs pruned so far. Streams
+	// created afterwards number their events above it, so a client resuming
+	// such a job with its Last-Event-ID does not skip the new events.
+	floor int64
+}
+
+// eventStream holds the events and subscribers of one job
+type eventStream struct {
+	history     []models.JobEvent
+	lastID      int64
+	lastAt      time.Time
+	finished    bool
+	subscribers map[chan models.JobEvent]struct{}
+}
+
+// NewEventBus creates an empty event bus
+func NewEventBus() *EventBus {
+	return &EventBus{streams: make(map[string]*eventStream)}
+}
+
+// Publish numbers the event within its job and delivers it to the job's
+// subscribers. A subscriber too slow to keep up is dropped, closing its
+// channel, and is expected to resubscribe from its last event.
+func (b *EventBus) Publish(event models.JobEvent) models.JobEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream, ok := b.streams[event.JobID]
+	if !ok {
+		stream = &eventStream{subscribers: make(map[chan models.JobEvent]struct{}), lastID: b.floor}
+		b.streams[event.JobID] = stream
+	}
+
+	stream.lastID++
+	stream.lastAt = time.Now()
+	event.ID = stream.lastID
+	if event.CreatedAt == 0 {
+		event.CreatedAt = stream.lastAt.Unix()
+	}
+
+	stream.history = append(stream.history, event)
+	if len(stream.history) > eventHistorySize {
+		stream.history = stream.history[len(stream.history)-eventHistorySize:]
+	}
+	if event.IsFinal() {
+		stream.finished = true
+	}
+
+	for ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return event
+}
+
+// Subscribe returns the known events of a job after lastEventID and a channel
+// receiving the following ones. The channel is closed by cancel, or when the
+// subscriber falls behind. Nothing is delivered after the final event.
+func (b *EventBus) Subscribe(jobID string, lastEventID int64) (history []models.JobEvent, events <-chan models.JobEvent, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream, ok := b.streams[jobID]
+	if !ok {
+		stream = &eventStream{subscribers: make(map[chan models.JobEvent]struct{}), lastID: b.floor, lastAt: time.Now()}
+		b.streams[jobID] = stream
+	}
+
+	for _, event := range stream.history {
+		if event.ID > lastEventID {
+			history = append(history, event)
+		}
+	}
+
+	ch := make(chan models.JobEvent, eventBufferSize)
+	stream.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := stream.subscribers[ch]; ok {
+				delete(stream.subscribers, ch)
+				close(ch)
+			}
+			// Do not keep a stream for a job that never published here, e.g. one run by another replica
+			if len(stream.subscribers) == 0 && len(stream.history) == 0 && b.streams[jobID] == stream {
+				delete(b.streams, jobID)
+			}
+		})
+	}
+	return history, ch, cancel
+}
+
+// Prune forgets the history of jobs finished longer than eventRetention ago,
+// and of jobs without events for JobCleanupAge, unless someone still listens
+func (b *EventBus) Prune(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for jobID, stream := range b.streams {
+		if len(stream.subscribers) > 0 {
+			continue
+		}
+		idle := now.Sub(stream.lastAt)
+		if (stream.finished && idle > eventRetention) || idle > JobCleanupAge {
+			if !stream.finished {
+				b.floor = max(b.floor, stream.lastID)
+			}
+			delete(b.streams, jobID)
+		}
+	}
+}
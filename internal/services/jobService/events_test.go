@@ -0,0 +1,80 @@
+package jobservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus_PublishAndResume(t *testing.T) {
+	bus := NewEventBus()
+	bus.Publish(models.JobEvent{JobID: "job-1", Type: models.JobEventStatus, Status: models.JobStatusPending})
+	bus.Publish(models.JobEvent{JobID: "job-2", Type: models.JobEventStatus, Status: models.JobStatusPending})
+
+	history, events, cancel := bus.Subscribe("job-1", 0)
+	defer cancel()
+	require.Len(t, history, 1)
+	require.Equal(t, int64(1), history[0].ID)
+
+	running := bus.Publish(models.JobEvent{JobID: "job-1", Type: models.JobEventStatus, Status: models.JobStatusRunning})
+	require.Equal(t, int64(2), running.ID)
+	require.Equal(t, running, <-events)
+
+	// A reconnecting client only gets what it missed
+	history, _, cancelResumed := bus.Subscribe("job-1", 1)
+	defer cancelResumed()
+	require.Len(t, history, 1)
+	require.Equal(t, models.JobStatusRunning, history[0].Status)
+
+	cancel()
+	_, ok := <-events
+	require.False(t, ok, "cancel closes the channel")
+}
+
+func TestEventBus_DropsSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	_, events, cancel := bus.Subscribe("job-1", 0)
+	defer cancel()
+
+	for range eventBufferSize + 1 {
+		bus.Publish(models.JobEvent{JobID: "job-1", Type: models.JobEventProvider, Provider: "gemini"})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	require.Equal(t, eventBufferSize, received)
+}
+
+func TestEventBus_Prune(t *testing.T) {
+	bus := NewEventBus()
+	bus.Publish(models.JobEvent{JobID: "finished", Type: models.JobEventResult, Status: models.JobStatusCompleted})
+	bus.Publish(models.JobEvent{JobID: "running", Type: models.JobEventStatus, Status: models.JobStatusRunning})
+
+	bus.Prune(time.Now().Add(eventRetention + time.Minute))
+
+	history, _, cancel := bus.Subscribe("finished", 0)
+	cancel()
+	require.Empty(t, history)
+	history, _, cancel = bus.Subscribe("running", 0)
+	cancel()
+	require.Len(t, history, 1)
+}
+
+func TestEventBus_PruneKeepsEventIDsOfUnfinishedJobs(t *testing.T) {
+	bus := NewEventBus()
+	bus.Publish(models.JobEvent{JobID: "pending", Type: models.JobEventStatus, Status: models.JobStatusPending})
+	last := bus.Publish(models.JobEvent{JobID: "pending", Type: models.JobEventRetry, Retry: 1})
+
+	bus.Prune(time.Now().Add(JobCleanupAge + time.Minute))
+
+	// A client resuming from its last event still gets the events published later
+	next := bus.Publish(models.JobEvent{JobID: "pending", Type: models.JobEventStatus, Status: models.JobStatusRunning})
+	require.Greater(t, next.ID, last.ID)
+	history, _, cancel := bus.Subscribe("pending", last.ID)
+	cancel()
+	require.Equal(t, []models.JobEvent{next}, history)
+}
@@ -0,0 +1,81 @@
+package jobservice
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// JobIDPrefix starts every job ID generated by ULIDGenerator
+const JobIDPrefix = "job_"
+
+// crockford is the base32 alphabet of ULIDs, it sorts in byte order
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// IDGenerator produces unique job IDs for jobs created at t
+type IDGenerator interface {
+	NewID(t time.Time) string
+}
+
+// ULIDGenerator produces "job_" prefixed ULIDs: a 48 bit millisecond timestamp
+// followed by 80 random bits, so IDs sort lexicographically by creation time.
+// IDs generated in the same millisecond increment the random part and stay
+// ordered. Random bits make IDs unique across replicas without coordination.
+type ULIDGenerator struct {
+	mu       sync.Mutex
+	lastMs   uint64
+	lastRand [10]byte
+}
+
+// NewULIDGenerator creates a monotonic ULID generator
+func NewULIDGenerator() *ULIDGenerator {
+	return &ULIDGenerator{}
+}
+
+func (g *ULIDGenerator) NewID(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+
+	g.mu.Lock()
+	if ms <= g.lastMs && incrementRandom(&g.lastRand) {
+		// Same millisecond, or a clock step back: keep the IDs of this process ordered
+		ms = g.lastMs
+	} else {
+		rand.Read(g.lastRand[:])
+		g.lastMs = ms
+	}
+	random := g.lastRand
+	g.mu.Unlock()
+
+	return JobIDPrefix + encodeULID(ms, random)
+}
+
+// incrementRandom adds one to the random part, reporting false on overflow
+func incrementRandom(r *[10]byte) bool {
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i]++
+		if r[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID writes the 128 bit ULID as 26 Crockford base32 characters
+func encodeULID(ms uint64, random [10]byte) string {
+	var id [16]byte
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	copy(id[6:], random[:])
+
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
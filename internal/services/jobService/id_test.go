@@ -0,0 +1,58 @@
+package jobservice
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestULIDGenerator_SortableAndUnique(t *testing.T) {
+	g := NewULIDGenerator()
+	now := time.UnixMilli(1_700_000_000_123)
+
+	// IDs of the same millisecond keep their generation order
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = g.NewID(now)
+	}
+	require.True(t, sort.StringsAreSorted(ids))
+
+	later := g.NewID(now.Add(time.Millisecond))
+	require.Greater(t, later, ids[len(ids)-1])
+
+	// The first 10 characters of the ULID hold the millisecond timestamp
+	id := ids[0]
+	require.Len(t, id, len(JobIDPrefix)+26)
+	require.Equal(t, JobIDPrefix+"01HF7YAT3V", id[:len(JobIDPrefix)+10])
+}
+
+func TestULIDGenerator_Concurrent(t *testing.T) {
+	g := NewULIDGenerator()
+	const workers, perWorker = 8, 500
+
+	var mu sync.Mutex
+	seen := make(map[string]struct{}, workers*perWorker)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				id := g.NewID(time.Now())
+				mu.Lock()
+				seen[id] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, seen, workers*perWorker)
+
+	// Separate generators, as on separate replicas, do not collide either
+	other := NewULIDGenerator()
+	now := time.Now()
+	require.NotEqual(t, g.NewID(now), other.NewID(now))
+}
@@ -0,0 +1,129 @@
+package jobservice
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/providers"
+)
+
+// InlineRun is a job processed right away for a client waiting on its
+// response, outside the queue. Nothing is stored unless the client stops
+// waiting and the run is handed over to the queue with Detach, which keeps
+// the processing going instead of starting it over.
+type InlineRun struct {
+	q        *JobQueueService
+	job      models.Job
+	ctx      context.Context
+	release  func()
+	detached atomic.Bool
+	done     chan struct{}
+
+	// resp, err and provider, the last provider tried, are set once done is closed
+	resp     models.AnalyzeResponse
+	err      error
+	provider string
+}
+
+// RunInline starts processing job on this replica. The processing outlives
+// ctx, it is bounded by JobProcessTimeout like a queued attempt.
+func (q *JobQueueService) RunInline(ctx context.Context, job models.Job) *InlineRun {
+	base, cancelCause := context.WithCancelCause(context.WithoutCancel(ctx))
+	runCtx, cancel := context.WithTimeout(base, JobProcessTimeout)
+	r := &InlineRun{
+		q:    q,
+		job:  job,
+		ctx:  runCtx,
+		done: make(chan struct{}),
+		release: func() {
+			cancel()
+			cancelCause(nil)
+		},
+	}
+	q.trackRunning(job.ID, cancelCause)
+
+	// Provider attempts are only worth publishing once the job is known to clients
+	processCtx := providers.WithAttemptObserver(runCtx, func(provider string) {
+		r.provider = provider
+		if r.detached.Load() {
+			q.events.Publish(models.JobEvent{JobID: job.ID, Type: models.JobEventProvider, Provider: provider})
+		}
+	})
+	go func() {
+		defer close(r.done)
+		r.resp, r.err = q.request.Process(processCtx, job.Request)
+	}()
+	return r
+}
+
+// Wait waits up to timeout for the run to finish, or until ctx is done.
+// finished is false while the run is still processing, it must then be handed
+// over with Detach. Wait must not be called again once it reported finished.
+func (r *InlineRun) Wait(ctx context.Context, timeout time.Duration) (resp models.AnalyzeResponse, finished bool, err error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-r.done:
+	case <-timer.C:
+		return models.AnalyzeResponse{}, false, nil
+	case <-ctx.Done():
+		return models.AnalyzeResponse{}, false, nil
+	}
+
+	r.q.untrackRunning(r.job.ID)
+	r.release()
+	return r.resp, true, r.err
+}
+
+// Detach hands an unfinished inline run over to the queue. Its job is stored
+// as running under this worker's lease and may be aborted; its outcome is
+// stored, retried and called back like that of a queued job. After Shutdown
+// the run is cancelled and the job stored as pending for the next start.
+func (r *InlineRun) Detach() error {
+	q := r.q
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job := r.job
+	if q.closed {
+		q.untrackRunning(job.ID)
+		r.release()
+		if err := q.storage.Save(job); err != nil {
+			return fmt.Errorf("failed to save job: %w", err)
+		}
+		q.publishStatus(job)
+		return nil
+	}
+
+	lease := q.newLease()
+	job.Status = models.JobStatusRunning
+	job.LeaseOwner = lease.Owner
+	job.LeaseExpiresAt = lease.ExpiresAt
+	if err := q.storage.Save(job); err != nil {
+		q.untrackRunning(job.ID)
+		r.release()
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	r.detached.Store(true)
+	q.publishStatus(job)
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		defer r.release()
+		defer q.untrackRunning(job.ID)
+
+		stopHeartbeat := q.startHeartbeat(r.ctx, job.ID)
+		<-r.done
+		stopHeartbeat()
+		releaseLease(&job)
+
+		job.Provider = r.provider
+		q.finishJob(r.ctx, job, r.resp, r.err)
+	}()
+	return nil
+}
@@ -0,0 +1,107 @@
+package jobservice
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/services/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInlineRun_FinishesWithoutStoringJob(t *testing.T) {
+	st := storage.NewInMemoryJobStorage()
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		return models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "ok"}}}, nil
+	})
+	svc := NewJobQueueService(testJobConfig(), st, proc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	resp, finished, err := svc.RunInline(context.Background(), job).Wait(context.Background(), time.Second)
+	require.NoError(t, err)
+	require.True(t, finished)
+	require.Equal(t, "ok", resp.SummarizeResponse.Element.Content)
+
+	_, err = st.Get(job.ID)
+	require.ErrorIs(t, err, models.ErrJobNotFound)
+	require.Empty(t, svc.running)
+}
+
+func TestInlineRun_DetachKeepsProcessing(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	st := storage.NewInMemoryJobStorage()
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		calls.Add(1)
+		<-release
+		return models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "ok"}}}, nil
+	})
+	cfg := testJobConfig()
+	cfg.WorkerID = "worker-test"
+	svc := NewJobQueueService(cfg, st, proc, nil)
+	defer svc.Shutdown()
+
+	// The client gives up before the response is ready
+	ctx, cancel := context.WithCancel(context.Background())
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	run := svc.RunInline(ctx, job)
+	_, finished, err := run.Wait(ctx, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, finished)
+	require.NoError(t, run.Detach())
+	cancel()
+
+	stored, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusRunning, stored.Status)
+	require.Equal(t, "worker-test", stored.LeaseOwner)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		return err == nil && got.Status == models.JobStatusCompleted
+	}, time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, "ok", got.Result.SummarizeResponse.Element.Content)
+	require.Empty(t, got.LeaseOwner)
+	require.Equal(t, int32(1), calls.Load(), "the queue must not process the request again")
+}
+
+func TestInlineRun_AbortAfterDetach(t *testing.T) {
+	cancelled := make(chan struct{})
+	st := storage.NewInMemoryJobStorage()
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return models.AnalyzeResponse{}, ctx.Err()
+	})
+	svc := NewJobQueueService(testJobConfig(), st, proc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	run := svc.RunInline(context.Background(), job)
+	_, finished, _ := run.Wait(context.Background(), 10*time.Millisecond)
+	require.False(t, finished)
+	require.NoError(t, run.Detach())
+
+	require.NoError(t, svc.Abort(context.Background(), job.ID))
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("detached run was not cancelled")
+	}
+
+	require.Eventually(t, func() bool {
+		svc.runningMu.Lock()
+		defer svc.runningMu.Unlock()
+		return len(svc.running) == 0
+	}, time.Second, 10*time.Millisecond)
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusAborted, got.Status)
+}
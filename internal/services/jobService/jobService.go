@@ -1,67 +1,224 @@
 package jobservice
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"math/rand/v2"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/metrics"
 	"github.com/aiservice/internal/models"
-	"github.com/aiservice/internal/utils"
+	"github.com/aiservice/internal/providers"
+	"github.com/aiservice/internal/services/quota"
+	"github.com/aiservice/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	// JobCleanupAge defines how old a job must be before it's considered for cleanup (in hours)
 	JobCleanupAge = 24 * time.Hour
+	// JobRetryMaxBackoff caps the delay between two attempts of the same job
+	JobRetryMaxBackoff = 5 * time.Minute
+	// JobProcessTimeout bounds a single processing attempt of a job
+	JobProcessTimeout = 5 * time.Minute
+
+	defaultLeaseDuration    = time.Minute
+	defaultRecoveryInterval = 30 * time.Second
+	defaultIdempotencyTTL   = 24 * time.Hour
 )
 
+var tracer = otel.Tracer("github.com/aiservice/internal/services/jobService")
+
+// errLeaseLost cancels a job whose lease was taken over, e.g. after this
+// worker stalled long enough for another replica to recover the job
+var errLeaseLost = errors.New("job lease lost")
+
 type JobQueueService struct {
-	queue       chan models.Job
-	oldJobQueue chan models.Job
-	wg          sync.WaitGroup
-	storage     JobStorage
-	request     Processor
+	queue        *scheduler
+	oldJobQueue  chan models.Job
+	wg           sync.WaitGroup
+	storage      JobStorage
+	request      Processor
+	callbacks    *CallbackSender
+	maxRetries   int
+	retryBackoff time.Duration
+	dbWorkers    int
+	// dbBusy counts the db workers holding a claimed job, queued or running
+	dbBusy atomic.Int32
+
+	// Running jobs are leased to workerID and renewed every heartbeatInterval
+	workerID          string
+	leaseDuration     time.Duration
+	heartbeatInterval time.Duration
+	recoveryInterval  time.Duration
+	maxRecoveries     int
+
+	idempotencyTTL time.Duration
+
+	// events receives the progress of the jobs processed here
+	events *EventBus
+
+	// mu guards closed so claimed jobs are never sent on the closed oldJobQueue
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+
+	// running holds the cancel func of every job currently being processed
+	runningMu sync.Mutex
+	running   map[string]context.CancelCauseFunc
 }
 
 type JobStorage interface {
 	Save(job models.Job) error
 	Get(id string) (models.Job, error)
 	GetAll() ([]models.Job, error)
+	// Query returns one page of jobs matching the filter, see models.JobFilter
+	Query(ctx context.Context, filter models.JobFilter) (models.JobPage, error)
 	Update(job models.Job) error
+	// Claim atomically moves a pending job to running under the lease. ok is false
+	// when the job is no longer pending: aborted, finished or claimed by another worker.
+	Claim(ctx context.Context, id string, lease models.Lease) (job models.Job, ok bool, err error)
+	// ClaimPending atomically moves up to limit pending jobs whose retry
+	// backoff has elapsed by now to running under the lease and returns them.
+	// Pending jobs whose lease expires after now are held in a worker's local
+	// queue and skipped.
+	ClaimPending(ctx context.Context, limit int, now int64, lease models.Lease) ([]models.Job, error)
+	// HoldPending moves the lease expiry of the pending jobs among ids that the
+	// lease owner holds to that of lease. A zero ExpiresAt hands them over to
+	// ClaimPending right away.
+	HoldPending(ctx context.Context, ids []string, lease models.Lease) error
+	// Heartbeat extends the lease of a running job. ok is false when the lease
+	// owner no longer holds the job: it was aborted, finished or recovered.
+	Heartbeat(ctx context.Context, id string, lease models.Lease) (ok bool, err error)
+	// Finish stores the outcome of a running job whose lease owner still holds
+	// it. ok is false when it no longer does: the job was aborted, recovered or
+	// claimed by another worker, and nothing is written.
+	Finish(ctx context.Context, job models.Job, owner string) (ok bool, err error)
+	// RecoverExpired moves running jobs whose lease expired before now back to
+	// pending, or to failed once they were recovered maxRecoveries times, and
+	// returns the affected jobs in their new state
+	RecoverExpired(ctx context.Context, now int64, maxRecoveries int) ([]models.Job, error)
+	// Abort moves a pending or running job to aborted, releasing its lease. It
+	// fails with models.ErrJobNotAbortable when the job already finished.
 	Abort(ctx context.Context, id string) error
 	DeleteJobs(ids ...string) error
 	Close() error
+	CallbackLog
+	IdempotencyStore
+	BatchStore
+	quota.Store
+}
+
+// CallbackLog persists webhook delivery attempts per job
+type CallbackLog interface {
+	SaveDelivery(delivery models.CallbackDelivery) error
+	GetDeliveries(jobID string) ([]models.CallbackDelivery, error)
+}
+
+// IdempotencyStore persists Idempotency-Key records, scoped per user
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey stores rec unless a record for the same user and key
+	// has not expired by now, in which case that record is returned with ok false
+	ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, now int64) (existing models.IdempotencyRecord, ok bool, err error)
+	UpdateIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error
+	DeleteIdempotencyKey(ctx context.Context, userID, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now int64) error
+}
+
+// BatchStore persists the batches jobs are submitted with, the jobs of a
+// batch are listed with a models.JobFilter on its ID
+type BatchStore interface {
+	SaveBatch(ctx context.Context, batch models.Batch) error
+	// GetBatch returns models.ErrBatchNotFound for unknown IDs
+	GetBatch(ctx context.Context, id string) (models.Batch, error)
 }
 
 type Processor interface {
 	Process(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error)
 }
 
+// jobIDs generates the IDs of new jobs, see SetIDGenerator
+var (
+	jobIDsMu sync.RWMutex
+	jobIDs   IDGenerator = NewULIDGenerator()
+)
+
+// SetIDGenerator replaces the generator NewJob uses for job IDs
+func SetIDGenerator(g IDGenerator) {
+	jobIDsMu.Lock()
+	defer jobIDsMu.Unlock()
+	jobIDs = g
+}
+
+// NewJob creates a pending job whose ID and creation time come from the same
+// instant, so ordering by (created_at, id) follows the creation order
 func NewJob(req models.AnalyzeRequest) models.Job {
+	now := time.Now()
 	return models.Job{
-		ID:        generateJobID(),
-		Request:   req,
-		CreatedAt: time.Now().Unix(),
-		Status:    models.JobStatusPending,
+		ID:          generateJobID(now),
+		Request:     req,
+		CreatedAt:   now.Unix(),
+		Status:      models.JobStatusPending,
+		UserID:      req.UserID(),
+		BoardID:     req.BoardID(),
+		CallbackURL: req.CallbackURL(),
 	}
 }
 
-func NewJobQueueService(bufSize, workers, dbWorkers int, storage JobStorage, p Processor) *JobQueueService {
+// NewJobQueueService starts the job workers. callbacks may be nil to disable webhook delivery.
+func NewJobQueueService(cfg config.JobConfig, storage JobStorage, p Processor, callbacks *CallbackSender) *JobQueueService {
 	q := &JobQueueService{
-		queue:       make(chan models.Job, bufSize),
-		oldJobQueue: make(chan models.Job, bufSize), // Initialize the oldJobQueue
-		storage:     storage,
-		request:     p,
+		queue:        newScheduler(cfg.QueueSize, cfg.MaxRunningPerUser),
+		oldJobQueue:  make(chan models.Job, cfg.DbWorkerCount), // Holds the claimed jobs of idle db workers
+		storage:      storage,
+		request:      p,
+		callbacks:    callbacks,
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: cfg.RetryBackoff,
+		dbWorkers:    cfg.DbWorkerCount,
+
+		workerID:          cfg.WorkerID,
+		leaseDuration:     cfg.LeaseDuration,
+		heartbeatInterval: cfg.HeartbeatInterval,
+		recoveryInterval:  cfg.RecoveryInterval,
+		maxRecoveries:     cfg.MaxRecoveries,
+
+		idempotencyTTL: cfg.IdempotencyTTL,
+		events:         NewEventBus(),
+
+		done:    make(chan struct{}),
+		running: make(map[string]context.CancelCauseFunc),
 	}
-	for range workers {
+	if q.workerID == "" {
+		q.workerID = defaultWorkerID()
+	}
+	if q.leaseDuration <= 0 {
+		q.leaseDuration = defaultLeaseDuration
+	}
+	if q.heartbeatInterval <= 0 {
+		q.heartbeatInterval = q.leaseDuration / 3
+	}
+	if q.recoveryInterval <= 0 {
+		q.recoveryInterval = defaultRecoveryInterval
+	}
+	if q.idempotencyTTL <= 0 {
+		q.idempotencyTTL = defaultIdempotencyTTL
+	}
+
+	metrics.Workers.Add(float64(cfg.WorkerCount + cfg.DbWorkerCount))
+	for range cfg.WorkerCount {
 		q.wg.Add(1)
 		go q.worker()
 	}
-	for range dbWorkers {
+	for range cfg.DbWorkerCount {
 		q.wg.Add(1)
 		go q.dbWorker()
 	}
@@ -69,49 +226,125 @@ func NewJobQueueService(bufSize, workers, dbWorkers int, storage JobStorage, p P
 	return q
 }
 
+// processOldJobs recovers abandoned jobs and picks up pending jobs left in
+// storage right away on startup and then periodically, and cleans up old jobs
 func (q *JobQueueService) processOldJobs() {
-	ticker := time.NewTicker(time.Minute * 2)
-	defer ticker.Stop()
+	q.recoverJobs()
+
+	recoveryTicker := time.NewTicker(q.recoveryInterval)
+	defer recoveryTicker.Stop()
+	cleanupTicker := time.NewTicker(time.Minute * 2)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-recoveryTicker.C:
+			q.recoverJobs()
+		case <-cleanupTicker.C:
+			if err := q.cleanJobs(context.Background()); err != nil {
+				slog.Error("failed to clean aborted jobs:", "err", err)
+			}
+			q.events.Prune(time.Now())
+			if err := q.storage.DeleteExpiredIdempotencyKeys(context.Background(), time.Now().Unix()); err != nil {
+				slog.Error("failed to delete expired idempotency keys:", "err", err)
+			}
+		}
+	}
+}
 
-	for range ticker.C {
-		jobs, err := q.storage.GetAll()
-		if err != nil {
-			slog.Error("failed to get all jobs:", "err", err)
+// recoverJobs requeues running jobs whose worker died, failing those that
+// keep killing their workers, then claims due pending jobs for the db workers
+func (q *JobQueueService) recoverJobs() {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	recovered, err := q.storage.RecoverExpired(ctx, now, q.maxRecoveries)
+	if err != nil {
+		slog.Error("failed to recover jobs with expired leases:", "err", err)
+	}
+	for _, j := range recovered {
+		if j.Status == models.JobStatusFailed {
+			slog.Error("job abandoned after repeated lease expirations", "job_id", j.ID, "recoveries", j.Recoveries)
+			q.publishStatus(j)
+			q.deliverCallback(tracing.WithTraceParent(ctx, j.TraceParent), j)
 			continue
 		}
+		slog.Warn("recovered job with expired lease", "job_id", j.ID, "recoveries", j.Recoveries)
+		q.publishStatus(j)
+	}
 
-		if err := q.cleanJobs(jobs...); err != nil {
-			slog.Error("failed to clean aborted jobs:", "err", err)
+	// Keep holding the jobs waiting in the local queue, the scheduler decides
+	// their order and ClaimPending must not take them past it
+	if ids := q.queue.ids(); len(ids) > 0 {
+		if err := q.storage.HoldPending(ctx, ids, q.newHold(time.Now())); err != nil {
+			slog.Error("failed to hold queued jobs:", "err", err)
 		}
+	}
 
-		// Process pending jobs that are in storage but not yet processed
-		for _, j := range jobs {
-			// Only process jobs that are pending and not already being processed
-			if j.Status == models.JobStatusPending {
-				// Try to send to oldJobQueue, but don't block if the queue is full
-				select {
-				case q.oldJobQueue <- j:
-					slog.Debug("sent pending job to oldJobQueue for processing", "job_id", j.ID)
-				default:
-					// Queue is full, skip this job for now
-					slog.Warn("oldJobQueue is full, skipping job", "job_id", j.ID)
-				}
-			}
+	// Claim pending jobs that are in storage but not yet processed, only as
+	// many as there are idle db workers: a claimed job waiting for a worker
+	// has nobody renewing its lease. Claiming makes sure a job left over by
+	// this or another replica runs exactly once.
+	free := q.dbWorkers - int(q.dbBusy.Load())
+	if free <= 0 {
+		return
+	}
+	claimed, err := q.storage.ClaimPending(ctx, free, now, q.newLease())
+	if err != nil {
+		slog.Error("failed to claim pending jobs:", "err", err)
+		return
+	}
+	for _, j := range claimed {
+		q.sendOldJob(j)
+	}
+}
+
+// sendOldJob hands a claimed job to the db workers without blocking and
+// releases it back to pending if they cannot take it
+func (q *JobQueueService) sendOldJob(j models.Job) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if !q.closed {
+		select {
+		case q.oldJobQueue <- j:
+			q.dbBusy.Add(1)
+			slog.Debug("sent pending job to oldJobQueue for processing", "job_id", j.ID)
+			return
+		default:
 		}
 	}
+
+	slog.Warn("oldJobQueue is unavailable, releasing job", "job_id", j.ID)
+	j.Status = models.JobStatusPending
+	releaseLease(&j)
+	if err := q.storage.Update(j); err != nil {
+		slog.Error("failed to release claimed job", "job_id", j.ID, "err", err)
+	}
 }
 
-func (q *JobQueueService) cleanJobs(jobs ...models.Job) error {
+// cleanJobs deletes aborted jobs and jobs still pending or running after
+// JobCleanupAge. Candidates are paged through Query, which walks the
+// (created_at, id) order instead of loading every job.
+func (q *JobQueueService) cleanJobs(ctx context.Context) error {
 	// Find aborted jobs
-	abortedJobs := utils.Filter(jobs, func(j models.Job) bool { return j.Status == models.JobStatusAborted })
-	abortedJobsIds := utils.Map(abortedJobs, func(j models.Job) string { return j.ID })
+	abortedJobsIds, err := q.queryJobIDs(ctx, models.JobFilter{
+		Statuses: []models.JobStatus{models.JobStatusAborted},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query aborted jobs: %w", err)
+	}
 
 	// Find inactive jobs (older than JobCleanupAge and still pending/running)
-	inactiveJobs := utils.Filter(jobs, func(j models.Job) bool {
-		return (j.Status == models.JobStatusPending || j.Status == models.JobStatusRunning) &&
-			time.Since(time.Unix(j.CreatedAt, 0)) > JobCleanupAge
+	inactiveJobsIds, err := q.queryJobIDs(ctx, models.JobFilter{
+		Statuses:  []models.JobStatus{models.JobStatusPending, models.JobStatusRunning},
+		CreatedTo: time.Now().Add(-JobCleanupAge).Unix(),
 	})
-	inactiveJobsIds := utils.Map(inactiveJobs, func(j models.Job) string { return j.ID })
+	if err != nil {
+		return fmt.Errorf("failed to query inactive jobs: %w", err)
+	}
 
 	// Combine both sets of job IDs to delete
 	allJobIdsToDelete := append(abortedJobsIds, inactiveJobsIds...)
@@ -128,6 +361,38 @@ func (q *JobQueueService) cleanJobs(jobs ...models.Job) error {
 	return nil
 }
 
+// queryJobIDs collects the IDs of every job matching filter, oldest first
+func (q *JobQueueService) queryJobIDs(ctx context.Context, filter models.JobFilter) ([]string, error) {
+	jobs, err := q.queryJobs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(jobs))
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+	return ids, nil
+}
+
+// queryJobs collects every job matching filter, oldest first
+func (q *JobQueueService) queryJobs(ctx context.Context, filter models.JobFilter) ([]models.Job, error) {
+	filter.Order = models.SortAsc
+	filter.Limit = models.MaxJobPageSize
+
+	var jobs []models.Job
+	for {
+		page, err := q.storage.Query(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, page.Jobs...)
+		if page.NextCursor == "" {
+			return jobs, nil
+		}
+		filter.Cursor = page.NextCursor
+	}
+}
+
 type QueueFullErr struct {
 }
 
@@ -136,21 +401,31 @@ func (q QueueFullErr) Error() string {
 }
 
 func (q *JobQueueService) Enqueue(job models.Job) error {
+	// Hold the job while it waits in the local queue, see recoverJobs
+	hold := q.newHold(time.Now())
+	job.LeaseOwner, job.LeaseExpiresAt = hold.Owner, hold.ExpiresAt
 	if err := q.storage.Save(job); err != nil {
 		return fmt.Errorf("failed to save job: %w", err)
 	}
-	select {
-	case q.queue <- job:
-		return nil
-	default:
-		return QueueFullErr{}
+	q.publishStatus(job)
+
+	if err := q.queue.push(job); err != nil {
+		q.releaseHold(job.ID)
+		return err
 	}
+	metrics.JobsEnqueued.WithLabelValues(job.Request.RequestType).Inc()
+	return nil
 }
 
 func (q *JobQueueService) GetJob(ctx context.Context, jobID string) (models.Job, error) {
 	return q.storage.Get(jobID)
 }
 
+// ListJobs returns one page of jobs matching the filter
+func (q *JobQueueService) ListJobs(ctx context.Context, filter models.JobFilter) (models.JobPage, error) {
+	return q.storage.Query(ctx, filter)
+}
+
 func (q *JobQueueService) Status(jobID string) (models.JobStatus, error) {
 	job, err := q.storage.Get(jobID)
 	if err != nil {
@@ -161,142 +436,469 @@ func (q *JobQueueService) Status(jobID string) (models.JobStatus, error) {
 
 func (q *JobQueueService) worker() {
 	defer q.wg.Done()
-	for job := range q.queue {
+	for {
+		job, ok := q.queue.next()
+		if !ok {
+			return
+		}
+		metrics.WorkersBusy.Inc()
 		q.processJob(job)
+		metrics.WorkersBusy.Dec()
+		q.queue.done(job)
 	}
 }
 
 func (q *JobQueueService) dbWorker() {
 	defer q.wg.Done()
 	for job := range q.oldJobQueue {
-		q.processJob(job)
+		metrics.WorkersBusy.Inc()
+		q.processClaimedJob(job)
+		metrics.WorkersBusy.Dec()
+		q.dbBusy.Add(-1)
 	}
 }
 
+// processJob claims a queued job and runs it
 func (q *JobQueueService) processJob(job models.Job) {
 	slog.Info("job starting processing", "id", job.ID)
 
-	// Check if job was aborted atomically
-	currentJob, err := q.storage.Get(job.ID)
+	// Register the cancel func before claiming so an abort landing right
+	// after the claim always reaches this job
+	ctx, done := q.newRunContext(job.ID)
+	defer done()
+
+	claimed, ok, err := q.storage.Claim(ctx, job.ID, q.newLease())
 	if err != nil {
-		slog.Error("failed to get job from storage", "id", job.ID, "err", err)
+		slog.Error("failed to claim job", "id", job.ID, "err", err)
 		return
 	}
-
-	if currentJob.Status == models.JobStatusAborted {
-		slog.Info("stop processing aborted job", "id", job.ID)
+	if !ok {
+		slog.Info("job is no longer pending, skipping", "id", job.ID)
 		return
 	}
 
-	// Attempt to update status to running atomically
-	job.Status = models.JobStatusRunning
-	if err := q.storage.Update(job); err != nil {
-		slog.Error("failed to update job status to running", "id", job.ID, "err", err)
+	q.runJob(ctx, claimed)
+}
+
+// processClaimedJob runs a job already moved to running by ClaimPending
+func (q *JobQueueService) processClaimedJob(job models.Job) {
+	slog.Info("job starting processing", "id", job.ID)
+
+	ctx, done := q.newRunContext(job.ID)
+	defer done()
+
+	// An abort may have landed between the claim and the tracking above, or
+	// the lease expired and the job was recovered while it waited for a worker
+	ok, err := q.storage.Heartbeat(ctx, job.ID, q.newLease())
+	if err != nil {
+		slog.Error("failed to renew job lease", "id", job.ID, "err", err)
+		return
+	}
+	if !ok {
+		slog.Info("job is no longer held by this worker, skipping", "id", job.ID)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
+	q.runJob(ctx, job)
+}
+
+// runJob processes a running job and stores its outcome. The job continues
+// the trace of the request that submitted it.
+func (q *JobQueueService) runJob(ctx context.Context, job models.Job) {
+	ctx, span := tracer.Start(tracing.WithTraceParent(ctx, job.TraceParent), "job."+job.Request.RequestType,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("job.id", job.ID),
+			attribute.Int("job.retries", job.Retries),
+		))
+	q.publishStatus(job)
+
+	// Process calls the observer synchronously, job ends up naming the last provider tried
+	processCtx := providers.WithAttemptObserver(ctx, func(provider string) {
+		job.Provider = provider
+		q.events.Publish(models.JobEvent{JobID: job.ID, Type: models.JobEventProvider, Provider: provider, Retry: job.Retries})
+	})
+
+	stopHeartbeat := q.startHeartbeat(ctx, job.ID)
+	start := time.Now()
+	resp, err := q.request.Process(processCtx, job.Request)
+	metrics.JobProcessingDuration.WithLabelValues(job.Request.RequestType).Observe(time.Since(start).Seconds())
+	stopHeartbeat()
+	releaseLease(&job)
+
+	q.finishJob(ctx, job, resp, err)
+	tracing.End(span, err)
+}
 
-	resp, err := q.request.Process(ctx, job.Request)
+// finishJob stores the outcome of processing a running job: its result, its
+// failure or its retry. ctx is the processing context, whose cancellation
+// tells aborts and lost leases apart from failures.
+func (q *JobQueueService) finishJob(ctx context.Context, job models.Job, resp models.AnalyzeResponse, err error) {
+	if errors.Is(context.Cause(ctx), errLeaseLost) {
+		slog.Warn("job lease lost during processing, leaving the job to its new owner", "id", job.ID)
+		return
+	}
+
+	// Only an abort cancels the job context, the timeout surfaces as
+	// DeadlineExceeded. Abort already stored the status.
+	if errors.Is(ctx.Err(), context.Canceled) {
+		slog.Info("job was aborted during processing", "id", job.ID)
+		job.Status = models.JobStatusAborted
+		observeFinished(job)
+		return
+	}
 
 	if err != nil {
-		slog.Info("[job %s] error: %v", job.ID, err)
-		// Double-check if job was aborted during processing before updating status
-		finalJob, getStatusErr := q.storage.Get(job.ID)
-		if getStatusErr != nil || finalJob.Status != models.JobStatusAborted {
-			job.Status = models.JobStatusFailed
-			_ = q.storage.Update(job)
-			q.deliverCallback(job, map[string]any{
-				"status": "error",
-				"error":  err.Error(),
-			})
+		slog.Info("job processing failed", "id", job.ID, "err", err)
+		if providers.IsRetryable(err) && job.Retries < q.maxRetries {
+			q.retryJob(ctx, job, err)
+			return
+		}
+
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+		if job.Retries > 0 {
+			job.Error = fmt.Sprintf("%s (gave up after %d retries)", err.Error(), job.Retries)
 		}
+		if !q.storeOutcome(ctx, job) {
+			return
+		}
+		observeFinished(job)
+		q.publishStatus(job)
+		q.deliverCallback(ctx, job)
 		return
 	}
 
-	// Double-check if job was aborted during processing before updating status
-	finalJob, getStatusErr := q.storage.Get(job.ID)
-	if getStatusErr != nil || finalJob.Status != models.JobStatusAborted {
-		job.Status = models.JobStatusCompleted
-		_ = q.storage.Update(job)
-		q.deliverCallback(job, map[string]any{
-			"status": "success",
-			"result": resp,
-		})
-	} else {
-		slog.Info("job was aborted during processing", "id", job.ID)
+	job.Status = models.JobStatusCompleted
+	job.Result = &resp
+	job.Error = ""
+	if !q.storeOutcome(ctx, job) {
+		return
 	}
+	observeFinished(job)
+	q.publishStatus(job)
+	q.deliverCallback(ctx, job)
 
 	slog.Info("job completed", "id", job.ID)
 }
 
+// storeOutcome writes the outcome of a job this worker ran. It reports false
+// when the job was aborted or taken over by another worker meanwhile, whose
+// state then stands and the outcome is dropped.
+func (q *JobQueueService) storeOutcome(ctx context.Context, job models.Job) bool {
+	// The outcome is stored even when processing timed out
+	ok, err := q.storage.Finish(context.WithoutCancel(ctx), job, q.workerID)
+	if err != nil {
+		slog.Error("failed to store job outcome", "id", job.ID, "status", job.Status, "err", err)
+		return false
+	}
+	if !ok {
+		slog.Info("job is no longer held by this worker, dropping its outcome", "id", job.ID, "status", job.Status)
+	}
+	return ok
+}
+
+// retryJob puts a job that failed with a retryable error back to pending and
+// re-enqueues it once its backoff has elapsed, or the Retry-After of the
+// provider that failed it when longer, up to JobRetryMaxBackoff
+func (q *JobQueueService) retryJob(ctx context.Context, job models.Job, cause error) {
+	job.Retries++
+	delay := q.retryDelay(job.Retries)
+	if retryAfter := providers.RetryAfter(cause); retryAfter > delay {
+		delay = min(retryAfter, JobRetryMaxBackoff)
+	}
+
+	job.Status = models.JobStatusPending
+	job.Error = cause.Error()
+	job.NextRetryAt = time.Now().Add(delay).Unix()
+	hold := q.newHold(time.Now().Add(delay))
+	job.LeaseOwner, job.LeaseExpiresAt = hold.Owner, hold.ExpiresAt
+	if !q.storeOutcome(ctx, job) {
+		return
+	}
+
+	metrics.JobRetries.WithLabelValues(job.Request.RequestType).Inc()
+	slog.Warn("job failed with retryable error, retrying",
+		"id", job.ID, "retry", job.Retries, "max_retries", q.maxRetries, "backoff", delay, "err", cause)
+	q.events.Publish(models.JobEvent{
+		JobID:       job.ID,
+		Type:        models.JobEventRetry,
+		Retry:       job.Retries,
+		NextRetryAt: job.NextRetryAt,
+		Error:       job.Error,
+	})
+	q.publishStatus(job)
+
+	time.AfterFunc(delay, func() {
+		if err := q.queue.push(job); err != nil {
+			// The queue is full or closed, processOldJobs will pick the pending job up
+			slog.Warn("queue is full, deferring job retry", "id", job.ID)
+			q.releaseHold(job.ID)
+		}
+	})
+}
+
+// observeFinished counts a job that reached its final status
+func observeFinished(job models.Job) {
+	metrics.JobsFinished.WithLabelValues(job.Request.RequestType, string(job.Status)).Inc()
+}
+
+// retryDelay computes the exponential backoff with jitter for the given retry number
+func (q *JobQueueService) retryDelay(retry int) time.Duration {
+	if q.retryBackoff <= 0 {
+		return 0
+	}
+
+	delay := q.retryBackoff
+	for i := 1; i < retry && delay < JobRetryMaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, JobRetryMaxBackoff)
+
+	// Add up to 50% jitter so retries of jobs failing together spread out
+	return delay + time.Duration(rand.Int64N(int64(delay)/2+1))
+}
+
+// Abort marks a job as aborted and cancels its processing if it is running
 func (q *JobQueueService) Abort(ctx context.Context, jobID string) error {
-	return q.storage.Abort(ctx, jobID)
+	if err := q.storage.Abort(ctx, jobID); err != nil {
+		return err
+	}
+
+	if q.cancelRunning(jobID, nil) {
+		slog.Info("cancelling running job", "id", jobID)
+	}
+	q.publishStatus(models.Job{ID: jobID, Status: models.JobStatusAborted})
+
+	return nil
+}
+
+// SubscribeEvents follows the events this process publishes for a job, see EventBus.Subscribe
+func (q *JobQueueService) SubscribeEvents(jobID string, lastEventID int64) ([]models.JobEvent, <-chan models.JobEvent, func()) {
+	return q.events.Subscribe(jobID, lastEventID)
+}
+
+// publishStatus publishes the current status of a job, followed by the
+// final result event once the job is finished
+func (q *JobQueueService) publishStatus(job models.Job) {
+	q.events.Publish(models.JobEvent{JobID: job.ID, Type: models.JobEventStatus, Status: job.Status, Retry: job.Retries})
+	if job.Status.IsFinished() {
+		q.events.Publish(models.JobEvent{JobID: job.ID, Type: models.JobEventResult, Status: job.Status, Error: job.Error, Result: job.Result})
+	}
+}
+
+// newRunContext creates the processing context of a job and registers its
+// cancel func, the returned func releases both
+func (q *JobQueueService) newRunContext(jobID string) (context.Context, func()) {
+	base, cancelCause := context.WithCancelCause(context.Background())
+	ctx, cancel := context.WithTimeout(base, JobProcessTimeout)
+	q.trackRunning(jobID, cancelCause)
+	return ctx, func() {
+		q.untrackRunning(jobID)
+		cancel()
+		cancelCause(nil)
+	}
+}
+
+// cancelRunning cancels a job processed by this service, a nil cause means an abort
+func (q *JobQueueService) cancelRunning(jobID string, cause error) bool {
+	q.runningMu.Lock()
+	cancel, ok := q.running[jobID]
+	q.runningMu.Unlock()
+	if ok {
+		cancel(cause)
+	}
+	return ok
+}
+
+func (q *JobQueueService) trackRunning(jobID string, cancel context.CancelCauseFunc) {
+	q.runningMu.Lock()
+	defer q.runningMu.Unlock()
+	q.running[jobID] = cancel
+}
+
+func (q *JobQueueService) untrackRunning(jobID string) {
+	q.runningMu.Lock()
+	defer q.runningMu.Unlock()
+	delete(q.running, jobID)
+}
+
+// newLease grants this worker a fresh lease on a job
+func (q *JobQueueService) newLease() models.Lease {
+	return models.Lease{
+		Owner:     q.workerID,
+		ExpiresAt: time.Now().Add(q.leaseDuration).Unix(),
+	}
+}
+
+// newHold leases a pending job in the local queue to this worker until one
+// lease duration past the next recovery after from, recoverJobs renews it
+func (q *JobQueueService) newHold(from time.Time) models.Lease {
+	return models.Lease{
+		Owner:     q.workerID,
+		ExpiresAt: from.Add(q.recoveryInterval + q.leaseDuration).Unix(),
+	}
+}
+
+// releaseHold lets ClaimPending take a pending job that did not make it into
+// the local queue
+func (q *JobQueueService) releaseHold(jobID string) {
+	if err := q.storage.HoldPending(context.Background(), []string{jobID}, models.Lease{Owner: q.workerID}); err != nil {
+		slog.Error("failed to release held job", "id", jobID, "err", err)
+	}
+}
+
+// startHeartbeat renews the lease of a running job until the returned func is
+// called, cancelling the job if another worker took it over
+func (q *JobQueueService) startHeartbeat(ctx context.Context, jobID string) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(q.heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			ok, err := q.storage.Heartbeat(ctx, jobID, q.newLease())
+			if err != nil {
+				// Keep working, the lease only lapses if heartbeats fail for a whole lease duration
+				slog.Warn("failed to renew job lease", "id", jobID, "err", err)
+				continue
+			}
+			if !ok {
+				q.cancelRunning(jobID, errLeaseLost)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
 }
 
-func (q *JobQueueService) deliverCallback(job models.Job, payload map[string]any) {
-	// Extract callback URL from the original request if it exists
-	callbackURL := q.extractCallbackURL(job.Request)
-	if callbackURL == "" {
+// releaseLease clears the lease of a job leaving the running state
+func releaseLease(job *models.Job) {
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = 0
+}
+
+// deliverCallback sends the webhook of a finished job in the background, as
+// part of the trace of ctx
+func (q *JobQueueService) deliverCallback(ctx context.Context, job models.Job) {
+	if q.callbacks == nil || job.CallbackURL == "" {
 		// No callback URL provided, nothing to do
 		return
 	}
 
 	// Send the callback asynchronously to avoid blocking job processing
-	go q.sendCallbackRequest(job, callbackURL, payload)
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		_, _ = q.callbacks.Deliver(ctx, job)
+	}()
 }
 
-func (q *JobQueueService) extractCallbackURL(req models.AnalyzeRequest) string {
-	// This would need to be implemented based on how callback URLs are stored in requests
-	// For now, returning empty string as the functionality isn't fully implemented in the models
-	// In a real implementation, the callback URL would be stored in the request object
-
-	// Placeholder implementation - in a real system, the callback URL would be part of the original request
-	return "" // Return empty for now since models don't include callback URL field
+// GetCallbackDeliveries returns the recorded webhook delivery attempts of a job
+func (q *JobQueueService) GetCallbackDeliveries(ctx context.Context, jobID string) ([]models.CallbackDelivery, error) {
+	if _, err := q.storage.Get(jobID); err != nil {
+		return nil, err
+	}
+	return q.storage.GetDeliveries(jobID)
 }
 
-func (q *JobQueueService) sendCallbackRequest(job models.Job, callbackURL string, payload map[string]any) {
-	// Convert payload to JSON
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		slog.Error("failed to marshal callback payload", "job_id", job.ID, "err", err)
-		return
+// ReplayCallback re-sends the final webhook of a completed or failed job. It
+// fails with models.ErrCallbacksDisabled, models.ErrJobNotReplayable or
+// models.ErrNoCallbackURL before any delivery is attempted.
+func (q *JobQueueService) ReplayCallback(ctx context.Context, jobID string) (models.CallbackDelivery, error) {
+	if q.callbacks == nil {
+		return models.CallbackDelivery{}, models.ErrCallbacksDisabled
 	}
 
-	// Create HTTP request
-	httpClient := &http.Client{Timeout: 30 * time.Second} // Reasonable timeout for callbacks
-	req, err := http.NewRequestWithContext(context.Background(), "POST", callbackURL, bytes.NewBuffer(jsonPayload))
+	job, err := q.storage.Get(jobID)
 	if err != nil {
-		slog.Error("failed to create callback request", "job_id", job.ID, "err", err)
-		return
+		return models.CallbackDelivery{}, err
+	}
+	if job.Status != models.JobStatusCompleted && job.Status != models.JobStatusFailed {
+		return models.CallbackDelivery{}, fmt.Errorf("job %s is %s: %w", job.ID, job.Status, models.ErrJobNotReplayable)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Callback-Type", "job-status-update")
-	req.Header.Set("X-Request-ID", job.ID)
+	return q.callbacks.Deliver(ctx, job)
+}
+
+// ReserveIdempotencyKey reserves a user's key for the request about to start
+// jobID. The reservation only lasts inFlight until CompleteIdempotencyKey, so
+// a request lost half-way does not block its retries for the whole TTL. When
+// the key is already taken, its record is returned with ok false.
+func (q *JobQueueService) ReserveIdempotencyKey(ctx context.Context, userID, key, requestHash, jobID string, inFlight time.Duration) (rec models.IdempotencyRecord, ok bool, err error) {
+	now := time.Now()
+	rec = models.IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		JobID:       jobID,
+		CreatedAt:   now.Unix(),
+		ExpiresAt:   now.Add(inFlight).Unix(),
+	}
 
-	// Send the request
-	resp, err := httpClient.Do(req)
+	existing, ok, err := q.storage.ReserveIdempotencyKey(ctx, rec, now.Unix())
 	if err != nil {
-		slog.Error("failed to send callback request", "job_id", job.ID, "err", err)
-		return
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if !ok {
+		return existing, false, nil
 	}
-	defer resp.Body.Close()
+	return rec, true, nil
+}
 
-	// Log the response
-	slog.Info("callback sent", "job_id", job.ID, "status_code", resp.StatusCode, "callback_url", callbackURL)
+// CompleteIdempotencyKey stores the outcome of a reserved key and keeps it for the idempotency TTL
+func (q *JobQueueService) CompleteIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	rec.ExpiresAt = time.Now().Add(q.idempotencyTTL).Unix()
+	if err := q.storage.UpdateIdempotencyKey(ctx, rec); err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
 
-	// In a production system, you would want to implement retry logic here
-	// for cases where the callback fails
+// ReleaseIdempotencyKey frees a reserved key whose request failed, so a retry runs it again
+func (q *JobQueueService) ReleaseIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	if err := q.storage.DeleteIdempotencyKey(ctx, rec.UserID, rec.Key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
 }
 
 func (q *JobQueueService) Shutdown() {
-	close(q.queue)
+	q.mu.Lock()
+	q.closed = true
+	close(q.done)
+	q.mu.Unlock()
+
+	q.queue.close()
 	close(q.oldJobQueue)  // Also close the old job queue
 	q.wg.Wait()
 }
 
-func generateJobID() string {
-	return fmt.Sprintf("job_%d", time.Now().UnixNano())
+// defaultWorkerID names this process as a lease owner, unique across restarts
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%08x", host, rand.Uint32())
+}
+
+func generateJobID(t time.Time) string {
+	jobIDsMu.RLock()
+	defer jobIDsMu.RUnlock()
+	return jobIDs.NewID(t)
 }
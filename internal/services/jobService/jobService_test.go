@@ -1,5 +1,27 @@
 package jobservice
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/metrics"
+	"github.com/aiservice/internal/mocks"
+	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/providers"
+	"github.com/aiservice/internal/services/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
 // func TestWorkerProcessesJobFromQueue(t *testing.T) {
 // 	ctrl := gomock.NewController(t)
 // 	defer ctrl.Finish()
@@ -64,3 +86,635 @@ package jobservice
 // 	// wait until all calls recorded
 // 	require.Eventually(t, func() bool { return len(called) == n }, 3*time.Second, 20*time.Millisecond)
 // }
+
+func testJobConfig() config.JobConfig {
+	return config.JobConfig{
+		QueueSize:    10,
+		WorkerCount:  1,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}
+}
+
+func TestProcessJob_StoresResult(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	st := storage.NewInMemoryJobStorage()
+	mockProc := mocks.NewMockProcessor(ctrl)
+	mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).Return(models.AnalyzeResponse{
+		SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "ok"}},
+	}, nil).Times(1)
+
+	svc := NewJobQueueService(testJobConfig(), st, mockProc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	require.NoError(t, svc.Enqueue(job))
+
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		return err == nil && got.Status == models.JobStatusCompleted
+	}, 2*time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.Result)
+	require.Equal(t, "ok", got.Result.SummarizeResponse.Element.Content)
+	require.Empty(t, got.Error)
+}
+
+func TestProcessJob_StoresFailureReason(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	st := storage.NewInMemoryJobStorage()
+	mockProc := mocks.NewMockProcessor(ctrl)
+	mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+		Return(models.AnalyzeResponse{}, errors.New("llm failed")).Times(1)
+
+	svc := NewJobQueueService(testJobConfig(), st, mockProc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	require.NoError(t, svc.Enqueue(job))
+
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		return err == nil && got.Status == models.JobStatusFailed
+	}, 2*time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Nil(t, got.Result)
+	require.Equal(t, "llm failed", got.Error)
+}
+
+func TestProcessJob_RetriesRetryableErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	st := storage.NewInMemoryJobStorage()
+	mockProc := mocks.NewMockProcessor(ctrl)
+	gomock.InOrder(
+		mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+			Return(models.AnalyzeResponse{}, &providers.ProviderError{Type: providers.InternalError, Message: "boom"}),
+		mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+			Return(models.AnalyzeResponse{}, &providers.AllProvidersFailedError{}),
+		mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+			Return(models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "ok"}}}, nil),
+	)
+
+	svc := NewJobQueueService(testJobConfig(), st, mockProc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	require.NoError(t, svc.Enqueue(job))
+
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		return err == nil && got.Status == models.JobStatusCompleted
+	}, 2*time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, got.Retries)
+	require.Empty(t, got.Error)
+}
+
+func TestProcessJob_ReportsMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	st := storage.NewInMemoryJobStorage()
+	mockProc := mocks.NewMockProcessor(ctrl)
+	gomock.InOrder(
+		mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+			Return(models.AnalyzeResponse{}, &providers.ProviderError{Type: providers.InternalError, Message: "boom"}),
+		mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+			Return(models.AnalyzeResponse{}, nil),
+	)
+
+	// The collectors are global, compare against their values before the job
+	enqueued := metrics.JobsEnqueued.WithLabelValues(models.StructurizeType)
+	retries := metrics.JobRetries.WithLabelValues(models.StructurizeType)
+	completed := metrics.JobsFinished.WithLabelValues(models.StructurizeType, string(models.JobStatusCompleted))
+	enqueuedBefore, retriesBefore, completedBefore := testutil.ToFloat64(enqueued), testutil.ToFloat64(retries), testutil.ToFloat64(completed)
+
+	svc := NewJobQueueService(testJobConfig(), st, mockProc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewStructAnalyzeReq(models.StructurizeRequest{UserID: "user"}))
+	require.NoError(t, svc.Enqueue(job))
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(completed) == completedBefore+1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, enqueuedBefore+1, testutil.ToFloat64(enqueued))
+	require.Equal(t, retriesBefore+1, testutil.ToFloat64(retries))
+}
+
+func TestProcessJob_RetryWaitsForRetryAfter(t *testing.T) {
+	tests := map[string]error{
+		"provider asked to wait": &providers.AllProvidersFailedError{LastErr: &providers.ProviderError{
+			Type: providers.RateLimitError, Message: "slow down", RetryAfter: time.Minute,
+		}},
+		// Later attempts skip the provider, whose circuit breaker is still open
+		"providers skipped": &providers.AllProvidersFailedError{RetryAfter: time.Minute},
+	}
+	for name, processErr := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			st := storage.NewInMemoryJobStorage()
+			mockProc := mocks.NewMockProcessor(ctrl)
+			mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+				Return(models.AnalyzeResponse{}, processErr).
+				Times(1)
+
+			svc := NewJobQueueService(testJobConfig(), st, mockProc, nil)
+			defer svc.Shutdown()
+
+			job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+			start := time.Now()
+			require.NoError(t, svc.Enqueue(job))
+
+			require.Eventually(t, func() bool {
+				got, err := st.Get(job.ID)
+				return err == nil && got.Retries == 1
+			}, 2*time.Second, 10*time.Millisecond)
+
+			got, err := st.Get(job.ID)
+			require.NoError(t, err)
+			require.Equal(t, models.JobStatusPending, got.Status)
+			require.GreaterOrEqual(t, got.NextRetryAt, start.Add(time.Minute).Unix())
+		})
+	}
+}
+
+func TestProcessJob_FailsAfterRetriesExhausted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	st := storage.NewInMemoryJobStorage()
+	mockProc := mocks.NewMockProcessor(ctrl)
+	mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+		Return(models.AnalyzeResponse{}, &providers.ProviderError{Type: providers.RateLimitError, Message: "slow down"}).
+		Times(3)
+
+	svc := NewJobQueueService(testJobConfig(), st, mockProc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	require.NoError(t, svc.Enqueue(job))
+
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		return err == nil && got.Status == models.JobStatusFailed
+	}, 2*time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, got.Retries)
+	require.Contains(t, got.Error, "gave up after 2 retries")
+}
+
+func TestProcessJob_NonRetryableErrorFailsFast(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	st := storage.NewInMemoryJobStorage()
+	mockProc := mocks.NewMockProcessor(ctrl)
+	mockProc.EXPECT().Process(gomock.Any(), gomock.Any()).
+		Return(models.AnalyzeResponse{}, &providers.ProviderError{Type: providers.AccessDeniedError, Message: "forbidden"}).
+		Times(1)
+
+	svc := NewJobQueueService(testJobConfig(), st, mockProc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	require.NoError(t, svc.Enqueue(job))
+
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		return err == nil && got.Status == models.JobStatusFailed
+	}, 2*time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, 0, got.Retries)
+}
+
+func TestAbort_CancelsRunningJob(t *testing.T) {
+	var callbacks atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbacks.Add(1)
+	}))
+	defer receiver.Close()
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	st := storage.NewInMemoryJobStorage()
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return models.AnalyzeResponse{}, ctx.Err()
+	})
+
+	svc := NewJobQueueService(testJobConfig(), st, proc, NewCallbackSender(testCallbackConfig(), st))
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user", CallbackURL: receiver.URL}))
+	require.NoError(t, svc.Enqueue(job))
+
+	<-started
+	require.NoError(t, svc.Abort(context.Background(), job.ID))
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("running job was not cancelled")
+	}
+
+	require.Eventually(t, func() bool {
+		svc.runningMu.Lock()
+		defer svc.runningMu.Unlock()
+		return len(svc.running) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusAborted, got.Status)
+	require.Equal(t, int32(0), callbacks.Load())
+}
+
+func TestFinishJob_KeepsStateChangedByOthers(t *testing.T) {
+	tests := map[string]func(st *storage.InMemoryJobStorage, job models.Job) error{
+		// The abort reached the storage but not this worker, as from another replica
+		"aborted": func(st *storage.InMemoryJobStorage, job models.Job) error {
+			return st.Abort(context.Background(), job.ID)
+		},
+		"claimed by another worker": func(st *storage.InMemoryJobStorage, job models.Job) error {
+			job.LeaseOwner = "other-worker"
+			return st.Update(job)
+		},
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			var callbacks atomic.Int32
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callbacks.Add(1)
+			}))
+			defer receiver.Close()
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			st := storage.NewInMemoryJobStorage()
+			proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+				close(started)
+				<-release
+				return models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "done"}}}, nil
+			})
+
+			svc := NewJobQueueService(testJobConfig(), st, proc, NewCallbackSender(testCallbackConfig(), st))
+			defer svc.Shutdown()
+
+			job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user", CallbackURL: receiver.URL}))
+			require.NoError(t, svc.Enqueue(job))
+
+			<-started
+			running, err := st.Get(job.ID)
+			require.NoError(t, err)
+			require.NoError(t, change(st, running))
+			want, err := st.Get(job.ID)
+			require.NoError(t, err)
+
+			close(release)
+			require.Eventually(t, func() bool {
+				svc.runningMu.Lock()
+				defer svc.runningMu.Unlock()
+				return len(svc.running) == 0
+			}, time.Second, 10*time.Millisecond)
+			require.Never(t, func() bool { return callbacks.Load() > 0 }, 200*time.Millisecond, 10*time.Millisecond)
+
+			got, err := st.Get(job.ID)
+			require.NoError(t, err)
+			require.Equal(t, want.Status, got.Status)
+			require.Equal(t, want.LeaseOwner, got.LeaseOwner)
+			require.Nil(t, got.Result)
+		})
+	}
+}
+
+func testLeaseJobConfig() config.JobConfig {
+	cfg := testJobConfig()
+	cfg.WorkerCount = 0
+	cfg.DbWorkerCount = 1
+	cfg.WorkerID = "worker-test"
+	cfg.LeaseDuration = 2 * time.Second
+	cfg.HeartbeatInterval = 20 * time.Millisecond
+	cfg.RecoveryInterval = 20 * time.Millisecond
+	cfg.MaxRecoveries = 2
+	return cfg
+}
+
+// abandonedJob is a running job whose worker died while its lease was held
+func abandonedJob(recoveries int) models.Job {
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	job.Status = models.JobStatusRunning
+	job.LeaseOwner = "dead-worker"
+	job.LeaseExpiresAt = time.Now().Add(-time.Minute).Unix()
+	job.Recoveries = recoveries
+	return job
+}
+
+func TestRecoverJobs_RequeuesExpiredLease(t *testing.T) {
+	st := storage.NewInMemoryJobStorage()
+	job := abandonedJob(0)
+	require.NoError(t, st.Save(job))
+
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		return models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "ok"}}}, nil
+	})
+	svc := NewJobQueueService(testLeaseJobConfig(), st, proc, nil)
+	defer svc.Shutdown()
+
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		return err == nil && got.Status == models.JobStatusCompleted
+	}, 2*time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, 1, got.Recoveries)
+	require.Empty(t, got.LeaseOwner)
+}
+
+func TestRecoverJobs_RunsEachClaimedJobOnce(t *testing.T) {
+	st := storage.NewInMemoryJobStorage()
+	var jobs []models.Job
+	for i := range 3 {
+		job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: fmt.Sprintf("user-%d", i)}))
+		require.NoError(t, st.Save(job))
+		jobs = append(jobs, job)
+	}
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		mu.Lock()
+		calls[req.UserID()]++
+		mu.Unlock()
+		time.Sleep(700 * time.Millisecond)
+		return models.AnalyzeResponse{}, nil
+	})
+
+	// More pending jobs than db workers, each taking most of the lease
+	cfg := testLeaseJobConfig()
+	cfg.LeaseDuration = time.Second
+	svc := NewJobQueueService(cfg, st, proc, nil)
+	defer svc.Shutdown()
+
+	require.Eventually(t, func() bool {
+		for _, job := range jobs {
+			got, err := st.Get(job.ID)
+			if err != nil || got.Status != models.JobStatusCompleted {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, job := range jobs {
+		require.Equal(t, 1, calls[job.UserID], job.ID)
+		got, err := st.Get(job.ID)
+		require.NoError(t, err)
+		require.Zero(t, got.Recoveries, job.ID)
+	}
+}
+
+func TestRecoverJobs_LeavesQueuedJobsToScheduler(t *testing.T) {
+	st := storage.NewInMemoryJobStorage()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		mu.Lock()
+		order = append(order, req.UserID())
+		mu.Unlock()
+		<-release
+		return models.AnalyzeResponse{}, nil
+	})
+
+	// One worker for the queue and an idle db worker polling storage
+	cfg := testLeaseJobConfig()
+	cfg.WorkerCount = 1
+	svc := NewJobQueueService(cfg, st, proc, nil)
+	defer svc.Shutdown()
+
+	var jobs []models.Job
+	for _, user := range []string{"alice", "alice", "alice", "bob"} {
+		job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: user}))
+		require.NoError(t, svc.Enqueue(job))
+		jobs = append(jobs, job)
+	}
+
+	// Several recoveries pass while the first job blocks the worker
+	time.Sleep(10 * cfg.RecoveryInterval)
+	close(release)
+
+	require.Eventually(t, func() bool {
+		for _, job := range jobs {
+			got, err := st.Get(job.ID)
+			if err != nil || got.Status != models.JobStatusCompleted {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"alice", "bob", "alice", "alice"}, order)
+}
+
+func TestRecoverJobs_FailsPoisonJob(t *testing.T) {
+	st := storage.NewInMemoryJobStorage()
+	job := abandonedJob(2)
+	require.NoError(t, st.Save(job))
+
+	var calls atomic.Int32
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		calls.Add(1)
+		return models.AnalyzeResponse{}, nil
+	})
+	svc := NewJobQueueService(testLeaseJobConfig(), st, proc, nil)
+	defer svc.Shutdown()
+
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		return err == nil && got.Status == models.JobStatusFailed
+	}, 2*time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobAbandonedError, got.Error)
+	require.Equal(t, int32(0), calls.Load())
+}
+
+func TestRunJob_StopsWhenLeaseIsTakenOver(t *testing.T) {
+	st := storage.NewInMemoryJobStorage()
+	cancelled := make(chan error, 1)
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return models.AnalyzeResponse{}, ctx.Err()
+	})
+
+	cfg := testLeaseJobConfig()
+	cfg.WorkerCount = 1
+	cfg.DbWorkerCount = 0
+	svc := NewJobQueueService(cfg, st, proc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	require.NoError(t, svc.Enqueue(job))
+
+	var running models.Job
+	require.Eventually(t, func() bool {
+		got, err := st.Get(job.ID)
+		running = got
+		return err == nil && got.Status == models.JobStatusRunning
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, "worker-test", running.LeaseOwner)
+
+	// Another replica recovered the job and holds it now
+	running.LeaseOwner = "other-worker"
+	require.NoError(t, st.Update(running))
+
+	select {
+	case err := <-cancelled:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("job was not cancelled after losing its lease")
+	}
+
+	require.Eventually(t, func() bool {
+		svc.runningMu.Lock()
+		defer svc.runningMu.Unlock()
+		return len(svc.running) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	got, err := st.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusRunning, got.Status)
+	require.Equal(t, "other-worker", got.LeaseOwner)
+}
+
+// sequentialIDs is a predictable IDGenerator
+type sequentialIDs struct {
+	n int
+}
+
+func (g *sequentialIDs) NewID(t time.Time) string {
+	g.n++
+	return fmt.Sprintf("test_%03d", g.n)
+}
+
+func TestNewJob_UsesIDGenerator(t *testing.T) {
+	SetIDGenerator(&sequentialIDs{})
+	defer SetIDGenerator(NewULIDGenerator())
+
+	first := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	second := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	require.Equal(t, "test_001", first.ID)
+	require.Equal(t, "test_002", second.ID)
+}
+
+func TestCleanJobs_DeletesAbortedAndInactiveJobs(t *testing.T) {
+	st := storage.NewInMemoryJobStorage()
+	stale := time.Now().Add(-JobCleanupAge - time.Hour).Unix()
+	jobs := map[string]models.JobStatus{
+		"aborted":       models.JobStatusAborted,
+		"stale-pending": models.JobStatusPending,
+		"stale-running": models.JobStatusRunning,
+		"stale-done":    models.JobStatusCompleted,
+		"fresh-pending": models.JobStatusPending,
+	}
+	for id, status := range jobs {
+		job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+		job.ID = id
+		job.Status = status
+		if id != "fresh-pending" {
+			job.CreatedAt = stale
+		}
+		require.NoError(t, st.Save(job))
+	}
+
+	svc := NewJobQueueService(config.JobConfig{QueueSize: 1}, st, processorFunc(nil), nil)
+	defer svc.Shutdown()
+	require.NoError(t, svc.cleanJobs(context.Background()))
+
+	left, err := st.GetAll()
+	require.NoError(t, err)
+	ids := []string{}
+	for _, job := range left {
+		ids = append(ids, job.ID)
+	}
+	require.ElementsMatch(t, []string{"stale-done", "fresh-pending"}, ids)
+}
+
+// eventTypes lists the type and status of events, e.g. "status:running"
+func eventTypes(events []models.JobEvent) []string {
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, string(e.Type)+":"+string(e.Status))
+	}
+	return types
+}
+
+func TestJobEvents_FollowJobLifecycle(t *testing.T) {
+	st := storage.NewInMemoryJobStorage()
+	attempts := 0
+	proc := processorFunc(func(ctx context.Context, req models.AnalyzeRequest) (models.AnalyzeResponse, error) {
+		attempts++
+		if attempts == 1 {
+			return models.AnalyzeResponse{}, &providers.ProviderError{Type: providers.RateLimitError, Message: "slow down"}
+		}
+		return models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "ok"}}}, nil
+	})
+
+	svc := NewJobQueueService(testJobConfig(), st, proc, nil)
+	defer svc.Shutdown()
+
+	job := NewJob(models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: "user"}))
+	_, events, cancel := svc.SubscribeEvents(job.ID, 0)
+	defer cancel()
+	require.NoError(t, svc.Enqueue(job))
+
+	var received []models.JobEvent
+	timeout := time.After(2 * time.Second)
+	for len(received) == 0 || !received[len(received)-1].IsFinal() {
+		select {
+		case e := <-events:
+			received = append(received, e)
+		case <-timeout:
+			t.Fatalf("no final event, got %v", eventTypes(received))
+		}
+	}
+
+	require.Equal(t, []string{
+		"status:pending",
+		"status:running",
+		"retry:",
+		"status:pending",
+		"status:running",
+		"status:completed",
+		"result:completed",
+	}, eventTypes(received))
+	require.Equal(t, 1, received[2].Retry)
+	require.NotNil(t, received[len(received)-1].Result)
+
+	// A late subscriber gets the whole history
+	history, _, cancelLate := svc.SubscribeEvents(job.ID, 0)
+	defer cancelLate()
+	require.Equal(t, received, history)
+}
@@ -0,0 +1,145 @@
+package jobservice
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/aiservice/internal/metrics"
+	"github.com/aiservice/internal/models"
+)
+
+// priorityLevels is the number of distinct models.JobPriority levels
+const priorityLevels = 3
+
+// scheduler is the in-memory queue between Enqueue and the workers. Jobs are
+// handed out by priority, and within a priority round-robin across users, so
+// one user queueing many boards does not delay everyone else. A user has at
+// most maxPerUser jobs handed out at once, further jobs wait even when
+// workers are idle.
+type scheduler struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	capacity   int
+	maxPerUser int // 0 means unlimited
+	size       int
+	levels     [priorityLevels]schedulerLevel
+	running    map[string]int // jobs handed out per user and not done yet
+	closed     bool
+}
+
+// schedulerLevel holds the queued jobs of one priority
+type schedulerLevel struct {
+	users []string                // users with queued jobs, in round-robin order
+	jobs  map[string][]models.Job // queued jobs per user, oldest first
+}
+
+func newScheduler(capacity, maxPerUser int) *scheduler {
+	s := &scheduler{
+		capacity:   capacity,
+		maxPerUser: maxPerUser,
+		running:    make(map[string]int),
+	}
+	for i := range s.levels {
+		s.levels[i].jobs = make(map[string][]models.Job)
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// push queues a job, failing with QueueFullErr when capacity jobs are queued
+// or the scheduler is closed
+func (s *scheduler) push(job models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.size >= s.capacity {
+		return QueueFullErr{}
+	}
+
+	level := &s.levels[job.Request.Priority().Level()]
+	if len(level.jobs[job.UserID]) == 0 {
+		level.users = append(level.users, job.UserID)
+	}
+	level.jobs[job.UserID] = append(level.jobs[job.UserID], job)
+	s.size++
+	metrics.QueueDepth.Inc()
+	s.cond.Broadcast()
+	return nil
+}
+
+// next blocks until a job may run and hands it out, the caller reports its
+// end with done. ok is false once the scheduler is closed and drained.
+func (s *scheduler) next() (job models.Job, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if job, ok := s.pop(); ok {
+			s.running[job.UserID]++
+			return job, true
+		}
+		if s.closed && s.size == 0 {
+			return models.Job{}, false
+		}
+		s.cond.Wait()
+	}
+}
+
+// pop removes the next job of the first user under the limit, taking the
+// highest priority first and moving that user to the back of its level
+func (s *scheduler) pop() (models.Job, bool) {
+	for p := priorityLevels - 1; p >= 0; p-- {
+		level := &s.levels[p]
+		for i, user := range level.users {
+			if s.maxPerUser > 0 && s.running[user] >= s.maxPerUser {
+				continue
+			}
+
+			queued := level.jobs[user]
+			job := queued[0]
+			level.users = slices.Delete(level.users, i, i+1)
+			if len(queued) == 1 {
+				delete(level.jobs, user)
+			} else {
+				level.jobs[user] = queued[1:]
+				level.users = append(level.users, user)
+			}
+			s.size--
+			metrics.QueueDepth.Dec()
+			return job, true
+		}
+	}
+	return models.Job{}, false
+}
+
+// done releases the slot of a job handed out by next
+func (s *scheduler) done(job models.Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[job.UserID]--; s.running[job.UserID] <= 0 {
+		delete(s.running, job.UserID)
+	}
+	s.cond.Broadcast()
+}
+
+// ids returns the IDs of the queued jobs
+func (s *scheduler) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, s.size)
+	for _, level := range s.levels {
+		for _, jobs := range level.jobs {
+			for _, job := range jobs {
+				ids = append(ids, job.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// close rejects further jobs, next keeps handing out the queued ones
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+}
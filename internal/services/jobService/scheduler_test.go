@@ -0,0 +1,99 @@
+package jobservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// scheduledJob creates a queued job of user with the given priority
+func scheduledJob(id, user string, priority models.JobPriority) models.Job {
+	req := models.NewSumAnalyzeReq(models.SummarizeRequest{UserID: user, Priority: priority})
+	return models.Job{ID: id, UserID: user, Request: req, Status: models.JobStatusPending}
+}
+
+// nextIDs takes n jobs from the scheduler, marking each done right away
+func nextIDs(t *testing.T, s *scheduler, n int) []string {
+	var ids []string
+	for range n {
+		job, ok := s.next()
+		require.True(t, ok)
+		s.done(job)
+		ids = append(ids, job.ID)
+	}
+	return ids
+}
+
+func TestScheduler_RoundRobinAcrossUsers(t *testing.T) {
+	s := newScheduler(10, 0)
+	for _, id := range []string{"a1", "a2", "a3", "a4"} {
+		require.NoError(t, s.push(scheduledJob(id, "alice", "")))
+	}
+	require.NoError(t, s.push(scheduledJob("b1", "bob", "")))
+	require.NoError(t, s.push(scheduledJob("b2", "bob", "")))
+
+	require.Equal(t, []string{"a1", "b1", "a2", "b2", "a3", "a4"}, nextIDs(t, s, 6))
+}
+
+func TestScheduler_HigherPriorityFirst(t *testing.T) {
+	s := newScheduler(10, 0)
+	require.NoError(t, s.push(scheduledJob("low", "alice", models.JobPriorityLow)))
+	require.NoError(t, s.push(scheduledJob("normal", "alice", models.JobPriorityNormal)))
+	require.NoError(t, s.push(scheduledJob("default", "bob", "")))
+	require.NoError(t, s.push(scheduledJob("high", "carol", models.JobPriorityHigh)))
+
+	require.Equal(t, []string{"high", "normal", "default", "low"}, nextIDs(t, s, 4))
+}
+
+func TestScheduler_PerUserLimit(t *testing.T) {
+	s := newScheduler(10, 1)
+	require.NoError(t, s.push(scheduledJob("a1", "alice", models.JobPriorityHigh)))
+	require.NoError(t, s.push(scheduledJob("a2", "alice", models.JobPriorityHigh)))
+	require.NoError(t, s.push(scheduledJob("b1", "bob", models.JobPriorityLow)))
+
+	first, ok := s.next()
+	require.True(t, ok)
+	require.Equal(t, "a1", first.ID)
+
+	// alice is at her limit, bob's lower priority job goes ahead
+	second, ok := s.next()
+	require.True(t, ok)
+	require.Equal(t, "b1", second.ID)
+
+	// Nothing may run until alice's job is done
+	got := make(chan models.Job, 1)
+	go func() {
+		job, _ := s.next()
+		got <- job
+	}()
+	select {
+	case job := <-got:
+		t.Fatalf("job %s handed out above the per-user limit", job.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.done(first)
+	select {
+	case job := <-got:
+		require.Equal(t, "a2", job.ID)
+	case <-time.After(time.Second):
+		t.Fatal("job not handed out after the running one was done")
+	}
+}
+
+func TestScheduler_CapacityAndClose(t *testing.T) {
+	s := newScheduler(2, 0)
+	require.NoError(t, s.push(scheduledJob("a1", "alice", "")))
+	require.NoError(t, s.push(scheduledJob("b1", "bob", "")))
+	require.ErrorAs(t, s.push(scheduledJob("c1", "carol", "")), &QueueFullErr{})
+
+	// Queued jobs are still handed out after close, new ones are rejected
+	s.close()
+	require.ErrorAs(t, s.push(scheduledJob("c1", "carol", "")), &QueueFullErr{})
+	require.Equal(t, []string{"a1", "b1"}, nextIDs(t, s, 2))
+
+	_, ok := s.next()
+	require.False(t, ok)
+}
@@ -6,16 +6,28 @@ import (
 	"fmt"
 
 	"github.com/aiservice/internal/models"
+	"github.com/aiservice/internal/tracing"
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/aiservice/internal/providers"
 )
 
+var tracer = otel.Tracer("github.com/aiservice/internal/services/pipeline")
+
 type PipelineState struct {
 	AnalyzeRequest  models.AnalyzeRequest
+	Parts           []*ai.Part // LLM prompt built by the preprocessing step
 	AnalyzeResponse models.AnalyzeResponse
 }
 
-type Step func(ctx context.Context, state *PipelineState) error
+// Step is one stage of a pipeline, Execute traces each step in a span named after it
+type Step struct {
+	Name string
+	Run  func(ctx context.Context, state *PipelineState) error
+}
 
 type Pipeline struct {
 	steps []Step
@@ -27,19 +39,27 @@ func NewPipeline(steps ...Step) *Pipeline {
 
 func (p *Pipeline) Execute(ctx context.Context, state *PipelineState) error {
 	for _, step := range p.steps {
-		if err := step(ctx, state); err != nil {
+		if err := p.run(ctx, step, state); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (p *Pipeline) run(ctx context.Context, step Step, state *PipelineState) error {
+	ctx, span := tracer.Start(ctx, "pipeline."+step.Name,
+		trace.WithAttributes(attribute.String("request.type", state.AnalyzeRequest.RequestType)))
+	err := step.Run(ctx, state)
+	tracing.End(span, err)
+	return err
+}
+
 func BuildPipeline(t string, llm providers.LLMClient) (*Pipeline, error) {
 	switch t {
 	case models.SummarizeType:
-		return NewPipeline(newSummarizeStep(llm)), nil
+		return NewPipeline(newPreprocessStep(), newSummarizeStep(llm)), nil
 	case models.StructurizeType:
-		return NewPipeline(newStructurizeStep(llm)), nil
+		return NewPipeline(newPreprocessStep(), newStructurizeStep(llm)), nil
 	default:
 		return nil, fmt.Errorf("unsupported input type: %s", t)
 	}
@@ -2,37 +2,42 @@ package pipeline
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/aiservice/internal/models"
 	"github.com/aiservice/internal/preprocessing"
 	"github.com/aiservice/internal/providers"
-	"github.com/firebase/genkit/go/ai"
 )
 
 // Preprocessor for transforming raw data into structured formats
 var preprocessor = preprocessing.NewPreprocessor()
 
-func newLlmSummarizeParts(req models.SummarizeRequest) ([]*ai.Part, error) {
-	return preprocessor.PreprocessSummarizeRequest(req)
-}
-
-func newLlmStructurizeParts(req models.StructurizeRequest) ([]*ai.Part, error) {
-	return preprocessor.PreprocessStructurizeRequest(req)
+// newPreprocessStep builds the LLM prompt of the request
+func newPreprocessStep() Step {
+	return Step{Name: "preprocess", Run: func(ctx context.Context, state *PipelineState) error {
+		req := state.AnalyzeRequest
+		var err error
+		switch req.RequestType {
+		case models.SummarizeType:
+			state.Parts, err = preprocessor.PreprocessSummarizeRequest(ctx, req.SummarizeRequest)
+		case models.StructurizeType:
+			state.Parts, err = preprocessor.PreprocessStructurizeRequest(ctx, req.StructurizeRequest)
+		default:
+			err = fmt.Errorf("unsupported input type: %s", req.RequestType)
+		}
+		return err
+	}}
 }
 
 func newSummarizeStep(llm providers.LLMClient) Step {
-	return func(ctx context.Context, state *PipelineState) error {
-		parts, err := newLlmSummarizeParts(state.AnalyzeRequest.SummarizeRequest)
-		if err != nil {
-			return err
-		}
-		resp, err := llm.Summarize(ctx, parts)
+	return Step{Name: models.SummarizeType, Run: func(ctx context.Context, state *PipelineState) error {
+		resp, err := llm.Summarize(ctx, state.Parts)
 		if err != nil {
 			return err
 		}
 		state.AnalyzeResponse.SummarizeResponse = fillSumRespWithMeta(resp, state)
 		return nil
-	}
+	}}
 }
 
 func fillSumRespWithMeta(aiResp models.SummarizeResponse, state *PipelineState) models.SummarizeResponse {
@@ -41,22 +46,19 @@ func fillSumRespWithMeta(aiResp models.SummarizeResponse, state *PipelineState)
 		UserID:      state.AnalyzeRequest.SummarizeRequest.UserID,
 		RequestType: models.SummarizeType,
 		Element:     aiResp.Element,
+		Provider:    aiResp.Provider,
 	}
 }
 
 func newStructurizeStep(llm providers.LLMClient) Step {
-	return func(ctx context.Context, state *PipelineState) error {
-		parts, err := newLlmStructurizeParts(state.AnalyzeRequest.StructurizeRequest)
-		if err != nil {
-			return err
-		}
-		resp, err := llm.Structurize(ctx, parts)
+	return Step{Name: models.StructurizeType, Run: func(ctx context.Context, state *PipelineState) error {
+		resp, err := llm.Structurize(ctx, state.Parts)
 		if err != nil {
 			return err
 		}
 		state.AnalyzeResponse.StructurizeResponse = fillStructRespWithMeta(resp, state)
 		return nil
-	}
+	}}
 }
 
 func fillStructRespWithMeta(aiResp models.StructurizeResponse, state *PipelineState) models.StructurizeResponse {
@@ -66,5 +68,6 @@ func fillStructRespWithMeta(aiResp models.StructurizeResponse, state *PipelineSt
 		RequestType:    models.StructurizeType,
 		AiTreeResponse: aiResp.AiTreeResponse,
 		File:           aiResp.File,
+		Provider:       aiResp.Provider,
 	}
 }
@@ -0,0 +1,299 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+)
+
+const (
+	// concurrencyRetryAfter is suggested to clients over their concurrent jobs quota
+	concurrencyRetryAfter = 10 * time.Second
+	// usageRetention is how long daily usage stays queryable
+	usageRetention = 7 * 24 * time.Hour
+	// cleanupInterval is how often expired counters are deleted
+	cleanupInterval = 5 * time.Minute
+)
+
+// Store persists quota limits and usage counters in the job database
+type Store interface {
+	// GetQuotaLimits returns the custom limits of a subject, ok is false when it has none
+	GetQuotaLimits(ctx context.Context, subject models.QuotaSubject) (limits models.QuotaLimits, ok bool, err error)
+	ListQuotaLimits(ctx context.Context) ([]models.QuotaLimits, error)
+	SaveQuotaLimits(ctx context.Context, limits models.QuotaLimits) error
+	DeleteQuotaLimits(ctx context.Context, subject models.QuotaSubject) error
+	// CountQuotaRequest counts a request in the minute starting at window
+	// unless limit requests were counted there already, 0 meaning no limit
+	CountQuotaRequest(ctx context.Context, subject models.QuotaSubject, window int64, limit int) (ok bool, err error)
+	// AcquireQuotaSlot holds a concurrent job slot for jobID unless limit
+	// slots of the subject are live at now, 0 meaning no limit. A slot is live
+	// until expiresAt and for as long as its job is pending or running.
+	AcquireQuotaSlot(ctx context.Context, subject models.QuotaSubject, jobID string, limit int, now, expiresAt int64) (ok bool, err error)
+	// ReleaseQuotaSlots frees the slots held for jobID
+	ReleaseQuotaSlots(ctx context.Context, jobID string) error
+	// AddQuotaUsage adds LLM usage to the day starting at day
+	AddQuotaUsage(ctx context.Context, subject models.QuotaSubject, day int64, tokens int64, cost float64) error
+	GetQuotaUsage(ctx context.Context, subject models.QuotaSubject, window, day, now int64) (models.QuotaUsage, error)
+	// DeleteExpiredQuota deletes request counters of windows before window,
+	// usage of days before day and slots no longer live at now
+	DeleteExpiredQuota(ctx context.Context, window, day, now int64) error
+}
+
+// ErrInvalidLimits rejects limits set through the admin API
+var ErrInvalidLimits = errors.New("invalid quota limits")
+
+// ExceededError rejects a request over one of the quotas of its user or tenant
+type ExceededError struct {
+	Subject    models.QuotaSubject
+	Limit      string // the exceeded limit, named as in models.QuotaLimits
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	// Whole seconds, rounded up like the Retry-After header
+	retryAfter := (e.RetryAfter + time.Second - 1).Truncate(time.Second)
+	return fmt.Sprintf("%s %s exceeded its %s quota, retry in %s", e.Subject.Scope, e.Subject.ID, e.Limit, retryAfter)
+}
+
+// Service enforces per-user and per-tenant quotas. Limits default to the
+// configuration and can be overridden per subject through the admin API.
+type Service struct {
+	store Store
+	cfg   config.QuotaConfig
+	now   func() time.Time
+}
+
+func NewService(cfg config.QuotaConfig, store Store) *Service {
+	return &Service{
+		store: store,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// AllowRequest counts a request of the user and tenant against their
+// requests per minute, tenantID may be empty
+func (s *Service) AllowRequest(ctx context.Context, userID, tenantID string) error {
+	now := s.now().UTC()
+	window := now.Truncate(time.Minute)
+
+	for _, subject := range subjects(userID, tenantID) {
+		limits, _, err := s.Limits(ctx, subject)
+		if err != nil {
+			return err
+		}
+		ok, err := s.store.CountQuotaRequest(ctx, subject, window.Unix(), limits.RequestsPerMinute)
+		if err != nil {
+			return fmt.Errorf("failed to count request: %w", err)
+		}
+		if !ok {
+			return &ExceededError{Subject: subject, Limit: "requestsPerMinute", RetryAfter: window.Add(time.Minute).Sub(now)}
+		}
+	}
+	return nil
+}
+
+// Admit checks the daily budgets of the user and tenant and holds a
+// concurrent job slot for jobID. The slot lasts for hold, or as long as the
+// job is pending or running once it is stored, unless Release frees it.
+func (s *Service) Admit(ctx context.Context, userID, tenantID, jobID string, hold time.Duration) error {
+	now := s.now().UTC()
+	day := startOfDay(now)
+
+	for _, subject := range subjects(userID, tenantID) {
+		limits, _, err := s.Limits(ctx, subject)
+		if err != nil {
+			s.Release(ctx, jobID)
+			return err
+		}
+
+		if limits.DailyTokens > 0 || limits.DailyCost > 0 {
+			usage, err := s.store.GetQuotaUsage(ctx, subject, now.Truncate(time.Minute).Unix(), day.Unix(), now.Unix())
+			if err != nil {
+				s.Release(ctx, jobID)
+				return fmt.Errorf("failed to get quota usage: %w", err)
+			}
+			exceeded := ""
+			switch {
+			case limits.DailyTokens > 0 && usage.TokensToday >= limits.DailyTokens:
+				exceeded = "dailyTokens"
+			case limits.DailyCost > 0 && usage.CostToday >= limits.DailyCost:
+				exceeded = "dailyCost"
+			}
+			if exceeded != "" {
+				s.Release(ctx, jobID)
+				return &ExceededError{Subject: subject, Limit: exceeded, RetryAfter: day.Add(24 * time.Hour).Sub(now)}
+			}
+		}
+
+		// Slots are held even without a limit so the usage shows concurrent jobs
+		ok, err := s.store.AcquireQuotaSlot(ctx, subject, jobID, limits.ConcurrentJobs, now.Unix(), now.Add(hold).Unix())
+		if err != nil {
+			s.Release(ctx, jobID)
+			return fmt.Errorf("failed to acquire concurrent job slot: %w", err)
+		}
+		if !ok {
+			s.Release(ctx, jobID)
+			return &ExceededError{Subject: subject, Limit: "concurrentJobs", RetryAfter: concurrencyRetryAfter}
+		}
+	}
+	return nil
+}
+
+// HandOver makes the slots Admit held for jobID last exactly as long as its
+// stored job is pending or running, instead of the hold given to Admit
+func (s *Service) HandOver(ctx context.Context, userID, tenantID, jobID string) {
+	now := s.now().Unix()
+	for _, subject := range subjects(userID, tenantID) {
+		// Without a limit the slot is only refreshed, expiring right away
+		if _, err := s.store.AcquireQuotaSlot(context.WithoutCancel(ctx), subject, jobID, 0, now, now); err != nil {
+			slog.Error("failed to hand concurrent job slot over", "jobID", jobID, "err", err)
+		}
+	}
+}
+
+// Release frees the concurrent job slots held for jobID
+func (s *Service) Release(ctx context.Context, jobID string) {
+	// The slots must be freed even when the request was cancelled
+	if err := s.store.ReleaseQuotaSlots(context.WithoutCancel(ctx), jobID); err != nil {
+		slog.Error("failed to release concurrent job slots", "jobID", jobID, "err", err)
+	}
+}
+
+// RecordUsage adds the tokens an LLM call of provider consumed to the daily
+// usage of the user and tenant, priced with the configured token prices
+func (s *Service) RecordUsage(ctx context.Context, userID, tenantID, provider string, tokens int64) {
+	price, ok := s.cfg.TokenPrices[provider]
+	if !ok {
+		price = s.cfg.DefaultTokenPrice
+	}
+	cost := float64(tokens) / 1000 * price
+	day := startOfDay(s.now().UTC()).Unix()
+
+	for _, subject := range subjects(userID, tenantID) {
+		if err := s.store.AddQuotaUsage(context.WithoutCancel(ctx), subject, day, tokens, cost); err != nil {
+			slog.Error("failed to record quota usage", "scope", subject.Scope, "subject", subject.ID, "err", err)
+		}
+	}
+}
+
+// Limits returns the limits of a subject, custom is false when the configured defaults apply
+func (s *Service) Limits(ctx context.Context, subject models.QuotaSubject) (limits models.QuotaLimits, custom bool, err error) {
+	limits, ok, err := s.store.GetQuotaLimits(ctx, subject)
+	if err != nil {
+		return models.QuotaLimits{}, false, fmt.Errorf("failed to get quota limits: %w", err)
+	}
+	if ok {
+		return limits, true, nil
+	}
+
+	defaults := s.cfg.User
+	if subject.Scope == models.QuotaScopeTenant {
+		defaults = s.cfg.Tenant
+	}
+	return models.QuotaLimits{
+		Scope:             subject.Scope,
+		SubjectID:         subject.ID,
+		RequestsPerMinute: defaults.RequestsPerMinute,
+		ConcurrentJobs:    defaults.ConcurrentJobs,
+		DailyTokens:       defaults.DailyTokens,
+		DailyCost:         defaults.DailyCost,
+	}, false, nil
+}
+
+// Status returns the limits of a subject along with its current usage
+func (s *Service) Status(ctx context.Context, subject models.QuotaSubject) (models.QuotaStatus, error) {
+	limits, custom, err := s.Limits(ctx, subject)
+	if err != nil {
+		return models.QuotaStatus{}, err
+	}
+
+	now := s.now().UTC()
+	usage, err := s.store.GetQuotaUsage(ctx, subject, now.Truncate(time.Minute).Unix(), startOfDay(now).Unix(), now.Unix())
+	if err != nil {
+		return models.QuotaStatus{}, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	return models.QuotaStatus{Limits: limits, Custom: custom, Usage: usage}, nil
+}
+
+// ListLimits returns every subject with custom limits
+func (s *Service) ListLimits(ctx context.Context) ([]models.QuotaLimits, error) {
+	limits, err := s.store.ListQuotaLimits(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quota limits: %w", err)
+	}
+	return limits, nil
+}
+
+// SetLimits stores custom limits replacing the defaults of their subject
+func (s *Service) SetLimits(ctx context.Context, limits models.QuotaLimits) (models.QuotaLimits, error) {
+	if err := validateLimits(limits); err != nil {
+		return models.QuotaLimits{}, err
+	}
+	limits.UpdatedAt = s.now().Unix()
+	if err := s.store.SaveQuotaLimits(ctx, limits); err != nil {
+		return models.QuotaLimits{}, fmt.Errorf("failed to save quota limits: %w", err)
+	}
+	return limits, nil
+}
+
+// ResetLimits deletes the custom limits of a subject, restoring the defaults
+func (s *Service) ResetLimits(ctx context.Context, subject models.QuotaSubject) error {
+	if err := s.store.DeleteQuotaLimits(ctx, subject); err != nil {
+		return fmt.Errorf("failed to delete quota limits: %w", err)
+	}
+	return nil
+}
+
+// Run deletes expired counters periodically until ctx is done
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := s.now().UTC()
+			window := now.Truncate(time.Minute).Unix()
+			day := startOfDay(now.Add(-usageRetention)).Unix()
+			if err := s.store.DeleteExpiredQuota(ctx, window, day, now.Unix()); err != nil {
+				slog.Error("failed to delete expired quota counters", "err", err)
+			}
+		}
+	}
+}
+
+// validateLimits checks limits received through the admin API
+func validateLimits(limits models.QuotaLimits) error {
+	if !limits.Scope.Valid() {
+		return fmt.Errorf("%w: unknown scope %q, expected user or tenant", ErrInvalidLimits, limits.Scope)
+	}
+	if strings.TrimSpace(limits.SubjectID) == "" {
+		return fmt.Errorf("%w: subjectId is empty", ErrInvalidLimits)
+	}
+	if limits.RequestsPerMinute < 0 || limits.ConcurrentJobs < 0 || limits.DailyTokens < 0 || limits.DailyCost < 0 {
+		return fmt.Errorf("%w: limits must be non-negative, 0 meaning unlimited", ErrInvalidLimits)
+	}
+	return nil
+}
+
+// subjects lists who a request is counted for, the tenant only when known
+func subjects(userID, tenantID string) []models.QuotaSubject {
+	list := []models.QuotaSubject{{Scope: models.QuotaScopeUser, ID: userID}}
+	if tenantID != "" {
+		list = append(list, models.QuotaSubject{Scope: models.QuotaScopeTenant, ID: tenantID})
+	}
+	return list
+}
+
+// startOfDay returns the UTC midnight daily budgets reset at
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
@@ -0,0 +1,233 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aiservice/internal/config"
+	"github.com/aiservice/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore keeps quotas in maps, slots only expire by time since it knows no jobs
+type fakeStore struct {
+	limits   map[models.QuotaSubject]models.QuotaLimits
+	requests map[models.QuotaSubject]map[int64]int
+	slots    map[models.QuotaSubject]map[string]int64
+	tokens   map[models.QuotaSubject]int64
+	cost     map[models.QuotaSubject]float64
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		limits:   make(map[models.QuotaSubject]models.QuotaLimits),
+		requests: make(map[models.QuotaSubject]map[int64]int),
+		slots:    make(map[models.QuotaSubject]map[string]int64),
+		tokens:   make(map[models.QuotaSubject]int64),
+		cost:     make(map[models.QuotaSubject]float64),
+	}
+}
+
+func (f *fakeStore) GetQuotaLimits(_ context.Context, subject models.QuotaSubject) (models.QuotaLimits, bool, error) {
+	limits, ok := f.limits[subject]
+	return limits, ok, nil
+}
+
+func (f *fakeStore) ListQuotaLimits(_ context.Context) ([]models.QuotaLimits, error) {
+	var list []models.QuotaLimits
+	for _, limits := range f.limits {
+		list = append(list, limits)
+	}
+	return list, nil
+}
+
+func (f *fakeStore) SaveQuotaLimits(_ context.Context, limits models.QuotaLimits) error {
+	f.limits[limits.Subject()] = limits
+	return nil
+}
+
+func (f *fakeStore) DeleteQuotaLimits(_ context.Context, subject models.QuotaSubject) error {
+	delete(f.limits, subject)
+	return nil
+}
+
+func (f *fakeStore) CountQuotaRequest(_ context.Context, subject models.QuotaSubject, window int64, limit int) (bool, error) {
+	if f.requests[subject] == nil {
+		f.requests[subject] = make(map[int64]int)
+	}
+	if limit > 0 && f.requests[subject][window] >= limit {
+		return false, nil
+	}
+	f.requests[subject][window]++
+	return true, nil
+}
+
+func (f *fakeStore) liveSlots(subject models.QuotaSubject, now int64) int {
+	n := 0
+	for _, expiresAt := range f.slots[subject] {
+		if expiresAt > now {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeStore) AcquireQuotaSlot(_ context.Context, subject models.QuotaSubject, jobID string, limit int, now, expiresAt int64) (bool, error) {
+	if limit > 0 && f.liveSlots(subject, now) >= limit {
+		return false, nil
+	}
+	if f.slots[subject] == nil {
+		f.slots[subject] = make(map[string]int64)
+	}
+	f.slots[subject][jobID] = expiresAt
+	return true, nil
+}
+
+func (f *fakeStore) ReleaseQuotaSlots(_ context.Context, jobID string) error {
+	for _, slots := range f.slots {
+		delete(slots, jobID)
+	}
+	return nil
+}
+
+func (f *fakeStore) AddQuotaUsage(_ context.Context, subject models.QuotaSubject, day int64, tokens int64, cost float64) error {
+	f.tokens[subject] += tokens
+	f.cost[subject] += cost
+	return nil
+}
+
+func (f *fakeStore) GetQuotaUsage(_ context.Context, subject models.QuotaSubject, window, day, now int64) (models.QuotaUsage, error) {
+	return models.QuotaUsage{
+		RequestsThisMinute: f.requests[subject][window],
+		ConcurrentJobs:     f.liveSlots(subject, now),
+		TokensToday:        f.tokens[subject],
+		CostToday:          f.cost[subject],
+	}, nil
+}
+
+func (f *fakeStore) DeleteExpiredQuota(_ context.Context, window, day, now int64) error {
+	return nil
+}
+
+// newTestService returns a service over a fake store whose clock starts at 10:00:30 UTC
+func newTestService(cfg config.QuotaConfig) (*Service, *fakeStore, *time.Time) {
+	store := newFakeStore()
+	s := NewService(cfg, store)
+	now := time.Date(2026, 1, 2, 10, 0, 30, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, store, &now
+}
+
+func TestService_AllowRequest(t *testing.T) {
+	ctx := context.Background()
+	s, _, now := newTestService(config.QuotaConfig{
+		User:   config.QuotaLimitsConfig{RequestsPerMinute: 2},
+		Tenant: config.QuotaLimitsConfig{RequestsPerMinute: 3},
+	})
+
+	require.NoError(t, s.AllowRequest(ctx, "alice", "acme"))
+	require.NoError(t, s.AllowRequest(ctx, "alice", "acme"))
+
+	var exceeded *ExceededError
+	require.ErrorAs(t, s.AllowRequest(ctx, "alice", "acme"), &exceeded)
+	require.Equal(t, models.QuotaSubject{Scope: models.QuotaScopeUser, ID: "alice"}, exceeded.Subject)
+	require.Equal(t, "requestsPerMinute", exceeded.Limit)
+	require.Equal(t, 30*time.Second, exceeded.RetryAfter, "the window resets at the next minute")
+
+	// bob's user quota is separate, the tenant's is shared
+	require.NoError(t, s.AllowRequest(ctx, "bob", "acme"))
+	require.ErrorAs(t, s.AllowRequest(ctx, "bob", "acme"), &exceeded)
+	require.Equal(t, models.QuotaScopeTenant, exceeded.Subject.Scope)
+
+	*now = now.Add(time.Minute)
+	require.NoError(t, s.AllowRequest(ctx, "alice", "acme"))
+}
+
+func TestService_AdmitConcurrentJobs(t *testing.T) {
+	ctx := context.Background()
+	s, _, now := newTestService(config.QuotaConfig{User: config.QuotaLimitsConfig{ConcurrentJobs: 1}})
+
+	require.NoError(t, s.Admit(ctx, "alice", "", "job-1", time.Minute))
+
+	var exceeded *ExceededError
+	require.ErrorAs(t, s.Admit(ctx, "alice", "", "job-2", time.Minute), &exceeded)
+	require.Equal(t, "concurrentJobs", exceeded.Limit)
+	require.NoError(t, s.Admit(ctx, "bob", "", "job-3", time.Minute))
+
+	// A released slot is free right away, a forgotten one once its hold expires
+	s.Release(ctx, "job-1")
+	require.NoError(t, s.Admit(ctx, "alice", "", "job-2", time.Minute))
+	*now = now.Add(time.Minute)
+	require.NoError(t, s.Admit(ctx, "alice", "", "job-4", time.Minute))
+}
+
+func TestService_AdmitRejectsWholeRequest(t *testing.T) {
+	ctx := context.Background()
+	s, store, _ := newTestService(config.QuotaConfig{Tenant: config.QuotaLimitsConfig{ConcurrentJobs: 1}})
+
+	require.NoError(t, s.Admit(ctx, "alice", "acme", "job-1", time.Minute))
+	require.Error(t, s.Admit(ctx, "bob", "acme", "job-2", time.Minute))
+
+	// bob's user slot taken before the tenant rejected the job is given back
+	require.Zero(t, store.liveSlots(models.QuotaSubject{Scope: models.QuotaScopeUser, ID: "bob"}, 0))
+}
+
+func TestService_DailyBudgets(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestService(config.QuotaConfig{
+		User:              config.QuotaLimitsConfig{DailyTokens: 1000},
+		Tenant:            config.QuotaLimitsConfig{DailyCost: 1},
+		TokenPrices:       map[string]float64{"gemini": 2},
+		DefaultTokenPrice: 0.5,
+	})
+
+	s.RecordUsage(ctx, "alice", "acme", "gemini", 400)
+	s.RecordUsage(ctx, "alice", "acme", "unknown", 600)
+
+	status, err := s.Status(ctx, models.QuotaSubject{Scope: models.QuotaScopeTenant, ID: "acme"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), status.Usage.TokensToday)
+	require.InDelta(t, 0.8+0.3, status.Usage.CostToday, 1e-9)
+
+	var exceeded *ExceededError
+	require.ErrorAs(t, s.Admit(ctx, "alice", "acme", "job-1", time.Minute), &exceeded)
+	require.Equal(t, "dailyTokens", exceeded.Limit)
+	require.Equal(t, 14*time.Hour-30*time.Second, exceeded.RetryAfter, "budgets reset at UTC midnight")
+
+	// Another user of the tenant is still over the tenant's cost budget
+	require.ErrorAs(t, s.Admit(ctx, "bob", "acme", "job-2", time.Minute), &exceeded)
+	require.Equal(t, "dailyCost", exceeded.Limit)
+	require.NoError(t, s.Admit(ctx, "bob", "", "job-3", time.Minute))
+}
+
+func TestService_CustomLimits(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestService(config.QuotaConfig{User: config.QuotaLimitsConfig{RequestsPerMinute: 1}})
+	alice := models.QuotaSubject{Scope: models.QuotaScopeUser, ID: "alice"}
+
+	limits, custom, err := s.Limits(ctx, alice)
+	require.NoError(t, err)
+	require.False(t, custom)
+	require.Equal(t, 1, limits.RequestsPerMinute)
+
+	_, err = s.SetLimits(ctx, models.QuotaLimits{Scope: "team", SubjectID: "alice"})
+	require.ErrorIs(t, err, ErrInvalidLimits)
+	_, err = s.SetLimits(ctx, models.QuotaLimits{Scope: models.QuotaScopeUser, SubjectID: "alice", ConcurrentJobs: -1})
+	require.ErrorIs(t, err, ErrInvalidLimits)
+
+	saved, err := s.SetLimits(ctx, models.QuotaLimits{Scope: models.QuotaScopeUser, SubjectID: "alice", RequestsPerMinute: 0})
+	require.NoError(t, err)
+	require.NotZero(t, saved.UpdatedAt)
+
+	// A zero custom limit lifts the default one
+	for range 5 {
+		require.NoError(t, s.AllowRequest(ctx, "alice", ""))
+	}
+
+	require.NoError(t, s.ResetLimits(ctx, alice))
+	_, custom, err = s.Limits(ctx, alice)
+	require.NoError(t, err)
+	require.False(t, custom)
+	require.Error(t, s.AllowRequest(ctx, "alice", ""))
+}
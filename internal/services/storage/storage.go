@@ -3,19 +3,58 @@ package storage
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/aiservice/internal/models"
 )
 
 type InMemoryJobStorage struct {
-	jobs map[string]models.Job
-	mu   sync.RWMutex
+	jobs            map[string]models.Job
+	batches         map[string]models.Batch
+	deliveries      map[string][]models.CallbackDelivery
+	nextDeliveryID  int64
+	idempotencyKeys map[idempotencyKey]models.IdempotencyRecord
+	quotaLimits     map[models.QuotaSubject]models.QuotaLimits
+	quotaRequests   map[quotaWindow]int
+	quotaUsage      map[quotaWindow]quotaUsage
+	quotaSlots      map[quotaSlot]int64 // expiry of each slot
+	mu              sync.RWMutex
+}
+
+// idempotencyKey scopes an Idempotency-Key to its user
+type idempotencyKey struct {
+	userID string
+	key    string
+}
+
+// quotaWindow is the counter of a quota subject in the window or day starting at start
+type quotaWindow struct {
+	subject models.QuotaSubject
+	start   int64
+}
+
+type quotaUsage struct {
+	tokens int64
+	cost   float64
+}
+
+// quotaSlot is a concurrent job slot of a quota subject
+type quotaSlot struct {
+	jobID   string
+	subject models.QuotaSubject
 }
 
 func NewInMemoryJobStorage() *InMemoryJobStorage {
 	return &InMemoryJobStorage{
-		jobs: make(map[string]models.Job),
+		jobs:            make(map[string]models.Job),
+		batches:         make(map[string]models.Batch),
+		deliveries:      make(map[string][]models.CallbackDelivery),
+		idempotencyKeys: make(map[idempotencyKey]models.IdempotencyRecord),
+		quotaLimits:     make(map[models.QuotaSubject]models.QuotaLimits),
+		quotaRequests:   make(map[quotaWindow]int),
+		quotaUsage:      make(map[quotaWindow]quotaUsage),
+		quotaSlots:      make(map[quotaSlot]int64),
 	}
 }
 
@@ -32,7 +71,7 @@ func (s *InMemoryJobStorage) Get(id string) (models.Job, error) {
 	if job, ok := s.jobs[id]; ok {
 		return job, nil
 	}
-	return models.Job{}, fmt.Errorf("job not found")
+	return models.Job{}, models.ErrJobNotFound
 }
 
 func (s *InMemoryJobStorage) Update(job models.Job) error {
@@ -47,9 +86,14 @@ func (s *InMemoryJobStorage) Abort(ctx context.Context, id string) error {
 	defer s.mu.Unlock()
 	job, ok := s.jobs[id]
 	if !ok {
-		return fmt.Errorf("job not found")
+		return models.ErrJobNotFound
+	}
+	if job.Status != models.JobStatusPending && job.Status != models.JobStatusRunning {
+		return models.ErrJobNotAbortable
 	}
 	job.Status = models.JobStatusAborted
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = 0
 	s.jobs[id] = job
 	return nil
 }
@@ -64,15 +108,368 @@ func (s *InMemoryJobStorage) GetAll() ([]models.Job, error) {
 	return jobs, nil
 }
 
+func (s *InMemoryJobStorage) Query(ctx context.Context, filter models.JobFilter) (models.JobPage, error) {
+	filter = filter.Normalize()
+
+	var cursor *models.JobCursor
+	if filter.Cursor != "" {
+		c, err := models.DecodeJobCursor(filter.Cursor)
+		if err != nil {
+			return models.JobPage{}, err
+		}
+		cursor = &c
+	}
+
+	s.mu.RLock()
+	matched := make([]models.Job, 0)
+	for _, job := range s.jobs {
+		if !filter.Matches(job) {
+			continue
+		}
+		if cursor != nil && !cursor.After(job, filter.Order) {
+			continue
+		}
+		matched = append(matched, job)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		less := a.CreatedAt < b.CreatedAt || (a.CreatedAt == b.CreatedAt && a.ID < b.ID)
+		if filter.Order == models.SortAsc {
+			return less
+		}
+		return !less
+	})
+
+	page := models.JobPage{Jobs: matched}
+	if len(matched) > filter.Limit {
+		page.Jobs = matched[:filter.Limit]
+		page.NextCursor = models.EncodeJobCursor(page.Jobs[filter.Limit-1])
+	}
+	return page, nil
+}
+
+func (s *InMemoryJobStorage) Claim(ctx context.Context, id string, lease models.Lease) (models.Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != models.JobStatusPending {
+		return models.Job{}, false, nil
+	}
+	job.Status = models.JobStatusRunning
+	job.LeaseOwner = lease.Owner
+	job.LeaseExpiresAt = lease.ExpiresAt
+	s.jobs[id] = job
+	return job, true, nil
+}
+
+func (s *InMemoryJobStorage) ClaimPending(ctx context.Context, limit int, now int64, lease models.Lease) ([]models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := make([]models.Job, 0)
+	for _, job := range s.jobs {
+		if job.Status == models.JobStatusPending && job.NextRetryAt <= now && job.LeaseExpiresAt < now {
+			pending = append(pending, job)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		a, b := pending[i], pending[j]
+		return a.CreatedAt < b.CreatedAt || (a.CreatedAt == b.CreatedAt && a.ID < b.ID)
+	})
+	if len(pending) > limit {
+		pending = pending[:max(limit, 0)]
+	}
+	for i := range pending {
+		pending[i].Status = models.JobStatusRunning
+		pending[i].LeaseOwner = lease.Owner
+		pending[i].LeaseExpiresAt = lease.ExpiresAt
+		s.jobs[pending[i].ID] = pending[i]
+	}
+	return pending, nil
+}
+
+func (s *InMemoryJobStorage) HoldPending(ctx context.Context, ids []string, lease models.Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		job, ok := s.jobs[id]
+		if !ok || job.Status != models.JobStatusPending || job.LeaseOwner != lease.Owner {
+			continue
+		}
+		job.LeaseExpiresAt = lease.ExpiresAt
+		s.jobs[id] = job
+	}
+	return nil
+}
+
+func (s *InMemoryJobStorage) Heartbeat(ctx context.Context, id string, lease models.Lease) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != models.JobStatusRunning || job.LeaseOwner != lease.Owner {
+		return false, nil
+	}
+	job.LeaseExpiresAt = lease.ExpiresAt
+	s.jobs[id] = job
+	return true, nil
+}
+
+func (s *InMemoryJobStorage) Finish(ctx context.Context, job models.Job, owner string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.jobs[job.ID]
+	if !ok || current.Status != models.JobStatusRunning || current.LeaseOwner != owner {
+		return false, nil
+	}
+	s.jobs[job.ID] = job
+	return true, nil
+}
+
+func (s *InMemoryJobStorage) RecoverExpired(ctx context.Context, now int64, maxRecoveries int) ([]models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var affected []models.Job
+	for id, job := range s.jobs {
+		if job.Status != models.JobStatusRunning || job.LeaseExpiresAt >= now {
+			continue
+		}
+		if job.Recoveries >= maxRecoveries {
+			job.Status = models.JobStatusFailed
+			job.Error = models.JobAbandonedError
+		} else {
+			job.Status = models.JobStatusPending
+			job.Recoveries++
+			job.NextRetryAt = 0
+		}
+		job.LeaseOwner = ""
+		job.LeaseExpiresAt = 0
+		s.jobs[id] = job
+		affected = append(affected, job)
+	}
+	return affected, nil
+}
+
 func (s *InMemoryJobStorage) DeleteJobs(ids ...string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for _, id := range ids {
 		delete(s.jobs, id)
+		delete(s.deliveries, id)
+	}
+	return nil
+}
+
+func (s *InMemoryJobStorage) SaveDelivery(delivery models.CallbackDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextDeliveryID++
+	delivery.ID = s.nextDeliveryID
+	s.deliveries[delivery.JobID] = append(s.deliveries[delivery.JobID], delivery)
+	return nil
+}
+
+func (s *InMemoryJobStorage) GetDeliveries(jobID string) ([]models.CallbackDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deliveries := make([]models.CallbackDelivery, len(s.deliveries[jobID]))
+	copy(deliveries, s.deliveries[jobID])
+	return deliveries, nil
+}
+
+func (s *InMemoryJobStorage) ReserveIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord, now int64) (models.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{userID: rec.UserID, key: rec.Key}
+	if existing, ok := s.idempotencyKeys[k]; ok && existing.ExpiresAt > now {
+		return existing, false, nil
+	}
+	s.idempotencyKeys[k] = rec
+	return rec, true, nil
+}
+
+func (s *InMemoryJobStorage) UpdateIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{userID: rec.UserID, key: rec.Key}
+	if _, ok := s.idempotencyKeys[k]; !ok {
+		return fmt.Errorf("idempotency key not found")
+	}
+	s.idempotencyKeys[k] = rec
+	return nil
+}
+
+func (s *InMemoryJobStorage) DeleteIdempotencyKey(ctx context.Context, userID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotencyKeys, idempotencyKey{userID: userID, key: key})
+	return nil
+}
+
+func (s *InMemoryJobStorage) DeleteExpiredIdempotencyKeys(ctx context.Context, now int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, rec := range s.idempotencyKeys {
+		if rec.ExpiresAt <= now {
+			delete(s.idempotencyKeys, k)
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryJobStorage) GetQuotaLimits(ctx context.Context, subject models.QuotaSubject) (models.QuotaLimits, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	limits, ok := s.quotaLimits[subject]
+	return limits, ok, nil
+}
+
+func (s *InMemoryJobStorage) ListQuotaLimits(ctx context.Context) ([]models.QuotaLimits, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]models.QuotaLimits, 0, len(s.quotaLimits))
+	for _, limits := range s.quotaLimits {
+		list = append(list, limits)
 	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Scope != list[j].Scope {
+			return list[i].Scope < list[j].Scope
+		}
+		return list[i].SubjectID < list[j].SubjectID
+	})
+	return list, nil
+}
+
+func (s *InMemoryJobStorage) SaveQuotaLimits(ctx context.Context, limits models.QuotaLimits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quotaLimits[limits.Subject()] = limits
+	return nil
+}
+
+func (s *InMemoryJobStorage) DeleteQuotaLimits(ctx context.Context, subject models.QuotaSubject) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.quotaLimits, subject)
 	return nil
 }
 
+func (s *InMemoryJobStorage) CountQuotaRequest(ctx context.Context, subject models.QuotaSubject, window int64, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := quotaWindow{subject: subject, start: window}
+	if limit > 0 && s.quotaRequests[k] >= limit {
+		return false, nil
+	}
+	s.quotaRequests[k]++
+	return true, nil
+}
+
+func (s *InMemoryJobStorage) AcquireQuotaSlot(ctx context.Context, subject models.QuotaSubject, jobID string, limit int, now, expiresAt int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := quotaSlot{jobID: jobID, subject: subject}
+	if limit > 0 && s.liveQuotaSlots(subject, now) >= limit {
+		return false, nil
+	}
+	s.quotaSlots[k] = expiresAt
+	return true, nil
+}
+
+// liveQuotaSlots counts the slots of a subject that are live at now, the caller holds s.mu
+func (s *InMemoryJobStorage) liveQuotaSlots(subject models.QuotaSubject, now int64) int {
+	live := 0
+	for k, expiresAt := range s.quotaSlots {
+		if k.subject == subject && s.quotaSlotLive(k.jobID, expiresAt, now) {
+			live++
+		}
+	}
+	return live
+}
+
+// quotaSlotLive reports whether a slot still holds, the caller holds s.mu
+func (s *InMemoryJobStorage) quotaSlotLive(jobID string, expiresAt, now int64) bool {
+	if expiresAt > now {
+		return true
+	}
+	job, ok := s.jobs[jobID]
+	return ok && (job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning)
+}
+
+func (s *InMemoryJobStorage) ReleaseQuotaSlots(ctx context.Context, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.quotaSlots {
+		if k.jobID == jobID {
+			delete(s.quotaSlots, k)
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryJobStorage) AddQuotaUsage(ctx context.Context, subject models.QuotaSubject, day int64, tokens int64, cost float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := quotaWindow{subject: subject, start: day}
+	usage := s.quotaUsage[k]
+	usage.tokens += tokens
+	usage.cost += cost
+	s.quotaUsage[k] = usage
+	return nil
+}
+
+func (s *InMemoryJobStorage) GetQuotaUsage(ctx context.Context, subject models.QuotaSubject, window, day, now int64) (models.QuotaUsage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	usage := s.quotaUsage[quotaWindow{subject: subject, start: day}]
+	return models.QuotaUsage{
+		RequestsThisMinute: s.quotaRequests[quotaWindow{subject: subject, start: window}],
+		ConcurrentJobs:     s.liveQuotaSlots(subject, now),
+		TokensToday:        usage.tokens,
+		CostToday:          usage.cost,
+	}, nil
+}
+
+func (s *InMemoryJobStorage) DeleteExpiredQuota(ctx context.Context, window, day, now int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.quotaRequests {
+		if k.start < window {
+			delete(s.quotaRequests, k)
+		}
+	}
+	for k := range s.quotaUsage {
+		if k.start < day {
+			delete(s.quotaUsage, k)
+		}
+	}
+	for k, expiresAt := range s.quotaSlots {
+		if !s.quotaSlotLive(k.jobID, expiresAt, now) {
+			delete(s.quotaSlots, k)
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryJobStorage) SaveBatch(ctx context.Context, batch models.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.batches[batch.ID]; ok {
+		return fmt.Errorf("batch %s already exists", batch.ID)
+	}
+	s.batches[batch.ID] = batch
+	return nil
+}
+
+func (s *InMemoryJobStorage) GetBatch(ctx context.Context, id string) (models.Batch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if batch, ok := s.batches[id]; ok {
+		return batch, nil
+	}
+	return models.Batch{}, models.ErrBatchNotFound
+}
+
 func (s *InMemoryJobStorage) Close() error {
 	// No resources to close for in-memory storage
 	return nil
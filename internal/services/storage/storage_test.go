@@ -1,11 +1,14 @@
 package storage
 
 import (
+	"context"
 	"strconv"
 	"sync"
 	"testing"
 
 	"github.com/aiservice/internal/models"
+	jobservice "github.com/aiservice/internal/services/jobService"
+	"github.com/aiservice/internal/services/storage/storagetest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -68,3 +71,52 @@ func TestInMemoryJobStorage_Concurrency(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestInMemoryJobStorage_Query(t *testing.T) {
+	s := NewInMemoryJobStorage()
+	for i := 0; i < 5; i++ {
+		status := models.JobStatusCompleted
+		if i%2 == 0 {
+			status = models.JobStatusPending
+		}
+		require.NoError(t, s.Save(models.Job{
+			ID:        "job" + strconv.Itoa(i),
+			CreatedAt: int64(100 + i),
+			Status:    status,
+			UserID:    "user1",
+			Request:   models.AnalyzeRequest{RequestType: models.SummarizeType},
+		}))
+	}
+	require.NoError(t, s.Save(models.Job{ID: "other", CreatedAt: 200, UserID: "user2", Status: models.JobStatusPending}))
+
+	page, err := s.Query(context.Background(), models.JobFilter{UserID: "user1", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 2)
+	require.Equal(t, "job4", page.Jobs[0].ID)
+	require.Equal(t, "job3", page.Jobs[1].ID)
+	require.NotEmpty(t, page.NextCursor)
+
+	page, err = s.Query(context.Background(), models.JobFilter{UserID: "user1", Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Equal(t, []string{"job2", "job1"}, []string{page.Jobs[0].ID, page.Jobs[1].ID})
+
+	page, err = s.Query(context.Background(), models.JobFilter{UserID: "user1", Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 1)
+	require.Empty(t, page.NextCursor)
+
+	page, err = s.Query(context.Background(), models.JobFilter{Statuses: []models.JobStatus{models.JobStatusPending}, Order: models.SortAsc, CreatedFrom: 101, CreatedTo: 200})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 2)
+	require.Equal(t, "job2", page.Jobs[0].ID)
+	require.Equal(t, "job4", page.Jobs[1].ID)
+
+	_, err = s.Query(context.Background(), models.JobFilter{Cursor: "not a cursor"})
+	require.ErrorIs(t, err, models.ErrInvalidCursor)
+}
+
+func TestInMemoryJobStorage_Contract(t *testing.T) {
+	storagetest.RunJobStorageContract(t, func(t *testing.T) jobservice.JobStorage {
+		return NewInMemoryJobStorage()
+	})
+}
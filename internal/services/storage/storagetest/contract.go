@@ -0,0 +1,684 @@
+// Package storagetest holds the behaviour every jobservice.JobStorage backend must share
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aiservice/internal/models"
+	jobservice "github.com/aiservice/internal/services/jobService"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty storage, it is called once per sub-test
+type Factory func(t *testing.T) jobservice.JobStorage
+
+// RunJobStorageContract runs the shared storage contract against a backend
+func RunJobStorageContract(t *testing.T, newStorage Factory) {
+	t.Run("SaveGetUpdate", func(t *testing.T) { testSaveGetUpdate(t, newStorage(t)) })
+	t.Run("GetNotFound", func(t *testing.T) { testGetNotFound(t, newStorage(t)) })
+	t.Run("Abort", func(t *testing.T) { testAbort(t, newStorage(t)) })
+	t.Run("Query", func(t *testing.T) { testQuery(t, newStorage(t)) })
+	t.Run("Claim", func(t *testing.T) { testClaim(t, newStorage(t)) })
+	t.Run("ConcurrentClaim", func(t *testing.T) { testConcurrentClaim(t, newStorage(t)) })
+	t.Run("ClaimPending", func(t *testing.T) { testClaimPending(t, newStorage(t)) })
+	t.Run("ConcurrentClaimPending", func(t *testing.T) { testConcurrentClaimPending(t, newStorage(t)) })
+	t.Run("HoldPending", func(t *testing.T) { testHoldPending(t, newStorage(t)) })
+	t.Run("Heartbeat", func(t *testing.T) { testHeartbeat(t, newStorage(t)) })
+	t.Run("Finish", func(t *testing.T) { testFinish(t, newStorage(t)) })
+	t.Run("RecoverExpired", func(t *testing.T) { testRecoverExpired(t, newStorage(t)) })
+	t.Run("CallbackDeliveries", func(t *testing.T) { testCallbackDeliveries(t, newStorage(t)) })
+	t.Run("IdempotencyKeys", func(t *testing.T) { testIdempotencyKeys(t, newStorage(t)) })
+	t.Run("Batches", func(t *testing.T) { testBatches(t, newStorage(t)) })
+	t.Run("QuotaLimits", func(t *testing.T) { testQuotaLimits(t, newStorage(t)) })
+	t.Run("QuotaCounters", func(t *testing.T) { testQuotaCounters(t, newStorage(t)) })
+	t.Run("ConcurrentQuotaSlots", func(t *testing.T) { testConcurrentQuotaSlots(t, newStorage(t)) })
+}
+
+// testLease is the lease used by claims in the contract
+var testLease = models.Lease{Owner: "worker-1", ExpiresAt: 5000}
+
+func newJob(id string, createdAt int64, status models.JobStatus) models.Job {
+	return models.Job{
+		ID:        id,
+		CreatedAt: createdAt,
+		Status:    status,
+		UserID:    "user",
+		BoardID:   "board",
+		Request: models.AnalyzeRequest{
+			RequestType:      models.SummarizeType,
+			SummarizeRequest: models.SummarizeRequest{UserID: "user"},
+		},
+	}
+}
+
+func testSaveGetUpdate(t *testing.T, s jobservice.JobStorage) {
+	job := newJob("job-1", 100, models.JobStatusPending)
+	job.CallbackURL = "https://example.com/hook"
+	job.TraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	require.NoError(t, s.Save(job))
+
+	got, err := s.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, job.ID, got.ID)
+	require.Equal(t, job.Status, got.Status)
+	require.Equal(t, job.UserID, got.UserID)
+	require.Equal(t, job.CallbackURL, got.CallbackURL)
+	require.Equal(t, job.TraceParent, got.TraceParent)
+	require.Equal(t, job.Request.RequestType, got.Request.RequestType)
+
+	job.Status = models.JobStatusCompleted
+	job.Retries = 2
+	job.Provider = "yandex-gpt"
+	job.Result = &models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "summary"}}}
+	require.NoError(t, s.Update(job))
+
+	got, err = s.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusCompleted, got.Status)
+	require.Equal(t, 2, got.Retries)
+	require.Equal(t, "yandex-gpt", got.Provider)
+	require.NotNil(t, got.Result)
+	require.Equal(t, "summary", got.Result.SummarizeResponse.Element.Content)
+
+	// Saving an existing job overwrites it
+	job.Status = models.JobStatusFailed
+	job.Result = nil
+	job.Error = "boom"
+	require.NoError(t, s.Save(job))
+
+	got, err = s.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusFailed, got.Status)
+	require.Nil(t, got.Result)
+	require.Equal(t, "boom", got.Error)
+
+	require.NoError(t, s.DeleteJobs(job.ID))
+	_, err = s.Get(job.ID)
+	require.Error(t, err)
+}
+
+func testGetNotFound(t *testing.T, s jobservice.JobStorage) {
+	_, err := s.Get("no-such-job")
+	require.Error(t, err)
+}
+
+func testAbort(t *testing.T, s jobservice.JobStorage) {
+	require.NoError(t, s.Save(newJob("job-abort", 100, models.JobStatusPending)))
+	require.NoError(t, s.Abort(context.Background(), "job-abort"))
+
+	got, err := s.Get("job-abort")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusAborted, got.Status)
+
+	_, ok, err := s.Claim(context.Background(), "job-abort", testLease)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// A running job is aborted and loses its lease
+	require.NoError(t, s.Save(newJob("job-abort-running", 100, models.JobStatusPending)))
+	_, ok, err = s.Claim(context.Background(), "job-abort-running", testLease)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, s.Abort(context.Background(), "job-abort-running"))
+	got, err = s.Get("job-abort-running")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusAborted, got.Status)
+	require.Empty(t, got.LeaseOwner)
+
+	// A job that finished keeps its outcome
+	require.NoError(t, s.Save(newJob("job-abort-done", 100, models.JobStatusCompleted)))
+	require.ErrorIs(t, s.Abort(context.Background(), "job-abort-done"), models.ErrJobNotAbortable)
+	got, err = s.Get("job-abort-done")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusCompleted, got.Status)
+
+	require.ErrorIs(t, s.Abort(context.Background(), "no-such-job"), models.ErrJobNotFound)
+}
+
+func testQuery(t *testing.T, s jobservice.JobStorage) {
+	for i := 0; i < 5; i++ {
+		status := models.JobStatusCompleted
+		if i%2 == 0 {
+			status = models.JobStatusPending
+		}
+		require.NoError(t, s.Save(newJob(fmt.Sprintf("job-%d", i), int64(100+i/2), status)))
+	}
+	other := newJob("job-other", 100, models.JobStatusPending)
+	other.UserID = "someone-else"
+	other.Principal = "service-a"
+	require.NoError(t, s.Save(other))
+
+	var ids []string
+	filter := models.JobFilter{UserID: "user", Limit: 2}
+	for {
+		page, err := s.Query(context.Background(), filter)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Jobs), 2)
+		for _, job := range page.Jobs {
+			ids = append(ids, job.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	require.Equal(t, []string{"job-4", "job-3", "job-2", "job-1", "job-0"}, ids)
+
+	page, err := s.Query(context.Background(), models.JobFilter{
+		Statuses:    []models.JobStatus{models.JobStatusPending},
+		UserID:      "user",
+		CreatedFrom: 101,
+		Order:       models.SortAsc,
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 2)
+	require.Equal(t, "job-2", page.Jobs[0].ID)
+	require.Equal(t, "job-4", page.Jobs[1].ID)
+	require.Empty(t, page.NextCursor)
+
+	page, err = s.Query(context.Background(), models.JobFilter{Principal: "service-a"})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 1)
+	require.Equal(t, "job-other", page.Jobs[0].ID)
+	require.Equal(t, "service-a", page.Jobs[0].Principal)
+
+	_, err = s.Query(context.Background(), models.JobFilter{Cursor: "not-a-cursor"})
+	require.ErrorIs(t, err, models.ErrInvalidCursor)
+}
+
+func testClaim(t *testing.T, s jobservice.JobStorage) {
+	require.NoError(t, s.Save(newJob("job-claim", 100, models.JobStatusPending)))
+
+	job, ok, err := s.Claim(context.Background(), "job-claim", testLease)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, models.JobStatusRunning, job.Status)
+	require.Equal(t, "user", job.UserID)
+	require.Equal(t, testLease.Owner, job.LeaseOwner)
+	require.Equal(t, testLease.ExpiresAt, job.LeaseExpiresAt)
+
+	got, err := s.Get("job-claim")
+	require.NoError(t, err)
+	require.Equal(t, testLease.Owner, got.LeaseOwner)
+
+	_, ok, err = s.Claim(context.Background(), "job-claim", testLease)
+	require.NoError(t, err)
+	require.False(t, ok, "a running job must not be claimed twice")
+
+	_, ok, err = s.Claim(context.Background(), "no-such-job", testLease)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func testConcurrentClaim(t *testing.T, s jobservice.JobStorage) {
+	require.NoError(t, s.Save(newJob("job-race", 100, models.JobStatusPending)))
+
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := s.Claim(context.Background(), "job-race", testLease)
+			require.NoError(t, err)
+			if ok {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), wins.Load())
+}
+
+func testClaimPending(t *testing.T, s jobservice.JobStorage) {
+	require.NoError(t, s.Save(newJob("job-old", 100, models.JobStatusPending)))
+	require.NoError(t, s.Save(newJob("job-new", 200, models.JobStatusPending)))
+	require.NoError(t, s.Save(newJob("job-done", 50, models.JobStatusCompleted)))
+	delayed := newJob("job-delayed", 10, models.JobStatusPending)
+	delayed.NextRetryAt = 1000
+	require.NoError(t, s.Save(delayed))
+
+	jobs, err := s.ClaimPending(context.Background(), 1, 500, testLease)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "job-old", jobs[0].ID)
+	require.Equal(t, models.JobStatusRunning, jobs[0].Status)
+
+	jobs, err = s.ClaimPending(context.Background(), 10, 500, testLease)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "job-new", jobs[0].ID)
+
+	jobs, err = s.ClaimPending(context.Background(), 10, 1000, testLease)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "job-delayed", jobs[0].ID)
+
+	jobs, err = s.ClaimPending(context.Background(), 0, 1000, testLease)
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+
+	got, err := s.Get("job-done")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusCompleted, got.Status)
+}
+
+func testConcurrentClaimPending(t *testing.T, s jobservice.JobStorage) {
+	const total = 20
+	for i := 0; i < total; i++ {
+		require.NoError(t, s.Save(newJob(fmt.Sprintf("job-%02d", i), int64(i), models.JobStatusPending)))
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				jobs, err := s.ClaimPending(context.Background(), 3, 1000, testLease)
+				require.NoError(t, err)
+				if len(jobs) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, job := range jobs {
+					seen[job.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, seen, total)
+	for id, count := range seen {
+		require.Equal(t, 1, count, "job %s claimed more than once", id)
+	}
+}
+
+func testHoldPending(t *testing.T, s jobservice.JobStorage) {
+	held := newJob("job-held", 100, models.JobStatusPending)
+	held.LeaseOwner, held.LeaseExpiresAt = testLease.Owner, 600
+	require.NoError(t, s.Save(held))
+	other := newJob("job-other", 200, models.JobStatusPending)
+	other.LeaseOwner, other.LeaseExpiresAt = "worker-2", 600
+	require.NoError(t, s.Save(other))
+	require.NoError(t, s.Save(newJob("job-free", 300, models.JobStatusPending)))
+
+	// Held jobs wait for their owner, only the free one is claimed
+	jobs, err := s.ClaimPending(context.Background(), 10, 500, testLease)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "job-free", jobs[0].ID)
+
+	// Only the owner's pending jobs are held longer
+	ids := []string{"job-held", "job-other", "job-free", "job-missing"}
+	require.NoError(t, s.HoldPending(context.Background(), ids, models.Lease{Owner: testLease.Owner, ExpiresAt: 900}))
+
+	got, err := s.Get("job-held")
+	require.NoError(t, err)
+	require.Equal(t, int64(900), got.LeaseExpiresAt)
+	got, err = s.Get("job-free")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusRunning, got.Status)
+	require.Equal(t, testLease.ExpiresAt, got.LeaseExpiresAt)
+
+	jobs, err = s.ClaimPending(context.Background(), 10, 700, testLease)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "job-other", jobs[0].ID, "a lapsed hold is claimable")
+
+	// A zero expiry releases the hold
+	require.NoError(t, s.HoldPending(context.Background(), []string{"job-held"}, models.Lease{Owner: testLease.Owner}))
+	jobs, err = s.ClaimPending(context.Background(), 10, 700, testLease)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "job-held", jobs[0].ID)
+
+	require.NoError(t, s.HoldPending(context.Background(), nil, testLease))
+}
+
+func testHeartbeat(t *testing.T, s jobservice.JobStorage) {
+	require.NoError(t, s.Save(newJob("job-beat", 100, models.JobStatusPending)))
+	_, ok, err := s.Claim(context.Background(), "job-beat", testLease)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	renewed := models.Lease{Owner: testLease.Owner, ExpiresAt: testLease.ExpiresAt + 60}
+	ok, err = s.Heartbeat(context.Background(), "job-beat", renewed)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	got, err := s.Get("job-beat")
+	require.NoError(t, err)
+	require.Equal(t, renewed.ExpiresAt, got.LeaseExpiresAt)
+
+	ok, err = s.Heartbeat(context.Background(), "job-beat", models.Lease{Owner: "intruder", ExpiresAt: 9999})
+	require.NoError(t, err)
+	require.False(t, ok, "only the lease owner may renew it")
+
+	require.NoError(t, s.Abort(context.Background(), "job-beat"))
+	ok, err = s.Heartbeat(context.Background(), "job-beat", renewed)
+	require.NoError(t, err)
+	require.False(t, ok, "an aborted job has no lease to renew")
+}
+
+func testFinish(t *testing.T, s jobservice.JobStorage) {
+	require.NoError(t, s.Save(newJob("job-finish", 100, models.JobStatusPending)))
+	claimed, ok, err := s.Claim(context.Background(), "job-finish", testLease)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	completed := claimed
+	completed.Status = models.JobStatusCompleted
+	completed.Provider = "openai"
+	completed.LeaseOwner, completed.LeaseExpiresAt = "", 0
+
+	ok, err = s.Finish(context.Background(), completed, "intruder")
+	require.NoError(t, err)
+	require.False(t, ok, "only the lease owner may finish the job")
+
+	ok, err = s.Finish(context.Background(), completed, testLease.Owner)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	got, err := s.Get("job-finish")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusCompleted, got.Status)
+	require.Equal(t, "openai", got.Provider)
+	require.Empty(t, got.LeaseOwner)
+
+	ok, err = s.Finish(context.Background(), completed, testLease.Owner)
+	require.NoError(t, err)
+	require.False(t, ok, "a finished job is not finished again")
+
+	// An abort landing while the job runs is kept
+	require.NoError(t, s.Save(newJob("job-aborted", 100, models.JobStatusPending)))
+	claimed, ok, err = s.Claim(context.Background(), "job-aborted", testLease)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, s.Abort(context.Background(), "job-aborted"))
+
+	claimed.Status = models.JobStatusCompleted
+	ok, err = s.Finish(context.Background(), claimed, testLease.Owner)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	got, err = s.Get("job-aborted")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusAborted, got.Status)
+}
+
+func testRecoverExpired(t *testing.T, s jobservice.JobStorage) {
+	expired := newJob("job-expired", 100, models.JobStatusRunning)
+	expired.LeaseOwner, expired.LeaseExpiresAt = "dead-worker", 400
+	require.NoError(t, s.Save(expired))
+
+	poison := newJob("job-poison", 100, models.JobStatusRunning)
+	poison.LeaseOwner, poison.LeaseExpiresAt, poison.Recoveries = "dead-worker", 400, 2
+	require.NoError(t, s.Save(poison))
+
+	alive := newJob("job-alive", 100, models.JobStatusRunning)
+	alive.LeaseOwner, alive.LeaseExpiresAt = "live-worker", 600
+	require.NoError(t, s.Save(alive))
+
+	require.NoError(t, s.Save(newJob("job-pending", 100, models.JobStatusPending)))
+
+	jobs, err := s.RecoverExpired(context.Background(), 500, 2)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+
+	got, err := s.Get("job-expired")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusPending, got.Status)
+	require.Equal(t, 1, got.Recoveries)
+	require.Empty(t, got.LeaseOwner)
+	require.Zero(t, got.LeaseExpiresAt)
+
+	got, err = s.Get("job-poison")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusFailed, got.Status)
+	require.Equal(t, models.JobAbandonedError, got.Error)
+
+	got, err = s.Get("job-alive")
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusRunning, got.Status)
+	require.Equal(t, "live-worker", got.LeaseOwner)
+
+	// The recovered job can be claimed again, the others cannot
+	claimed, err := s.ClaimPending(context.Background(), 10, 500, testLease)
+	require.NoError(t, err)
+	ids := []string{}
+	for _, job := range claimed {
+		ids = append(ids, job.ID)
+	}
+	require.ElementsMatch(t, []string{"job-expired", "job-pending"}, ids)
+
+	jobs, err = s.RecoverExpired(context.Background(), 500, 2)
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+}
+
+func testCallbackDeliveries(t *testing.T, s jobservice.JobStorage) {
+	job := newJob("job-hooks", 100, models.JobStatusCompleted)
+	require.NoError(t, s.Save(job))
+
+	require.NoError(t, s.SaveDelivery(models.CallbackDelivery{JobID: job.ID, URL: "https://example.com", Attempt: 1, StatusCode: 500, Error: "receiver responded with 500", CreatedAt: 1}))
+	require.NoError(t, s.SaveDelivery(models.CallbackDelivery{JobID: job.ID, URL: "https://example.com", Attempt: 2, StatusCode: 200, Success: true, CreatedAt: 2}))
+
+	deliveries, err := s.GetDeliveries(job.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, 1, deliveries[0].Attempt)
+	require.False(t, deliveries[0].Success)
+	require.Equal(t, "receiver responded with 500", deliveries[0].Error)
+	require.True(t, deliveries[1].Success)
+	require.Less(t, deliveries[0].ID, deliveries[1].ID)
+
+	require.NoError(t, s.DeleteJobs(job.ID))
+	deliveries, err = s.GetDeliveries(job.ID)
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+}
+
+func testIdempotencyKeys(t *testing.T, s jobservice.JobStorage) {
+	ctx := context.Background()
+	rec := models.IdempotencyRecord{UserID: "user", Key: "key-1", RequestHash: "hash-1", JobID: "job-1", CreatedAt: 100, ExpiresAt: 200}
+
+	got, ok, err := s.ReserveIdempotencyKey(ctx, rec, 100)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, rec, got)
+
+	// The same key of another user is independent
+	other := rec
+	other.UserID = "other-user"
+	other.JobID = "job-2"
+	_, ok, err = s.ReserveIdempotencyKey(ctx, other, 100)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// A live reservation is returned instead of being replaced
+	retry := rec
+	retry.JobID = "job-3"
+	got, ok, err = s.ReserveIdempotencyKey(ctx, retry, 150)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "job-1", got.JobID)
+	require.Nil(t, got.Response)
+
+	rec.Response = &models.AnalyzeResponse{SummarizeResponse: models.SummarizeResponse{Element: models.Text{Content: "ok"}}}
+	rec.ExpiresAt = 1000
+	require.NoError(t, s.UpdateIdempotencyKey(ctx, rec))
+	got, ok, err = s.ReserveIdempotencyKey(ctx, retry, 500)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NotNil(t, got.Response)
+	require.Equal(t, "ok", got.Response.SummarizeResponse.Element.Content)
+	require.Equal(t, int64(1000), got.ExpiresAt)
+
+	// An expired record is taken over
+	got, ok, err = s.ReserveIdempotencyKey(ctx, retry, 1000)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "job-3", got.JobID)
+
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, "user", "key-1"))
+	require.Error(t, s.UpdateIdempotencyKey(ctx, rec))
+	_, ok, err = s.ReserveIdempotencyKey(ctx, rec, 100)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Only expired records are cleaned up
+	require.NoError(t, s.DeleteExpiredIdempotencyKeys(ctx, 200))
+	_, ok, err = s.ReserveIdempotencyKey(ctx, other, 150)
+	require.NoError(t, err)
+	require.True(t, ok, "the expired record of other-user was deleted")
+	_, ok, err = s.ReserveIdempotencyKey(ctx, retry, 150)
+	require.NoError(t, err)
+	require.False(t, ok, "the live record of user was kept")
+}
+
+func testBatches(t *testing.T, s jobservice.JobStorage) {
+	ctx := context.Background()
+	_, err := s.GetBatch(ctx, "batch-1")
+	require.ErrorIs(t, err, models.ErrBatchNotFound)
+
+	batch := models.Batch{ID: "batch-1", CreatedAt: 100, Size: 2, Principal: "service-a"}
+	require.NoError(t, s.SaveBatch(ctx, batch))
+	got, err := s.GetBatch(ctx, batch.ID)
+	require.NoError(t, err)
+	require.Equal(t, batch, got)
+
+	for i, id := range []string{"job-b", "job-a"} {
+		job := newJob(id, int64(100+i), models.JobStatusPending)
+		job.BatchID = batch.ID
+		require.NoError(t, s.Save(job))
+	}
+	require.NoError(t, s.Save(newJob("job-single", 100, models.JobStatusPending)))
+
+	page, err := s.Query(ctx, models.JobFilter{BatchID: batch.ID, Order: models.SortAsc})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 2)
+	require.Equal(t, "job-b", page.Jobs[0].ID)
+	require.Equal(t, "job-a", page.Jobs[1].ID)
+	require.Equal(t, batch.ID, page.Jobs[0].BatchID)
+}
+
+func testQuotaLimits(t *testing.T, s jobservice.JobStorage) {
+	ctx := context.Background()
+	alice := models.QuotaSubject{Scope: models.QuotaScopeUser, ID: "alice"}
+	acme := models.QuotaSubject{Scope: models.QuotaScopeTenant, ID: "acme"}
+
+	_, ok, err := s.GetQuotaLimits(ctx, alice)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	limits := models.QuotaLimits{Scope: alice.Scope, SubjectID: alice.ID, RequestsPerMinute: 10, ConcurrentJobs: 2, DailyTokens: 1000, DailyCost: 1.5, UpdatedAt: 100}
+	require.NoError(t, s.SaveQuotaLimits(ctx, limits))
+	require.NoError(t, s.SaveQuotaLimits(ctx, models.QuotaLimits{Scope: acme.Scope, SubjectID: acme.ID, RequestsPerMinute: 100}))
+
+	got, ok, err := s.GetQuotaLimits(ctx, alice)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, limits, got)
+
+	// Saving again replaces the limits
+	limits.ConcurrentJobs = 5
+	require.NoError(t, s.SaveQuotaLimits(ctx, limits))
+	got, _, err = s.GetQuotaLimits(ctx, alice)
+	require.NoError(t, err)
+	require.Equal(t, 5, got.ConcurrentJobs)
+
+	list, err := s.ListQuotaLimits(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, acme.ID, list[0].SubjectID, "tenants sort before users")
+	require.Equal(t, alice.ID, list[1].SubjectID)
+
+	require.NoError(t, s.DeleteQuotaLimits(ctx, alice))
+	_, ok, err = s.GetQuotaLimits(ctx, alice)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func testQuotaCounters(t *testing.T, s jobservice.JobStorage) {
+	ctx := context.Background()
+	alice := models.QuotaSubject{Scope: models.QuotaScopeUser, ID: "alice"}
+
+	// Requests are counted up to the limit of their window
+	for range 2 {
+		ok, err := s.CountQuotaRequest(ctx, alice, 60, 2)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	ok, err := s.CountQuotaRequest(ctx, alice, 60, 2)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = s.CountQuotaRequest(ctx, alice, 120, 2)
+	require.NoError(t, err)
+	require.True(t, ok, "a new window starts from zero")
+
+	// Slots are limited while live, a slot of a running job outlives its expiry
+	require.NoError(t, s.Save(newJob("job-1", 100, models.JobStatusRunning)))
+	ok, err = s.AcquireQuotaSlot(ctx, alice, "job-1", 2, 100, 110)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = s.AcquireQuotaSlot(ctx, alice, "job-2", 2, 100, 110)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = s.AcquireQuotaSlot(ctx, alice, "job-3", 2, 100, 110)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = s.AcquireQuotaSlot(ctx, alice, "job-3", 2, 200, 210)
+	require.NoError(t, err)
+	require.True(t, ok, "the slot of job-2 expired")
+
+	require.NoError(t, s.AddQuotaUsage(ctx, alice, 0, 100, 0.5))
+	require.NoError(t, s.AddQuotaUsage(ctx, alice, 0, 50, 0.25))
+	require.NoError(t, s.AddQuotaUsage(ctx, alice, 86400, 7, 1))
+
+	usage, err := s.GetQuotaUsage(ctx, alice, 120, 0, 200)
+	require.NoError(t, err)
+	require.Equal(t, models.QuotaUsage{RequestsThisMinute: 1, ConcurrentJobs: 2, TokensToday: 150, CostToday: 0.75}, usage)
+
+	require.NoError(t, s.ReleaseQuotaSlots(ctx, "job-3"))
+	require.NoError(t, s.DeleteExpiredQuota(ctx, 120, 86400, 200))
+	usage, err = s.GetQuotaUsage(ctx, alice, 60, 0, 200)
+	require.NoError(t, err)
+	require.Equal(t, models.QuotaUsage{ConcurrentJobs: 1}, usage, "old windows and days are deleted, the running job keeps its slot")
+
+	usage, err = s.GetQuotaUsage(ctx, alice, 120, 86400, 200)
+	require.NoError(t, err)
+	require.Equal(t, models.QuotaUsage{RequestsThisMinute: 1, ConcurrentJobs: 1, TokensToday: 7, CostToday: 1}, usage)
+}
+
+func testConcurrentQuotaSlots(t *testing.T, s jobservice.JobStorage) {
+	ctx := context.Background()
+	alice := models.QuotaSubject{Scope: models.QuotaScopeUser, ID: "alice"}
+
+	const limit = 3
+	var acquired atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := s.AcquireQuotaSlot(ctx, alice, fmt.Sprintf("job-%d", i), limit, 100, 200)
+			require.NoError(t, err)
+			if ok {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(limit), acquired.Load())
+}
@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aiservice/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceParent_RoundTrip(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.TracingConfig{})
+	require.NoError(t, err)
+	defer shutdown(context.Background())
+
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := WithTraceParent(context.Background(), traceParent)
+	require.Equal(t, traceParent, TraceParent(ctx))
+
+	require.Empty(t, TraceParent(context.Background()))
+	require.Empty(t, TraceParent(WithTraceParent(context.Background(), "not a traceparent")))
+}
+
+func TestSetup_RejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), config.TracingConfig{Exporter: "zipkin"})
+	require.Error(t, err)
+}
+
+func TestSetup_StdoutExporter(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.TracingConfig{
+		Exporter:    ExporterStdout,
+		File:        filepath.Join(t.TempDir(), "traces.json"),
+		ServiceName: "aiservice-test",
+		SampleRatio: 1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+}